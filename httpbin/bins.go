@@ -0,0 +1,144 @@
+package httpbin
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// Limits on the parameters accepted by the /bins endpoints
+const (
+	defaultBinTTL = time.Hour
+	maxBinTTL     = 24 * time.Hour
+)
+
+// maxBins bounds the number of bins that may exist at once, and
+// maxBinRequests bounds the number of requests captured by each bin, so that
+// clients cannot exhaust the server's memory. The total size of the request
+// bodies captured by each bin is separately bounded by MaxBodySize.
+const (
+	maxBins        = 100
+	maxBinRequests = 100
+)
+
+var (
+	errBinNotFound = errors.New("bin not found")
+	errTooManyBins = errors.New("too many bins in use")
+)
+
+// bin holds the requests captured on behalf of a single /bins/{id} URL, oldest
+// first.
+type bin struct {
+	requests []capturedRequest
+	size     int64
+	nextID   int
+	expires  time.Time
+}
+
+// binStore holds the bins created via the /bins endpoints. Bins expire after
+// a fixed TTL, and only the most recent requests captured by each bin are
+// kept.
+type binStore struct {
+	mu   sync.Mutex
+	bins map[string]*bin
+}
+
+func newBinStore() *binStore {
+	return &binStore{bins: make(map[string]*bin)}
+}
+
+// create creates a new, empty bin that expires after ttl.
+func (s *binStore) create(id string, ttl time.Duration, now time.Time) (time.Time, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.bins) >= maxBins {
+		s.sweep(now)
+		if len(s.bins) >= maxBins {
+			return time.Time{}, errTooManyBins
+		}
+	}
+	expires := now.Add(ttl)
+	s.bins[id] = &bin{nextID: 1, expires: expires}
+	return expires, nil
+}
+
+// record adds a captured request to the bin with the given id, assigning it
+// an id and discarding the bin's oldest requests as necessary to stay within
+// maxBinRequests and maxBytes.
+func (s *binStore) record(id string, req capturedRequest, maxBytes int64, now time.Time) (capturedRequest, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	b, found := s.bins[id]
+	if !found || !now.Before(b.expires) {
+		return req, errBinNotFound
+	}
+
+	req.ID = b.nextID
+	b.nextID++
+	b.requests = append(b.requests, req)
+	b.size += req.BodySize
+	for len(b.requests) > maxBinRequests || (b.size > maxBytes && len(b.requests) > 1) {
+		b.size -= b.requests[0].BodySize
+		b.requests = b.requests[1:]
+	}
+	return req, nil
+}
+
+// list returns the requests captured by the bin with the given id, oldest
+// first, if it exists.
+func (s *binStore) list(id string, now time.Time) ([]capturedRequest, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	b, found := s.bins[id]
+	if !found || !now.Before(b.expires) {
+		return nil, false
+	}
+	requests := make([]capturedRequest, len(b.requests))
+	copy(requests, b.requests)
+	return requests, true
+}
+
+// sweep removes expired bins. Callers must hold s.mu.
+func (s *binStore) sweep(now time.Time) {
+	for id, b := range s.bins {
+		if !now.Before(b.expires) {
+			delete(s.bins, id)
+		}
+	}
+}
+
+// captureRequest reads the full incoming request, including its body, into a
+// capturedRequest. Bodies that are not valid UTF-8 are captured as base64
+// encoded data URLs.
+func (h *HTTPBin) captureRequest(r *http.Request) (capturedRequest, error) {
+	start := time.Now()
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return capturedRequest{}, err
+	}
+
+	req := capturedRequest{
+		Method:   r.Method,
+		URL:      getURL(r).String(),
+		Args:     r.URL.Query(),
+		Headers:  getRequestHeaders(r, h.excludeHeadersProcessor),
+		Origin:   getClientIP(r),
+		BodySize: int64(len(body)),
+		Time:     start,
+		Duration: time.Since(start).String(),
+	}
+	if utf8.Valid(body) {
+		req.Body = string(body)
+	} else {
+		contentType, _, _ := strings.Cut(r.Header.Get("Content-Type"), ";")
+		req.Body = encodeData(body, contentType)
+	}
+	return req, nil
+}
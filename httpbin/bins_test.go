@@ -0,0 +1,66 @@
+package httpbin
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mccutchen/go-httpbin/v2/internal/testing/assert"
+)
+
+func TestBinStore(t *testing.T) {
+	t.Parallel()
+
+	t.Run("oldest requests are discarded", func(t *testing.T) {
+		t.Parallel()
+		s := newBinStore()
+		now := time.Now()
+		_, err := s.create("bin", time.Minute, now)
+		assert.NilError(t, err)
+
+		for range maxBinRequests + 5 {
+			_, err := s.record("bin", capturedRequest{BodySize: 1}, 1024, now)
+			assert.NilError(t, err)
+		}
+		requests, _ := s.list("bin", now)
+		assert.Equal(t, len(requests), maxBinRequests, "incorrect number of requests")
+		assert.Equal(t, requests[0].ID, 6, "expected oldest requests to be discarded")
+
+		// requests too large to fit are kept on their own
+		_, err = s.record("bin", capturedRequest{BodySize: 1000}, 1024, now)
+		assert.NilError(t, err)
+		_, err = s.record("bin", capturedRequest{BodySize: 2000}, 1024, now)
+		assert.NilError(t, err)
+		requests, _ = s.list("bin", now)
+		assert.Equal(t, len(requests), 1, "incorrect number of requests")
+		assert.Equal(t, requests[0].BodySize, int64(2000), "expected only most recent request")
+	})
+
+	t.Run("bins expire", func(t *testing.T) {
+		t.Parallel()
+		s := newBinStore()
+		now := time.Now()
+		_, err := s.create("bin", time.Minute, now)
+		assert.NilError(t, err)
+
+		_, err = s.record("bin", capturedRequest{}, 1024, now.Add(time.Minute))
+		assert.Equal(t, err, errBinNotFound, "expected expired bin")
+		_, found := s.list("bin", now.Add(time.Minute))
+		assert.Equal(t, found, false, "expected expired bin")
+	})
+
+	t.Run("number of bins is bounded", func(t *testing.T) {
+		t.Parallel()
+		s := newBinStore()
+		now := time.Now()
+		for i := range maxBins {
+			_, err := s.create(string(rune('a'+i)), time.Minute, now)
+			assert.NilError(t, err)
+		}
+		_, err := s.create("new", time.Minute, now)
+		assert.Equal(t, err, errTooManyBins, "expected capacity error")
+
+		// expired bins are swept to make room
+		_, err = s.create("new", time.Minute, now.Add(time.Minute))
+		assert.NilError(t, err)
+	})
+}
@@ -0,0 +1,373 @@
+package httpbin
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+var errCassetteClosed = errors.New("cassette is closed")
+
+// Interaction is a request proxied to an upstream server in record mode,
+// along with the upstream server's response.
+type Interaction struct {
+	Time     time.Time        `json:"time"`
+	Request  RecordedRequest  `json:"request"`
+	Response RecordedResponse `json:"response"`
+}
+
+// RecordedRequest is a request recorded in a cassette. Bodies are encoded as
+// base64 in cassette files.
+type RecordedRequest struct {
+	Method  string      `json:"method"`
+	Path    string      `json:"path"`
+	Query   string      `json:"query"`
+	Headers http.Header `json:"headers"`
+	Body    []byte      `json:"body"`
+
+	// Hex-encoded SHA-256 hash of the body, used to match requests on replay
+	BodySHA256 string `json:"body_sha256"`
+}
+
+// RecordedResponse is an upstream server's response recorded in a cassette,
+// whose body is truncated to MaxBodySize.
+type RecordedResponse struct {
+	Status        int         `json:"status"`
+	Headers       http.Header `json:"headers"`
+	Body          []byte      `json:"body"`
+	BodyTruncated bool        `json:"body_truncated,omitempty"`
+}
+
+// CassetteWriter records interactions to a cassette file, as JSON lines. It
+// is safe for concurrent use.
+type CassetteWriter struct {
+	mu sync.Mutex
+	f  *os.File
+}
+
+// NewCassetteWriter opens the cassette file at the given path for recording,
+// creating it if it does not exist. New interactions are appended to any
+// already recorded.
+func NewCassetteWriter(path string) (*CassetteWriter, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	return &CassetteWriter{f: f}, nil
+}
+
+// Write appends the given interaction to the cassette.
+func (cw *CassetteWriter) Write(in Interaction) error {
+	line, err := json.Marshal(in)
+	if err != nil {
+		return err
+	}
+	cw.mu.Lock()
+	defer cw.mu.Unlock()
+	if cw.f == nil {
+		return errCassetteClosed
+	}
+	_, err = cw.f.Write(append(line, '\n'))
+	return err
+}
+
+// Close closes the cassette file.
+func (cw *CassetteWriter) Close() error {
+	cw.mu.Lock()
+	defer cw.mu.Unlock()
+	if cw.f == nil {
+		return nil
+	}
+	err := cw.f.Close()
+	cw.f = nil
+	return err
+}
+
+// LoadCassette loads the interactions recorded in the cassette file at the
+// given path, in the order they were recorded.
+func LoadCassette(path string) ([]Interaction, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	// recorded bodies may be as large as MaxBodySize, so lines are not
+	// subject to bufio.Scanner's size limit
+	var interactions []Interaction
+	r := bufio.NewReader(f)
+	for lineNum := 1; ; lineNum++ {
+		line, err := r.ReadBytes('\n')
+		if len(bytes.TrimSpace(line)) > 0 {
+			var in Interaction
+			if err := json.Unmarshal(line, &in); err != nil {
+				return nil, fmt.Errorf("%s:%d: invalid interaction: %w", path, lineNum, err)
+			}
+			if status := in.Response.Status; status < 100 || status > 599 {
+				return nil, fmt.Errorf("%s:%d: invalid interaction: response status %d must be in range [100, 599]", path, lineNum, status)
+			}
+			interactions = append(interactions, in)
+		}
+		if errors.Is(err, io.EOF) {
+			return interactions, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// MatchRules configures which parts of a request must match a recorded
+// request in order for its response to be replayed.
+type MatchRules struct {
+	Method bool
+	Path   bool
+	Query  bool
+
+	// Bodies are compared via their SHA-256 hashes
+	Body bool
+
+	// Names of headers whose values must match
+	Headers []string
+}
+
+// DefaultMatchRules matches requests on their method, path and query.
+var DefaultMatchRules = MatchRules{Method: true, Path: true, Query: true}
+
+// String returns a comma-separated list of the attributes matched, in the
+// format accepted by the -replay-match flag.
+func (m MatchRules) String() string {
+	var attrs []string
+	if m.Method {
+		attrs = append(attrs, "method")
+	}
+	if m.Path {
+		attrs = append(attrs, "path")
+	}
+	if m.Query {
+		attrs = append(attrs, "query")
+	}
+	for _, name := range m.Headers {
+		attrs = append(attrs, "header:"+name)
+	}
+	if m.Body {
+		attrs = append(attrs, "body")
+	}
+	return strings.Join(attrs, ",")
+}
+
+// matches reports whether the given request and body match the recorded
+// request.
+func (m MatchRules) matches(r *http.Request, bodyHash string, rec RecordedRequest) bool {
+	if m.Method && r.Method != rec.Method {
+		return false
+	}
+	if m.Path && r.URL.Path != rec.Path {
+		return false
+	}
+	if m.Query {
+		recQuery, _ := url.ParseQuery(rec.Query)
+		if !maps.EqualFunc(r.URL.Query(), recQuery, slices.Equal) {
+			return false
+		}
+	}
+	for _, name := range m.Headers {
+		if !slices.Equal(r.Header.Values(name), rec.Headers.Values(name)) {
+			return false
+		}
+	}
+	if m.Body && bodyHash != rec.BodySHA256 {
+		return false
+	}
+	return true
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// recordUpstream reverse-proxies every request to the given upstream server,
+// recording each interaction to the given cassette. Responses are streamed to
+// the client as they are received, and their bodies are recorded up to
+// maxBodySize bytes.
+func recordUpstream(upstream *url.URL, cassette *CassetteWriter, maxBodySize int64) http.Handler {
+	proxy := &httputil.ReverseProxy{
+		Rewrite: func(pr *httputil.ProxyRequest) {
+			pr.SetURL(upstream)
+		},
+		FlushInterval: -1,
+		ErrorHandler: func(w http.ResponseWriter, _ *http.Request, err error) {
+			if rw, ok := w.(*recordingResponseWriter); ok {
+				rw.failed = true
+			}
+			writeError(w, http.StatusBadGateway, fmt.Errorf("upstream request failed: %w", err))
+		},
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body []byte
+		if r.Body != nil {
+			var err error
+			body, err = io.ReadAll(r.Body)
+			if err != nil {
+				writeError(w, http.StatusBadRequest, fmt.Errorf("error reading request body: %w", err))
+				return
+			}
+			r.Body = io.NopCloser(bytes.NewReader(body))
+		}
+
+		in := Interaction{
+			Time: time.Now(),
+			Request: RecordedRequest{
+				Method:     r.Method,
+				Path:       r.URL.Path,
+				Query:      r.URL.RawQuery,
+				Headers:    r.Header.Clone(),
+				Body:       body,
+				BodySHA256: sha256Hex(body),
+			},
+		}
+		rw := &recordingResponseWriter{w: w, limit: maxBodySize}
+		proxy.ServeHTTP(rw, r)
+		if rw.failed {
+			return
+		}
+		in.Response = RecordedResponse{
+			Status:        rw.status,
+			Headers:       rw.header,
+			Body:          rw.body,
+			BodyTruncated: rw.truncated,
+		}
+		// failing to record an interaction must not affect the response,
+		// which has already been written
+		_ = cassette.Write(in)
+	})
+}
+
+// recordingResponseWriter records the response written through it, keeping
+// up to limit bytes of its body.
+type recordingResponseWriter struct {
+	w         http.ResponseWriter
+	limit     int64
+	status    int
+	header    http.Header
+	body      []byte
+	truncated bool
+
+	// set if the upstream request failed, in which case the response is
+	// not recorded
+	failed bool
+}
+
+func (rw *recordingResponseWriter) Header() http.Header {
+	return rw.w.Header()
+}
+
+func (rw *recordingResponseWriter) WriteHeader(status int) {
+	if rw.status == 0 {
+		rw.status = status
+		rw.header = rw.w.Header().Clone()
+	}
+	rw.w.WriteHeader(status)
+}
+
+func (rw *recordingResponseWriter) Write(b []byte) (int, error) {
+	if rw.status == 0 {
+		rw.WriteHeader(http.StatusOK)
+	}
+	if room := rw.limit - int64(len(rw.body)); room < int64(len(b)) {
+		rw.body = append(rw.body, b[:max(room, 0)]...)
+		rw.truncated = true
+	} else {
+		rw.body = append(rw.body, b...)
+	}
+	return rw.w.Write(b)
+}
+
+func (rw *recordingResponseWriter) Flush() {
+	if f, ok := rw.w.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// replayer serves the responses recorded in a cassette, in place of an
+// upstream server.
+type replayer struct {
+	rules        MatchRules
+	mu           sync.Mutex
+	interactions []Interaction
+	replayed     []bool
+}
+
+func newReplayer(interactions []Interaction, rules MatchRules) *replayer {
+	return &replayer{
+		rules:        rules,
+		interactions: interactions,
+		replayed:     make([]bool, len(interactions)),
+	}
+}
+
+// next returns the interaction to replay in response to the given request.
+// Repeated requests are served the matching interactions in the order they
+// were recorded, after which the last is served again.
+func (rp *replayer) next(r *http.Request, body []byte) (Interaction, bool) {
+	bodyHash := sha256Hex(body)
+	rp.mu.Lock()
+	defer rp.mu.Unlock()
+	last := -1
+	for i, in := range rp.interactions {
+		if !rp.rules.matches(r, bodyHash, in.Request) {
+			continue
+		}
+		if !rp.replayed[i] {
+			rp.replayed[i] = true
+			return in, true
+		}
+		last = i
+	}
+	if last == -1 {
+		return Interaction{}, false
+	}
+	return rp.interactions[last], true
+}
+
+func (rp *replayer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var body []byte
+	if r.Body != nil {
+		var err error
+		body, err = io.ReadAll(r.Body)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("error reading request body: %w", err))
+			return
+		}
+	}
+
+	in, ok := rp.next(r, body)
+	if !ok {
+		writeError(w, http.StatusBadGateway, fmt.Errorf("no recorded interaction matches %s %s on %s", r.Method, r.URL.RequestURI(), rp.rules))
+		return
+	}
+	for k, v := range in.Response.Headers {
+		// the recorded body may have been truncated
+		if k == "Content-Length" {
+			continue
+		}
+		w.Header()[k] = v
+	}
+	w.WriteHeader(in.Response.Status)
+	w.Write(in.Response.Body)
+}
@@ -0,0 +1,241 @@
+package httpbin
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/mccutchen/go-httpbin/v2/internal/testing/assert"
+)
+
+func TestRecordReplay(t *testing.T) {
+	t.Parallel()
+
+	upstreamMux := http.NewServeMux()
+	upstreamMux.HandleFunc("/echo", func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		w.Header().Set("X-Upstream", "yes")
+		w.WriteHeader(http.StatusAccepted)
+		fmt.Fprintf(w, "%s %s?%s %s", r.Method, r.URL.Path, r.URL.RawQuery, body)
+	})
+	upstreamMux.HandleFunc("/stream", func(w http.ResponseWriter, _ *http.Request) {
+		for i := range 3 {
+			fmt.Fprintf(w, "chunk %d\n", i)
+			w.(http.Flusher).Flush()
+		}
+	})
+	upstreamMux.HandleFunc("/large", func(w http.ResponseWriter, _ *http.Request) {
+		w.Write([]byte(strings.Repeat("a", 2048)))
+	})
+	upstream := httptest.NewServer(upstreamMux)
+	t.Cleanup(upstream.Close)
+	upstreamURL, _ := url.Parse(upstream.URL)
+
+	path := filepath.Join(t.TempDir(), "cassette.jsonl")
+	cassette, err := NewCassetteWriter(path)
+	assert.NilError(t, err)
+	recorder := setupTestApp(t, WithRecordUpstream(upstreamURL, cassette))
+
+	doRequest := func(t *testing.T, app *appTestInfo, method, path, body string) *http.Response {
+		t.Helper()
+		req := newTestRequest(t, method, app.URL(path), strings.NewReader(body))
+		return mustDoRequest(t, app, req)
+	}
+
+	resp := doRequest(t, recorder, "POST", "/echo?a=1&b=2", "hello")
+	assert.StatusCode(t, resp, http.StatusAccepted)
+	assert.Header(t, resp, "X-Upstream", "yes")
+	assert.BodyEquals(t, resp, "POST /echo?a=1&b=2 hello")
+
+	resp = doRequest(t, recorder, "POST", "/echo", "goodbye")
+	assert.BodyEquals(t, resp, "POST /echo? goodbye")
+
+	resp = doRequest(t, recorder, "GET", "/stream", "")
+	assert.BodyEquals(t, resp, "chunk 0\nchunk 1\nchunk 2\n")
+
+	resp = doRequest(t, recorder, "GET", "/large", "")
+	assert.BodySize(t, resp, 2048)
+
+	// requests are proxied in place of the built-in endpoints
+	resp = doRequest(t, recorder, "GET", "/get", "")
+	assert.StatusCode(t, resp, http.StatusNotFound)
+	assert.NilError(t, cassette.Close())
+
+	interactions, err := LoadCassette(path)
+	assert.NilError(t, err)
+	assert.Equal(t, len(interactions), 5, "incorrect number of interactions")
+	assert.Equal(t, string(interactions[0].Request.Body), "hello", "incorrect request body")
+	assert.Equal(t, interactions[0].Request.Query, "a=1&b=2", "incorrect query")
+	assert.Equal(t, interactions[0].Response.Status, http.StatusAccepted, "incorrect status")
+	assert.Equal(t, string(interactions[2].Response.Body), "chunk 0\nchunk 1\nchunk 2\n", "incorrect streamed body")
+	assert.Equal(t, len(interactions[3].Response.Body), 1024, "expected body to be truncated to max body size")
+	assert.Equal(t, interactions[3].Response.BodyTruncated, true, "expected body to be marked as truncated")
+
+	t.Run("replay", func(t *testing.T) {
+		t.Parallel()
+		replayer := setupTestApp(t, WithReplay(interactions, DefaultMatchRules))
+
+		resp := doRequest(t, replayer, "POST", "/echo?b=2&a=1", "ignored")
+		assert.StatusCode(t, resp, http.StatusAccepted)
+		assert.Header(t, resp, "X-Upstream", "yes")
+		assert.BodyEquals(t, resp, "POST /echo?a=1&b=2 hello")
+
+		resp = doRequest(t, replayer, "GET", "/large", "")
+		assert.StatusCode(t, resp, http.StatusOK)
+		assert.BodySize(t, resp, 1024)
+
+		resp = doRequest(t, replayer, "GET", "/echo?a=1&b=2", "")
+		assert.StatusCode(t, resp, http.StatusBadGateway)
+		assert.BodyContains(t, resp, "no recorded interaction matches GET /echo?a=1&b=2 on method,path,query")
+	})
+
+	t.Run("replay matching body", func(t *testing.T) {
+		t.Parallel()
+		rules := MatchRules{Method: true, Path: true, Body: true}
+		replayer := setupTestApp(t, WithReplay(interactions, rules))
+
+		resp := doRequest(t, replayer, "POST", "/echo", "goodbye")
+		assert.BodyEquals(t, resp, "POST /echo? goodbye")
+
+		resp = doRequest(t, replayer, "POST", "/echo", "hello")
+		assert.BodyEquals(t, resp, "POST /echo?a=1&b=2 hello")
+
+		resp = doRequest(t, replayer, "POST", "/echo", "other")
+		assert.StatusCode(t, resp, http.StatusBadGateway)
+	})
+
+	t.Run("repeated requests replay matches in order", func(t *testing.T) {
+		t.Parallel()
+		rules := MatchRules{Method: true, Path: true}
+		replayer := setupTestApp(t, WithReplay(interactions, rules))
+
+		for _, want := range []string{"POST /echo?a=1&b=2 hello", "POST /echo? goodbye", "POST /echo? goodbye"} {
+			resp := doRequest(t, replayer, "POST", "/echo", "")
+			assert.BodyEquals(t, resp, want)
+		}
+	})
+}
+
+func TestRecordUpstreamError(t *testing.T) {
+	t.Parallel()
+
+	// an upstream server that is no longer listening
+	upstream := httptest.NewServer(http.NotFoundHandler())
+	upstreamURL, _ := url.Parse(upstream.URL)
+	upstream.Close()
+
+	path := filepath.Join(t.TempDir(), "cassette.jsonl")
+	cassette, err := NewCassetteWriter(path)
+	assert.NilError(t, err)
+	defer cassette.Close()
+	app := setupTestApp(t, WithRecordUpstream(upstreamURL, cassette))
+
+	req := newTestRequest(t, "GET", app.URL("/get"), nil)
+	resp := mustDoRequest(t, app, req)
+	assert.StatusCode(t, resp, http.StatusBadGateway)
+	assert.BodyContains(t, resp, "upstream request failed")
+
+	interactions, err := LoadCassette(path)
+	assert.NilError(t, err)
+	assert.Equal(t, len(interactions), 0, "expected failed request not to be recorded")
+}
+
+func TestMatchRules(t *testing.T) {
+	t.Parallel()
+
+	rec := RecordedRequest{
+		Method:     "POST",
+		Path:       "/foo",
+		Query:      "a=1&a=2",
+		Headers:    http.Header{"X-Tenant": {"acme"}},
+		BodySHA256: sha256Hex([]byte("body")),
+	}
+	testCases := map[string]struct {
+		rules  MatchRules
+		modify func(r *http.Request)
+		body   string
+		want   bool
+	}{
+		"default rules match": {
+			rules: DefaultMatchRules,
+			want:  true,
+		},
+		"method mismatch": {
+			rules:  DefaultMatchRules,
+			modify: func(r *http.Request) { r.Method = "PUT" },
+			want:   false,
+		},
+		"query order matters within a key": {
+			rules:  DefaultMatchRules,
+			modify: func(r *http.Request) { r.URL.RawQuery = "a=2&a=1" },
+			want:   false,
+		},
+		"query ignored": {
+			rules:  MatchRules{Method: true, Path: true},
+			modify: func(r *http.Request) { r.URL.RawQuery = "" },
+			want:   true,
+		},
+		"header match": {
+			rules: MatchRules{Headers: []string{"x-tenant"}},
+			want:  true,
+		},
+		"header mismatch": {
+			rules:  MatchRules{Headers: []string{"x-tenant"}},
+			modify: func(r *http.Request) { r.Header.Set("X-Tenant", "other") },
+			want:   false,
+		},
+		"body mismatch": {
+			rules: MatchRules{Body: true},
+			body:  "other",
+			want:  false,
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			r := httptest.NewRequest("POST", "/foo?a=1&a=2", nil)
+			r.Header.Set("X-Tenant", "acme")
+			if tc.modify != nil {
+				tc.modify(r)
+			}
+			body := "body"
+			if tc.body != "" {
+				body = tc.body
+			}
+			assert.Equal(t, tc.rules.matches(r, sha256Hex([]byte(body)), rec), tc.want, "incorrect match")
+		})
+	}
+
+	assert.Equal(t, MatchRules{Method: true, Body: true, Headers: []string{"X-Foo"}}.String(), "method,header:X-Foo,body", "incorrect string")
+}
+
+func TestLoadCassette(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "cassette.jsonl")
+	data := `{"request": {"method": "GET", "path": "/a"}, "response": {"status": 200}}` + "\n\nnope\n"
+	assert.NilError(t, os.WriteFile(path, []byte(data), 0o644))
+
+	_, err := LoadCassette(path)
+	if err == nil || !strings.HasPrefix(err.Error(), path+":3: invalid interaction") {
+		t.Fatalf("expected invalid interaction error, got %v", err)
+	}
+
+	data = `{"request": {"method": "GET", "path": "/a"}, "response": {"status": 200}}` + "\n" + `{"request": {"method": "GET", "path": "/b"}, "response": {"status": 1000}}` + "\n"
+	assert.NilError(t, os.WriteFile(path, []byte(data), 0o644))
+	_, err = LoadCassette(path)
+	if err == nil || err.Error() != path+":2: invalid interaction: response status 1000 must be in range [100, 599]" {
+		t.Fatalf("expected invalid status error, got %v", err)
+	}
+
+	cassette, err := NewCassetteWriter(path)
+	assert.NilError(t, err)
+	assert.NilError(t, cassette.Close())
+	assert.Error(t, cassette.Write(Interaction{}), errCassetteClosed)
+}
@@ -0,0 +1,251 @@
+package httpbin
+
+import (
+	"fmt"
+	"maps"
+	"math/rand"
+	"net/http"
+	"path"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// chaosFaults maps the name of each connection fault that may be chosen as a
+// /chaos outcome to the function that injects it, given what remains of the
+// request's MaxDuration once the outcome's delay has elapsed.
+var chaosFaults = map[string]func(w http.ResponseWriter, remaining time.Duration){
+	"empty-reply": func(w http.ResponseWriter, _ time.Duration) { emptyReply(w) },
+	"hang":        hangConn,
+	"reset":       func(w http.ResponseWriter, _ time.Duration) { resetReply(w) },
+}
+
+// chaosOutcome is a single possible outcome of a request to /chaos: either a
+// status code or a connection fault, after an optional delay.
+type chaosOutcome struct {
+	spec   string
+	status int
+	fault  string
+	delay  time.Duration
+}
+
+// parseChaosOutcome returns a parser for outcomes given in status[@delay] or
+// fault[@delay] format, e.g. 500@2s or reset, whose delays are bounded by
+// maxDuration.
+func parseChaosOutcome(maxDuration time.Duration) func(string) (chaosOutcome, error) {
+	return func(spec string) (chaosOutcome, error) {
+		outcome := chaosOutcome{spec: spec}
+		rawOutcome, rawDelay, found := strings.Cut(spec, "@")
+		if found {
+			delay, err := parseBoundedDuration(rawDelay, 0, maxDuration)
+			if err != nil {
+				return outcome, fmt.Errorf("invalid delay: %w", err)
+			}
+			outcome.delay = delay
+		}
+		if _, ok := chaosFaults[rawOutcome]; ok {
+			outcome.fault = rawOutcome
+			return outcome, nil
+		}
+		status, err := parseStatusCode(rawOutcome)
+		if err != nil {
+			return outcome, fmt.Errorf("must be a status code or one of %s", strings.Join(chaosFaultNames(), ", "))
+		}
+		outcome.status = status
+		return outcome, nil
+	}
+}
+
+// chaosFaultNames returns the sorted names of the supported connection
+// faults.
+func chaosFaultNames() []string {
+	names := make([]string, 0, len(chaosFaults))
+	for name := range chaosFaults {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// chaosAdminPath is the path of the admin endpoint used to inspect and update
+// the server-wide chaos mode settings at runtime. Requests to it are never
+// subject to chaos.
+const chaosAdminPath = "/_chaos"
+
+// ChaosSettings configures the errors and latency injected into requests by
+// server-wide chaos mode.
+type ChaosSettings struct {
+	// Fraction of requests, in the range [0, 1], that fail with a 500
+	// Internal Server Error response.
+	ErrorRate float64
+
+	// Latency added to each request, bounded by MaxDuration.
+	Latency time.Duration
+}
+
+// Chaos configures server-wide chaos mode, which injects errors and latency
+// into requests regardless of which parameters clients send.
+type Chaos struct {
+	// Default settings for requests subject to chaos.
+	ChaosSettings
+
+	// Route patterns subject to chaos, where each pattern is either a path
+	// glob as understood by path.Match (e.g. /status/*) or, if it ends in a
+	// slash, a path prefix (e.g. /anything/). All routes are subject to chaos
+	// if empty.
+	Routes []string
+
+	// Per-route settings, keyed by route pattern, which take precedence over
+	// the defaults. Routes matching an override are always subject to chaos.
+	// If more than one override matches, the longest pattern wins.
+	Overrides map[string]ChaosSettings
+
+	// Seed for the random number generator used to decide which requests
+	// fail, for reproducible chaos. A random seed is used if zero.
+	Seed int64
+}
+
+// Validate checks that the chaos settings are valid: error rates must be in
+// the range [0, 1], latencies must not be negative, and routes must be valid
+// patterns.
+func (c Chaos) Validate() error {
+	return c.validate(0)
+}
+
+// validate checks that the chaos settings are valid, additionally bounding
+// latency by maxDuration if it is non-zero.
+func (c Chaos) validate(maxDuration time.Duration) error {
+	if err := c.ChaosSettings.validate(maxDuration); err != nil {
+		return err
+	}
+	for _, pattern := range c.Routes {
+		if err := validateChaosRoute(pattern); err != nil {
+			return err
+		}
+	}
+	for pattern, settings := range c.Overrides {
+		if err := validateChaosRoute(pattern); err != nil {
+			return err
+		}
+		if err := settings.validate(maxDuration); err != nil {
+			return fmt.Errorf("invalid override for route %q: %w", pattern, err)
+		}
+	}
+	return nil
+}
+
+func (s ChaosSettings) validate(maxDuration time.Duration) error {
+	if s.ErrorRate < 0 || s.ErrorRate > 1 {
+		return fmt.Errorf("invalid error rate %v: not in range [0, 1]", s.ErrorRate)
+	}
+	if s.Latency < 0 {
+		return fmt.Errorf("invalid latency %s: must not be negative", s.Latency)
+	}
+	if maxDuration > 0 && s.Latency > maxDuration {
+		return fmt.Errorf("invalid latency %s: not in range [0, %s]", s.Latency, maxDuration)
+	}
+	return nil
+}
+
+func validateChaosRoute(pattern string) error {
+	if !strings.HasPrefix(pattern, "/") {
+		return fmt.Errorf("invalid route %q: must start with a slash", pattern)
+	}
+	if _, err := path.Match(pattern, ""); err != nil {
+		return fmt.Errorf("invalid route %q: %w", pattern, err)
+	}
+	return nil
+}
+
+// matchChaosRoute reports whether the request path matches the given route
+// pattern.
+func matchChaosRoute(pattern, reqPath string) bool {
+	if strings.HasSuffix(pattern, "/") {
+		return strings.HasPrefix(reqPath, pattern)
+	}
+	ok, _ := path.Match(pattern, reqPath)
+	return ok
+}
+
+// chaosMode holds the current server-wide chaos settings, which may be
+// updated at runtime via the admin endpoint.
+type chaosMode struct {
+	mu       sync.Mutex
+	settings Chaos
+	rng      *rand.Rand
+}
+
+func newChaosMode(c Chaos) *chaosMode {
+	m := &chaosMode{}
+	m.set(c)
+	return m
+}
+
+// get returns a copy of the current settings.
+func (m *chaosMode) get() Chaos {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.settings
+}
+
+// set replaces the current settings, reseeding the random number generator
+// if a seed is given.
+func (m *chaosMode) set(c Chaos) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	c.Routes = slices.Clone(c.Routes)
+	c.Overrides = maps.Clone(c.Overrides)
+	if c.Seed == 0 && m.rng != nil {
+		c.Seed = m.settings.Seed
+	} else {
+		if c.Seed == 0 {
+			c.Seed = time.Now().UnixNano()
+		}
+		m.rng = rand.New(rand.NewSource(c.Seed))
+	}
+	m.settings = c
+}
+
+// roll decides whether a request for the given path is subject to chaos and,
+// if so, how long it is delayed and whether it fails.
+func (m *chaosMode) roll(reqPath string) (delay time.Duration, fail bool, ok bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	settings, ok := m.settingsFor(reqPath)
+	if !ok {
+		return 0, false, false
+	}
+	fail = settings.ErrorRate > 0 && m.rng.Float64() < settings.ErrorRate
+	return settings.Latency, fail, true
+}
+
+// settingsFor returns the settings that apply to the given path, if it is
+// subject to chaos. Callers must hold m.mu.
+func (m *chaosMode) settingsFor(reqPath string) (ChaosSettings, bool) {
+	var (
+		bestPattern string
+		best        ChaosSettings
+		found       bool
+	)
+	for pattern, settings := range m.settings.Overrides {
+		if len(pattern) > len(bestPattern) && matchChaosRoute(pattern, reqPath) {
+			bestPattern, best, found = pattern, settings, true
+		}
+	}
+	if found {
+		return best, true
+	}
+
+	if len(m.settings.Routes) == 0 {
+		return m.settings.ChaosSettings, true
+	}
+	for _, pattern := range m.settings.Routes {
+		if matchChaosRoute(pattern, reqPath) {
+			return m.settings.ChaosSettings, true
+		}
+	}
+	return ChaosSettings{}, false
+}
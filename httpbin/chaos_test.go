@@ -0,0 +1,136 @@
+package httpbin
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mccutchen/go-httpbin/v2/internal/testing/assert"
+)
+
+func TestChaosMode(t *testing.T) {
+	t.Parallel()
+
+	t.Run("route matching", func(t *testing.T) {
+		t.Parallel()
+		m := newChaosMode(Chaos{
+			ChaosSettings: ChaosSettings{Latency: time.Second},
+			Routes:        []string{"/get", "/status/*", "/anything/"},
+			Overrides: map[string]ChaosSettings{
+				"/anything/":     {Latency: 2 * time.Second},
+				"/anything/foo/": {Latency: 3 * time.Second},
+				"/json":          {Latency: 4 * time.Second},
+			},
+		})
+
+		testCases := []struct {
+			path      string
+			wantDelay time.Duration
+			wantOK    bool
+		}{
+			{"/get", time.Second, true},
+			{"/get/", 0, false},
+			{"/status/500", time.Second, true},
+			{"/status/500/foo", 0, false},
+			{"/anything/bar", 2 * time.Second, true},
+			{"/anything/foo/bar", 3 * time.Second, true},
+			{"/json", 4 * time.Second, true},
+			{"/xml", 0, false},
+		}
+		for _, tc := range testCases {
+			delay, _, ok := m.roll(tc.path)
+			assert.Equal(t, ok, tc.wantOK, "incorrect match for %s", tc.path)
+			assert.Equal(t, delay, tc.wantDelay, "incorrect delay for %s", tc.path)
+		}
+	})
+
+	t.Run("all routes by default", func(t *testing.T) {
+		t.Parallel()
+		m := newChaosMode(Chaos{ChaosSettings: ChaosSettings{ErrorRate: 1}})
+		_, fail, ok := m.roll("/foo/bar")
+		assert.Equal(t, ok, true, "expected chaos for all routes")
+		assert.Equal(t, fail, true, "expected failure")
+	})
+
+	t.Run("seeded failures are reproducible", func(t *testing.T) {
+		t.Parallel()
+		rollN := func(m *chaosMode) []bool {
+			results := make([]bool, 20)
+			for i := range results {
+				_, results[i], _ = m.roll("/get")
+			}
+			return results
+		}
+		cfg := Chaos{ChaosSettings: ChaosSettings{ErrorRate: 0.5}, Seed: 1234}
+		m := newChaosMode(cfg)
+		want := rollN(m)
+		assert.DeepEqual(t, rollN(newChaosMode(cfg)), want, "expected same failures for same seed")
+
+		// updating settings without a seed continues the existing sequence,
+		// while giving a seed restarts it
+		m.set(Chaos{ChaosSettings: ChaosSettings{ErrorRate: 0.5}})
+		assert.Equal(t, m.get().Seed, int64(1234), "expected seed to be kept")
+		m.set(cfg)
+		assert.DeepEqual(t, rollN(m), want, "expected same failures after reseeding")
+	})
+}
+
+func TestChaosValidate(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		chaos   Chaos
+		wantErr string
+	}{
+		"zero value": {},
+		"ok": {
+			chaos: Chaos{
+				ChaosSettings: ChaosSettings{ErrorRate: 0.5, Latency: time.Hour},
+				Routes:        []string{"/get", "/status/*", "/anything/"},
+				Overrides:     map[string]ChaosSettings{"/json": {ErrorRate: 1}},
+			},
+		},
+		"error rate out of range": {
+			chaos:   Chaos{ChaosSettings: ChaosSettings{ErrorRate: 1.5}},
+			wantErr: "invalid error rate 1.5: not in range [0, 1]",
+		},
+		"negative latency": {
+			chaos:   Chaos{ChaosSettings: ChaosSettings{Latency: -time.Second}},
+			wantErr: "invalid latency -1s: must not be negative",
+		},
+		"relative route": {
+			chaos:   Chaos{Routes: []string{"get"}},
+			wantErr: `invalid route "get": must start with a slash`,
+		},
+		"malformed route": {
+			chaos:   Chaos{Routes: []string{"/status/["}},
+			wantErr: `invalid route "/status/[": syntax error in pattern`,
+		},
+		"invalid override": {
+			chaos:   Chaos{Overrides: map[string]ChaosSettings{"/get": {ErrorRate: -1}}},
+			wantErr: `invalid override for route "/get": invalid error rate -1: not in range [0, 1]`,
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			err := tc.chaos.Validate()
+			if tc.wantErr == "" {
+				assert.NilError(t, err)
+				return
+			}
+			if err == nil || err.Error() != tc.wantErr {
+				t.Fatalf("expected error %q, got %v", tc.wantErr, err)
+			}
+		})
+	}
+
+	t.Run("WithChaos panics on invalid settings", func(t *testing.T) {
+		t.Parallel()
+		defer func() {
+			if err := recover(); err == nil {
+				t.Fatalf("expected to recover from panic, got nil")
+			}
+		}()
+		New(WithChaos(Chaos{ChaosSettings: ChaosSettings{ErrorRate: 2}}))
+	})
+}
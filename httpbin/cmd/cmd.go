@@ -12,6 +12,7 @@ import (
 	"math"
 	"net"
 	"net/http"
+	"net/url"
 	"os"
 	"os/signal"
 	"runtime"
@@ -86,12 +87,13 @@ func mainImpl(args []string, build BuildInfo, getEnvVal func(string) string, get
 	}
 
 	logger := setupLogger(out, cfg.LogFormat, cfg.LogLevel)
+	observer := httpbin.StdLogObserver(logger)
 
 	opts := []httpbin.OptionFunc{
 		httpbin.WithEnv(cfg.Env),
 		httpbin.WithMaxBodySize(cfg.MaxBodySize),
 		httpbin.WithMaxDuration(cfg.MaxDuration),
-		httpbin.WithObserver(httpbin.StdLogObserver(logger)),
+		httpbin.WithObserver(observer),
 		httpbin.WithExcludeHeaders(cfg.ExcludeHeaders),
 	}
 	if cfg.UseFullVersion {
@@ -106,10 +108,90 @@ func mainImpl(args []string, build BuildInfo, getEnvVal func(string) string, get
 	if len(cfg.AllowedRedirectDomains) > 0 {
 		opts = append(opts, httpbin.WithAllowedRedirectDomains(cfg.AllowedRedirectDomains))
 	}
+	if len(cfg.AllowedWebhookDomains) > 0 {
+		opts = append(opts, httpbin.WithAllowedWebhookDomains(cfg.AllowedWebhookDomains))
+	}
+	if cfg.APIKey != "" {
+		opts = append(opts, httpbin.WithAPIKey(cfg.APIKey))
+	}
+	if cfg.RateLimit > 0 {
+		opts = append(opts, httpbin.WithRateLimit(httpbin.RateLimit{
+			Rate:      cfg.RateLimit,
+			Burst:     cfg.RateLimitBurst,
+			KeyHeader: cfg.RateLimitKeyHeader,
+		}))
+	}
+	if cfg.FaultInjectionHeaders {
+		opts = append(opts, httpbin.WithFaultInjectionHeaders())
+	}
+	if cfg.ChaosAdmin {
+		opts = append(opts, httpbin.WithChaosAdmin())
+	}
+	if cfg.ChaosErrorRate > 0 || cfg.ChaosLatency > 0 || len(cfg.ChaosOverrides) > 0 {
+		opts = append(opts, httpbin.WithChaos(httpbin.Chaos{
+			ChaosSettings: httpbin.ChaosSettings{
+				ErrorRate: cfg.ChaosErrorRate,
+				Latency:   cfg.ChaosLatency,
+			},
+			Routes:    cfg.ChaosRoutes,
+			Overrides: cfg.ChaosOverrides,
+			Seed:      cfg.ChaosSeed,
+		}))
+	}
+	if cfg.MaxBandwidth > 0 {
+		opts = append(opts, httpbin.WithMaxBandwidth(cfg.MaxBandwidth))
+	}
+	if cfg.MaxConcurrentRequests > 0 {
+		opts = append(opts, httpbin.WithMaxConcurrentRequests(cfg.MaxConcurrentRequests, cfg.QueueTimeout))
+	}
 	if cfg.UnsafeAllowDangerousResponses {
 		opts = append(opts, httpbin.WithUnsafeAllowDangerousResponses())
 	}
+	if len(cfg.Mocks) > 0 || cfg.MocksAdmin || cfg.HAR != nil {
+		opts = append(opts, httpbin.WithMocks(cfg.MocksPrefix, cfg.Mocks))
+	}
+	if cfg.MocksAdmin {
+		opts = append(opts, httpbin.WithMocksAdmin())
+	}
+	if cfg.HAR != nil {
+		opts = append(opts, httpbin.WithHAR(cfg.HAR, cfg.HARTimings))
+	}
+	if cfg.RecordHAR {
+		opts = append(opts, httpbin.WithHARRecorder(httpbin.DefaultHARMaxEntries))
+	}
+	if cfg.RecordUpstream != "" {
+		cassette, err := httpbin.NewCassetteWriter(cfg.Cassette)
+		if err != nil {
+			logger.Error(fmt.Sprintf("error: could not open cassette: %s", err))
+			return 1
+		}
+		defer func() {
+			if err := cassette.Close(); err != nil {
+				logger.Error(fmt.Sprintf("error: could not close cassette: %s", err))
+			}
+		}()
+		// already validated by loadConfig
+		upstream, _ := url.Parse(cfg.RecordUpstream)
+		opts = append(opts, httpbin.WithRecordUpstream(upstream, cassette))
+	}
+	if cfg.Replay {
+		opts = append(opts, httpbin.WithReplay(cfg.ReplayInteractions, cfg.ReplayMatch))
+	}
+	if cfg.Store != "" {
+		store, err := openStore(cfg)
+		if err != nil {
+			logger.Error(fmt.Sprintf("error: could not open %s store: %s", cfg.Store, err))
+			return 1
+		}
+		defer func() {
+			if err := store.Close(); err != nil {
+				logger.Error(fmt.Sprintf("error: could not close %s store: %s", cfg.Store, err))
+			}
+		}()
+		opts = append(opts, httpbin.WithStore(store))
+	}
 	app := httpbin.New(opts...)
+	defer app.Close()
 
 	srv := &http.Server{
 		Addr:              net.JoinHostPort(cfg.ListenHost, strconv.Itoa(cfg.ListenPort)),
@@ -119,7 +201,7 @@ func mainImpl(args []string, build BuildInfo, getEnvVal func(string) string, get
 		ReadTimeout:       cfg.SrvReadTimeout,
 	}
 
-	if err := listenAndServeGracefully(srv, cfg, logger); err != nil {
+	if err := listenAndServeGracefully(srv, cfg, logger, observer); err != nil {
 		logger.Error(fmt.Sprintf("error: %s", err))
 		return 1
 	}
@@ -132,13 +214,42 @@ func mainImpl(args []string, build BuildInfo, getEnvVal func(string) string, get
 type config struct {
 	Env                    map[string]string
 	AllowedRedirectDomains []string
+	AllowedWebhookDomains  []string
+	APIKey                 string
+	Cassette               string
+	ChaosAdmin             bool
+	ChaosErrorRate         float64
+	ChaosLatency           time.Duration
+	ChaosOverrides         map[string]httpbin.ChaosSettings
+	ChaosRoutes            []string
+	ChaosSeed              int64
 	ListenHost             string
 	ExcludeHeaders         string
+	FaultInjectionHeaders  bool
+	HAR                    *httpbin.HARArchive
+	HARFile                string
+	HARTimings             bool
 	ListenPort             int
+	MaxBandwidth           int64
 	MaxBodySize            int64
+	MaxConcurrentRequests  int
+	MaxConnections         int
 	MaxDuration            time.Duration
+	Mocks                  []httpbin.Mock
+	MocksAdmin             bool
+	MocksFile              string
+	MocksPrefix            string
 	Prefix                 string
+	QueueTimeout           time.Duration
+	RateLimit              float64
+	RateLimitBurst         int
+	RateLimitKeyHeader     string
 	RealHostname           string
+	RecordHAR              bool
+	RecordUpstream         string
+	Replay                 bool
+	ReplayInteractions     []httpbin.Interaction
+	ReplayMatch            httpbin.MatchRules
 	TLSCertFile            string
 	TLSKeyFile             string
 	LogFormat              string
@@ -146,6 +257,10 @@ type config struct {
 	SrvMaxHeaderBytes      int
 	SrvReadHeaderTimeout   time.Duration
 	SrvReadTimeout         time.Duration
+	Store                  string
+	StoreMaxAge            time.Duration
+	StoreMaxRecords        int
+	StorePath              string
 
 	// If true, endpoints that allow clients to specify a response
 	// Conntent-Type will NOT escape HTML entities in the response body, which
@@ -163,7 +278,10 @@ type config struct {
 
 	// temporary placeholders for arguments that need extra processing
 	rawAllowedRedirectDomains string
+	rawAllowedWebhookDomains  string
+	rawChaosRoutes            string
 	rawLogLevel               string
+	rawReplayMatch            string
 	rawUseRealHostname        bool
 }
 
@@ -191,16 +309,45 @@ func loadConfig(args []string, getEnvVal func(string) string, getEnviron func()
 	fs.BoolVar(&cfg.ShowVersion, "version", false, "Print version and exit")
 	fs.BoolVar(&cfg.rawUseRealHostname, "use-real-hostname", false, "Expose value of os.Hostname() in the /hostname endpoint instead of dummy value")
 	fs.DurationVar(&cfg.MaxDuration, "max-duration", httpbin.DefaultMaxDuration, "Maximum duration a response may take")
+	fs.Int64Var(&cfg.MaxBandwidth, "max-bandwidth", 0, "Maximum bandwidth for each response, in bytes per second (0 means no limit)")
 	fs.Int64Var(&cfg.MaxBodySize, "max-body-size", httpbin.DefaultMaxBodySize, "Maximum size of request or response, in bytes")
+	fs.IntVar(&cfg.MaxConcurrentRequests, "max-concurrent-requests", 0, "Maximum number of requests handled concurrently (0 means no limit)")
+	fs.IntVar(&cfg.MaxConnections, "max-connections", 0, "Maximum number of open client connections (0 means no limit)")
+	fs.DurationVar(&cfg.QueueTimeout, "queue-timeout", 0, "How long requests and connections beyond -max-concurrent-requests or -max-connections wait for a free slot before being rejected")
+	fs.StringVar(&cfg.MocksFile, "mocks-file", "", "Path to a JSON file defining mock endpoints with canned responses")
+	fs.BoolVar(&cfg.MocksAdmin, "mocks-admin", false, "Allow clients to register mock endpoints at runtime via the unauthenticated /_mocks admin API")
+	fs.StringVar(&cfg.MocksPrefix, "mocks-prefix", httpbin.DefaultMocksPrefix, "Path prefix under which mock endpoints from -mocks-file, -mocks-admin and -har-file are served")
+	fs.StringVar(&cfg.HARFile, "har-file", "", "Path to a HAR 1.2 file whose entries are served as mock responses")
+	fs.BoolVar(&cfg.HARTimings, "har-timings", false, "Delay responses from -har-file by their recorded timings, bounded by -max-duration")
+	fs.BoolVar(&cfg.RecordHAR, "record-har", false, "Record served requests and responses, exported in HAR 1.2 format via /har")
 	fs.IntVar(&cfg.ListenPort, "port", defaultListenPort, "Port to listen on")
 	fs.StringVar(&cfg.rawAllowedRedirectDomains, "allowed-redirect-domains", "", "Comma-separated list of domains the /redirect-to endpoint will allow")
+	fs.StringVar(&cfg.rawAllowedWebhookDomains, "allowed-webhook-domains", "", "Comma-separated list of domains to which the /webhooks/send endpoint will deliver webhooks; the endpoint is disabled if empty")
+	fs.StringVar(&cfg.APIKey, "api-key", "", "API key expected by the /api-key endpoint")
+	fs.BoolVar(&cfg.ChaosAdmin, "chaos-admin", false, "Allow clients to update chaos mode settings at runtime via the unauthenticated PUT /_chaos admin API")
+	fs.Float64Var(&cfg.ChaosErrorRate, "chaos-error-rate", 0, "Fraction of requests, between 0 and 1, that fail with a 500 error in chaos mode")
+	fs.DurationVar(&cfg.ChaosLatency, "chaos-latency", 0, "Latency added to each request in chaos mode")
+	fs.StringVar(&cfg.rawChaosRoutes, "chaos-routes", "", "Comma-separated list of route patterns (e.g. /get,/status/*,/anything/) subject to chaos mode, each with optional =error_rate@latency overrides (all routes if empty)")
+	fs.Int64Var(&cfg.ChaosSeed, "chaos-seed", 0, "Seed for the random number generator used in chaos mode, for reproducible failures (random if 0)")
 	fs.StringVar(&cfg.ListenHost, "host", defaultListenHost, "Host to listen on")
 	fs.StringVar(&cfg.Prefix, "prefix", "", "Path prefix (empty or start with slash and does not end with slash)")
+	fs.Float64Var(&cfg.RateLimit, "rate-limit", 0, "Max requests per second allowed for each client (0 disables rate limiting)")
+	fs.IntVar(&cfg.RateLimitBurst, "rate-limit-burst", 0, "Max burst of requests allowed for each client (defaults to -rate-limit)")
+	fs.StringVar(&cfg.RateLimitKeyHeader, "rate-limit-key-header", "", "Request header (e.g. X-API-Key) combined with client IP to identify clients for rate limiting; should be set by a trusted proxy")
 	fs.StringVar(&cfg.TLSCertFile, "https-cert-file", "", "HTTPS Server certificate file")
 	fs.StringVar(&cfg.TLSKeyFile, "https-key-file", "", "HTTPS Server private key file")
+	fs.BoolVar(&cfg.FaultInjectionHeaders, "fault-injection-headers", false, "Allow clients to inject delays and errors into any endpoint via X-Httpbin-* headers or _httpbin_* query params")
 	fs.StringVar(&cfg.ExcludeHeaders, "exclude-headers", "", "Drop platform-specific headers. Comma-separated list of headers key to drop, supporting wildcard matching.")
 	fs.StringVar(&cfg.LogFormat, "log-format", defaultLogFormat, "Log format (text or json)")
 	fs.StringVar(&cfg.rawLogLevel, "log-level", defaultLogLevel, "Logging level (DEBUG, INFO, WARN, ERROR, OFF)")
+	fs.StringVar(&cfg.Cassette, "cassette", "", "Path to the cassette file recorded by -record-upstream or served by -replay")
+	fs.StringVar(&cfg.RecordUpstream, "record-upstream", "", "Reverse-proxy every request to this upstream URL instead of the built-in endpoints, recording each interaction to -cassette")
+	fs.BoolVar(&cfg.Replay, "replay", false, "Serve every request from the interactions recorded in -cassette instead of the built-in endpoints")
+	fs.StringVar(&cfg.rawReplayMatch, "replay-match", httpbin.DefaultMatchRules.String(), "Comma-separated list of request attributes that must match a recorded interaction with -replay (method, path, query, body, header:<name>)")
+	fs.StringVar(&cfg.Store, "store", "", `Backend used to persist request history exposed via /history ("memory" or "file", disabled if empty)`)
+	fs.DurationVar(&cfg.StoreMaxAge, "store-max-age", 0, "Max age of request history retained by -store (0 means no limit)")
+	fs.IntVar(&cfg.StoreMaxRecords, "store-max-records", httpbin.DefaultStoreMaxRecords, "Max number of requests retained by -store")
+	fs.StringVar(&cfg.StorePath, "store-path", "", "Path to the JSON lines file used by -store=file")
 	fs.IntVar(&cfg.SrvMaxHeaderBytes, "srv-max-header-bytes", defaultSrvMaxHeaderBytes, "Value to use for the http.Server's MaxHeaderBytes option")
 	fs.DurationVar(&cfg.SrvReadHeaderTimeout, "srv-read-header-timeout", defaultSrvReadHeaderTimeout, "Value to use for the http.Server's ReadHeaderTimeout option")
 	fs.DurationVar(&cfg.SrvReadTimeout, "srv-read-timeout", defaultSrvReadTimeout, "Value to use for the http.Server's ReadTimeout option")
@@ -271,6 +418,9 @@ func loadConfig(args []string, getEnvVal func(string) string, getEnviron func()
 			return nil, configErr("Prefix %#v must not end with a slash", cfg.Prefix)
 		}
 	}
+	if cfg.APIKey == "" && getEnvVal("API_KEY") != "" {
+		cfg.APIKey = getEnvVal("API_KEY")
+	}
 	if cfg.ExcludeHeaders == "" && getEnvVal("EXCLUDE_HEADERS") != "" {
 		cfg.ExcludeHeaders = getEnvVal("EXCLUDE_HEADERS")
 	}
@@ -281,6 +431,225 @@ func loadConfig(args []string, getEnvVal func(string) string, getEnviron func()
 		}
 	}
 
+	if cfg.RateLimit == 0 && getEnvVal("RATE_LIMIT") != "" {
+		cfg.RateLimit, err = strconv.ParseFloat(getEnvVal("RATE_LIMIT"), 64)
+		if err != nil {
+			return nil, configErr("invalid value %#v for env var RATE_LIMIT: parse error", getEnvVal("RATE_LIMIT"))
+		}
+	}
+	if cfg.RateLimit < 0 {
+		return nil, configErr("invalid rate limit %v, must be >= 0", cfg.RateLimit)
+	}
+	if cfg.RateLimitBurst == 0 && getEnvVal("RATE_LIMIT_BURST") != "" {
+		cfg.RateLimitBurst, err = strconv.Atoi(getEnvVal("RATE_LIMIT_BURST"))
+		if err != nil {
+			return nil, configErr("invalid value %#v for env var RATE_LIMIT_BURST: parse error", getEnvVal("RATE_LIMIT_BURST"))
+		}
+	}
+	if cfg.RateLimitBurst < 0 {
+		return nil, configErr("invalid rate limit burst %d, must be >= 0", cfg.RateLimitBurst)
+	}
+	if cfg.RateLimitKeyHeader == "" && getEnvVal("RATE_LIMIT_KEY_HEADER") != "" {
+		cfg.RateLimitKeyHeader = getEnvVal("RATE_LIMIT_KEY_HEADER")
+	}
+
+	if cfg.MaxBandwidth == 0 && getEnvVal("MAX_BANDWIDTH") != "" {
+		cfg.MaxBandwidth, err = strconv.ParseInt(getEnvVal("MAX_BANDWIDTH"), 10, 64)
+		if err != nil {
+			return nil, configErr("invalid value %#v for env var MAX_BANDWIDTH: parse error", getEnvVal("MAX_BANDWIDTH"))
+		}
+	}
+	if cfg.MaxBandwidth < 0 {
+		return nil, configErr("invalid max bandwidth %d, must be >= 0", cfg.MaxBandwidth)
+	}
+
+	if cfg.MaxConcurrentRequests == 0 && getEnvVal("MAX_CONCURRENT_REQUESTS") != "" {
+		cfg.MaxConcurrentRequests, err = strconv.Atoi(getEnvVal("MAX_CONCURRENT_REQUESTS"))
+		if err != nil {
+			return nil, configErr("invalid value %#v for env var MAX_CONCURRENT_REQUESTS: parse error", getEnvVal("MAX_CONCURRENT_REQUESTS"))
+		}
+	}
+	if cfg.MaxConcurrentRequests < 0 {
+		return nil, configErr("invalid max concurrent requests %d, must be >= 0", cfg.MaxConcurrentRequests)
+	}
+	if cfg.MaxConnections == 0 && getEnvVal("MAX_CONNECTIONS") != "" {
+		cfg.MaxConnections, err = strconv.Atoi(getEnvVal("MAX_CONNECTIONS"))
+		if err != nil {
+			return nil, configErr("invalid value %#v for env var MAX_CONNECTIONS: parse error", getEnvVal("MAX_CONNECTIONS"))
+		}
+	}
+	if cfg.MaxConnections < 0 {
+		return nil, configErr("invalid max connections %d, must be >= 0", cfg.MaxConnections)
+	}
+	if cfg.QueueTimeout == 0 && getEnvVal("QUEUE_TIMEOUT") != "" {
+		cfg.QueueTimeout, err = time.ParseDuration(getEnvVal("QUEUE_TIMEOUT"))
+		if err != nil {
+			return nil, configErr("invalid value %#v for env var QUEUE_TIMEOUT: parse error", getEnvVal("QUEUE_TIMEOUT"))
+		}
+	}
+	if cfg.QueueTimeout < 0 {
+		return nil, configErr("invalid queue timeout %s, must be >= 0", cfg.QueueTimeout)
+	}
+
+	if getEnvBool(getEnvVal("CHAOS_ADMIN")) {
+		cfg.ChaosAdmin = true
+	}
+	if cfg.ChaosErrorRate == 0 && getEnvVal("CHAOS_ERROR_RATE") != "" {
+		cfg.ChaosErrorRate, err = strconv.ParseFloat(getEnvVal("CHAOS_ERROR_RATE"), 64)
+		if err != nil {
+			return nil, configErr("invalid value %#v for env var CHAOS_ERROR_RATE: parse error", getEnvVal("CHAOS_ERROR_RATE"))
+		}
+	}
+	if cfg.ChaosLatency == 0 && getEnvVal("CHAOS_LATENCY") != "" {
+		cfg.ChaosLatency, err = time.ParseDuration(getEnvVal("CHAOS_LATENCY"))
+		if err != nil {
+			return nil, configErr("invalid value %#v for env var CHAOS_LATENCY: parse error", getEnvVal("CHAOS_LATENCY"))
+		}
+	}
+	if cfg.ChaosSeed == 0 && getEnvVal("CHAOS_SEED") != "" {
+		cfg.ChaosSeed, err = strconv.ParseInt(getEnvVal("CHAOS_SEED"), 10, 64)
+		if err != nil {
+			return nil, configErr("invalid value %#v for env var CHAOS_SEED: parse error", getEnvVal("CHAOS_SEED"))
+		}
+	}
+	if cfg.rawChaosRoutes == "" && getEnvVal("CHAOS_ROUTES") != "" {
+		cfg.rawChaosRoutes = getEnvVal("CHAOS_ROUTES")
+	}
+	cfg.ChaosRoutes, cfg.ChaosOverrides, err = parseChaosRoutes(cfg.rawChaosRoutes, httpbin.ChaosSettings{
+		ErrorRate: cfg.ChaosErrorRate,
+		Latency:   cfg.ChaosLatency,
+	})
+	if err != nil {
+		return nil, configErr("invalid chaos routes %q: %s", cfg.rawChaosRoutes, err)
+	}
+	chaos := httpbin.Chaos{
+		ChaosSettings: httpbin.ChaosSettings{
+			ErrorRate: cfg.ChaosErrorRate,
+			Latency:   cfg.ChaosLatency,
+		},
+		Routes:    cfg.ChaosRoutes,
+		Overrides: cfg.ChaosOverrides,
+	}
+	if err := chaos.Validate(); err != nil {
+		return nil, configErr("invalid chaos mode: %s", err)
+	}
+
+	if cfg.MocksFile == "" && getEnvVal("MOCKS_FILE") != "" {
+		cfg.MocksFile = getEnvVal("MOCKS_FILE")
+	}
+	if cfg.MocksPrefix == httpbin.DefaultMocksPrefix && getEnvVal("MOCKS_PREFIX") != "" {
+		cfg.MocksPrefix = getEnvVal("MOCKS_PREFIX")
+	}
+	if cfg.MocksFile != "" {
+		cfg.Mocks, err = httpbin.LoadMocks(cfg.MocksFile)
+		if err != nil {
+			return nil, configErr("invalid mocks file %q: %s", cfg.MocksFile, err)
+		}
+		if err := httpbin.ValidateMocks(cfg.MocksPrefix, cfg.Mocks, cfg.MaxDuration); err != nil {
+			return nil, configErr("invalid mocks file %q: %s", cfg.MocksFile, err)
+		}
+	}
+	if getEnvBool(getEnvVal("MOCKS_ADMIN")) {
+		cfg.MocksAdmin = true
+	}
+	if cfg.HARFile == "" && getEnvVal("HAR_FILE") != "" {
+		cfg.HARFile = getEnvVal("HAR_FILE")
+	}
+	if getEnvBool(getEnvVal("HAR_TIMINGS")) {
+		cfg.HARTimings = true
+	}
+	if cfg.HARFile != "" {
+		cfg.HAR, err = httpbin.LoadHAR(cfg.HARFile)
+		if err != nil {
+			return nil, configErr("invalid HAR file %q: %s", cfg.HARFile, err)
+		}
+	} else if cfg.HARTimings {
+		return nil, configErr("HAR timings may only be given with a HAR file")
+	}
+	if (cfg.MocksAdmin || cfg.HARFile != "") && cfg.MocksFile == "" {
+		if err := httpbin.ValidateMocks(cfg.MocksPrefix, nil, cfg.MaxDuration); err != nil {
+			return nil, configErr("%s", err)
+		}
+	}
+	if getEnvBool(getEnvVal("RECORD_HAR")) {
+		cfg.RecordHAR = true
+	}
+
+	if cfg.Store == "" && getEnvVal("STORE") != "" {
+		cfg.Store = getEnvVal("STORE")
+	}
+	if cfg.StorePath == "" && getEnvVal("STORE_PATH") != "" {
+		cfg.StorePath = getEnvVal("STORE_PATH")
+	}
+	if cfg.StoreMaxAge == 0 && getEnvVal("STORE_MAX_AGE") != "" {
+		cfg.StoreMaxAge, err = time.ParseDuration(getEnvVal("STORE_MAX_AGE"))
+		if err != nil {
+			return nil, configErr("invalid value %#v for env var STORE_MAX_AGE: parse error", getEnvVal("STORE_MAX_AGE"))
+		}
+	}
+	if cfg.StoreMaxRecords == httpbin.DefaultStoreMaxRecords && getEnvVal("STORE_MAX_RECORDS") != "" {
+		cfg.StoreMaxRecords, err = strconv.Atoi(getEnvVal("STORE_MAX_RECORDS"))
+		if err != nil {
+			return nil, configErr("invalid value %#v for env var STORE_MAX_RECORDS: parse error", getEnvVal("STORE_MAX_RECORDS"))
+		}
+	}
+	switch cfg.Store {
+	case "", "memory":
+		if cfg.StorePath != "" {
+			return nil, configErr("store path may only be given with store \"file\"")
+		}
+	case "file":
+		if cfg.StorePath == "" {
+			return nil, configErr("store path is required with store \"file\"")
+		}
+	default:
+		return nil, configErr(`invalid store %q, must be "memory" or "file"`, cfg.Store)
+	}
+	if cfg.StoreMaxAge < 0 {
+		return nil, configErr("invalid store max age %s, must be >= 0", cfg.StoreMaxAge)
+	}
+	if cfg.StoreMaxRecords < 1 {
+		return nil, configErr("invalid store max records %d, must be >= 1", cfg.StoreMaxRecords)
+	}
+
+	if cfg.Cassette == "" && getEnvVal("CASSETTE") != "" {
+		cfg.Cassette = getEnvVal("CASSETTE")
+	}
+	if cfg.RecordUpstream == "" && getEnvVal("RECORD_UPSTREAM") != "" {
+		cfg.RecordUpstream = getEnvVal("RECORD_UPSTREAM")
+	}
+	if getEnvBool(getEnvVal("REPLAY")) {
+		cfg.Replay = true
+	}
+	if cfg.rawReplayMatch == httpbin.DefaultMatchRules.String() && getEnvVal("REPLAY_MATCH") != "" {
+		cfg.rawReplayMatch = getEnvVal("REPLAY_MATCH")
+	}
+	switch {
+	case cfg.RecordUpstream != "" && cfg.Replay:
+		return nil, configErr("record upstream and replay are mutually exclusive")
+	case cfg.RecordUpstream != "" || cfg.Replay:
+		if cfg.Cassette == "" {
+			return nil, configErr("cassette is required to record upstream or replay")
+		}
+	case cfg.Cassette != "":
+		return nil, configErr("cassette may only be given to record upstream or replay")
+	}
+	if cfg.RecordUpstream != "" {
+		if u, err := url.Parse(cfg.RecordUpstream); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, configErr("invalid record upstream %q, must be an absolute http or https URL", cfg.RecordUpstream)
+		}
+	}
+	if cfg.Replay {
+		cfg.ReplayMatch, err = parseMatchRules(cfg.rawReplayMatch)
+		if err != nil {
+			return nil, configErr("invalid replay match %q: %s", cfg.rawReplayMatch, err)
+		}
+		cfg.ReplayInteractions, err = httpbin.LoadCassette(cfg.Cassette)
+		if err != nil {
+			return nil, configErr("invalid cassette %q: %s", cfg.Cassette, err)
+		}
+	}
+
 	if cfg.TLSCertFile == "" && getEnvVal("HTTPS_CERT_FILE") != "" {
 		cfg.TLSCertFile = getEnvVal("HTTPS_CERT_FILE")
 	}
@@ -326,6 +695,15 @@ func loadConfig(args []string, getEnvVal func(string) string, getEnviron func()
 		}
 	}
 
+	if cfg.rawAllowedWebhookDomains == "" && getEnvVal("ALLOWED_WEBHOOK_DOMAINS") != "" {
+		cfg.rawAllowedWebhookDomains = getEnvVal("ALLOWED_WEBHOOK_DOMAINS")
+	}
+	for domain := range strings.SplitSeq(cfg.rawAllowedWebhookDomains, ",") {
+		if strings.TrimSpace(domain) != "" {
+			cfg.AllowedWebhookDomains = append(cfg.AllowedWebhookDomains, strings.TrimSpace(domain))
+		}
+	}
+
 	// set the http.Server options
 	if cfg.SrvMaxHeaderBytes == defaultSrvMaxHeaderBytes && getEnvVal("SRV_MAX_HEADER_BYTES") != "" {
 		cfg.SrvMaxHeaderBytes, err = strconv.Atoi(getEnvVal("SRV_MAX_HEADER_BYTES"))
@@ -346,6 +724,9 @@ func loadConfig(args []string, getEnvVal func(string) string, getEnviron func()
 		}
 	}
 
+	if getEnvBool(getEnvVal("FAULT_INJECTION_HEADERS")) {
+		cfg.FaultInjectionHeaders = true
+	}
 	if getEnvBool(getEnvVal("UNSAFE_ALLOW_DANGEROUS_RESPONSES")) {
 		cfg.UnsafeAllowDangerousResponses = true
 	}
@@ -355,7 +736,10 @@ func loadConfig(args []string, getEnvVal func(string) string, getEnviron func()
 
 	// reset temporary fields to their zero values
 	cfg.rawAllowedRedirectDomains = ""
+	cfg.rawAllowedWebhookDomains = ""
+	cfg.rawChaosRoutes = ""
 	cfg.rawLogLevel = ""
+	cfg.rawReplayMatch = ""
 	cfg.rawUseRealHostname = false
 
 	for _, envVar := range getEnviron() {
@@ -393,6 +777,91 @@ func parseLogLevel(s string) (slog.Level, error) {
 	}
 }
 
+// openStore opens the request history store described by the given config.
+func openStore(cfg *config) (httpbin.Store, error) {
+	limits := httpbin.StoreLimits{
+		MaxRecords: cfg.StoreMaxRecords,
+		MaxAge:     cfg.StoreMaxAge,
+	}
+	if cfg.Store == "file" {
+		return httpbin.NewFileStore(cfg.StorePath, limits)
+	}
+	return httpbin.NewMemoryStore(limits), nil
+}
+
+// parseMatchRules parses a comma-separated list of request attributes that
+// must match a recorded interaction in replay mode.
+func parseMatchRules(raw string) (httpbin.MatchRules, error) {
+	var rules httpbin.MatchRules
+	for attr := range strings.SplitSeq(raw, ",") {
+		attr = strings.TrimSpace(attr)
+		switch attr {
+		case "method":
+			rules.Method = true
+		case "path":
+			rules.Path = true
+		case "query":
+			rules.Query = true
+		case "body":
+			rules.Body = true
+		case "":
+			continue
+		default:
+			name, ok := strings.CutPrefix(attr, "header:")
+			if !ok || name == "" {
+				return httpbin.MatchRules{}, fmt.Errorf("unknown attribute %q", attr)
+			}
+			rules.Headers = append(rules.Headers, name)
+		}
+	}
+	return rules, nil
+}
+
+// parseChaosRoutes parses a comma-separated list of route patterns subject to
+// chaos mode, where each pattern may be followed by =error_rate@latency to
+// override the default settings for that route. Either part of an override
+// may be omitted, in which case the default is used. The resulting settings
+// are validated via (httpbin.Chaos).Validate.
+func parseChaosRoutes(raw string, defaults httpbin.ChaosSettings) ([]string, map[string]httpbin.ChaosSettings, error) {
+	var (
+		routes    []string
+		overrides map[string]httpbin.ChaosSettings
+	)
+	for rawRoute := range strings.SplitSeq(raw, ",") {
+		rawRoute = strings.TrimSpace(rawRoute)
+		if rawRoute == "" {
+			continue
+		}
+		pattern, rawOverride, hasOverride := strings.Cut(rawRoute, "=")
+		routes = append(routes, pattern)
+		if !hasOverride {
+			continue
+		}
+
+		settings := defaults
+		rawErrorRate, rawLatency, hasLatency := strings.Cut(rawOverride, "@")
+		if rawErrorRate != "" {
+			errorRate, err := strconv.ParseFloat(rawErrorRate, 64)
+			if err != nil {
+				return nil, nil, fmt.Errorf("route %q: error rate %q must be a number", pattern, rawErrorRate)
+			}
+			settings.ErrorRate = errorRate
+		}
+		if hasLatency {
+			latency, err := time.ParseDuration(rawLatency)
+			if err != nil {
+				return nil, nil, fmt.Errorf("route %q: latency %q must be a duration", pattern, rawLatency)
+			}
+			settings.Latency = latency
+		}
+		if overrides == nil {
+			overrides = make(map[string]httpbin.ChaosSettings)
+		}
+		overrides[pattern] = settings
+	}
+	return routes, overrides, nil
+}
+
 func setupLogger(out io.Writer, logFormat string, level slog.Level) *slog.Logger {
 	if level == logLevelOff {
 		out = io.Discard
@@ -412,7 +881,26 @@ func setupLogger(out io.Writer, logFormat string, level slog.Level) *slog.Logger
 	return slog.New(handler)
 }
 
-func listenAndServeGracefully(srv *http.Server, cfg *config, logger *slog.Logger) error {
+func listenAndServeGracefully(srv *http.Server, cfg *config, logger *slog.Logger, observer httpbin.Observer) error {
+	useTLS := cfg.TLSCertFile != "" && cfg.TLSKeyFile != ""
+
+	ln, err := net.Listen("tcp", srv.Addr)
+	if err != nil {
+		return err
+	}
+	if cfg.MaxConnections > 0 {
+		ln = newLimitListener(ln, cfg.MaxConnections, cfg.QueueTimeout, useTLS, func(c net.Conn) {
+			// rejected connections never reach the handler, so we report
+			// them to the observer directly
+			clientIP, _, _ := net.SplitHostPort(c.RemoteAddr().String())
+			observer(httpbin.Result{
+				Status:     http.StatusServiceUnavailable,
+				ClientIP:   clientIP,
+				RejectedBy: "max_connections",
+			})
+		})
+	}
+
 	doneCh := make(chan error, 1)
 
 	go func() {
@@ -426,13 +914,12 @@ func listenAndServeGracefully(srv *http.Server, cfg *config, logger *slog.Logger
 		doneCh <- srv.Shutdown(ctx)
 	}()
 
-	var err error
-	if cfg.TLSCertFile != "" && cfg.TLSKeyFile != "" {
+	if useTLS {
 		logger.Info(fmt.Sprintf("go-httpbin listening on https://%s", srv.Addr))
-		err = srv.ListenAndServeTLS(cfg.TLSCertFile, cfg.TLSKeyFile)
+		err = srv.ServeTLS(ln, cfg.TLSCertFile, cfg.TLSKeyFile)
 	} else {
 		logger.Info(fmt.Sprintf("go-httpbin listening on http://%s", srv.Addr))
-		err = srv.ListenAndServe()
+		err = srv.Serve(ln)
 	}
 	if err != nil && err != http.ErrServerClosed {
 		return err
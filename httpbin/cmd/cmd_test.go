@@ -1,13 +1,18 @@
 package cmd
 
 import (
+	"bufio"
 	"bytes"
 	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"log/slog"
+	"net"
+	"net/http"
 	"os"
 	"reflect"
+	"syscall"
 	"testing"
 	"time"
 
@@ -23,8 +28,30 @@ import (
 const usage = `Usage of go-httpbin:
   -allowed-redirect-domains string
     	Comma-separated list of domains the /redirect-to endpoint will allow
+  -allowed-webhook-domains string
+    	Comma-separated list of domains to which the /webhooks/send endpoint will deliver webhooks; the endpoint is disabled if empty
+  -api-key string
+    	API key expected by the /api-key endpoint
+  -cassette string
+    	Path to the cassette file recorded by -record-upstream or served by -replay
+  -chaos-admin
+    	Allow clients to update chaos mode settings at runtime via the unauthenticated PUT /_chaos admin API
+  -chaos-error-rate float
+    	Fraction of requests, between 0 and 1, that fail with a 500 error in chaos mode
+  -chaos-latency duration
+    	Latency added to each request in chaos mode
+  -chaos-routes string
+    	Comma-separated list of route patterns (e.g. /get,/status/*,/anything/) subject to chaos mode, each with optional =error_rate@latency overrides (all routes if empty)
+  -chaos-seed int
+    	Seed for the random number generator used in chaos mode, for reproducible failures (random if 0)
   -exclude-headers string
     	Drop platform-specific headers. Comma-separated list of headers key to drop, supporting wildcard matching.
+  -fault-injection-headers
+    	Allow clients to inject delays and errors into any endpoint via X-Httpbin-* headers or _httpbin_* query params
+  -har-file string
+    	Path to a HAR 1.2 file whose entries are served as mock responses
+  -har-timings
+    	Delay responses from -har-file by their recorded timings, bounded by -max-duration
   -host string
     	Host to listen on (default "0.0.0.0")
   -https-cert-file string
@@ -35,20 +62,56 @@ const usage = `Usage of go-httpbin:
     	Log format (text or json) (default "text")
   -log-level string
     	Logging level (DEBUG, INFO, WARN, ERROR, OFF) (default "INFO")
+  -max-bandwidth int
+    	Maximum bandwidth for each response, in bytes per second (0 means no limit)
   -max-body-size int
     	Maximum size of request or response, in bytes (default 1048576)
+  -max-concurrent-requests int
+    	Maximum number of requests handled concurrently (0 means no limit)
+  -max-connections int
+    	Maximum number of open client connections (0 means no limit)
   -max-duration duration
     	Maximum duration a response may take (default 10s)
+  -mocks-admin
+    	Allow clients to register mock endpoints at runtime via the unauthenticated /_mocks admin API
+  -mocks-file string
+    	Path to a JSON file defining mock endpoints with canned responses
+  -mocks-prefix string
+    	Path prefix under which mock endpoints from -mocks-file, -mocks-admin and -har-file are served (default "/mocks")
   -port int
     	Port to listen on (default 8080)
   -prefix string
     	Path prefix (empty or start with slash and does not end with slash)
+  -queue-timeout duration
+    	How long requests and connections beyond -max-concurrent-requests or -max-connections wait for a free slot before being rejected
+  -rate-limit float
+    	Max requests per second allowed for each client (0 disables rate limiting)
+  -rate-limit-burst int
+    	Max burst of requests allowed for each client (defaults to -rate-limit)
+  -rate-limit-key-header string
+    	Request header (e.g. X-API-Key) combined with client IP to identify clients for rate limiting; should be set by a trusted proxy
+  -record-har
+    	Record served requests and responses, exported in HAR 1.2 format via /har
+  -record-upstream string
+    	Reverse-proxy every request to this upstream URL instead of the built-in endpoints, recording each interaction to -cassette
+  -replay
+    	Serve every request from the interactions recorded in -cassette instead of the built-in endpoints
+  -replay-match string
+    	Comma-separated list of request attributes that must match a recorded interaction with -replay (method, path, query, body, header:<name>) (default "method,path,query")
   -srv-max-header-bytes int
     	Value to use for the http.Server's MaxHeaderBytes option (default 16384)
   -srv-read-header-timeout duration
     	Value to use for the http.Server's ReadHeaderTimeout option (default 1s)
   -srv-read-timeout duration
     	Value to use for the http.Server's ReadTimeout option (default 5s)
+  -store string
+    	Backend used to persist request history exposed via /history ("memory" or "file", disabled if empty)
+  -store-max-age duration
+    	Max age of request history retained by -store (0 means no limit)
+  -store-max-records int
+    	Max number of requests retained by -store (default 10000)
+  -store-path string
+    	Path to the JSON lines file used by -store=file
   -unsafe-allow-dangerous-responses
     	Allow endpoints to return unescaped HTML when clients control response Content-Type (enables XSS attacks)
   -use-full-version
@@ -70,6 +133,30 @@ func TestLoadConfig(t *testing.T) {
 	defaultCfg, err := loadConfig(nil, func(string) string { return "" }, func() []string { return nil }, getHostnameDefault)
 	assert.NilError(t, err)
 
+	cassetteDir := t.TempDir()
+	cassetteFile := cassetteDir + "/cassette.jsonl"
+	assert.NilError(t, os.WriteFile(cassetteFile, []byte(`{"request": {"method": "GET", "path": "/get"}, "response": {"status": 200}}`+"\n"), 0o644))
+	invalidCassetteFile := cassetteDir + "/invalid.jsonl"
+	assert.NilError(t, os.WriteFile(invalidCassetteFile, []byte("nope\n"), 0o644))
+	wantInteractions := []httpbin.Interaction{{
+		Request:  httpbin.RecordedRequest{Method: "GET", Path: "/get"},
+		Response: httpbin.RecordedResponse{Status: 200},
+	}}
+
+	harFile := cassetteDir + "/traffic.har"
+	assert.NilError(t, os.WriteFile(harFile, []byte(`{"log": {"entries": [{"request": {"method": "GET", "url": "http://example.com/foo"}, "response": {"status": 200}}]}}`), 0o644))
+	wantHAR, err := httpbin.LoadHAR(harFile)
+	assert.NilError(t, err)
+
+	mocksDir := t.TempDir()
+	mocksFile := mocksDir + "/mocks.json"
+	assert.NilError(t, os.WriteFile(mocksFile, []byte(`{"mocks": [{"method": "GET", "path": "/users/{id}", "body": "ok"}]}`), 0o644))
+	invalidMocksFile := mocksDir + "/invalid-mocks.json"
+	assert.NilError(t, os.WriteFile(invalidMocksFile, []byte(`{"mocks": [{"path": "users"}]}`), 0o644))
+	slowMocksFile := mocksDir + "/slow-mocks.json"
+	assert.NilError(t, os.WriteFile(slowMocksFile, []byte(`{"mocks": [{"path": "/slow", "delay": "2s"}]}`), 0o644))
+	wantMocks := []httpbin.Mock{{Method: "GET", Path: "/users/{id}", Body: []byte("ok")}}
+
 	testCases := map[string]struct {
 		args        []string
 		env         map[string]string
@@ -89,6 +176,8 @@ func TestLoadConfig(t *testing.T) {
 				SrvMaxHeaderBytes:    defaultSrvMaxHeaderBytes,
 				SrvReadHeaderTimeout: defaultSrvReadHeaderTimeout,
 				SrvReadTimeout:       defaultSrvReadTimeout,
+				StoreMaxRecords:      httpbin.DefaultStoreMaxRecords,
+				MocksPrefix:          httpbin.DefaultMocksPrefix,
 			},
 		},
 		"-h": {
@@ -255,6 +344,446 @@ func TestLoadConfig(t *testing.T) {
 			}),
 		},
 
+		// rate limit
+		"invalid -rate-limit": {
+			args:    []string{"-rate-limit", "foo"},
+			wantErr: errors.New("invalid value \"foo\" for flag -rate-limit: parse error"),
+		},
+		"invalid RATE_LIMIT": {
+			env:     map[string]string{"RATE_LIMIT": "foo"},
+			wantErr: errors.New("invalid value \"foo\" for env var RATE_LIMIT: parse error"),
+		},
+		"invalid negative -rate-limit": {
+			args:    []string{"-rate-limit", "-1"},
+			wantErr: errors.New("invalid rate limit -1, must be >= 0"),
+		},
+		"invalid RATE_LIMIT_BURST": {
+			env:     map[string]string{"RATE_LIMIT_BURST": "foo"},
+			wantErr: errors.New("invalid value \"foo\" for env var RATE_LIMIT_BURST: parse error"),
+		},
+		"invalid negative -rate-limit-burst": {
+			args:    []string{"-rate-limit-burst", "-1"},
+			wantErr: errors.New("invalid rate limit burst -1, must be >= 0"),
+		},
+		"ok rate limit CLI": {
+			args: []string{"-rate-limit", "2.5", "-rate-limit-burst", "10", "-rate-limit-key-header", "X-API-Key"},
+			wantCfg: mergedConfig(defaultCfg, &config{
+				RateLimit:          2.5,
+				RateLimitBurst:     10,
+				RateLimitKeyHeader: "X-API-Key",
+			}),
+		},
+		"ok rate limit env": {
+			env: map[string]string{"RATE_LIMIT": "5", "RATE_LIMIT_BURST": "20", "RATE_LIMIT_KEY_HEADER": "X-Client"},
+			wantCfg: mergedConfig(defaultCfg, &config{
+				RateLimit:          5,
+				RateLimitBurst:     20,
+				RateLimitKeyHeader: "X-Client",
+			}),
+		},
+		"ok rate limit CLI takes precedence over env": {
+			args: []string{"-rate-limit", "1", "-rate-limit-burst", "2", "-rate-limit-key-header", "X-CLI"},
+			env:  map[string]string{"RATE_LIMIT": "5", "RATE_LIMIT_BURST": "20", "RATE_LIMIT_KEY_HEADER": "X-Env"},
+			wantCfg: mergedConfig(defaultCfg, &config{
+				RateLimit:          1,
+				RateLimitBurst:     2,
+				RateLimitKeyHeader: "X-CLI",
+			}),
+		},
+
+		// chaos mode
+		"invalid CHAOS_ERROR_RATE": {
+			env:     map[string]string{"CHAOS_ERROR_RATE": "foo"},
+			wantErr: errors.New("invalid value \"foo\" for env var CHAOS_ERROR_RATE: parse error"),
+		},
+		"invalid -chaos-error-rate": {
+			args:    []string{"-chaos-error-rate", "1.5"},
+			wantErr: errors.New("invalid chaos mode: invalid error rate 1.5: not in range [0, 1]"),
+		},
+		"invalid CHAOS_LATENCY": {
+			env:     map[string]string{"CHAOS_LATENCY": "foo"},
+			wantErr: errors.New("invalid value \"foo\" for env var CHAOS_LATENCY: parse error"),
+		},
+		"invalid negative -chaos-latency": {
+			args:    []string{"-chaos-latency", "-1s"},
+			wantErr: errors.New("invalid chaos mode: invalid latency -1s: must not be negative"),
+		},
+		"invalid CHAOS_SEED": {
+			env:     map[string]string{"CHAOS_SEED": "foo"},
+			wantErr: errors.New("invalid value \"foo\" for env var CHAOS_SEED: parse error"),
+		},
+		"invalid -chaos-routes pattern": {
+			args:    []string{"-chaos-routes", "get"},
+			wantErr: errors.New(`invalid chaos mode: invalid route "get": must start with a slash`),
+		},
+		"invalid -chaos-routes error rate": {
+			args:    []string{"-chaos-routes", "/get=2"},
+			wantErr: errors.New(`invalid chaos mode: invalid override for route "/get": invalid error rate 2: not in range [0, 1]`),
+		},
+		"invalid -chaos-routes error rate syntax": {
+			args:    []string{"-chaos-routes", "/get=foo"},
+			wantErr: errors.New(`invalid chaos routes "/get=foo": route "/get": error rate "foo" must be a number`),
+		},
+		"invalid -chaos-routes negative latency": {
+			args:    []string{"-chaos-routes", "/get=@-1s"},
+			wantErr: errors.New(`invalid chaos mode: invalid override for route "/get": invalid latency -1s: must not be negative`),
+		},
+		"invalid -chaos-routes latency": {
+			args:    []string{"-chaos-routes", "/get=@foo"},
+			wantErr: errors.New(`invalid chaos routes "/get=@foo": route "/get": latency "foo" must be a duration`),
+		},
+		"ok chaos CLI": {
+			args: []string{
+				"-chaos-error-rate", "0.1",
+				"-chaos-latency", "100ms",
+				"-chaos-routes", "/get, /status/*=0.5, /anything/=@1s, /json=1@0s",
+				"-chaos-seed", "1234",
+			},
+			wantCfg: mergedConfig(defaultCfg, &config{
+				ChaosErrorRate: 0.1,
+				ChaosLatency:   100 * time.Millisecond,
+				ChaosRoutes:    []string{"/get", "/status/*", "/anything/", "/json"},
+				ChaosOverrides: map[string]httpbin.ChaosSettings{
+					"/status/*":  {ErrorRate: 0.5, Latency: 100 * time.Millisecond},
+					"/anything/": {ErrorRate: 0.1, Latency: time.Second},
+					"/json":      {ErrorRate: 1, Latency: 0},
+				},
+				ChaosSeed: 1234,
+			}),
+		},
+		"ok chaos env": {
+			env: map[string]string{
+				"CHAOS_ERROR_RATE": "0.2",
+				"CHAOS_LATENCY":    "1s",
+				"CHAOS_ROUTES":     "/get",
+				"CHAOS_SEED":       "42",
+			},
+			wantCfg: mergedConfig(defaultCfg, &config{
+				ChaosErrorRate: 0.2,
+				ChaosLatency:   time.Second,
+				ChaosRoutes:    []string{"/get"},
+				ChaosSeed:      42,
+			}),
+		},
+		"ok -chaos-admin": {
+			args: []string{"-chaos-admin"},
+			wantCfg: mergedConfig(defaultCfg, &config{
+				ChaosAdmin: true,
+			}),
+		},
+		"ok CHAOS_ADMIN": {
+			env: map[string]string{"CHAOS_ADMIN": "true"},
+			wantCfg: mergedConfig(defaultCfg, &config{
+				ChaosAdmin: true,
+			}),
+		},
+		"ok chaos CLI takes precedence over env": {
+			args: []string{"-chaos-error-rate", "0.5", "-chaos-routes", "/json"},
+			env:  map[string]string{"CHAOS_ERROR_RATE": "0.2", "CHAOS_ROUTES": "/get"},
+			wantCfg: mergedConfig(defaultCfg, &config{
+				ChaosErrorRate: 0.5,
+				ChaosRoutes:    []string{"/json"},
+			}),
+		},
+
+		// mocks
+		"invalid -mocks-file missing": {
+			args:    []string{"-mocks-file", mocksDir + "/missing.json"},
+			wantErr: fmt.Errorf("invalid mocks file %q: open %s/missing.json: no such file or directory", mocksDir+"/missing.json", mocksDir),
+		},
+		"invalid -mocks-file mock": {
+			args:    []string{"-mocks-file", invalidMocksFile},
+			wantErr: fmt.Errorf(`invalid mocks file %q: mock 0: invalid path "users", must start with a slash`, invalidMocksFile),
+		},
+		"invalid -mocks-file delay longer than -max-duration": {
+			args:    []string{"-mocks-file", slowMocksFile, "-max-duration", "1s"},
+			wantErr: fmt.Errorf(`invalid mocks file %q: mock 0: invalid delay 2s, must be <= 1s`, slowMocksFile),
+		},
+		"invalid -mocks-prefix": {
+			args:    []string{"-mocks-file", mocksFile, "-mocks-prefix", "mocks"},
+			wantErr: fmt.Errorf(`invalid mocks file %q: invalid mocks prefix "mocks", must start with a slash and not end with a slash`, mocksFile),
+		},
+		"ok -mocks-file": {
+			args: []string{"-mocks-file", mocksFile, "-mocks-prefix", "/api"},
+			wantCfg: mergedConfig(defaultCfg, &config{
+				Mocks:       wantMocks,
+				MocksFile:   mocksFile,
+				MocksPrefix: "/api",
+			}),
+		},
+		"ok -mocks-admin": {
+			args: []string{"-mocks-admin", "-mocks-prefix", "/api"},
+			wantCfg: mergedConfig(defaultCfg, &config{
+				MocksAdmin:  true,
+				MocksPrefix: "/api",
+			}),
+		},
+		"ok -har-file": {
+			args: []string{"-har-file", harFile, "-har-timings"},
+			wantCfg: mergedConfig(defaultCfg, &config{
+				HAR:        wantHAR,
+				HARFile:    harFile,
+				HARTimings: true,
+			}),
+		},
+		"ok HAR_FILE": {
+			env: map[string]string{"HAR_FILE": harFile, "HAR_TIMINGS": "true"},
+			wantCfg: mergedConfig(defaultCfg, &config{
+				HAR:        wantHAR,
+				HARFile:    harFile,
+				HARTimings: true,
+			}),
+		},
+		"invalid -har-file": {
+			args:    []string{"-har-file", mocksFile},
+			wantErr: fmt.Errorf(`invalid HAR file %q: missing log`, mocksFile),
+		},
+		"invalid -har-timings without -har-file": {
+			args:    []string{"-har-timings"},
+			wantErr: errors.New("HAR timings may only be given with a HAR file"),
+		},
+		"ok -record-har": {
+			args: []string{"-record-har"},
+			wantCfg: mergedConfig(defaultCfg, &config{
+				RecordHAR: true,
+			}),
+		},
+		"ok RECORD_HAR=1": {
+			env: map[string]string{"RECORD_HAR": "1"},
+			wantCfg: mergedConfig(defaultCfg, &config{
+				RecordHAR: true,
+			}),
+		},
+		"ok MOCKS_ADMIN=1": {
+			env: map[string]string{"MOCKS_ADMIN": "1"},
+			wantCfg: mergedConfig(defaultCfg, &config{
+				MocksAdmin: true,
+			}),
+		},
+		"invalid -mocks-prefix with -mocks-admin": {
+			args:    []string{"-mocks-admin", "-mocks-prefix", "/api/"},
+			wantErr: errors.New(`invalid mocks prefix "/api/", must start with a slash and not end with a slash`),
+		},
+		"ok MOCKS_FILE": {
+			env: map[string]string{"MOCKS_FILE": mocksFile, "MOCKS_PREFIX": "/api"},
+			wantCfg: mergedConfig(defaultCfg, &config{
+				Mocks:       wantMocks,
+				MocksFile:   mocksFile,
+				MocksPrefix: "/api",
+			}),
+		},
+
+		// request history store
+		"invalid -store": {
+			args:    []string{"-store", "redis"},
+			wantErr: errors.New(`invalid store "redis", must be "memory" or "file"`),
+		},
+		"invalid -store=file without -store-path": {
+			args:    []string{"-store", "file"},
+			wantErr: errors.New(`store path is required with store "file"`),
+		},
+		"invalid -store-path without -store=file": {
+			args:    []string{"-store", "memory", "-store-path", "/tmp/history.jsonl"},
+			wantErr: errors.New(`store path may only be given with store "file"`),
+		},
+		"invalid STORE_MAX_AGE": {
+			env:     map[string]string{"STORE_MAX_AGE": "foo"},
+			wantErr: errors.New("invalid value \"foo\" for env var STORE_MAX_AGE: parse error"),
+		},
+		"invalid negative -store-max-age": {
+			args:    []string{"-store-max-age", "-1s"},
+			wantErr: errors.New("invalid store max age -1s, must be >= 0"),
+		},
+		"invalid STORE_MAX_RECORDS": {
+			env:     map[string]string{"STORE_MAX_RECORDS": "foo"},
+			wantErr: errors.New("invalid value \"foo\" for env var STORE_MAX_RECORDS: parse error"),
+		},
+		"invalid -store-max-records": {
+			args:    []string{"-store-max-records", "0"},
+			wantErr: errors.New("invalid store max records 0, must be >= 1"),
+		},
+		"ok store CLI": {
+			args: []string{
+				"-store", "file",
+				"-store-path", "/tmp/history.jsonl",
+				"-store-max-age", "24h",
+				"-store-max-records", "500",
+			},
+			wantCfg: mergedConfig(defaultCfg, &config{
+				Store:           "file",
+				StorePath:       "/tmp/history.jsonl",
+				StoreMaxAge:     24 * time.Hour,
+				StoreMaxRecords: 500,
+			}),
+		},
+		"ok store env": {
+			env: map[string]string{
+				"STORE":             "memory",
+				"STORE_MAX_AGE":     "1h",
+				"STORE_MAX_RECORDS": "100",
+			},
+			wantCfg: mergedConfig(defaultCfg, &config{
+				Store:           "memory",
+				StoreMaxAge:     time.Hour,
+				StoreMaxRecords: 100,
+			}),
+		},
+		"ok store CLI takes precedence over env": {
+			args: []string{"-store", "memory", "-store-max-records", "5"},
+			env:  map[string]string{"STORE": "file", "STORE_PATH": "", "STORE_MAX_RECORDS": "100"},
+			wantCfg: mergedConfig(defaultCfg, &config{
+				Store:           "memory",
+				StoreMaxRecords: 5,
+			}),
+		},
+
+		// record and replay
+		"invalid -record-upstream and -replay": {
+			args:    []string{"-record-upstream", "http://example.com", "-replay", "-cassette", cassetteFile},
+			wantErr: errors.New("record upstream and replay are mutually exclusive"),
+		},
+		"invalid -record-upstream without -cassette": {
+			args:    []string{"-record-upstream", "http://example.com"},
+			wantErr: errors.New("cassette is required to record upstream or replay"),
+		},
+		"invalid -cassette without mode": {
+			args:    []string{"-cassette", cassetteFile},
+			wantErr: errors.New("cassette may only be given to record upstream or replay"),
+		},
+		"invalid -record-upstream": {
+			args:    []string{"-record-upstream", "example.com", "-cassette", cassetteFile},
+			wantErr: errors.New(`invalid record upstream "example.com", must be an absolute http or https URL`),
+		},
+		"invalid -replay-match": {
+			args:    []string{"-replay", "-cassette", cassetteFile, "-replay-match", "method,cookies"},
+			wantErr: errors.New(`invalid replay match "method,cookies": unknown attribute "cookies"`),
+		},
+		"invalid -cassette": {
+			args:    []string{"-replay", "-cassette", invalidCassetteFile},
+			wantErr: fmt.Errorf(`invalid cassette %q: %s:1: invalid interaction: invalid character 'o' in literal null (expecting 'u')`, invalidCassetteFile, invalidCassetteFile),
+		},
+		"ok -record-upstream": {
+			args: []string{"-record-upstream", "https://example.com/api", "-cassette", cassetteFile},
+			wantCfg: mergedConfig(defaultCfg, &config{
+				Cassette:       cassetteFile,
+				RecordUpstream: "https://example.com/api",
+			}),
+		},
+		"ok -replay": {
+			args: []string{"-replay", "-cassette", cassetteFile, "-replay-match", "method, path, header:X-Tenant, body"},
+			wantCfg: mergedConfig(defaultCfg, &config{
+				Cassette:           cassetteFile,
+				Replay:             true,
+				ReplayInteractions: wantInteractions,
+				ReplayMatch:        httpbin.MatchRules{Method: true, Path: true, Body: true, Headers: []string{"X-Tenant"}},
+			}),
+		},
+		"ok REPLAY": {
+			env: map[string]string{"REPLAY": "1", "CASSETTE": cassetteFile, "REPLAY_MATCH": "method,query"},
+			wantCfg: mergedConfig(defaultCfg, &config{
+				Cassette:           cassetteFile,
+				Replay:             true,
+				ReplayInteractions: wantInteractions,
+				ReplayMatch:        httpbin.MatchRules{Method: true, Query: true},
+			}),
+		},
+		"ok -replay default match": {
+			args: []string{"-replay", "-cassette", cassetteFile},
+			wantCfg: mergedConfig(defaultCfg, &config{
+				Cassette:           cassetteFile,
+				Replay:             true,
+				ReplayInteractions: wantInteractions,
+				ReplayMatch:        httpbin.DefaultMatchRules,
+			}),
+		},
+		"ok RECORD_UPSTREAM": {
+			env: map[string]string{"RECORD_UPSTREAM": "http://localhost:9000", "CASSETTE": cassetteFile},
+			wantCfg: mergedConfig(defaultCfg, &config{
+				Cassette:       cassetteFile,
+				RecordUpstream: "http://localhost:9000",
+			}),
+		},
+
+		// max bandwidth
+		"invalid MAX_BANDWIDTH": {
+			env:     map[string]string{"MAX_BANDWIDTH": "foo"},
+			wantErr: errors.New("invalid value \"foo\" for env var MAX_BANDWIDTH: parse error"),
+		},
+		"invalid negative -max-bandwidth": {
+			args:    []string{"-max-bandwidth", "-1"},
+			wantErr: errors.New("invalid max bandwidth -1, must be >= 0"),
+		},
+		"ok -max-bandwidth": {
+			args: []string{"-max-bandwidth", "65536"},
+			wantCfg: mergedConfig(defaultCfg, &config{
+				MaxBandwidth: 65536,
+			}),
+		},
+		"ok MAX_BANDWIDTH": {
+			env: map[string]string{"MAX_BANDWIDTH": "1024"},
+			wantCfg: mergedConfig(defaultCfg, &config{
+				MaxBandwidth: 1024,
+			}),
+		},
+		"ok -max-bandwidth takes precedence over MAX_BANDWIDTH": {
+			args: []string{"-max-bandwidth", "65536"},
+			env:  map[string]string{"MAX_BANDWIDTH": "1024"},
+			wantCfg: mergedConfig(defaultCfg, &config{
+				MaxBandwidth: 65536,
+			}),
+		},
+
+		// max concurrent requests, max connections, queue timeout
+		"invalid MAX_CONCURRENT_REQUESTS": {
+			env:     map[string]string{"MAX_CONCURRENT_REQUESTS": "foo"},
+			wantErr: errors.New("invalid value \"foo\" for env var MAX_CONCURRENT_REQUESTS: parse error"),
+		},
+		"invalid negative -max-concurrent-requests": {
+			args:    []string{"-max-concurrent-requests", "-1"},
+			wantErr: errors.New("invalid max concurrent requests -1, must be >= 0"),
+		},
+		"invalid MAX_CONNECTIONS": {
+			env:     map[string]string{"MAX_CONNECTIONS": "foo"},
+			wantErr: errors.New("invalid value \"foo\" for env var MAX_CONNECTIONS: parse error"),
+		},
+		"invalid negative -max-connections": {
+			args:    []string{"-max-connections", "-1"},
+			wantErr: errors.New("invalid max connections -1, must be >= 0"),
+		},
+		"invalid QUEUE_TIMEOUT": {
+			env:     map[string]string{"QUEUE_TIMEOUT": "foo"},
+			wantErr: errors.New("invalid value \"foo\" for env var QUEUE_TIMEOUT: parse error"),
+		},
+		"invalid negative -queue-timeout": {
+			args:    []string{"-queue-timeout", "-1s"},
+			wantErr: errors.New("invalid queue timeout -1s, must be >= 0"),
+		},
+		"ok concurrency limits CLI": {
+			args: []string{"-max-concurrent-requests", "100", "-max-connections", "200", "-queue-timeout", "500ms"},
+			wantCfg: mergedConfig(defaultCfg, &config{
+				MaxConcurrentRequests: 100,
+				MaxConnections:        200,
+				QueueTimeout:          500 * time.Millisecond,
+			}),
+		},
+		"ok concurrency limits env": {
+			env: map[string]string{"MAX_CONCURRENT_REQUESTS": "10", "MAX_CONNECTIONS": "20", "QUEUE_TIMEOUT": "2s"},
+			wantCfg: mergedConfig(defaultCfg, &config{
+				MaxConcurrentRequests: 10,
+				MaxConnections:        20,
+				QueueTimeout:          2 * time.Second,
+			}),
+		},
+		"ok concurrency limits CLI takes precedence over env": {
+			args: []string{"-max-concurrent-requests", "1", "-max-connections", "2", "-queue-timeout", "3s"},
+			env:  map[string]string{"MAX_CONCURRENT_REQUESTS": "10", "MAX_CONNECTIONS": "20", "QUEUE_TIMEOUT": "2s"},
+			wantCfg: mergedConfig(defaultCfg, &config{
+				MaxConcurrentRequests: 1,
+				MaxConnections:        2,
+				QueueTimeout:          3 * time.Second,
+			}),
+		},
+
 		// https cert file
 		"https cert and key must both be provided, cert only": {
 			args:    []string{"-https-cert-file", "/tmp/test.crt"},
@@ -379,6 +908,48 @@ func TestLoadConfig(t *testing.T) {
 			}),
 		},
 
+		// allowed-webhook-domains
+		"ok -allowed-webhook-domains": {
+			args: []string{"-allowed-webhook-domains", "foo, bar  ,, baz   "},
+			wantCfg: mergedConfig(defaultCfg, &config{
+				AllowedWebhookDomains: []string{"foo", "bar", "baz"},
+			}),
+		},
+		"ok ALLOWED_WEBHOOK_DOMAINS": {
+			env: map[string]string{"ALLOWED_WEBHOOK_DOMAINS": "foo,bar"},
+			wantCfg: mergedConfig(defaultCfg, &config{
+				AllowedWebhookDomains: []string{"foo", "bar"},
+			}),
+		},
+		"ok allowed webhook domains CLI takes precedence over env": {
+			args: []string{"-allowed-webhook-domains", "foo.cli"},
+			env:  map[string]string{"ALLOWED_WEBHOOK_DOMAINS": "foo.env"},
+			wantCfg: mergedConfig(defaultCfg, &config{
+				AllowedWebhookDomains: []string{"foo.cli"},
+			}),
+		},
+
+		// api-key
+		"ok -api-key": {
+			args: []string{"-api-key", "cli-key"},
+			wantCfg: mergedConfig(defaultCfg, &config{
+				APIKey: "cli-key",
+			}),
+		},
+		"ok API_KEY": {
+			env: map[string]string{"API_KEY": "env-key"},
+			wantCfg: mergedConfig(defaultCfg, &config{
+				APIKey: "env-key",
+			}),
+		},
+		"ok api key CLI takes precedence over env": {
+			args: []string{"-api-key", "cli-key"},
+			env:  map[string]string{"API_KEY": "env-key"},
+			wantCfg: mergedConfig(defaultCfg, &config{
+				APIKey: "cli-key",
+			}),
+		},
+
 		// log-format
 		"ok use json log format": {
 			args: []string{"-log-format", "json"},
@@ -555,6 +1126,24 @@ func TestLoadConfig(t *testing.T) {
 			wantCfg: defaultCfg,
 		},
 
+		// fault-injection-headers
+		"ok -fault-injection-headers": {
+			args: []string{"-fault-injection-headers"},
+			wantCfg: mergedConfig(defaultCfg, &config{
+				FaultInjectionHeaders: true,
+			}),
+		},
+		"ok FAULT_INJECTION_HEADERS=1": {
+			env: map[string]string{"FAULT_INJECTION_HEADERS": "1"},
+			wantCfg: mergedConfig(defaultCfg, &config{
+				FaultInjectionHeaders: true,
+			}),
+		},
+		"ok FAULT_INJECTION_HEADERS=false": {
+			env:     map[string]string{"FAULT_INJECTION_HEADERS": "false"},
+			wantCfg: defaultCfg,
+		},
+
 		// use-full-version
 		"ok -use-full-version": {
 			args: []string{"-use-full-version"},
@@ -654,6 +1243,16 @@ func TestMainImpl(t *testing.T) {
 			wantCode:    1,
 			wantOut:     "error: could not look up real hostname: hostname failure",
 		},
+		"store error": {
+			args: []string{
+				"-store", "file",
+				"-store-path", "./store-dir-does-not-exist/history.jsonl",
+			},
+			wantCode: 1,
+			wantOutFn: func(t *testing.T, out string) {
+				assert.Contains(t, out, `msg="error: could not open file store: open ./store-dir-does-not-exist/history.jsonl.tmp: no such file or directory"`, "store error does not contain expected message")
+			},
+		},
 		"server error": {
 			args: []string{
 				"-port", "-256",
@@ -717,6 +1316,125 @@ func TestMainImpl(t *testing.T) {
 	}
 }
 
+func TestLimitListener(t *testing.T) {
+	t.Parallel()
+
+	inner, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NilError(t, err)
+
+	rejected := make(chan string, 1)
+	ln := newLimitListener(inner, 1, 200*time.Millisecond, false, func(c net.Conn) {
+		rejected <- c.RemoteAddr().String()
+	})
+	defer ln.Close()
+
+	accepted := make(chan net.Conn, 2)
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			accepted <- c
+		}
+	}()
+
+	// first connection fits within the limit
+	c1, err := net.Dial("tcp", ln.Addr().String())
+	assert.NilError(t, err)
+	defer c1.Close()
+	server1 := <-accepted
+
+	// second connection is rejected with a canned 503 after the queue
+	// timeout elapses
+	c2, err := net.Dial("tcp", ln.Addr().String())
+	assert.NilError(t, err)
+	defer c2.Close()
+	assert.Equal(t, <-rejected, c2.LocalAddr().String(), "incorrect rejected connection")
+	resp, err := http.ReadResponse(bufio.NewReader(c2), nil)
+	assert.NilError(t, err)
+	assert.Equal(t, resp.StatusCode, http.StatusServiceUnavailable, "incorrect status code")
+	assert.Equal(t, resp.Header.Get("Retry-After"), "1", "incorrect Retry-After header")
+	body, err := io.ReadAll(resp.Body)
+	assert.NilError(t, err)
+	assert.Equal(t, string(body), connRejectedBody, "incorrect body")
+
+	// once the first connection closes, a queued connection is accepted
+	c3, err := net.Dial("tcp", ln.Addr().String())
+	assert.NilError(t, err)
+	defer c3.Close()
+	assert.NilError(t, server1.Close())
+	select {
+	case server3 := <-accepted:
+		server3.Close()
+	case <-rejected:
+		t.Fatal("expected queued connection to be accepted")
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for queued connection")
+	}
+}
+
+func TestLimitListenerQueue(t *testing.T) {
+	t.Parallel()
+
+	inner, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NilError(t, err)
+
+	queueTimeout := 300 * time.Millisecond
+	rejected := make(chan string, 2)
+	ln := newLimitListener(inner, 1, queueTimeout, false, func(c net.Conn) {
+		rejected <- c.RemoteAddr().String()
+	})
+	defer ln.Close()
+
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			accepted <- c
+		}
+	}()
+
+	c1, err := net.Dial("tcp", ln.Addr().String())
+	assert.NilError(t, err)
+	defer c1.Close()
+	server1 := <-accepted
+	defer server1.Close()
+
+	// connections beyond the limit wait for a slot concurrently, rather than
+	// one after another
+	start := time.Now()
+	for range 2 {
+		c, err := net.Dial("tcp", ln.Addr().String())
+		assert.NilError(t, err)
+		defer c.Close()
+	}
+	<-rejected
+	<-rejected
+	if elapsed := time.Since(start); elapsed >= 2*queueTimeout {
+		t.Fatalf("expected queued connections to be rejected after %s, took %s", queueTimeout, elapsed)
+	}
+}
+
+func TestLimitListenerReset(t *testing.T) {
+	t.Parallel()
+
+	inner, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NilError(t, err)
+
+	// connections accepted by a limitListener must still be reset with a
+	// TCP RST rather than closed gracefully
+	srv := &http.Server{Handler: httpbin.New().Handler()}
+	go srv.Serve(newLimitListener(inner, 1, 0, false, nil))
+	defer srv.Close()
+
+	_, err = http.Get("http://" + inner.Addr().String() + "/fault/reset")
+	assert.Equal(t, errors.Is(err, syscall.ECONNRESET), true, "expected %v, got %v", syscall.ECONNRESET, err)
+}
+
 func environSlice(env map[string]string) []string {
 	envStrings := make([]string, 0, len(env))
 	for name, value := range env {
@@ -780,6 +1498,10 @@ func mergedConfig(base, override *config) *config {
 			if !overrideField.IsNil() {
 				resultField.Set(overrideField)
 			}
+		case reflect.Struct:
+			if !overrideField.IsZero() {
+				resultField.Set(overrideField)
+			}
 		}
 	}
 
@@ -0,0 +1,177 @@
+package cmd
+
+import (
+	"errors"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// connRejectedBody mirrors the JSON error responses written by the httpbin
+// handlers.
+const connRejectedBody = `{"status_code":503,"error":"Service Unavailable","detail":"too many open connections"}`
+
+// connRejectedResponse is written to connections rejected because the server
+// is already handling the maximum number of connections.
+var connRejectedResponse = []byte("HTTP/1.1 503 Service Unavailable\r\n" +
+	"Content-Type: application/json; charset=utf-8\r\n" +
+	"Retry-After: 1\r\n" +
+	"Connection: close\r\n" +
+	"Content-Length: " + strconv.Itoa(len(connRejectedBody)) + "\r\n" +
+	"\r\n" +
+	connRejectedBody)
+
+// connRejectedWriteTimeout bounds how long we will spend writing the canned
+// 503 response to a rejected connection.
+const connRejectedWriteTimeout = 1 * time.Second
+
+// limitListener is a net.Listener that limits the number of simultaneously
+// open connections. Connections beyond the limit wait up to queueTimeout for
+// another connection to close before being rejected.
+//
+// Connections are accepted from the underlying listener in the background,
+// and each connection beyond the limit waits for a slot in its own goroutine,
+// so that waiting connections do not hold up those behind them.
+type limitListener struct {
+	net.Listener
+
+	slots        chan struct{}
+	queueTimeout time.Duration
+
+	// If true, rejected connections are closed without writing a response,
+	// because we cannot speak plaintext HTTP to a client expecting TLS.
+	tls bool
+
+	// Called for every rejected connection
+	onReject func(net.Conn)
+
+	acceptOnce sync.Once
+	conns      chan net.Conn
+	errs       chan error
+
+	closeOnce sync.Once
+	closed    chan struct{}
+}
+
+func newLimitListener(l net.Listener, n int, queueTimeout time.Duration, tls bool, onReject func(net.Conn)) *limitListener {
+	return &limitListener{
+		Listener:     l,
+		slots:        make(chan struct{}, n),
+		queueTimeout: queueTimeout,
+		tls:          tls,
+		onReject:     onReject,
+		conns:        make(chan net.Conn),
+		errs:         make(chan error),
+		closed:       make(chan struct{}),
+	}
+}
+
+// Accept waits for and returns the next connection that fits within the
+// limit.
+func (l *limitListener) Accept() (net.Conn, error) {
+	l.acceptOnce.Do(func() { go l.acceptLoop() })
+	select {
+	case c := <-l.conns:
+		return c, nil
+	case err := <-l.errs:
+		return nil, err
+	case <-l.closed:
+		return nil, net.ErrClosed
+	}
+}
+
+// Close closes the underlying listener, stopping any background work.
+func (l *limitListener) Close() error {
+	l.closeOnce.Do(func() { close(l.closed) })
+	return l.Listener.Close()
+}
+
+// acceptLoop accepts connections from the underlying listener until it is
+// closed, handing off those that fit within the limit to Accept and queueing
+// or rejecting those that do not.
+func (l *limitListener) acceptLoop() {
+	for {
+		c, err := l.Listener.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				l.closeOnce.Do(func() { close(l.closed) })
+				return
+			}
+			// other errors are passed on to Accept, whose caller is
+			// responsible for deciding whether to keep accepting
+			select {
+			case l.errs <- err:
+				continue
+			case <-l.closed:
+				return
+			}
+		}
+		select {
+		case l.slots <- struct{}{}:
+			l.handoff(c)
+		default:
+			go l.queue(c)
+		}
+	}
+}
+
+// queue waits up to queueTimeout for a slot for the given connection,
+// rejecting it if none becomes available.
+func (l *limitListener) queue(c net.Conn) {
+	if l.queueTimeout <= 0 {
+		l.reject(c)
+		return
+	}
+	timer := time.NewTimer(l.queueTimeout)
+	defer timer.Stop()
+	select {
+	case l.slots <- struct{}{}:
+		l.handoff(c)
+	case <-timer.C:
+		l.reject(c)
+	case <-l.closed:
+		c.Close()
+	}
+}
+
+// handoff passes a connection holding a slot on to Accept.
+func (l *limitListener) handoff(c net.Conn) {
+	lc := &limitConn{Conn: c, release: func() { <-l.slots }}
+	select {
+	case l.conns <- lc:
+	case <-l.closed:
+		lc.Close()
+	}
+}
+
+func (l *limitListener) reject(c net.Conn) {
+	defer c.Close()
+	if l.onReject != nil {
+		l.onReject(c)
+	}
+	if l.tls {
+		return
+	}
+	_ = c.SetWriteDeadline(time.Now().Add(connRejectedWriteTimeout))
+	_, _ = c.Write(connRejectedResponse)
+}
+
+// limitConn releases its slot in the limitListener exactly once, when closed.
+type limitConn struct {
+	net.Conn
+	once    sync.Once
+	release func()
+}
+
+// NetConn returns the underlying connection, so that handlers may reach the
+// TCP connection beneath, e.g. to reset it.
+func (c *limitConn) NetConn() net.Conn {
+	return c.Conn
+}
+
+func (c *limitConn) Close() error {
+	err := c.Conn.Close()
+	c.once.Do(c.release)
+	return err
+}
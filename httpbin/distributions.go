@@ -0,0 +1,173 @@
+package httpbin
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// delaySampler samples a delay from a latency distribution.
+type delaySampler func(rng *rand.Rand) time.Duration
+
+// delayDistributions maps the name of each latency distribution supported by
+// the /delay endpoint to a function that parses the distribution's parameters
+// from the query string.
+var delayDistributions = map[string]func(q url.Values, maxDuration time.Duration) (delaySampler, error){
+	"normal":      parseNormalDistribution,
+	"lognormal":   parseLognormalDistribution,
+	"exponential": parseExponentialDistribution,
+	"uniform":     parseUniformDistribution,
+	"percentiles": parsePercentilesDistribution,
+}
+
+// parseNormalDistribution parses a normal distribution with the given mean
+// and stddev.
+func parseNormalDistribution(q url.Values, maxDuration time.Duration) (delaySampler, error) {
+	mean, err := parseDistributionParam(q, "mean", maxDuration)
+	if err != nil {
+		return nil, err
+	}
+	stddev, err := parseDistributionParam(q, "stddev", maxDuration)
+	if err != nil {
+		return nil, err
+	}
+	return func(rng *rand.Rand) time.Duration {
+		return time.Duration(float64(mean) + rng.NormFloat64()*float64(stddev))
+	}, nil
+}
+
+// parseLognormalDistribution parses a log-normal distribution, the usual shape
+// of real-world latencies, whose samples have the given mean and stddev.
+func parseLognormalDistribution(q url.Values, maxDuration time.Duration) (delaySampler, error) {
+	mean, err := parseDistributionParam(q, "mean", maxDuration)
+	if err != nil {
+		return nil, err
+	}
+	if mean == 0 {
+		return nil, errors.New("invalid mean: must be greater than 0")
+	}
+	stddev, err := parseDistributionParam(q, "stddev", maxDuration)
+	if err != nil {
+		return nil, err
+	}
+
+	// derive the parameters of the underlying normal distribution from the
+	// desired mean and stddev of the log-normal distribution
+	m, s := mean.Seconds(), stddev.Seconds()
+	sigma := math.Sqrt(math.Log(1 + (s*s)/(m*m)))
+	mu := math.Log(m) - sigma*sigma/2
+	return func(rng *rand.Rand) time.Duration {
+		return time.Duration(math.Exp(mu+sigma*rng.NormFloat64()) * float64(time.Second))
+	}, nil
+}
+
+// parseExponentialDistribution parses an exponential distribution with the
+// given mean.
+func parseExponentialDistribution(q url.Values, maxDuration time.Duration) (delaySampler, error) {
+	mean, err := parseDistributionParam(q, "mean", maxDuration)
+	if err != nil {
+		return nil, err
+	}
+	return func(rng *rand.Rand) time.Duration {
+		return time.Duration(rng.ExpFloat64() * float64(mean))
+	}, nil
+}
+
+// parseUniformDistribution parses a uniform distribution between the given
+// min (defaults to 0) and max.
+func parseUniformDistribution(q url.Values, maxDuration time.Duration) (delaySampler, error) {
+	var (
+		minDelay time.Duration
+		err      error
+	)
+	if q.Get("min") != "" {
+		minDelay, err = parseDistributionParam(q, "min", maxDuration)
+		if err != nil {
+			return nil, err
+		}
+	}
+	maxDelay, err := parseDistributionParam(q, "max", maxDuration)
+	if err != nil {
+		return nil, err
+	}
+	if minDelay > maxDelay {
+		return nil, fmt.Errorf("invalid min: %s greater than max %s", minDelay, maxDelay)
+	}
+	return func(rng *rand.Rand) time.Duration {
+		return minDelay + time.Duration(rng.Float64()*float64(maxDelay-minDelay))
+	}, nil
+}
+
+// percentilePoint is a single point on an empirical latency distribution.
+type percentilePoint struct {
+	percentile float64
+	delay      time.Duration
+}
+
+// parsePercentilesDistribution parses an empirical distribution from any
+// number of pNN=duration params (e.g. p50=100ms&p99=2s), sampling delays by
+// interpolating linearly between the given percentiles, starting from a
+// delay of 0 at p0.
+func parsePercentilesDistribution(q url.Values, maxDuration time.Duration) (delaySampler, error) {
+	points := []percentilePoint{{0, 0}}
+	for key := range q {
+		rawPercentile, ok := strings.CutPrefix(key, "p")
+		if !ok {
+			continue
+		}
+		percentile, err := strconv.ParseFloat(rawPercentile, 64)
+		if err != nil || percentile <= 0 || percentile > 100 {
+			return nil, fmt.Errorf("invalid percentile %q: must be in range (0, 100]", key)
+		}
+		delay, err := parseDistributionParam(q, key, maxDuration)
+		if err != nil {
+			return nil, err
+		}
+		points = append(points, percentilePoint{percentile, delay})
+	}
+	if len(points) == 1 {
+		return nil, errors.New("at least one percentile (e.g. p50=100ms) is required")
+	}
+
+	slices.SortFunc(points, func(a, b percentilePoint) int {
+		return cmp.Compare(a.percentile, b.percentile)
+	})
+	for i := 1; i < len(points); i++ {
+		if points[i].delay < points[i-1].delay {
+			return nil, fmt.Errorf("invalid percentiles: p%g delay %s less than p%g delay %s", points[i].percentile, points[i].delay, points[i-1].percentile, points[i-1].delay)
+		}
+	}
+
+	return func(rng *rand.Rand) time.Duration {
+		p := rng.Float64() * 100
+		for i := 1; i < len(points); i++ {
+			lo, hi := points[i-1], points[i]
+			if p < hi.percentile {
+				frac := (p - lo.percentile) / (hi.percentile - lo.percentile)
+				return lo.delay + time.Duration(frac*float64(hi.delay-lo.delay))
+			}
+		}
+		return points[len(points)-1].delay
+	}, nil
+}
+
+// parseDistributionParam parses a required duration parameter of a latency
+// distribution, bounded by maxDuration.
+func parseDistributionParam(q url.Values, name string, maxDuration time.Duration) (time.Duration, error) {
+	rawVal := q.Get(name)
+	if rawVal == "" {
+		return 0, fmt.Errorf("missing required %s parameter", name)
+	}
+	d, err := parseBoundedDuration(rawVal, 0, maxDuration)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s: %w", name, err)
+	}
+	return d, nil
+}
@@ -0,0 +1,92 @@
+package httpbin
+
+import (
+	"math/rand"
+	"net/url"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/mccutchen/go-httpbin/v2/internal/testing/assert"
+)
+
+func TestDelayDistributions(t *testing.T) {
+	t.Parallel()
+
+	const numSamples = 10000
+
+	// sampleDistribution draws sorted samples from the named distribution,
+	// for checking its shape via its mean and percentiles.
+	sampleDistribution := func(t *testing.T, name, rawQuery string) []time.Duration {
+		t.Helper()
+		q, err := url.ParseQuery(rawQuery)
+		assert.NilError(t, err)
+		sample, err := delayDistributions[name](q, time.Minute)
+		assert.NilError(t, err)
+
+		rng := rand.New(rand.NewSource(1234))
+		samples := make([]time.Duration, numSamples)
+		for i := range samples {
+			samples[i] = sample(rng)
+		}
+		slices.Sort(samples)
+		return samples
+	}
+
+	mean := func(samples []time.Duration) time.Duration {
+		var total time.Duration
+		for _, s := range samples {
+			total += s
+		}
+		return total / time.Duration(len(samples))
+	}
+
+	percentile := func(samples []time.Duration, p float64) time.Duration {
+		return samples[int(p/100*float64(len(samples)))]
+	}
+
+	// assertWithin asserts that got is within 10% of want
+	assertWithin := func(t *testing.T, got, want time.Duration, msg string) {
+		t.Helper()
+		if diff := got - want; diff < -want/10 || diff > want/10 {
+			t.Fatalf("%s: expected ~%s, got %s", msg, want, got)
+		}
+	}
+
+	t.Run("normal", func(t *testing.T) {
+		t.Parallel()
+		samples := sampleDistribution(t, "normal", "mean=200ms&stddev=50ms")
+		assertWithin(t, mean(samples), 200*time.Millisecond, "mean")
+		assertWithin(t, percentile(samples, 84), 250*time.Millisecond, "p84")
+	})
+
+	t.Run("lognormal", func(t *testing.T) {
+		t.Parallel()
+		samples := sampleDistribution(t, "lognormal", "mean=200ms&stddev=100ms")
+		assertWithin(t, mean(samples), 200*time.Millisecond, "mean")
+		assert.Equal(t, samples[0] > 0, true, "expected only positive samples")
+		assert.Equal(t, percentile(samples, 50) < mean(samples), true, "expected median below mean")
+	})
+
+	t.Run("exponential", func(t *testing.T) {
+		t.Parallel()
+		samples := sampleDistribution(t, "exponential", "mean=200ms")
+		assertWithin(t, mean(samples), 200*time.Millisecond, "mean")
+	})
+
+	t.Run("uniform", func(t *testing.T) {
+		t.Parallel()
+		samples := sampleDistribution(t, "uniform", "min=100ms&max=300ms")
+		assertWithin(t, mean(samples), 200*time.Millisecond, "mean")
+		assert.Equal(t, samples[0] >= 100*time.Millisecond, true, "expected min sample >= min")
+		assert.Equal(t, samples[len(samples)-1] <= 300*time.Millisecond, true, "expected max sample <= max")
+	})
+
+	t.Run("percentiles", func(t *testing.T) {
+		t.Parallel()
+		samples := sampleDistribution(t, "percentiles", "p50=100ms&p90=500ms&p99=2s")
+		assertWithin(t, percentile(samples, 50), 100*time.Millisecond, "p50")
+		assertWithin(t, percentile(samples, 90), 500*time.Millisecond, "p90")
+		assert.Equal(t, samples[len(samples)-1], 2*time.Second, "expected max sample to be p99")
+	})
+}
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"compress/gzip"
 	"compress/zlib"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -13,6 +14,7 @@ import (
 	"net/http"
 	"net/http/httputil"
 	"net/url"
+	"slices"
 	"strconv"
 	"strings"
 	"time"
@@ -195,6 +197,10 @@ func (h *HTTPBin) Headers(w http.ResponseWriter, r *http.Request) {
 type statusCase struct {
 	headers map[string]string
 	body    []byte
+
+	// retryAfter indicates that a Retry-After header may be included in the
+	// response, if requested
+	retryAfter bool
 }
 
 func createSpecialCases(prefix string) map[int]*statusCase {
@@ -202,6 +208,7 @@ func createSpecialCases(prefix string) map[int]*statusCase {
 		headers: map[string]string{
 			"Location": prefix + "/redirect/1",
 		},
+		retryAfter: true,
 	}
 	statusNotAcceptableBody := []byte(`{
   "message": "Client did not request a supported media type",
@@ -240,6 +247,7 @@ func createSpecialCases(prefix string) map[int]*statusCase {
 			headers: map[string]string{
 				"Location": prefix + "/image/jpeg",
 			},
+			retryAfter: true,
 		},
 		301: statusRedirectHeaders,
 		302: statusRedirectHeaders,
@@ -251,6 +259,7 @@ func createSpecialCases(prefix string) map[int]*statusCase {
 			headers: map[string]string{
 				"Location": prefix + "/image/jpeg",
 			},
+			retryAfter: true,
 		},
 		401: {
 			headers: map[string]string{
@@ -274,20 +283,42 @@ func createSpecialCases(prefix string) map[int]*statusCase {
 				"Proxy-Authenticate": `Basic realm="Fake Realm"`,
 			},
 		},
+		413: {
+			retryAfter: true,
+		},
 		418: {
 			body: []byte("I'm a teapot!"),
 			headers: map[string]string{
 				"X-More-Info": "http://tools.ietf.org/html/rfc2324",
 			},
 		},
+		429: {
+			retryAfter: true,
+		},
+		503: {
+			retryAfter: true,
+		},
 	}
 }
 
 // Status responds with the specified status code. TODO: support random choice
 // from multiple, optionally weighted status codes.
+//
+// If a retry_after param is given, it is sent as a Retry-After header along
+// with any 3xx, 413, 429 or 503 response.
 func (h *HTTPBin) Status(w http.ResponseWriter, r *http.Request) {
 	rawStatus := r.PathValue("code")
 
+	var retryAfter string
+	if userRetryAfter := r.URL.Query().Get("retry_after"); userRetryAfter != "" {
+		var err error
+		retryAfter, err = parseRetryAfter(userRetryAfter, h.MaxDuration)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("invalid retry_after: %w", err))
+			return
+		}
+	}
+
 	// simple case, specific status code is requested
 	if !strings.Contains(rawStatus, ",") {
 		code, err := parseStatusCode(rawStatus)
@@ -295,7 +326,7 @@ func (h *HTTPBin) Status(w http.ResponseWriter, r *http.Request) {
 			writeError(w, http.StatusBadRequest, err)
 			return
 		}
-		h.doStatus(w, code)
+		h.doStatus(w, code, retryAfter)
 		return
 	}
 
@@ -306,10 +337,12 @@ func (h *HTTPBin) Status(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	choice := weightedRandomChoice(choices, rand.Float64)
-	h.doStatus(w, choice)
+	h.doStatus(w, choice, retryAfter)
 }
 
-func (h *HTTPBin) doStatus(w http.ResponseWriter, code int) {
+// doStatus writes a response with the given status code, including the
+// Retry-After header if one is given and the status code supports it.
+func (h *HTTPBin) doStatus(w http.ResponseWriter, code int, retryAfter string) {
 	// default to plain text content type, which may be overriden by headers
 	// for special cases
 	w.Header().Set("Content-Type", textContentType)
@@ -317,6 +350,9 @@ func (h *HTTPBin) doStatus(w http.ResponseWriter, code int) {
 		for key, val := range specialCase.headers {
 			w.Header().Set(key, val)
 		}
+		if specialCase.retryAfter && retryAfter != "" {
+			w.Header().Set("Retry-After", retryAfter)
+		}
 		w.WriteHeader(code)
 		if specialCase.body != nil {
 			w.Write(specialCase.body)
@@ -326,6 +362,129 @@ func (h *HTTPBin) doStatus(w http.ResponseWriter, code int) {
 	w.WriteHeader(code)
 }
 
+// Chaos responds with an outcome chosen at random from a weighted list of
+// status codes and connection faults, each with an optional delay, e.g.
+// /chaos/200@50ms:0.8,500@2s:0.15,reset:0.05. An optional seed param makes
+// the choice reproducible.
+func (h *HTTPBin) Chaos(w http.ResponseWriter, r *http.Request) {
+	choices, err := parseWeightedChoices(r.PathValue("outcomes"), parseChaosOutcome(h.MaxDuration))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	var totalWeight float64
+	for _, choice := range choices {
+		if choice.Weight < 0 {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("invalid weight value: %v must not be negative", choice.Weight))
+			return
+		}
+		totalWeight += choice.Weight
+	}
+	if totalWeight == 0 {
+		writeError(w, http.StatusBadRequest, errors.New("invalid weights: at least one weight must be greater than 0"))
+		return
+	}
+
+	rng, err := parseSeed(r.URL.Query().Get("seed"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid seed: %w", err))
+		return
+	}
+	outcome := weightedRandomChoice(choices, rng.Float64)
+
+	select {
+	case <-r.Context().Done():
+		w.WriteHeader(499) // "Client Closed Request" https://httpstatuses.com/499
+		return
+	case <-time.After(outcome.delay):
+	}
+
+	if outcome.fault != "" {
+		// the hang fault must not hold the connection beyond MaxDuration in
+		// total, including the outcome's delay
+		chaosFaults[outcome.fault](w, h.MaxDuration-outcome.delay)
+		return
+	}
+	w.Header().Set("X-Chaos-Outcome", outcome.spec)
+	w.Header().Set("Server-Timing", encodeServerTimings([]serverTiming{
+		{"initial_delay", outcome.delay, "chaos outcome " + outcome.spec},
+	}))
+	h.doStatus(w, outcome.status, "")
+}
+
+// ChaosMode returns the current server-wide chaos mode settings.
+func (h *HTTPBin) ChaosMode(w http.ResponseWriter, _ *http.Request) {
+	c := h.chaos.get()
+	resp := chaosResponse{
+		ErrorRate: c.ErrorRate,
+		Latency:   c.Latency.String(),
+		Routes:    c.Routes,
+		Overrides: make(map[string]chaosSettingsResponse, len(c.Overrides)),
+		Seed:      c.Seed,
+	}
+	if resp.Routes == nil {
+		resp.Routes = []string{}
+	}
+	for pattern, settings := range c.Overrides {
+		resp.Overrides[pattern] = chaosSettingsResponse{
+			ErrorRate: settings.ErrorRate,
+			Latency:   settings.Latency.String(),
+		}
+	}
+	writeJSON(http.StatusOK, w, resp)
+}
+
+// SetChaosMode replaces the server-wide chaos mode settings with those given
+// in the JSON request body, in the format returned by ChaosMode. The random
+// number generator is only reseeded if a non-zero seed is given.
+func (h *HTTPBin) SetChaosMode(w http.ResponseWriter, r *http.Request) {
+	var req chaosResponse
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid request body: %w", err))
+		return
+	}
+
+	parseLatency := func(raw string) (time.Duration, error) {
+		if raw == "" {
+			return 0, nil
+		}
+		d, err := parseDuration(raw)
+		if err != nil {
+			return 0, fmt.Errorf("invalid latency %q", raw)
+		}
+		return d, nil
+	}
+
+	latency, err := parseLatency(req.Latency)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	c := Chaos{
+		ChaosSettings: ChaosSettings{ErrorRate: req.ErrorRate, Latency: latency},
+		Routes:        req.Routes,
+		Seed:          req.Seed,
+	}
+	if len(req.Overrides) > 0 {
+		c.Overrides = make(map[string]ChaosSettings, len(req.Overrides))
+	}
+	for pattern, override := range req.Overrides {
+		latency, err := parseLatency(override.Latency)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("invalid override for route %q: %w", pattern, err))
+			return
+		}
+		c.Overrides[pattern] = ChaosSettings{ErrorRate: override.ErrorRate, Latency: latency}
+	}
+	if err := c.validate(h.MaxDuration); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	h.chaos.set(c)
+	h.ChaosMode(w, r)
+}
+
 // Unstable - returns 500, sometimes
 func (h *HTTPBin) Unstable(w http.ResponseWriter, r *http.Request) {
 	var err error
@@ -350,15 +509,289 @@ func (h *HTTPBin) Unstable(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	// retry_after
+	var retryAfter string
+	if rawRetryAfter := r.URL.Query().Get("retry_after"); rawRetryAfter != "" {
+		retryAfter, err = parseRetryAfter(rawRetryAfter, h.MaxDuration)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("invalid retry_after: %w", err))
+			return
+		}
+	}
+
 	status := http.StatusOK
 	if rng.Float64() < failureRate {
 		status = http.StatusInternalServerError
+		if retryAfter != "" {
+			w.Header().Set("Retry-After", retryAfter)
+		}
 	}
 
 	w.Header().Set("Content-Type", textContentType)
 	w.WriteHeader(status)
 }
 
+// rateLimitDialects are the families of rate limit headers that may be
+// requested from the /rate-limit endpoint via the dialect query param.
+var rateLimitDialects = map[string]bool{
+	"x-ratelimit": true,
+	"ietf":        true,
+	"github":      true,
+}
+
+// RateLimited simulates a rate limited API, allowing at most limit requests
+// for each key in a fixed window and responding with a 429 and a Retry-After
+// header once the key's quota is exhausted.
+//
+// Accepts optional query parameters:
+//   - limit: number of requests allowed per window (default 10)
+//   - window: duration of each window (default 1m, max 1h)
+//   - dialect: comma-separated families of rate limit headers to include in
+//     the response, any of x-ratelimit, ietf, or github (default
+//     x-ratelimit,ietf)
+func (h *HTTPBin) RateLimited(w http.ResponseWriter, r *http.Request) {
+	var (
+		key      = r.PathValue("key")
+		q        = r.URL.Query()
+		limit    = 10
+		window   = time.Minute
+		dialects = []string{"x-ratelimit", "ietf"}
+		err      error
+	)
+
+	if userLimit := q.Get("limit"); userLimit != "" {
+		limit, err = strconv.Atoi(userLimit)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("invalid limit: %w", err))
+			return
+		} else if limit < 1 || limit > maxRateLimitQuota {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("invalid limit: %d not in range [1, %d]", limit, maxRateLimitQuota))
+			return
+		}
+	}
+
+	if userWindow := q.Get("window"); userWindow != "" {
+		window, err = parseBoundedDuration(userWindow, time.Second, maxRateLimitWindow)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("invalid window: %w", err))
+			return
+		}
+	}
+
+	if userDialects := q.Get("dialect"); userDialects != "" {
+		dialects = strings.Split(strings.ToLower(userDialects), ",")
+		for _, dialect := range dialects {
+			if !rateLimitDialects[dialect] {
+				writeError(w, http.StatusBadRequest, fmt.Errorf("invalid dialect: %q must be one of x-ratelimit, ietf, or github", dialect))
+				return
+			}
+		}
+		if slices.Contains(dialects, "x-ratelimit") && slices.Contains(dialects, "github") {
+			writeError(w, http.StatusBadRequest, errors.New("invalid dialect: x-ratelimit and github dialects cannot be combined"))
+			return
+		}
+	}
+
+	now := time.Now()
+	d, err := h.quotas.hit(key, limit, window, now)
+	if err != nil {
+		writeError(w, http.StatusServiceUnavailable, err)
+		return
+	}
+
+	resetSeconds := ceilSeconds(d.reset.Sub(now))
+	for _, dialect := range dialects {
+		switch dialect {
+		case "x-ratelimit":
+			w.Header().Set("X-RateLimit-Limit", strconv.Itoa(limit))
+			w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(d.remaining))
+			w.Header().Set("X-RateLimit-Reset", strconv.FormatInt(resetSeconds, 10))
+		case "ietf":
+			w.Header().Set("RateLimit-Policy", fmt.Sprintf(`"default";q=%d;w=%d`, limit, ceilSeconds(window)))
+			w.Header().Set("RateLimit", fmt.Sprintf(`"default";r=%d;t=%d`, d.remaining, resetSeconds))
+		case "github":
+			w.Header().Set("X-RateLimit-Limit", strconv.Itoa(limit))
+			w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(d.remaining))
+			w.Header().Set("X-RateLimit-Used", strconv.Itoa(d.used))
+			w.Header().Set("X-RateLimit-Reset", strconv.FormatInt(d.reset.Unix(), 10))
+			w.Header().Set("X-RateLimit-Resource", key)
+		}
+	}
+
+	status := http.StatusOK
+	if !d.allowed {
+		status = http.StatusTooManyRequests
+		w.Header().Set("Retry-After", strconv.FormatInt(resetSeconds, 10))
+	}
+	writeJSON(status, w, rateLimitResponse{
+		Key:       key,
+		Limit:     limit,
+		Remaining: d.remaining,
+		Used:      d.used,
+		Reset:     resetSeconds,
+	})
+}
+
+// Scenario responds with the next status code in a scripted sequence, where
+// each request for the same id advances through the sequence, so that retry
+// logic can be tested deterministically.
+func (h *HTTPBin) Scenario(w http.ResponseWriter, r *http.Request) {
+	var (
+		id       = r.PathValue("id")
+		q        = r.URL.Query()
+		sequence []int
+		ttl      = defaultScenarioTTL
+		err      error
+	)
+
+	if userSequence := q.Get("sequence"); userSequence != "" {
+		rawCodes := strings.Split(userSequence, ",")
+		if len(rawCodes) > maxScenarioSequenceLen {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("invalid sequence: more than %d status codes", maxScenarioSequenceLen))
+			return
+		}
+		sequence = make([]int, 0, len(rawCodes))
+		for _, rawCode := range rawCodes {
+			code, err := parseStatusCode(strings.TrimSpace(rawCode))
+			if err != nil {
+				writeError(w, http.StatusBadRequest, fmt.Errorf("invalid sequence: %w", err))
+				return
+			}
+			sequence = append(sequence, code)
+		}
+	}
+
+	if userTTL := q.Get("ttl"); userTTL != "" {
+		ttl, err = parseBoundedDuration(userTTL, time.Second, maxScenarioTTL)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("invalid ttl: %w", err))
+			return
+		}
+	}
+
+	step, err := h.scenarios.advance(id, sequence, ttl, time.Now())
+	switch {
+	case errors.Is(err, errScenarioNotFound):
+		writeError(w, http.StatusBadRequest, fmt.Errorf("missing sequence: scenario %q has not been started", id))
+		return
+	case err != nil:
+		writeError(w, http.StatusServiceUnavailable, err)
+		return
+	}
+
+	w.Header().Set("X-Scenario-Attempt", strconv.Itoa(step.attempt))
+	h.doStatus(w, step.status, "")
+}
+
+// ScenarioState returns the progress of the scenario with the given id,
+// including the time of each attempt.
+func (h *HTTPBin) ScenarioState(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	sc, found := h.scenarios.get(id, time.Now())
+	if !found {
+		writeError(w, http.StatusNotFound, fmt.Errorf("scenario %q not found", id))
+		return
+	}
+	writeJSON(http.StatusOK, w, scenarioResponse{
+		ID:           id,
+		Sequence:     sc.sequence,
+		Attempts:     sc.attempts,
+		NextStatus:   sc.sequence[min(sc.attempts, len(sc.sequence)-1)],
+		AttemptTimes: sc.attemptTimes,
+		Expires:      sc.expires,
+	})
+}
+
+// ScenarioReset forgets the scenario with the given id, so that the next
+// request starts its sequence from the beginning.
+func (h *HTTPBin) ScenarioReset(w http.ResponseWriter, r *http.Request) {
+	h.scenarios.reset(r.PathValue("id"), time.Now())
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// CreateBin creates a new request bin, whose URL captures every request made
+// to it for later inspection via its requests URL. Bins expire after an
+// optional ttl (default 1h, max 24h).
+func (h *HTTPBin) CreateBin(w http.ResponseWriter, r *http.Request) {
+	ttl := defaultBinTTL
+	if userTTL := r.URL.Query().Get("ttl"); userTTL != "" {
+		var err error
+		ttl, err = parseBoundedDuration(userTTL, time.Second, maxBinTTL)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("invalid ttl: %w", err))
+			return
+		}
+	}
+
+	id := uuidv4()
+	expires, err := h.bins.create(id, ttl, time.Now())
+	if err != nil {
+		writeError(w, http.StatusServiceUnavailable, err)
+		return
+	}
+
+	u := getURL(r)
+	binURL := &url.URL{Scheme: u.Scheme, Host: u.Host, Path: h.prefix + "/bins/" + id}
+	w.Header().Set("Location", binURL.Path)
+	writeJSON(http.StatusCreated, w, binResponse{
+		ID:          id,
+		URL:         binURL.String(),
+		RequestsURL: binURL.String() + "/requests",
+		Expires:     expires,
+	})
+}
+
+// BinCapture captures the incoming request, including its body, in the bin
+// with the given id and echoes the captured request back to the client.
+func (h *HTTPBin) BinCapture(w http.ResponseWriter, r *http.Request) {
+	req, err := h.captureRequest(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("error reading request body: %w", err))
+		return
+	}
+	id := r.PathValue("id")
+	req, err = h.bins.record(id, req, h.MaxBodySize, time.Now())
+	if err != nil {
+		writeError(w, http.StatusNotFound, fmt.Errorf("bin %q not found", id))
+		return
+	}
+	writeJSON(http.StatusOK, w, req)
+}
+
+// BinRequests lists the requests captured by the bin with the given id, oldest
+// first.
+func (h *HTTPBin) BinRequests(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	requests, found := h.bins.list(id, time.Now())
+	if !found {
+		writeError(w, http.StatusNotFound, fmt.Errorf("bin %q not found", id))
+		return
+	}
+	writeJSON(http.StatusOK, w, binRequestsResponse{Requests: requests})
+}
+
+// BinRequest returns a single request captured by the bin with the given id.
+func (h *HTTPBin) BinRequest(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	requests, found := h.bins.list(id, time.Now())
+	if !found {
+		writeError(w, http.StatusNotFound, fmt.Errorf("bin %q not found", id))
+		return
+	}
+	requestID, err := strconv.Atoi(r.PathValue("requestID"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid request id: %w", err))
+		return
+	}
+	for _, req := range requests {
+		if req.ID == requestID {
+			writeJSON(http.StatusOK, w, req)
+			return
+		}
+	}
+	writeError(w, http.StatusNotFound, fmt.Errorf("request %d not found in bin %q", requestID, id))
+}
+
 // ResponseHeaders sets every incoming query parameter as a response header and
 // returns the headers serialized as JSON.
 //
@@ -531,6 +964,144 @@ func (h *HTTPBin) DeleteCookies(w http.ResponseWriter, r *http.Request) {
 	h.doRedirect(w, "/cookies", http.StatusFound)
 }
 
+// SessionLoginForm renders an HTML login form that submits to /session/login,
+// carrying a CSRF token that must be submitted along with the CSRF cookie set
+// by this endpoint. The token is also returned in the X-CSRF-Token header for
+// the benefit of non-browser clients.
+//
+// An optional max_age query param controls the expiry of the session created
+// when the form is submitted.
+func (h *HTTPBin) SessionLoginForm(w http.ResponseWriter, r *http.Request) {
+	action := "/session/login"
+	if rawMaxAge := r.URL.Query().Get("max_age"); rawMaxAge != "" {
+		if _, err := parseBoundedDuration(rawMaxAge, time.Second, maxSessionMaxAge); err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("invalid max_age: %w", err))
+			return
+		}
+		action += "?" + url.Values{"max_age": {rawMaxAge}}.Encode()
+	}
+
+	token := randomToken()
+	http.SetCookie(w, &http.Cookie{
+		Name:     csrfCookieName,
+		Value:    token,
+		Path:     "/",
+		HttpOnly: true,
+		Secure:   isHTTPS(r),
+		SameSite: http.SameSiteStrictMode,
+	})
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set(csrfHeader, token)
+	writeHTML(w, mustRenderTemplate("forms-post.html.tmpl", formsPostData{
+		Prefix:    h.prefix,
+		Action:    action,
+		CSRFToken: token,
+	}), http.StatusOK)
+}
+
+// SessionLogin creates a new session and sets a signed, HttpOnly session
+// cookie before redirecting to /session/me.
+//
+// Requests must include the CSRF token issued by SessionLoginForm, either as
+// a csrf_token form field or an X-CSRF-Token header. The session's user is
+// taken from the username form field, falling back to the custname field of
+// the rendered login form.
+func (h *HTTPBin) SessionLogin(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("error parsing request body: %w", err))
+		return
+	}
+	if !validCSRFToken(r) {
+		writeError(w, http.StatusForbidden, errors.New("missing or invalid CSRF token"))
+		return
+	}
+
+	user := r.PostForm.Get("username")
+	if user == "" {
+		user = r.PostForm.Get("custname")
+	}
+	if user == "" {
+		writeError(w, http.StatusBadRequest, errors.New("missing required form field: username"))
+		return
+	}
+
+	maxAge := defaultSessionMaxAge
+	if rawMaxAge := r.Form.Get("max_age"); rawMaxAge != "" {
+		var err error
+		maxAge, err = parseBoundedDuration(rawMaxAge, time.Second, maxSessionMaxAge)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("invalid max_age: %w", err))
+			return
+		}
+	}
+
+	sess, cookieValue, err := h.sessions.create(user, maxAge)
+	if err != nil {
+		writeError(w, http.StatusServiceUnavailable, err)
+		return
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookieName,
+		Value:    cookieValue,
+		Path:     "/",
+		Expires:  sess.Expires,
+		MaxAge:   int(maxAge.Seconds()),
+		HttpOnly: true,
+		Secure:   isHTTPS(r),
+		SameSite: http.SameSiteLaxMode,
+	})
+	h.doRedirect(w, "/session/me", http.StatusSeeOther)
+}
+
+// SessionMe responds with the details of the current session, or a 401 if
+// the session cookie is missing, expired, revoked, or has been tampered with.
+func (h *HTTPBin) SessionMe(w http.ResponseWriter, r *http.Request) {
+	sess, err := h.sessionFromRequest(r)
+	if err != nil {
+		writeError(w, http.StatusUnauthorized, err)
+		return
+	}
+	writeJSON(http.StatusOK, w, sessionResponse{
+		Authenticated: true,
+		User:          sess.User,
+		Created:       sess.Created,
+		Expires:       sess.Expires,
+	})
+}
+
+// SessionLogout revokes the current session, if any, and clears the session
+// cookie. Like SessionLogin, it requires a valid CSRF token.
+func (h *HTTPBin) SessionLogout(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("error parsing request body: %w", err))
+		return
+	}
+	if !validCSRFToken(r) {
+		writeError(w, http.StatusForbidden, errors.New("missing or invalid CSRF token"))
+		return
+	}
+	if sess, err := h.sessionFromRequest(r); err == nil {
+		h.sessions.delete(sess.ID)
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookieName,
+		Path:     "/",
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   isHTTPS(r),
+		SameSite: http.SameSiteLaxMode,
+	})
+	writeJSON(http.StatusOK, w, sessionResponse{})
+}
+
+func (h *HTTPBin) sessionFromRequest(r *http.Request) (*session, error) {
+	c, err := r.Cookie(sessionCookieName)
+	if err != nil {
+		return nil, errSessionMissing
+	}
+	return h.sessions.lookup(c.Value)
+}
+
 // BasicAuth requires basic authentication
 func (h *HTTPBin) BasicAuth(w http.ResponseWriter, r *http.Request) {
 	expectedUser := r.PathValue("user")
@@ -573,25 +1144,102 @@ func (h *HTTPBin) HiddenBasicAuth(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
-// Stream responds with max(n, 100) lines of JSON-encoded request data.
-func (h *HTTPBin) Stream(w http.ResponseWriter, r *http.Request) {
-	n, err := strconv.Atoi(r.PathValue("numLines"))
-	if err != nil {
-		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid count: %w", err))
+// defaultAPIKeyNames maps each location where the /api-key endpoints may look
+// for an API key to the default name of the key in that location.
+var defaultAPIKeyNames = map[string]string{
+	"header": "X-API-Key",
+	"query":  "api_key",
+	"cookie": "api_key",
+}
+
+// APIKey requires an API key matching the one given in the path or, if no key
+// is given in the path, the one configured on the server. The key is read from
+// the X-API-Key header by default; the in and name query params may be used
+// to read it from a different header, a query param, or a cookie instead.
+//
+// Requests that do not include a key get a 401, requests that include the
+// wrong key get a 403.
+//
+// /api-key
+// /api-key/<key>
+func (h *HTTPBin) APIKey(w http.ResponseWriter, r *http.Request) {
+	h.handleAPIKey(w, r, false)
+}
+
+// HiddenAPIKey requires an API key, like APIKey, but returns a status of 404
+// if the request is unauthorized
+func (h *HTTPBin) HiddenAPIKey(w http.ResponseWriter, r *http.Request) {
+	h.handleAPIKey(w, r, true)
+}
+
+// handleAPIKey consolidates the logic for the APIKey and HiddenAPIKey
+// endpoints.
+func (h *HTTPBin) handleAPIKey(w http.ResponseWriter, r *http.Request, hidden bool) {
+	expectedKey := r.PathValue("key")
+	if expectedKey == "" {
+		expectedKey = h.apiKey
+	}
+	if expectedKey == "" {
+		writeError(w, http.StatusNotImplemented, errors.New("no API key configured"))
 		return
 	}
 
-	if n > 100 {
-		n = 100
-	} else if n < 1 {
-		n = 1
+	q := r.URL.Query()
+	in := strings.ToLower(q.Get("in"))
+	if in == "" {
+		in = "header"
+	}
+	name, ok := defaultAPIKeyNames[in]
+	if !ok {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid in: %q must be one of header, query, or cookie", in))
+		return
+	}
+	if userName := q.Get("name"); userName != "" {
+		name = userName
 	}
 
-	resp := &streamResponse{
-		Args:    r.URL.Query(),
-		Headers: getRequestHeaders(r, h.excludeHeadersProcessor),
-		Origin:  getClientIP(r),
-		URL:     getURL(r).String(),
+	givenKey, found := getAPIKey(r, in, name)
+	authorized := found && givenKey == expectedKey
+	if hidden && !authorized {
+		writeError(w, http.StatusNotFound, nil)
+		return
+	}
+
+	status := http.StatusOK
+	if !found {
+		status = http.StatusUnauthorized
+		w.Header().Set("WWW-Authenticate", fmt.Sprintf(`APIKey realm="Fake Realm", in="%s", name="%s"`, in, name))
+	} else if !authorized {
+		status = http.StatusForbidden
+	}
+
+	writeJSON(status, w, apiKeyResponse{
+		Authenticated: authorized,
+		Key:           givenKey,
+		In:            in,
+		Name:          name,
+	})
+}
+
+// Stream responds with max(n, 100) lines of JSON-encoded request data.
+func (h *HTTPBin) Stream(w http.ResponseWriter, r *http.Request) {
+	n, err := strconv.Atoi(r.PathValue("numLines"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid count: %w", err))
+		return
+	}
+
+	if n > 100 {
+		n = 100
+	} else if n < 1 {
+		n = 1
+	}
+
+	resp := &streamResponse{
+		Args:    r.URL.Query(),
+		Headers: getRequestHeaders(r, h.excludeHeadersProcessor),
+		Origin:  getClientIP(r),
+		URL:     getURL(r).String(),
 	}
 
 	f := w.(http.Flusher)
@@ -648,14 +1296,44 @@ func (h *HTTPBin) Trailers(w http.ResponseWriter, r *http.Request) {
 }
 
 // Delay waits for a given amount of time before responding, where the time may
-// be specified as a golang-style duration or seconds in floating point.
+// be specified as a golang-style duration or seconds in floating point, or
+// sampled from one of the latency distributions in delayDistributions.
 func (h *HTTPBin) Delay(w http.ResponseWriter, r *http.Request) {
-	delay, err := parseBoundedDuration(r.PathValue("duration"), 0, h.MaxDuration)
+	rawDuration := r.PathValue("duration")
+	if parseDistribution, ok := delayDistributions[rawDuration]; ok {
+		h.delayDistribution(w, r, rawDuration, parseDistribution)
+		return
+	}
+
+	delay, err := parseBoundedDuration(rawDuration, 0, h.MaxDuration)
 	if err != nil {
 		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid duration: %w", err))
 		return
 	}
+	h.doDelay(w, r, delay, "initial delay")
+}
+
+// delayDistribution delays responding for a duration sampled from the named
+// latency distribution, whose parameters are given in the query string.
+func (h *HTTPBin) delayDistribution(w http.ResponseWriter, r *http.Request, name string, parseDistribution func(url.Values, time.Duration) (delaySampler, error)) {
+	q := r.URL.Query()
+	sample, err := parseDistribution(q, h.MaxDuration)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid %s distribution: %w", name, err))
+		return
+	}
+	rng, err := parseSeed(q.Get("seed"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid seed: %w", err))
+		return
+	}
+	delay := min(max(sample(rng), 0), h.MaxDuration)
+	h.doDelay(w, r, delay, "sampled from "+name+" distribution")
+}
 
+// doDelay waits for the given delay before responding with the request data,
+// reporting the delay in the Server-Timing header.
+func (h *HTTPBin) doDelay(w http.ResponseWriter, r *http.Request, delay time.Duration, desc string) {
 	select {
 	case <-r.Context().Done():
 		w.WriteHeader(499) // "Client Closed Request" https://httpstatuses.com/499
@@ -663,7 +1341,7 @@ func (h *HTTPBin) Delay(w http.ResponseWriter, r *http.Request) {
 	case <-time.After(delay):
 	}
 	w.Header().Set("Server-Timing", encodeServerTimings([]serverTiming{
-		{"initial_delay", delay, "initial delay"},
+		{"initial_delay", delay, desc},
 	}))
 	h.RequestWithBody(w, r)
 }
@@ -729,6 +1407,25 @@ func (h *HTTPBin) Drip(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Optionally trickle out the status line and headers, spending whatever
+	// time remains after the delay and duration at most
+	var headerDelay time.Duration
+	if userHeaderDelay := q.Get("header_delay"); userHeaderDelay != "" {
+		headerDelay, err = parseBoundedDuration(userHeaderDelay, 0, h.MaxDuration)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("invalid header_delay: %w", err))
+			return
+		}
+	}
+	if headerDelay > 0 {
+		sw, ok := newSlowHeadersWriter(w, r, headerDelay, h.MaxDuration-duration-delay, h.MaxDuration)
+		if !ok {
+			return
+		}
+		defer sw.Close()
+		w = sw
+	}
+
 	pause := computePausePerWrite(duration, numBytes)
 
 	// Initial delay before we send any response data
@@ -744,12 +1441,16 @@ func (h *HTTPBin) Drip(w http.ResponseWriter, r *http.Request) {
 
 	w.Header().Set("Content-Type", textContentType)
 	w.Header().Set("Content-Length", fmt.Sprintf("%d", numBytes))
-	w.Header().Set("Server-Timing", encodeServerTimings([]serverTiming{
+	timings := []serverTiming{
 		{"total_duration", delay + duration, "total request duration"},
 		{"initial_delay", delay, "initial delay"},
 		{"write_duration", duration, "duration of writes after initial delay"},
 		{"pause_per_write", pause, "computed pause between writes"},
-	}))
+	}
+	if headerDelay > 0 {
+		timings = append(timings, serverTiming{"header_delay", headerDelay, "pause between header lines"})
+	}
+	w.Header().Set("Server-Timing", encodeServerTimings(timings))
 	w.WriteHeader(code)
 
 	// what we write with each increment of the ticker
@@ -784,6 +1485,66 @@ func (h *HTTPBin) Drip(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// SlowHeaders responds like /get, but only after stalling before the status
+// line and pausing between each header line, to simulate a server that is
+// slow to send its response headers.
+func (h *HTTPBin) SlowHeaders(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+
+	var (
+		delay       time.Duration
+		headerDelay = 100 * time.Millisecond
+		count       = 5
+		err         error
+	)
+
+	if userDelay := q.Get("delay"); userDelay != "" {
+		delay, err = parseBoundedDuration(userDelay, 0, h.MaxDuration)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("invalid delay: %w", err))
+			return
+		}
+	}
+
+	if userHeaderDelay := q.Get("header_delay"); userHeaderDelay != "" {
+		headerDelay, err = parseBoundedDuration(userHeaderDelay, 0, h.MaxDuration)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("invalid header_delay: %w", err))
+			return
+		}
+	}
+
+	if userCount := q.Get("count"); userCount != "" {
+		count, err = strconv.Atoi(userCount)
+		if err != nil || count < 0 || count > maxSlowHeadersCount {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("invalid count: must be an integer in range [0, %d]", maxSlowHeadersCount))
+			return
+		}
+	}
+
+	// Initial delay before we send the status line
+	if delay > 0 {
+		select {
+		case <-time.After(delay):
+			// ok
+		case <-r.Context().Done():
+			w.WriteHeader(499) // "Client Closed Request" https://httpstatuses.com/499
+			return
+		}
+	}
+
+	sw, ok := newSlowHeadersWriter(w, r, headerDelay, h.MaxDuration-delay, h.MaxDuration-delay)
+	if !ok {
+		return
+	}
+	defer sw.Close()
+
+	for i := 1; i <= count; i++ {
+		sw.Header().Set(fmt.Sprintf("X-Slow-Header-%d", i), strconv.Itoa(i))
+	}
+	h.Get(sw, r)
+}
+
 // Range returns up to N bytes, with support for HTTP Range requests.
 //
 // This departs from original httpbin in a few ways:
@@ -956,6 +1717,22 @@ func (h *HTTPBin) handleBytes(w http.ResponseWriter, r *http.Request, streaming
 			chunkSize = 10 * 1024
 		}
 
+		if userHeaderDelay := r.URL.Query().Get("header_delay"); userHeaderDelay != "" {
+			headerDelay, err := parseBoundedDuration(userHeaderDelay, 0, h.MaxDuration)
+			if err != nil {
+				writeError(w, http.StatusBadRequest, fmt.Errorf("invalid header_delay: %w", err))
+				return
+			}
+			if headerDelay > 0 {
+				sw, ok := newSlowHeadersWriter(w, r, headerDelay, h.MaxDuration, h.MaxDuration)
+				if !ok {
+					return
+				}
+				defer sw.Close()
+				w = sw
+			}
+		}
+
 		write = func() func(chunk []byte) {
 			f := w.(http.Flusher)
 			return func(chunk []byte) {
@@ -1156,6 +1933,69 @@ func (h *HTTPBin) Base64(w http.ResponseWriter, r *http.Request) {
 	writeResponse(w, http.StatusOK, ct, result)
 }
 
+// Template renders a Go text/template, given via the template query param or
+// else the request body, against the details of the incoming request.
+func (h *HTTPBin) Template(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	rng, err := parseSeed(q.Get("seed"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid seed: %w", err))
+		return
+	}
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("error reading request body: %w", err))
+		return
+	}
+
+	text := q.Get("template")
+	if !q.Has("template") {
+		text, body = string(body), nil
+	}
+	if text == "" {
+		writeError(w, http.StatusBadRequest, errors.New("missing template"))
+		return
+	}
+
+	renderer := &templateRenderer{rng: rng, maxBytes: h.MaxBodySize}
+	tmpl, err := renderer.parseTemplate(text)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid template: %w", err))
+		return
+	}
+
+	data := templateContext{
+		Method:     r.Method,
+		URL:        getURL(r).String(),
+		Path:       r.URL.Path,
+		PathValues: pathValues(r),
+		Query:      q,
+		Headers:    getRequestHeaders(r, h.excludeHeadersProcessor),
+		Origin:     getClientIP(r),
+		Body:       string(body),
+	}
+	if len(body) > 0 {
+		// the parsed JSON is only available for valid JSON bodies
+		_ = json.Unmarshal(body, &data.JSON)
+	}
+
+	out := &limitedBuffer{limit: h.MaxBodySize}
+	if err := tmpl.Execute(out, data); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("error rendering template: %w", err))
+		return
+	}
+
+	ct := q.Get("content-type")
+	if ct == "" {
+		ct = textContentType
+	}
+	// prevent XSS and other client side vulns if the content type is dangerous
+	if h.mustEscapeResponse(ct) {
+		out.buf = []byte(html.EscapeString(string(out.buf)))
+	}
+	writeResponse(w, http.StatusOK, ct, out.buf)
+}
+
 // DumpRequest - returns the given request in its HTTP/1.x wire representation.
 // The returned representation is an approximation only;
 // some details of the initial request are lost while parsing it into
@@ -1298,6 +2138,442 @@ func (h *HTTPBin) Bearer(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// History returns the most recent requests persisted to the history store,
+// newest first.
+func (h *HTTPBin) History(w http.ResponseWriter, r *http.Request) {
+	limit := defaultHistoryLimit
+	if rawLimit := r.URL.Query().Get("limit"); rawLimit != "" {
+		var err error
+		limit, err = strconv.Atoi(rawLimit)
+		if err != nil || limit < 1 || limit > maxHistoryLimit {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("invalid limit %q, must be in range [1, %d]", rawLimit, maxHistoryLimit))
+			return
+		}
+	}
+	records, err := h.store.List(limit)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, fmt.Errorf("failed to read history: %w", err))
+		return
+	}
+	resp := historyResponse{Requests: make([]historyEntry, 0, len(records))}
+	for _, rec := range records {
+		resp.Requests = append(resp.Requests, historyEntry{
+			HistoryRecord: rec,
+			Duration:      rec.Duration.String(),
+		})
+	}
+	writeJSON(http.StatusOK, w, resp)
+}
+
+// CreateMock registers a mock endpoint at runtime in the given namespace,
+// which is served under the mocks prefix. The mock is defined by the JSON
+// request body, in the same format as the entries in a mocks file except that
+// body_file is not supported and delays are bounded by MaxDuration.
+func (h *HTTPBin) CreateMock(w http.ResponseWriter, r *http.Request) {
+	namespace := r.PathValue("namespace")
+
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	var def mockDefinition
+	if err := dec.Decode(&def); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid request body: %w", err))
+		return
+	}
+	if def.BodyFile != "" {
+		writeError(w, http.StatusBadRequest, errors.New("body_file is not supported for runtime mocks"))
+		return
+	}
+	m, err := def.toMock("")
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if m.Delay > h.MaxDuration {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid delay %s, must be <= %s", m.Delay, h.MaxDuration))
+		return
+	}
+	// runtime mocks are defined by untrusted clients, so prevent XSS and
+	// other client side vulns if the content type is dangerous
+	if h.mustEscapeResponse(m.contentType()) {
+		m.Body = []byte(html.EscapeString(string(m.Body)))
+	}
+
+	id, err := h.mockRegistry.register(namespace, m)
+	if err != nil {
+		status := http.StatusBadRequest
+		switch {
+		case errors.Is(err, errTooManyMockNamespaces):
+			status = http.StatusServiceUnavailable
+		case errors.Is(err, errMockConflict), errors.Is(err, errTooManyMocks):
+			status = http.StatusConflict
+		}
+		writeError(w, status, err)
+		return
+	}
+
+	w.Header().Set("Location", h.prefix+mocksAdminPath+"/"+url.PathEscape(namespace)+"/"+strconv.Itoa(id))
+	writeJSON(http.StatusCreated, w, h.newMockResponse(r, namespace, registeredMock{id: id, mock: m}))
+}
+
+// ListMocks returns the mocks registered at runtime in the given namespace.
+func (h *HTTPBin) ListMocks(w http.ResponseWriter, r *http.Request) {
+	namespace := r.PathValue("namespace")
+	mocks, _, err := h.mockRegistry.list(namespace)
+	if err != nil {
+		writeError(w, http.StatusNotFound, err)
+		return
+	}
+	resp := mocksResponse{Namespace: namespace, Mocks: make([]mockResponse, 0, len(mocks))}
+	for _, rm := range mocks {
+		resp.Mocks = append(resp.Mocks, h.newMockResponse(r, namespace, rm))
+	}
+	writeJSON(http.StatusOK, w, resp)
+}
+
+// ClearMocks removes the given namespace, along with all of its mocks and
+// their recorded hits.
+func (h *HTTPBin) ClearMocks(w http.ResponseWriter, r *http.Request) {
+	if !h.mockRegistry.clear(r.PathValue("namespace")) {
+		writeError(w, http.StatusNotFound, errMockNamespaceNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// DeleteMock removes a single mock registered at runtime.
+func (h *HTTPBin) DeleteMock(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid id %q", r.PathValue("id")))
+		return
+	}
+	if !h.mockRegistry.remove(r.PathValue("namespace"), id) {
+		writeError(w, http.StatusNotFound, errors.New("mock not found"))
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// VerifyMocks returns the number of requests served by each mock in the given
+// namespace, broken down by the media type of each request's Content-Type, so
+// that clients may assert on how a system under test called them.
+func (h *HTTPBin) VerifyMocks(w http.ResponseWriter, r *http.Request) {
+	namespace := r.PathValue("namespace")
+	mocks, unmatched, err := h.mockRegistry.list(namespace)
+	if err != nil {
+		writeError(w, http.StatusNotFound, err)
+		return
+	}
+	resp := mockVerifyResponse{
+		Namespace: namespace,
+		Mocks:     make([]mockHitsResponse, 0, len(mocks)),
+		Unmatched: unmatched,
+	}
+	for _, rm := range mocks {
+		hits := 0
+		for _, n := range rm.hits {
+			hits += n
+		}
+		resp.Mocks = append(resp.Mocks, mockHitsResponse{
+			ID:                rm.id,
+			Method:            rm.mock.Method,
+			Path:              rm.mock.Path,
+			Hits:              hits,
+			HitsByContentType: rm.hits,
+		})
+	}
+	writeJSON(http.StatusOK, w, resp)
+}
+
+// RuntimeMock serves the mocks registered at runtime in the given namespace,
+// whose paths are relative to the namespace.
+func (h *HTTPBin) RuntimeMock(w http.ResponseWriter, r *http.Request) {
+	namespace := r.PathValue("mockNamespace")
+
+	r2 := new(http.Request)
+	*r2 = *r
+	r2.URL = new(url.URL)
+	*r2.URL = *r.URL
+	r2.URL.Path = "/" + r.PathValue("mockPath")
+	r2.URL.RawPath = ""
+
+	handler, ok := h.mockRegistry.handler(namespace, r2)
+	if !ok {
+		// the pattern this handler is registered under is more specific than
+		// the HAR player's, so requests matching no runtime mock fall back to
+		// any matching HAR entry
+		if h.harPlayer != nil {
+			if e, ok := h.harPlayer.next(r); ok {
+				h.harPlayer.serve(w, r, e)
+				return
+			}
+		}
+		writeError(w, http.StatusNotFound, fmt.Errorf("no mock in namespace %q matches %s %s", namespace, r.Method, r2.URL.Path))
+		return
+	}
+	handler.ServeHTTP(w, r2)
+}
+
+func (h *HTTPBin) newMockResponse(r *http.Request, namespace string, rm registeredMock) mockResponse {
+	// the mock's path is a pattern, whose wildcards are left unescaped
+	u := getURL(r)
+	mockURL := u.Scheme + "://" + u.Host + h.prefix + h.mocksPrefix + "/" + url.PathEscape(namespace) + rm.mock.Path
+	status := rm.mock.Status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	headers := rm.mock.Headers
+	if headers == nil {
+		headers = map[string]string{}
+	}
+	return mockResponse{
+		ID:      rm.id,
+		Method:  rm.mock.Method,
+		Path:    rm.mock.Path,
+		URL:     mockURL,
+		Status:  status,
+		Headers: headers,
+		Body:    string(rm.mock.Body),
+		Delay:   rm.mock.Delay.String(),
+	}
+}
+
+// Idempotent implements the IETF Idempotency-Key header for POST and PATCH
+// requests. The first request with a given key is processed, echoing the
+// request like /post, and its response is stored for an optional ttl (default
+// 24h). Retries with the same key and payload are served the stored response,
+// while a different payload is rejected with a 422 and concurrent duplicates
+// of a request still being processed with a 409. Keys are scoped to the
+// client's IP address. An optional delay simulates slow processing.
+func (h *HTTPBin) Idempotent(w http.ResponseWriter, r *http.Request) {
+	key := r.Header.Get("Idempotency-Key")
+	if key == "" {
+		writeError(w, http.StatusBadRequest, errors.New("missing Idempotency-Key header"))
+		return
+	}
+	if len(key) > maxIdempotencyKeyLength {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid Idempotency-Key header, must be at most %d characters", maxIdempotencyKeyLength))
+		return
+	}
+
+	q := r.URL.Query()
+	ttl := defaultIdempotencyKeyTTL
+	if userTTL := q.Get("ttl"); userTTL != "" {
+		var err error
+		ttl, err = parseBoundedDuration(userTTL, time.Second, maxIdempotencyKeyTTL)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("invalid ttl: %w", err))
+			return
+		}
+	}
+	var delay time.Duration
+	if userDelay := q.Get("delay"); userDelay != "" {
+		var err error
+		delay, err = parseBoundedDuration(userDelay, 0, h.MaxDuration)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("invalid delay: %w", err))
+			return
+		}
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("error reading request body: %w", err))
+		return
+	}
+	// the same payload sent with a different method is a different request
+	fingerprint := sha256Hex(append([]byte(r.Method+"\n"), body...))
+
+	// keys are scoped to the client, so that clients cannot replay each
+	// other's responses
+	entry, err := h.idempotency.begin(getClientIP(r), key, fingerprint, ttl, time.Now())
+	switch {
+	case errors.Is(err, errIdempotencyKeyMismatch):
+		writeError(w, http.StatusUnprocessableEntity, err)
+		return
+	case errors.Is(err, errIdempotencyKeyInFlight):
+		writeError(w, http.StatusConflict, err)
+		return
+	case err != nil:
+		writeError(w, http.StatusServiceUnavailable, err)
+		return
+	case entry.done:
+		w.Header().Set("Idempotent-Replayed", "true")
+		writeResponse(w, entry.status, jsonContentType, entry.body)
+		return
+	}
+
+	// if the request cannot be processed, the key is released so that the
+	// client may retry
+	completed := false
+	defer func() {
+		if !completed {
+			h.idempotency.release(entry)
+		}
+	}()
+
+	if delay > 0 {
+		select {
+		case <-r.Context().Done():
+			w.WriteHeader(499) // "Client Closed Request" https://httpstatuses.com/499
+			return
+		case <-time.After(delay):
+		}
+	}
+
+	resp := &idempotentResponse{
+		bodyResponse: bodyResponse{
+			Args:    q,
+			Files:   nilValues,
+			Form:    nilValues,
+			Headers: getRequestHeaders(r, h.excludeHeadersProcessor),
+			Method:  r.Method,
+			Origin:  getClientIP(r),
+			URL:     getURL(r).String(),
+		},
+		ID:             uuidv4(),
+		IdempotencyKey: key,
+		Created:        time.Now().UTC(),
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	if err := parseBody(r, &resp.bodyResponse); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("error parsing request body: %w", err))
+		return
+	}
+
+	var buf bytes.Buffer
+	mustMarshalJSON(&buf, resp)
+	if err := h.idempotency.complete(entry, http.StatusCreated, buf.Bytes(), time.Now()); err != nil {
+		writeError(w, http.StatusServiceUnavailable, err)
+		return
+	}
+	completed = true
+	w.Header().Set("Idempotent-Replayed", "false")
+	writeResponse(w, http.StatusCreated, jsonContentType, buf.Bytes())
+}
+
+// SendWebhook delivers the request body as a webhook to the target URL given
+// by the url parameter, signed according to the Standard Webhooks spec. The
+// webhook is delivered count times, interval apart, in the background, and
+// each delivery is retried with exponential backoff until the target responds
+// with a 2xx status or the attempts are exhausted.
+func (h *HTTPBin) SendWebhook(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	target, err := url.Parse(q.Get("url"))
+	if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" {
+		writeError(w, http.StatusBadRequest, errors.New("invalid url: must be an absolute http or https URL"))
+		return
+	}
+	if !h.webhooks.allowed(target) {
+		writeError(w, http.StatusForbidden, fmt.Errorf("forbidden url: webhooks may not be sent to %q", target.Host))
+		return
+	}
+
+	count := 1
+	if userCount := q.Get("count"); userCount != "" {
+		count, err = strconv.Atoi(userCount)
+		if err != nil || count < 1 || count > maxWebhookCount {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("invalid count: must be an integer in range [1, %d]", maxWebhookCount))
+			return
+		}
+	}
+	var interval time.Duration
+	if userInterval := q.Get("interval"); userInterval != "" {
+		interval, err = parseBoundedDuration(userInterval, 0, h.MaxDuration)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("invalid interval: %w", err))
+			return
+		}
+	}
+	attempts := defaultWebhookAttempts
+	if userAttempts := q.Get("attempts"); userAttempts != "" {
+		attempts, err = strconv.Atoi(userAttempts)
+		if err != nil || attempts < 1 || attempts > maxWebhookAttempts {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("invalid attempts: must be an integer in range [1, %d]", maxWebhookAttempts))
+			return
+		}
+	}
+	backoff := min(defaultWebhookBackoff, h.MaxDuration)
+	if userBackoff := q.Get("backoff"); userBackoff != "" {
+		backoff, err = parseBoundedDuration(userBackoff, 0, h.MaxDuration)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("invalid backoff: %w", err))
+			return
+		}
+	}
+	signatureHeader := defaultWebhookSignatureHeader
+	if userHeader := q.Get("header"); userHeader != "" {
+		if !validHeaderName(userHeader) {
+			writeError(w, http.StatusBadRequest, errors.New("invalid header: must be a valid header name"))
+			return
+		}
+		signatureHeader = userHeader
+	}
+	var secret []byte
+	if userSecret := q.Get("secret"); userSecret != "" {
+		secret, err = parseWebhookSecret(userSecret)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("invalid secret: %w", err))
+			return
+		}
+	} else {
+		secret = newWebhookSecret()
+	}
+
+	payload, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("error reading request body: %w", err))
+		return
+	}
+	contentType := r.Header.Get("Content-Type")
+	if contentType == "" {
+		contentType = jsonContentType
+	}
+
+	msg := webhookMessage{
+		url:             target.String(),
+		contentType:     contentType,
+		payload:         payload,
+		secret:          secret,
+		signatureHeader: signatureHeader,
+	}
+	deliveries, err := h.webhooks.schedule(msg, count, interval, attempts, backoff, h.MaxDuration, time.Now())
+	if err != nil {
+		writeError(w, http.StatusServiceUnavailable, err)
+		return
+	}
+	writeJSON(http.StatusAccepted, w, webhookSendResponse{
+		Deliveries:      deliveries,
+		Secret:          formatWebhookSecret(secret),
+		SignatureHeader: signatureHeader,
+	})
+}
+
+// WebhookDeliveries lists the most recent webhook deliveries, oldest first.
+func (h *HTTPBin) WebhookDeliveries(w http.ResponseWriter, _ *http.Request) {
+	writeJSON(http.StatusOK, w, webhookDeliveriesResponse{Deliveries: h.webhooks.list()})
+}
+
+// WebhookDelivery returns the webhook delivery with the given id.
+func (h *HTTPBin) WebhookDelivery(w http.ResponseWriter, r *http.Request) {
+	delivery, err := h.webhooks.get(r.PathValue("id"))
+	if err != nil {
+		writeError(w, http.StatusNotFound, err)
+		return
+	}
+	writeJSON(http.StatusOK, w, delivery)
+}
+
+// HAR exports the most recent requests and responses served in HAR 1.2
+// format.
+func (h *HTTPBin) HAR(w http.ResponseWriter, _ *http.Request) {
+	version := h.version.Version
+	if version == "" {
+		version = "unknown"
+	}
+	writeJSON(http.StatusOK, w, h.harRecorder.export(harCreator{Name: h.version.Service, Version: version}))
+}
+
 // Hostname - returns the hostname.
 func (h *HTTPBin) Hostname(w http.ResponseWriter, _ *http.Request) {
 	writeJSON(http.StatusOK, w, hostnameResponse{
@@ -1399,12 +2675,18 @@ func (h *HTTPBin) SSE(w http.ResponseWriter, r *http.Request) {
 // writeServerSentEvent writes the bytes that constitute a single server-sent
 // event message, including both the event type and data.
 func writeServerSentEvent(dst io.Writer, id int, ts time.Time) {
-	dst.Write([]byte("event: ping\n"))
-	dst.Write([]byte("data: "))
-	json.NewEncoder(dst).Encode(serverSentEvent{
+	writeServerSentEventData(dst, "ping", serverSentEvent{
 		ID:        id,
 		Timestamp: ts.UnixMilli(),
 	})
+}
+
+// writeServerSentEventData writes a single server-sent event message of the
+// given event type, with its data encoded as JSON.
+func writeServerSentEventData(dst io.Writer, event string, data any) {
+	dst.Write([]byte("event: " + event + "\n"))
+	dst.Write([]byte("data: "))
+	json.NewEncoder(dst).Encode(data)
 	// each SSE ends with two newlines (\n\n), the first of which is written
 	// automatically by json.NewEncoder().Encode()
 	dst.Write([]byte("\n"))
@@ -1458,3 +2740,239 @@ func (h *HTTPBin) WebSocketEcho(w http.ResponseWriter, r *http.Request) {
 	}
 	ws.Serve(websocket.EchoHandler)
 }
+
+// WatchHook captures any request made to it and delivers it to every client
+// currently watching the same channel via WatchEvents or WatchWebSocket.
+func (h *HTTPBin) WatchHook(w http.ResponseWriter, r *http.Request) {
+	req, err := h.captureRequest(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("error reading request body: %w", err))
+		return
+	}
+	req, delivered := h.watchers.publish(r.PathValue("channel"), req)
+	writeJSON(http.StatusOK, w, watchHookResponse{
+		Delivered: delivered,
+		Request:   req,
+	})
+}
+
+// WatchEvents streams every request subsequently made to the channel's hook
+// as a server-sent event, until count requests have been sent (if given) or
+// the timeout elapses. The client is watching once the response headers have
+// been received.
+func (h *HTTPBin) WatchEvents(w http.ResponseWriter, r *http.Request) {
+	count, timeout, err := h.parseWatchParams(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	requests, unsubscribe, err := h.watchers.subscribe(r.PathValue("channel"))
+	if err != nil {
+		writeError(w, http.StatusServiceUnavailable, err)
+		return
+	}
+	defer unsubscribe()
+
+	w.Header().Set("Content-Type", sseContentType)
+	w.WriteHeader(http.StatusOK)
+	flusher := w.(http.Flusher)
+	flusher.Flush()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	for sent := 0; count == 0 || sent < count; sent++ {
+		select {
+		case req := <-requests:
+			writeServerSentEventData(w, "request", req)
+			flusher.Flush()
+		case <-timer.C:
+			return
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+// WatchWebSocket is the websocket equivalent of WatchEvents, sending each
+// request made to the channel's hook as a JSON text message.
+func (h *HTTPBin) WatchWebSocket(w http.ResponseWriter, r *http.Request) {
+	count, timeout, err := h.parseWatchParams(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	requests, unsubscribe, err := h.watchers.subscribe(r.PathValue("channel"))
+	if err != nil {
+		writeError(w, http.StatusServiceUnavailable, err)
+		return
+	}
+	defer unsubscribe()
+
+	ws := websocket.New(w, r, websocket.Limits{
+		MaxDuration:     timeout,
+		MaxFragmentSize: int(h.MaxBodySize),
+		MaxMessageSize:  int(h.MaxBodySize),
+	})
+	if err := ws.Handshake(); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+	messages := make(chan *websocket.Message)
+	go func() {
+		defer close(messages)
+		for sent := 0; count == 0 || sent < count; sent++ {
+			select {
+			case req := <-requests:
+				payload, _ := json.Marshal(req)
+				select {
+				case messages <- &websocket.Message{Payload: payload}:
+				case <-ctx.Done():
+					return
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	ws.Push(messages)
+}
+
+// parseWatchParams parses the optional count and timeout params accepted by
+// the /watch endpoints, where a count of 0 means unlimited and the timeout
+// defaults to (and is bounded by) MaxDuration.
+func (h *HTTPBin) parseWatchParams(r *http.Request) (int, time.Duration, error) {
+	var (
+		q       = r.URL.Query()
+		count   int
+		timeout = h.MaxDuration
+		err     error
+	)
+	if userCount := q.Get("count"); userCount != "" {
+		count, err = strconv.Atoi(userCount)
+		if err != nil || count < 0 {
+			return 0, 0, fmt.Errorf("invalid count: must be an integer >= 0")
+		}
+	}
+	if userTimeout := q.Get("timeout"); userTimeout != "" {
+		timeout, err = parseBoundedDuration(userTimeout, time.Millisecond, h.MaxDuration)
+		if err != nil {
+			return 0, 0, fmt.Errorf("invalid timeout: %w", err)
+		}
+	}
+	return count, timeout, nil
+}
+
+// FaultReset - resets the client's connection with a TCP RST instead of
+// responding.
+func (h *HTTPBin) FaultReset(w http.ResponseWriter, _ *http.Request) {
+	resetReply(w)
+}
+
+// resetReply resets the client's connection with a TCP RST.
+func resetReply(w http.ResponseWriter) {
+	conn, _, ok := hijackConn(w)
+	if !ok {
+		return
+	}
+	_ = resetConn(conn)
+}
+
+// FaultCloseAfter - advertises a response body larger than n bytes, but closes
+// the connection after writing only the first n bytes of it.
+func (h *HTTPBin) FaultCloseAfter(w http.ResponseWriter, r *http.Request) {
+	n, err := strconv.ParseInt(r.PathValue("n"), 10, 64)
+	if err != nil || n < 0 || n > h.MaxBodySize {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid n: must be an integer in range [0, %d]", h.MaxBodySize))
+		return
+	}
+
+	contentLength := max(2*n, n+1)
+	if userContentLength := r.URL.Query().Get("content_length"); userContentLength != "" {
+		contentLength, err = strconv.ParseInt(userContentLength, 10, 64)
+		if err != nil || contentLength <= n {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("invalid content_length: must be an integer greater than %d", n))
+			return
+		}
+	}
+
+	conn, buf, ok := hijackConn(w)
+	if !ok {
+		return
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(h.MaxDuration))
+
+	fmt.Fprintf(buf, "HTTP/1.1 200 OK\r\nContent-Type: application/octet-stream\r\nContent-Length: %d\r\n\r\n", contentLength)
+	buf.Write(bytes.Repeat([]byte("*"), int(n)))
+	buf.Flush()
+}
+
+// FaultHang - accepts the request but never responds, holding the connection
+// open until the client gives up or the server's max duration elapses.
+func (h *HTTPBin) FaultHang(w http.ResponseWriter, _ *http.Request) {
+	hangConn(w, h.MaxDuration)
+}
+
+// hangConn holds the client's connection open without responding, until the
+// client closes it or the timeout elapses.
+func hangConn(w http.ResponseWriter, timeout time.Duration) {
+	conn, _, ok := hijackConn(w)
+	if !ok {
+		return
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(timeout))
+
+	// anything else the client sends is ignored, until it closes the
+	// connection or the deadline is reached
+	_, _ = io.Copy(io.Discard, conn)
+}
+
+// FaultEmptyReply - closes the client's connection without writing a single
+// byte of response.
+func (h *HTTPBin) FaultEmptyReply(w http.ResponseWriter, _ *http.Request) {
+	emptyReply(w)
+}
+
+// emptyReply closes the client's connection without responding.
+func emptyReply(w http.ResponseWriter) {
+	conn, _, ok := hijackConn(w)
+	if !ok {
+		return
+	}
+	conn.Close()
+}
+
+// Malformed - writes a deliberately broken HTTP/1.1 response of the given
+// kind, for testing the robustness of HTTP clients and parsers.
+func (h *HTTPBin) Malformed(w http.ResponseWriter, r *http.Request) {
+	kind := r.PathValue("kind")
+	writeMalformed, ok := malformedResponses[kind]
+	if !ok {
+		writeError(w, http.StatusNotFound, fmt.Errorf("invalid kind %q: must be one of %s", kind, strings.Join(malformedKinds(), ", ")))
+		return
+	}
+
+	headerSize := defaultMalformedHeaderSize
+	if userHeaderSize := r.URL.Query().Get("size"); userHeaderSize != "" {
+		var err error
+		headerSize, err = strconv.Atoi(userHeaderSize)
+		if err != nil || headerSize < 1 || headerSize > maxMalformedHeaderSize {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("invalid size: must be an integer in range [1, %d]", maxMalformedHeaderSize))
+			return
+		}
+	}
+
+	conn, buf, ok := hijackConn(w)
+	if !ok {
+		return
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(h.MaxDuration))
+
+	writeMalformed(buf, headerSize)
+	buf.Flush()
+}
@@ -7,7 +7,9 @@ import (
 	"compress/zlib"
 	"context"
 	"encoding/base64"
+	"encoding/binary"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"html"
 	"io"
@@ -23,6 +25,7 @@ import (
 	"regexp"
 	"strconv"
 	"strings"
+	"syscall"
 	"testing"
 	"time"
 
@@ -89,6 +92,7 @@ func setupTestApp(t *testing.T, opts ...OptionFunc) *appTestInfo {
 	app := createApp(opts...)
 	srv := httptest.NewServer(app)
 	t.Cleanup(srv.Close)
+	t.Cleanup(func() { app.Close() })
 
 	client := srv.Client()
 	client.Timeout = 5 * time.Second
@@ -1261,6 +1265,53 @@ func TestStatus(t *testing.T) {
 			assert.StatusCode(t, resp, http.StatusBadRequest)
 		})
 	})
+
+	t.Run("retry after", func(t *testing.T) {
+		t.Parallel()
+
+		retryDate := time.Now().Add(500 * time.Millisecond).UTC().Format(http.TimeFormat)
+		tests := []struct {
+			url        string
+			status     int
+			retryAfter string
+		}{
+			{"/status/503?retry_after=1", 503, "1"},
+			{"/status/429?retry_after=0", 429, "0"},
+			{"/status/429?retry_after=" + url.QueryEscape(retryDate), 429, retryDate},
+			{"/status/301?retry_after=1", 301, "1"},
+			{"/status/503:1,200:0?retry_after=1", 503, "1"},
+			// ignored for status codes that do not support it
+			{"/status/200?retry_after=1", 200, ""},
+			{"/status/500?retry_after=1", 500, ""},
+			{"/status/200:1,503:0?retry_after=1", 200, ""},
+		}
+		for _, test := range tests {
+			t.Run("ok"+test.url, func(t *testing.T) {
+				t.Parallel()
+				req := newTestRequest(t, "GET", app.URL(test.url), nil)
+				resp := mustDoRequest(t, app, req)
+				assert.StatusCode(t, resp, test.status)
+				assert.Header(t, resp, "Retry-After", test.retryAfter)
+			})
+		}
+
+		badTests := []string{
+			"/status/503?retry_after=foo",
+			"/status/503?retry_after=-1",
+			"/status/503?retry_after=1.5",
+			// longer than max duration
+			"/status/503?retry_after=2",
+			"/status/503?retry_after=" + url.QueryEscape(time.Now().Add(time.Hour).UTC().Format(http.TimeFormat)),
+		}
+		for _, test := range badTests {
+			t.Run("bad"+test, func(t *testing.T) {
+				t.Parallel()
+				req := newTestRequest(t, "GET", app.URL(test), nil)
+				resp := mustDoRequest(t, app, req)
+				assert.StatusCode(t, resp, http.StatusBadRequest)
+			})
+		}
+	})
 }
 
 func TestUnstable(t *testing.T) {
@@ -1293,6 +1344,20 @@ func TestUnstable(t *testing.T) {
 		})
 	}
 
+	t.Run("ok_retry_after", func(t *testing.T) {
+		t.Parallel()
+		req := newTestRequest(t, "GET", app.URL("/unstable?seed=1234567890&retry_after=1"), nil)
+		resp := mustDoRequest(t, app, req)
+		assert.StatusCode(t, resp, 500)
+		assert.Header(t, resp, "Retry-After", "1")
+
+		// only sent with failures
+		req = newTestRequest(t, "GET", app.URL("/unstable?seed=1234567890&failure_rate=0.07&retry_after=1"), nil)
+		resp = mustDoRequest(t, app, req)
+		assert.StatusCode(t, resp, 200)
+		assert.Header(t, resp, "Retry-After", "")
+	})
+
 	edgeCaseTests := []string{
 		// strange but valid seed
 		"/unstable?seed=-12345",
@@ -1316,6 +1381,218 @@ func TestUnstable(t *testing.T) {
 		// bad seed
 		"/unstable?seed=3.14",
 		"/unstable?seed=foo",
+		// bad retry_after
+		"/unstable?retry_after=foo",
+		"/unstable?retry_after=2",
+	}
+	for _, test := range badTests {
+		t.Run("bad"+test, func(t *testing.T) {
+			t.Parallel()
+			req := newTestRequest(t, "GET", app.URL(test), nil)
+			resp := mustDoRequest(t, app, req)
+			assert.StatusCode(t, resp, http.StatusBadRequest)
+		})
+	}
+}
+
+func TestChaos(t *testing.T) {
+	t.Parallel()
+	app := setupTestApp(t)
+
+	tests := []struct {
+		url         string
+		status      int
+		outcome     string
+		minDuration time.Duration
+	}{
+		{"/chaos/418", 418, "418", 0},
+		{"/chaos/503@50ms", 503, "503@50ms", 50 * time.Millisecond},
+		// rand.NewSource(1234567890).Float64() => 0.08
+		{"/chaos/503@50ms:0.1,200:0.9?seed=1234567890", 503, "503@50ms", 50 * time.Millisecond},
+		{"/chaos/200:0.07,429@10ms:0.93?seed=1234567890", 429, "429@10ms", 10 * time.Millisecond},
+		{"/chaos/200:1,reset:0?seed=1234567890", 200, "200", 0},
+	}
+	for _, test := range tests {
+		t.Run("ok"+test.url, func(t *testing.T) {
+			t.Parallel()
+			start := time.Now()
+			req := newTestRequest(t, "GET", app.URL(test.url), nil)
+			resp := mustDoRequest(t, app, req)
+			assert.StatusCode(t, resp, test.status)
+			assert.Header(t, resp, "X-Chaos-Outcome", test.outcome)
+			assert.MinDuration(t, time.Since(start), test.minDuration)
+		})
+	}
+
+	t.Run("ok/reset", func(t *testing.T) {
+		t.Parallel()
+		req := newTestRequest(t, "GET", app.URL("/chaos/reset@10ms"), nil)
+		_, err := app.Client.Do(req)
+		assert.Equal(t, errors.Is(err, syscall.ECONNRESET), true, "expected %v, got %v", syscall.ECONNRESET, err)
+	})
+
+	t.Run("ok/hang bounded by max duration including delay", func(t *testing.T) {
+		t.Parallel()
+		app := setupTestApp(t, WithMaxDuration(200*time.Millisecond))
+		start := time.Now()
+		req := newTestRequest(t, "GET", app.URL("/chaos/hang@150ms"), nil)
+		_, err := app.Client.Do(req)
+		assert.Equal(t, errors.Is(err, io.EOF), true, "expected %v, got %v", io.EOF, err)
+		elapsed := time.Since(start)
+		assert.MinDuration(t, elapsed, 200*time.Millisecond)
+		if elapsed >= 350*time.Millisecond {
+			t.Fatalf("expected hang to end after max duration in total, took %s", elapsed)
+		}
+	})
+
+	t.Run("ok/empty-reply", func(t *testing.T) {
+		t.Parallel()
+		req := newTestRequest(t, "GET", app.URL("/chaos/200:0.07,empty-reply:0.93?seed=1234567890"), nil)
+		_, err := app.Client.Do(req)
+		assert.Equal(t, errors.Is(err, io.EOF), true, "expected %v, got %v", io.EOF, err)
+	})
+
+	t.Run("ok/client cancels during delay", func(t *testing.T) {
+		t.Parallel()
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		req := newTestRequest(t, "GET", app.URL("/chaos/200@1s"), nil).WithContext(ctx)
+		_, err := app.Client.Do(req)
+		assert.Equal(t, errors.Is(err, context.DeadlineExceeded), true, "expected %v, got %v", context.DeadlineExceeded, err)
+	})
+
+	badTests := []string{
+		"/chaos/foo",
+		"/chaos/200@foo",
+		"/chaos/200@2s", // longer than max duration
+		"/chaos/200@-1s",
+		"/chaos/reset@",
+		"/chaos/200:foo",
+		"/chaos/200:-1,500:2",
+		"/chaos/200:0,500:0",
+		"/chaos/200?seed=foo",
+	}
+	for _, test := range badTests {
+		t.Run("bad"+test, func(t *testing.T) {
+			t.Parallel()
+			req := newTestRequest(t, "GET", app.URL(test), nil)
+			resp := mustDoRequest(t, app, req)
+			assert.StatusCode(t, resp, http.StatusBadRequest)
+		})
+	}
+}
+
+func TestRateLimited(t *testing.T) {
+	t.Parallel()
+	app := setupTestApp(t)
+
+	t.Run("ok/quota exhausted", func(t *testing.T) {
+		t.Parallel()
+		for i := range 3 {
+			req := newTestRequest(t, "GET", app.URL("/rate-limit/exhausted?limit=3&window=10s"), nil)
+			resp := mustDoRequest(t, app, req)
+			result := mustParseResponse[rateLimitResponse](t, resp)
+			assert.DeepEqual(t, result, rateLimitResponse{
+				Key:       "exhausted",
+				Limit:     3,
+				Remaining: 2 - i,
+				Used:      i + 1,
+				Reset:     10,
+			}, "incorrect response")
+			assert.Header(t, resp, "X-RateLimit-Limit", "3")
+			assert.Header(t, resp, "X-RateLimit-Remaining", strconv.Itoa(2-i))
+			assert.Header(t, resp, "X-RateLimit-Reset", "10")
+			assert.Header(t, resp, "RateLimit-Policy", `"default";q=3;w=10`)
+			assert.Header(t, resp, "RateLimit", fmt.Sprintf(`"default";r=%d;t=10`, 2-i))
+			assert.Header(t, resp, "Retry-After", "")
+		}
+
+		req := newTestRequest(t, "GET", app.URL("/rate-limit/exhausted?limit=3&window=10s"), nil)
+		resp := mustDoRequest(t, app, req)
+		assert.StatusCode(t, resp, http.StatusTooManyRequests)
+		assert.ContentType(t, resp, jsonContentType)
+		assert.Header(t, resp, "Retry-After", "10")
+		assert.Header(t, resp, "X-RateLimit-Remaining", "0")
+		result := must.Unmarshal[rateLimitResponse](t, resp.Body)
+		assert.DeepEqual(t, result, rateLimitResponse{
+			Key:       "exhausted",
+			Limit:     3,
+			Remaining: 0,
+			Used:      3,
+			Reset:     10,
+		}, "incorrect response")
+
+		// other keys have their own quotas
+		req = newTestRequest(t, "GET", app.URL("/rate-limit/other?limit=3&window=10s"), nil)
+		resp = mustDoRequest(t, app, req)
+		assert.StatusCode(t, resp, http.StatusOK)
+	})
+
+	t.Run("ok/window resets", func(t *testing.T) {
+		t.Parallel()
+		app := setupTestApp(t)
+		app.App.quotas.windows["reset"] = &quotaWindow{
+			start: time.Now().Add(-2 * time.Second),
+			end:   time.Now().Add(-time.Second),
+			hits:  1,
+		}
+		req := newTestRequest(t, "GET", app.URL("/rate-limit/reset?limit=1"), nil)
+		resp := mustDoRequest(t, app, req)
+		result := mustParseResponse[rateLimitResponse](t, resp)
+		assert.Equal(t, result.Used, 1, "expected new window")
+	})
+
+	t.Run("ok/defaults", func(t *testing.T) {
+		t.Parallel()
+		req := newTestRequest(t, "GET", app.URL("/rate-limit/defaults"), nil)
+		resp := mustDoRequest(t, app, req)
+		result := mustParseResponse[rateLimitResponse](t, resp)
+		assert.DeepEqual(t, result, rateLimitResponse{
+			Key:       "defaults",
+			Limit:     10,
+			Remaining: 9,
+			Used:      1,
+			Reset:     60,
+		}, "incorrect response")
+	})
+
+	t.Run("ok/github dialect", func(t *testing.T) {
+		t.Parallel()
+		req := newTestRequest(t, "GET", app.URL("/rate-limit/github?limit=5&window=1h&dialect=github"), nil)
+		resp := mustDoRequest(t, app, req)
+		assert.StatusCode(t, resp, http.StatusOK)
+		assert.Header(t, resp, "X-RateLimit-Limit", "5")
+		assert.Header(t, resp, "X-RateLimit-Remaining", "4")
+		assert.Header(t, resp, "X-RateLimit-Used", "1")
+		assert.Header(t, resp, "X-RateLimit-Resource", "github")
+		assert.Header(t, resp, "RateLimit", "")
+
+		reset, err := strconv.ParseInt(resp.Header.Get("X-RateLimit-Reset"), 10, 64)
+		assert.NilError(t, err)
+		if delta := reset - time.Now().Add(time.Hour).Unix(); delta < -2 || delta > 2 {
+			t.Fatalf("expected X-RateLimit-Reset to be an epoch timestamp 1h in the future, got %d", reset)
+		}
+	})
+
+	t.Run("ok/ietf dialect", func(t *testing.T) {
+		t.Parallel()
+		req := newTestRequest(t, "GET", app.URL("/rate-limit/ietf?limit=5&window=30s&dialect=IETF"), nil)
+		resp := mustDoRequest(t, app, req)
+		assert.StatusCode(t, resp, http.StatusOK)
+		assert.Header(t, resp, "RateLimit-Policy", `"default";q=5;w=30`)
+		assert.Header(t, resp, "RateLimit", `"default";r=4;t=30`)
+		assert.Header(t, resp, "X-RateLimit-Limit", "")
+	})
+
+	badTests := []string{
+		"/rate-limit/bad?limit=foo",
+		"/rate-limit/bad?limit=0",
+		"/rate-limit/bad?limit=10001",
+		"/rate-limit/bad?window=foo",
+		"/rate-limit/bad?window=500ms",
+		"/rate-limit/bad?window=2h",
+		"/rate-limit/bad?dialect=foo",
+		"/rate-limit/bad?dialect=x-ratelimit,github",
 	}
 	for _, test := range badTests {
 		t.Run("bad"+test, func(t *testing.T) {
@@ -1327,6 +1604,214 @@ func TestUnstable(t *testing.T) {
 	}
 }
 
+func TestScenario(t *testing.T) {
+	t.Parallel()
+	app := setupTestApp(t)
+
+	t.Run("ok/sequence", func(t *testing.T) {
+		t.Parallel()
+		wantStatuses := []int{503, 503, 429, 200, 200}
+		for i, wantStatus := range wantStatuses {
+			req := newTestRequest(t, "GET", app.URL("/scenario/sequence?sequence=503,503,429,200"), nil)
+			resp := mustDoRequest(t, app, req)
+			assert.StatusCode(t, resp, wantStatus)
+			assert.Header(t, resp, "X-Scenario-Attempt", strconv.Itoa(i+1))
+		}
+
+		// the sequence may be omitted once the scenario has started
+		req := newTestRequest(t, "POST", app.URL("/scenario/sequence"), nil)
+		resp := mustDoRequest(t, app, req)
+		assert.StatusCode(t, resp, http.StatusOK)
+		assert.Header(t, resp, "X-Scenario-Attempt", "6")
+	})
+
+	t.Run("ok/state", func(t *testing.T) {
+		t.Parallel()
+		for _, wantStatus := range []int{500, 502} {
+			req := newTestRequest(t, "GET", app.URL("/scenario/state?sequence=500,502,200&ttl=1m"), nil)
+			resp := mustDoRequest(t, app, req)
+			assert.StatusCode(t, resp, wantStatus)
+		}
+
+		req := newTestRequest(t, "GET", app.URL("/scenario/state/state"), nil)
+		resp := mustDoRequest(t, app, req)
+		result := mustParseResponse[scenarioResponse](t, resp)
+		assert.Equal(t, result.ID, "state", "incorrect id")
+		assert.DeepEqual(t, result.Sequence, []int{500, 502, 200}, "incorrect sequence")
+		assert.Equal(t, result.Attempts, 2, "incorrect attempts")
+		assert.Equal(t, result.NextStatus, 200, "incorrect next status")
+		assert.Equal(t, len(result.AttemptTimes), 2, "incorrect number of attempt times")
+		assert.Equal(t, !result.AttemptTimes[1].Before(result.AttemptTimes[0]), true, "expected attempt times in order")
+		if delta := time.Until(result.Expires); delta < 50*time.Second || delta > time.Minute {
+			t.Fatalf("expected scenario to expire in ~1m, got %s", delta)
+		}
+	})
+
+	t.Run("ok/reset", func(t *testing.T) {
+		t.Parallel()
+		for _, wantStatus := range []int{503, 200, 503} {
+			req := newTestRequest(t, "GET", app.URL("/scenario/reset?sequence=503,200"), nil)
+			resp := mustDoRequest(t, app, req)
+			assert.StatusCode(t, resp, wantStatus)
+
+			if wantStatus == 200 {
+				req := newTestRequest(t, "POST", app.URL("/scenario/reset/reset"), nil)
+				resp := mustDoRequest(t, app, req)
+				assert.StatusCode(t, resp, http.StatusNoContent)
+			}
+		}
+	})
+
+	t.Run("ok/new sequence restarts scenario", func(t *testing.T) {
+		t.Parallel()
+		req := newTestRequest(t, "GET", app.URL("/scenario/restart?sequence=503,200"), nil)
+		resp := mustDoRequest(t, app, req)
+		assert.StatusCode(t, resp, http.StatusServiceUnavailable)
+
+		req = newTestRequest(t, "GET", app.URL("/scenario/restart?sequence=429,200"), nil)
+		resp = mustDoRequest(t, app, req)
+		assert.StatusCode(t, resp, http.StatusTooManyRequests)
+		assert.Header(t, resp, "X-Scenario-Attempt", "1")
+	})
+
+	t.Run("error/unknown scenario", func(t *testing.T) {
+		t.Parallel()
+		req := newTestRequest(t, "GET", app.URL("/scenario/unknown"), nil)
+		resp := mustDoRequest(t, app, req)
+		assert.StatusCode(t, resp, http.StatusBadRequest)
+
+		req = newTestRequest(t, "GET", app.URL("/scenario/unknown/state"), nil)
+		resp = mustDoRequest(t, app, req)
+		assert.StatusCode(t, resp, http.StatusNotFound)
+	})
+
+	badTests := []string{
+		"/scenario/bad?sequence=foo",
+		"/scenario/bad?sequence=200,,500",
+		"/scenario/bad?sequence=99",
+		"/scenario/bad?sequence=200&ttl=foo",
+		"/scenario/bad?sequence=200&ttl=500ms",
+		"/scenario/bad?sequence=200&ttl=25h",
+		"/scenario/bad?sequence=" + strings.Repeat("200,", maxScenarioSequenceLen) + "200",
+	}
+	for _, test := range badTests {
+		t.Run("bad"+test[:min(len(test), 50)], func(t *testing.T) {
+			t.Parallel()
+			req := newTestRequest(t, "GET", app.URL(test), nil)
+			resp := mustDoRequest(t, app, req)
+			assert.StatusCode(t, resp, http.StatusBadRequest)
+		})
+	}
+}
+
+func TestBins(t *testing.T) {
+	t.Parallel()
+	app := setupTestApp(t)
+
+	createBin := func(t *testing.T, path string) binResponse {
+		t.Helper()
+		req := newTestRequest(t, "POST", app.URL(path), nil)
+		resp := mustDoRequest(t, app, req)
+		assert.StatusCode(t, resp, http.StatusCreated)
+		return must.Unmarshal[binResponse](t, resp.Body)
+	}
+
+	t.Run("ok/capture and inspect", func(t *testing.T) {
+		t.Parallel()
+		start := time.Now()
+		bin := createBin(t, "/bins")
+		assert.Equal(t, bin.URL, app.URL("/bins/"+bin.ID), "incorrect bin url")
+		assert.Equal(t, bin.RequestsURL, app.URL("/bins/"+bin.ID+"/requests"), "incorrect requests url")
+		if delta := bin.Expires.Sub(start); delta < 59*time.Minute || delta > 61*time.Minute {
+			t.Fatalf("expected bin to expire in ~1h, got %s", delta)
+		}
+
+		req := newTestRequest(t, "POST", bin.URL+"?foo=bar", strings.NewReader(`{"hello": "world"}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-Webhook-Signature", "abc123")
+		resp := mustDoRequest(t, app, req)
+		captured := mustParseResponse[capturedRequest](t, resp)
+		assert.Equal(t, captured.ID, 1, "incorrect request id")
+
+		req = newTestRequest(t, "PUT", bin.URL, bytes.NewReader([]byte{0xff, 0xfe}))
+		resp = mustDoRequest(t, app, req)
+		assert.StatusCode(t, resp, http.StatusOK)
+
+		req = newTestRequest(t, "GET", bin.RequestsURL, nil)
+		resp = mustDoRequest(t, app, req)
+		result := mustParseResponse[binRequestsResponse](t, resp)
+		assert.Equal(t, len(result.Requests), 2, "incorrect number of captured requests")
+
+		first := result.Requests[0]
+		assert.Equal(t, first.ID, 1, "incorrect request id")
+		assert.Equal(t, first.Method, "POST", "incorrect method")
+		assert.Equal(t, first.URL, bin.URL+"?foo=bar", "incorrect url")
+		assert.DeepEqual(t, first.Args, url.Values{"foo": {"bar"}}, "incorrect args")
+		assert.Equal(t, first.Headers.Get("X-Webhook-Signature"), "abc123", "incorrect headers")
+		assert.Equal(t, first.Origin, "127.0.0.1", "incorrect origin")
+		assert.Equal(t, first.Body, `{"hello": "world"}`, "incorrect body")
+		assert.Equal(t, first.BodySize, int64(18), "incorrect body size")
+		assert.Equal(t, first.Time.Before(start), false, "incorrect time")
+
+		second := result.Requests[1]
+		assert.Equal(t, second.Method, "PUT", "incorrect method")
+		assert.Equal(t, second.Body, "data:application/octet-stream;base64,__4=", "expected binary body to be base64 encoded")
+
+		req = newTestRequest(t, "GET", bin.RequestsURL+"/2", nil)
+		resp = mustDoRequest(t, app, req)
+		assert.DeepEqual(t, mustParseResponse[capturedRequest](t, resp), second, "incorrect request")
+	})
+
+	t.Run("ok/ttl", func(t *testing.T) {
+		t.Parallel()
+		start := time.Now()
+		bin := createBin(t, "/bins?ttl=5m")
+		if delta := bin.Expires.Sub(start); delta < 4*time.Minute || delta > 6*time.Minute {
+			t.Fatalf("expected bin to expire in ~5m, got %s", delta)
+		}
+	})
+
+	t.Run("error/body too large", func(t *testing.T) {
+		t.Parallel()
+		bin := createBin(t, "/bins")
+		req := newTestRequest(t, "POST", bin.URL, strings.NewReader(strings.Repeat("*", 1025)))
+		resp := mustDoRequest(t, app, req)
+		assert.StatusCode(t, resp, http.StatusBadRequest)
+	})
+
+	errorTests := []struct {
+		method string
+		path   string
+		status int
+	}{
+		{"POST", "/bins?ttl=foo", http.StatusBadRequest},
+		{"POST", "/bins?ttl=500ms", http.StatusBadRequest},
+		{"POST", "/bins?ttl=25h", http.StatusBadRequest},
+		{"GET", "/bins", http.StatusMethodNotAllowed},
+		{"POST", "/bins/unknown", http.StatusNotFound},
+		{"GET", "/bins/unknown/requests", http.StatusNotFound},
+		{"GET", "/bins/unknown/requests/1", http.StatusNotFound},
+	}
+	for _, test := range errorTests {
+		t.Run("error/"+test.method+test.path, func(t *testing.T) {
+			t.Parallel()
+			req := newTestRequest(t, test.method, app.URL(test.path), nil)
+			resp := mustDoRequest(t, app, req)
+			assert.StatusCode(t, resp, test.status)
+		})
+	}
+
+	t.Run("error/unknown request", func(t *testing.T) {
+		t.Parallel()
+		bin := createBin(t, "/bins")
+		for path, status := range map[string]int{"/1": http.StatusNotFound, "/foo": http.StatusBadRequest} {
+			req := newTestRequest(t, "GET", bin.RequestsURL+path, nil)
+			resp := mustDoRequest(t, app, req)
+			assert.StatusCode(t, resp, status)
+		}
+	})
+}
+
 func TestResponseHeaders(t *testing.T) {
 	t.Parallel()
 	app := setupTestApp(t)
@@ -1871,43 +2356,262 @@ func TestCookies(t *testing.T) {
 	}
 }
 
-func TestBasicAuth(t *testing.T) {
+func TestSession(t *testing.T) {
 	t.Parallel()
 	app := setupTestApp(t)
 
-	t.Run("ok", func(t *testing.T) {
-		for _, method := range []string{"GET", "POST", "PUT", "DELETE", "PATCH"} {
-			t.Run(method, func(t *testing.T) {
-				t.Parallel()
-				req := newTestRequest(t, method, app.URL("/basic-auth/user/pass"), nil)
-				req.SetBasicAuth("user", "pass")
+	// getLoginForm fetches the login form, returning the CSRF cookie and
+	// token it issues.
+	getLoginForm := func(t *testing.T, query string) (*http.Cookie, string) {
+		t.Helper()
+		req := newTestRequest(t, "GET", app.URL("/session/login"+query), nil)
+		resp := mustDoRequest(t, app, req)
+		assert.StatusCode(t, resp, http.StatusOK)
+		assert.ContentType(t, resp, htmlContentType)
+		assert.Header(t, resp, "Cache-Control", "no-store")
+
+		token := resp.Header.Get(csrfHeader)
+		body := must.ReadAll(t, resp.Body)
+		assert.Contains(t, body, fmt.Sprintf(`<input type=hidden name="csrf_token" value="%s">`, token), "body")
+
+		for _, c := range resp.Cookies() {
+			if c.Name == csrfCookieName {
+				assert.Equal(t, c.Value, token, "csrf cookie does not match token")
+				assert.Equal(t, c.HttpOnly, true, "csrf cookie must be HttpOnly")
+				return c, token
+			}
+		}
+		t.Fatalf("csrf cookie not found")
+		return nil, ""
+	}
 
-				resp := mustDoRequest(t, app, req)
-				result := mustParseResponse[authResponse](t, resp)
-				expectedResult := authResponse{
-					Authenticated: true,
-					Authorized:    true,
-					User:          "user",
-				}
-				assert.DeepEqual(t, result, expectedResult, "expected authorized user")
-			})
+	// login submits the login form, returning the response.
+	login := func(t *testing.T, csrfCookie *http.Cookie, form url.Values) *http.Response {
+		t.Helper()
+		req := newTestRequest(t, "POST", app.URL("/session/login"), strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		if csrfCookie != nil {
+			req.AddCookie(csrfCookie)
 		}
-	})
+		return mustDoRequest(t, app, req)
+	}
 
-	t.Run("error/no auth", func(t *testing.T) {
-		for _, method := range []string{"GET", "POST", "PUT", "DELETE", "PATCH"} {
-			t.Run(method, func(t *testing.T) {
-				t.Parallel()
-				req := newTestRequest(t, method, app.URL("/basic-auth/user/pass"), nil)
-				resp := mustDoRequest(t, app, req)
-				assert.StatusCode(t, resp, http.StatusUnauthorized)
-				assert.ContentType(t, resp, jsonContentType)
-				assert.Header(t, resp, "WWW-Authenticate", `Basic realm="Fake Realm"`)
+	getSessionCookie := func(t *testing.T, resp *http.Response) *http.Cookie {
+		t.Helper()
+		for _, c := range resp.Cookies() {
+			if c.Name == sessionCookieName {
+				return c
+			}
+		}
+		t.Fatalf("session cookie not found")
+		return nil
+	}
 
-				result := must.Unmarshal[authResponse](t, resp.Body)
-				expectedResult := authResponse{
-					Authenticated: false,
-					Authorized:    false,
+	getMe := func(t *testing.T, sessionCookie *http.Cookie) *http.Response {
+		t.Helper()
+		req := newTestRequest(t, "GET", app.URL("/session/me"), nil)
+		if sessionCookie != nil {
+			req.AddCookie(sessionCookie)
+		}
+		return mustDoRequest(t, app, req)
+	}
+
+	t.Run("ok/full flow", func(t *testing.T) {
+		t.Parallel()
+		csrfCookie, token := getLoginForm(t, "")
+
+		resp := login(t, csrfCookie, url.Values{"username": {"alice"}, "csrf_token": {token}})
+		assert.StatusCode(t, resp, http.StatusSeeOther)
+		assert.Header(t, resp, "Location", "/session/me")
+		sessionCookie := getSessionCookie(t, resp)
+		assert.Equal(t, sessionCookie.HttpOnly, true, "session cookie must be HttpOnly")
+		assert.Equal(t, sessionCookie.MaxAge, int(defaultSessionMaxAge.Seconds()), "incorrect session cookie max age")
+
+		result := mustParseResponse[sessionResponse](t, getMe(t, sessionCookie))
+		assert.Equal(t, result.Authenticated, true, "expected authenticated session")
+		assert.Equal(t, result.User, "alice", "incorrect session user")
+		assert.Equal(t, result.Expires.Sub(result.Created), defaultSessionMaxAge, "incorrect session expiry")
+
+		// logout requires a csrf token, too
+		req := newTestRequest(t, "POST", app.URL("/session/logout"), nil)
+		req.AddCookie(sessionCookie)
+		resp = mustDoRequest(t, app, req)
+		assert.StatusCode(t, resp, http.StatusForbidden)
+
+		req = newTestRequest(t, "POST", app.URL("/session/logout"), nil)
+		req.Header.Set(csrfHeader, token)
+		req.AddCookie(csrfCookie)
+		req.AddCookie(sessionCookie)
+		resp = mustDoRequest(t, app, req)
+		result = mustParseResponse[sessionResponse](t, resp)
+		assert.DeepEqual(t, result, sessionResponse{}, "expected unauthenticated response")
+		assert.Equal(t, getSessionCookie(t, resp).MaxAge, -1, "expected session cookie to be cleared")
+
+		// the revoked session may not be used again, even though its cookie
+		// has not expired
+		resp = getMe(t, sessionCookie)
+		assert.StatusCode(t, resp, http.StatusUnauthorized)
+		assert.BodyContains(t, resp, errSessionInvalid.Error())
+	})
+
+	t.Run("ok/form fields and max_age", func(t *testing.T) {
+		t.Parallel()
+		csrfCookie, token := getLoginForm(t, "?max_age=90s")
+
+		req := newTestRequest(t, "GET", app.URL("/session/login?max_age=90s"), nil)
+		assert.BodyContains(t, mustDoRequest(t, app, req), `action="/session/login?max_age=90s"`)
+
+		// the login form is submitted with its max_age in the URL and its
+		// customer name field used as the user
+		req = newTestRequest(t, "POST", app.URL("/session/login?max_age=90s"), strings.NewReader(url.Values{"custname": {"bob"}, "csrf_token": {token}}.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.AddCookie(csrfCookie)
+		resp := mustDoRequest(t, app, req)
+		assert.StatusCode(t, resp, http.StatusSeeOther)
+		sessionCookie := getSessionCookie(t, resp)
+		assert.Equal(t, sessionCookie.MaxAge, 90, "incorrect session cookie max age")
+
+		result := mustParseResponse[sessionResponse](t, getMe(t, sessionCookie))
+		assert.Equal(t, result.User, "bob", "incorrect session user")
+		assert.Equal(t, result.Expires.Sub(result.Created), 90*time.Second, "incorrect session expiry")
+	})
+
+	t.Run("ok/prefix", func(t *testing.T) {
+		t.Parallel()
+		app := setupTestApp(t, WithPrefix("/test-prefix"))
+		req := newTestRequest(t, "GET", app.URL("/test-prefix/session/login"), nil)
+		resp := mustDoRequest(t, app, req)
+		assert.BodyContains(t, resp, `action="/test-prefix/session/login"`)
+	})
+
+	t.Run("error/csrf", func(t *testing.T) {
+		t.Parallel()
+		csrfCookie, token := getLoginForm(t, "")
+
+		// no token
+		resp := login(t, csrfCookie, url.Values{"username": {"alice"}})
+		assert.StatusCode(t, resp, http.StatusForbidden)
+
+		// no cookie
+		resp = login(t, nil, url.Values{"username": {"alice"}, "csrf_token": {token}})
+		assert.StatusCode(t, resp, http.StatusForbidden)
+
+		// mismatched token
+		resp = login(t, csrfCookie, url.Values{"username": {"alice"}, "csrf_token": {"wrong"}})
+		assert.StatusCode(t, resp, http.StatusForbidden)
+	})
+
+	t.Run("error/missing username", func(t *testing.T) {
+		t.Parallel()
+		csrfCookie, token := getLoginForm(t, "")
+		resp := login(t, csrfCookie, url.Values{"csrf_token": {token}})
+		assert.StatusCode(t, resp, http.StatusBadRequest)
+	})
+
+	for _, maxAge := range []string{"foo", "0", "500ms", "25h"} {
+		t.Run("error/invalid max_age/"+maxAge, func(t *testing.T) {
+			t.Parallel()
+			req := newTestRequest(t, "GET", app.URL("/session/login?max_age="+maxAge), nil)
+			resp := mustDoRequest(t, app, req)
+			assert.StatusCode(t, resp, http.StatusBadRequest)
+
+			csrfCookie, token := getLoginForm(t, "")
+			resp = login(t, csrfCookie, url.Values{"username": {"alice"}, "csrf_token": {token}, "max_age": {maxAge}})
+			assert.StatusCode(t, resp, http.StatusBadRequest)
+		})
+	}
+
+	t.Run("error/no session", func(t *testing.T) {
+		t.Parallel()
+		resp := getMe(t, nil)
+		assert.StatusCode(t, resp, http.StatusUnauthorized)
+		assert.BodyContains(t, resp, errSessionMissing.Error())
+	})
+
+	t.Run("error/expired session", func(t *testing.T) {
+		t.Parallel()
+		sess, _, err := app.App.sessions.create("alice", time.Minute)
+		assert.NilError(t, err)
+		cookieValue := app.App.sessions.sign(sess.ID, time.Now().Add(-time.Second))
+		resp := getMe(t, &http.Cookie{Name: sessionCookieName, Value: cookieValue})
+		assert.StatusCode(t, resp, http.StatusUnauthorized)
+		assert.BodyContains(t, resp, errSessionExpired.Error())
+	})
+
+	tamperTests := map[string]func(id, expires, sig string) string{
+		"garbage":         func(_, _, _ string) string { return "garbage" },
+		"other id":        func(_, expires, sig string) string { return "other." + expires + "." + sig },
+		"later expiry":    func(id, _, sig string) string { return id + ".99999999999." + sig },
+		"other signature": func(id, expires, _ string) string { return id + "." + expires + ".c2lnbmF0dXJl" },
+	}
+	for name, tamper := range tamperTests {
+		t.Run("error/tampered session/"+name, func(t *testing.T) {
+			t.Parallel()
+			_, cookieValue, err := app.App.sessions.create("alice", time.Minute)
+			assert.NilError(t, err)
+			id, expires, sig, _ := splitSessionCookie(cookieValue)
+			resp := getMe(t, &http.Cookie{Name: sessionCookieName, Value: tamper(id, expires, sig)})
+			assert.StatusCode(t, resp, http.StatusUnauthorized)
+			assert.BodyContains(t, resp, errSessionInvalid.Error())
+		})
+	}
+
+	t.Run("error/signed by another instance", func(t *testing.T) {
+		t.Parallel()
+		other := newSessionStore()
+		_, cookieValue, err := other.create("alice", time.Minute)
+		assert.NilError(t, err)
+		resp := getMe(t, &http.Cookie{Name: sessionCookieName, Value: cookieValue})
+		assert.StatusCode(t, resp, http.StatusUnauthorized)
+	})
+
+	t.Run("error/method not allowed", func(t *testing.T) {
+		t.Parallel()
+		for _, path := range []string{"/session/me", "/session/logout"} {
+			req := newTestRequest(t, "PUT", app.URL(path), nil)
+			resp := mustDoRequest(t, app, req)
+			assert.StatusCode(t, resp, http.StatusMethodNotAllowed)
+		}
+	})
+}
+
+func TestBasicAuth(t *testing.T) {
+	t.Parallel()
+	app := setupTestApp(t)
+
+	t.Run("ok", func(t *testing.T) {
+		for _, method := range []string{"GET", "POST", "PUT", "DELETE", "PATCH"} {
+			t.Run(method, func(t *testing.T) {
+				t.Parallel()
+				req := newTestRequest(t, method, app.URL("/basic-auth/user/pass"), nil)
+				req.SetBasicAuth("user", "pass")
+
+				resp := mustDoRequest(t, app, req)
+				result := mustParseResponse[authResponse](t, resp)
+				expectedResult := authResponse{
+					Authenticated: true,
+					Authorized:    true,
+					User:          "user",
+				}
+				assert.DeepEqual(t, result, expectedResult, "expected authorized user")
+			})
+		}
+	})
+
+	t.Run("error/no auth", func(t *testing.T) {
+		for _, method := range []string{"GET", "POST", "PUT", "DELETE", "PATCH"} {
+			t.Run(method, func(t *testing.T) {
+				t.Parallel()
+				req := newTestRequest(t, method, app.URL("/basic-auth/user/pass"), nil)
+				resp := mustDoRequest(t, app, req)
+				assert.StatusCode(t, resp, http.StatusUnauthorized)
+				assert.ContentType(t, resp, jsonContentType)
+				assert.Header(t, resp, "WWW-Authenticate", `Basic realm="Fake Realm"`)
+
+				result := must.Unmarshal[authResponse](t, resp.Body)
+				expectedResult := authResponse{
+					Authenticated: false,
+					Authorized:    false,
 					User:          "",
 				}
 				assert.DeepEqual(t, result, expectedResult, "expected unauthorized user")
@@ -2013,6 +2717,157 @@ func TestHiddenBasicAuth(t *testing.T) {
 	}
 }
 
+func TestAPIKey(t *testing.T) {
+	t.Parallel()
+	app := setupTestApp(t, WithAPIKey("server-key"))
+
+	okTests := []struct {
+		name     string
+		url      string
+		setKey   func(*http.Request)
+		wantResp apiKeyResponse
+	}{
+		{
+			name:     "default header",
+			url:      "/api-key/secret",
+			setKey:   func(r *http.Request) { r.Header.Set("X-API-Key", "secret") },
+			wantResp: apiKeyResponse{Authenticated: true, Key: "secret", In: "header", Name: "X-API-Key"},
+		},
+		{
+			name:     "custom header",
+			url:      "/api-key/secret?name=X-Custom-Key",
+			setKey:   func(r *http.Request) { r.Header.Set("X-Custom-Key", "secret") },
+			wantResp: apiKeyResponse{Authenticated: true, Key: "secret", In: "header", Name: "X-Custom-Key"},
+		},
+		{
+			name:     "default query param",
+			url:      "/api-key/secret?in=query&api_key=secret",
+			setKey:   func(*http.Request) {},
+			wantResp: apiKeyResponse{Authenticated: true, Key: "secret", In: "query", Name: "api_key"},
+		},
+		{
+			name:     "custom query param",
+			url:      "/api-key/secret?in=query&name=token&token=secret",
+			setKey:   func(*http.Request) {},
+			wantResp: apiKeyResponse{Authenticated: true, Key: "secret", In: "query", Name: "token"},
+		},
+		{
+			name:     "default cookie",
+			url:      "/api-key/secret?in=cookie",
+			setKey:   func(r *http.Request) { r.AddCookie(&http.Cookie{Name: "api_key", Value: "secret"}) },
+			wantResp: apiKeyResponse{Authenticated: true, Key: "secret", In: "cookie", Name: "api_key"},
+		},
+		{
+			name:     "custom cookie",
+			url:      "/api-key/secret?in=COOKIE&name=session",
+			setKey:   func(r *http.Request) { r.AddCookie(&http.Cookie{Name: "session", Value: "secret"}) },
+			wantResp: apiKeyResponse{Authenticated: true, Key: "secret", In: "cookie", Name: "session"},
+		},
+		{
+			name:     "server key",
+			url:      "/api-key",
+			setKey:   func(r *http.Request) { r.Header.Set("X-API-Key", "server-key") },
+			wantResp: apiKeyResponse{Authenticated: true, Key: "server-key", In: "header", Name: "X-API-Key"},
+		},
+	}
+	for _, test := range okTests {
+		t.Run("ok/"+test.name, func(t *testing.T) {
+			t.Parallel()
+			req := newTestRequest(t, "GET", app.URL(test.url), nil)
+			test.setKey(req)
+			resp := mustDoRequest(t, app, req)
+			result := mustParseResponse[apiKeyResponse](t, resp)
+			assert.DeepEqual(t, result, test.wantResp, "incorrect response")
+		})
+	}
+
+	t.Run("error/no key", func(t *testing.T) {
+		t.Parallel()
+		req := newTestRequest(t, "GET", app.URL("/api-key/secret?in=query"), nil)
+		resp := mustDoRequest(t, app, req)
+		assert.StatusCode(t, resp, http.StatusUnauthorized)
+		assert.ContentType(t, resp, jsonContentType)
+		assert.Header(t, resp, "WWW-Authenticate", `APIKey realm="Fake Realm", in="query", name="api_key"`)
+
+		result := must.Unmarshal[apiKeyResponse](t, resp.Body)
+		assert.DeepEqual(t, result, apiKeyResponse{In: "query", Name: "api_key"}, "incorrect response")
+	})
+
+	t.Run("error/wrong key", func(t *testing.T) {
+		t.Parallel()
+		req := newTestRequest(t, "GET", app.URL("/api-key/secret"), nil)
+		req.Header.Set("X-API-Key", "wrong")
+		resp := mustDoRequest(t, app, req)
+		assert.StatusCode(t, resp, http.StatusForbidden)
+		assert.ContentType(t, resp, jsonContentType)
+		assert.Header(t, resp, "WWW-Authenticate", "")
+
+		result := must.Unmarshal[apiKeyResponse](t, resp.Body)
+		assert.DeepEqual(t, result, apiKeyResponse{Key: "wrong", In: "header", Name: "X-API-Key"}, "incorrect response")
+	})
+
+	t.Run("error/key in wrong place", func(t *testing.T) {
+		t.Parallel()
+		req := newTestRequest(t, "GET", app.URL("/api-key/secret?in=cookie"), nil)
+		req.Header.Set("X-API-Key", "secret")
+		resp := mustDoRequest(t, app, req)
+		assert.StatusCode(t, resp, http.StatusUnauthorized)
+	})
+
+	t.Run("error/invalid location", func(t *testing.T) {
+		t.Parallel()
+		req := newTestRequest(t, "GET", app.URL("/api-key/secret?in=body"), nil)
+		resp := mustDoRequest(t, app, req)
+		assert.StatusCode(t, resp, http.StatusBadRequest)
+	})
+
+	t.Run("error/no server key configured", func(t *testing.T) {
+		t.Parallel()
+		app := setupTestApp(t)
+		req := newTestRequest(t, "GET", app.URL("/api-key"), nil)
+		req.Header.Set("X-API-Key", "secret")
+		resp := mustDoRequest(t, app, req)
+		assert.StatusCode(t, resp, http.StatusNotImplemented)
+	})
+}
+
+func TestHiddenAPIKey(t *testing.T) {
+	t.Parallel()
+	app := setupTestApp(t, WithAPIKey("server-key"))
+
+	t.Run("ok", func(t *testing.T) {
+		t.Parallel()
+		req := newTestRequest(t, "GET", app.URL("/hidden-api-key/secret"), nil)
+		req.Header.Set("X-API-Key", "secret")
+		resp := mustDoRequest(t, app, req)
+		result := mustParseResponse[apiKeyResponse](t, resp)
+		assert.DeepEqual(t, result, apiKeyResponse{Authenticated: true, Key: "secret", In: "header", Name: "X-API-Key"}, "incorrect response")
+	})
+
+	t.Run("ok/server key", func(t *testing.T) {
+		t.Parallel()
+		req := newTestRequest(t, "GET", app.URL("/hidden-api-key?in=query&api_key=server-key"), nil)
+		resp := mustDoRequest(t, app, req)
+		assert.StatusCode(t, resp, http.StatusOK)
+	})
+
+	t.Run("error/no key", func(t *testing.T) {
+		t.Parallel()
+		req := newTestRequest(t, "GET", app.URL("/hidden-api-key/secret"), nil)
+		resp := mustDoRequest(t, app, req)
+		assert.StatusCode(t, resp, http.StatusNotFound)
+		assert.Header(t, resp, "WWW-Authenticate", "")
+	})
+
+	t.Run("error/wrong key", func(t *testing.T) {
+		t.Parallel()
+		req := newTestRequest(t, "GET", app.URL("/hidden-api-key/secret"), nil)
+		req.Header.Set("X-API-Key", "wrong")
+		resp := mustDoRequest(t, app, req)
+		assert.StatusCode(t, resp, http.StatusNotFound)
+	})
+}
+
 func TestDigestAuth(t *testing.T) {
 	t.Parallel()
 	app := setupTestApp(t)
@@ -2199,6 +3054,111 @@ func TestStream(t *testing.T) {
 	}
 }
 
+func TestTemplate(t *testing.T) {
+	t.Parallel()
+	app := setupTestApp(t)
+
+	okTests := []struct {
+		method      string
+		path        string
+		body        string
+		wantBody    string
+		contentType string
+	}{
+		{
+			method:   "GET",
+			path:     "/template?name=world&template=" + url.QueryEscape(`hello, {{index .Query.name 0}} via {{.Method}} {{.Path}}`),
+			wantBody: "hello, world via GET /template",
+		},
+		{
+			method:   "GET",
+			path:     "/template/users/123?template=" + url.QueryEscape(`{{.PathValues.path}}`),
+			wantBody: "users/123",
+		},
+		{
+			method:   "POST",
+			path:     "/template?template=" + url.QueryEscape(`{{.JSON.user.name | upper}} x{{len .JSON.items}}{{range .JSON.items}} {{.}}{{end}}`),
+			body:     `{"user": {"name": "alice"}, "items": [1, 2]}`,
+			wantBody: "ALICE x2 1 2",
+		},
+		{
+			method:   "POST",
+			path:     "/template",
+			body:     `{{.Headers.Get "X-Test" | lower}} {{.Body | printf "%q"}}`,
+			wantBody: `value ""`,
+		},
+		{
+			method:      "GET",
+			path:        "/template?content-type=application/json&template=" + url.QueryEscape(`{"n": {{randInt 0 1000}}, "f": {{randFloat}}, "q": {{json .Query.x}}}`) + "&x=<b>&seed=1234",
+			wantBody:    `{"n": 682, "f": 0.6805445605385619, "q": ["\u003cb\u003e"]}`,
+			contentType: "application/json",
+		},
+		{
+			method:      "GET",
+			path:        "/template?content-type=text/html&template=" + url.QueryEscape(`<script>alert({{index .Query.x 0}})</script>`) + "&x=1",
+			wantBody:    "&lt;script&gt;alert(1)&lt;/script&gt;",
+			contentType: "text/html",
+		},
+	}
+	for _, test := range okTests {
+		t.Run("ok"+test.path, func(t *testing.T) {
+			t.Parallel()
+			req := newTestRequest(t, test.method, app.URL(test.path), strings.NewReader(test.body))
+			req.Header.Set("X-Test", "VALUE")
+			resp := mustDoRequest(t, app, req)
+			assert.StatusCode(t, resp, http.StatusOK)
+			if test.contentType == "" {
+				test.contentType = textContentType
+			}
+			assert.ContentType(t, resp, test.contentType)
+			assert.BodyEquals(t, resp, test.wantBody)
+		})
+	}
+
+	t.Run("ok/uuid and timestamps", func(t *testing.T) {
+		t.Parallel()
+		req := newTestRequest(t, "GET", app.URL("/template?template="+url.QueryEscape(`{{uuid}} {{now.Unix}}`)), nil)
+		resp := mustDoRequest(t, app, req)
+		assert.StatusCode(t, resp, http.StatusOK)
+		id, ts, _ := strings.Cut(must.ReadAll(t, resp.Body), " ")
+		assert.Equal(t, len(id), 36, "incorrect uuid length")
+		unix, err := strconv.ParseInt(ts, 10, 64)
+		assert.NilError(t, err)
+		assert.Equal(t, time.Since(time.Unix(unix, 0)) < time.Minute, true, "incorrect timestamp")
+	})
+
+	errorTests := []struct {
+		method  string
+		path    string
+		body    string
+		wantErr string
+	}{
+		{"GET", "/template", "", "missing template"},
+		{"GET", "/template?seed=foo&template=x", "", "invalid seed"},
+		{"GET", "/template?template=" + url.QueryEscape(`{{.Nope`), "", "invalid template"},
+		{"GET", "/template?template=" + url.QueryEscape(`{{define "x"}}{{end}}`), "", "defining templates is not supported"},
+		{"GET", "/template?template=" + url.QueryEscape(`{{template "template"}}`), "", "invoking templates is not supported"},
+		{"GET", "/template?template=" + url.QueryEscape(`{{if true}}{{block "x" .}}{{end}}{{end}}`), "", "defining templates is not supported"},
+		{"GET", "/template?template=" + url.QueryEscape(`{{.Nope}}`), "", "error rendering template"},
+		{"GET", "/template?template=" + url.QueryEscape(`{{range 100}}{{range 10000}}{{end}}{{end}}`), "", "loop iterations"},
+		{"GET", "/template?template=" + url.QueryEscape(`{{printf "%999999d" 1}}`), "", "width and precision"},
+		{"GET", "/template?template=" + url.QueryEscape(`{{printf "%[1]*d" 999999 1}}`), "", "* width and precision"},
+		{"GET", "/template?template=" + url.QueryEscape(`{{range 1000}}{{printf "%900d" 1}}{{end}}`), "", "exceeds max body size"},
+		{"GET", "/template?template=" + url.QueryEscape(`{{$x := "a"}}{{range 26}}{{$x = print $x $x}}{{end}}{{len $x}}`), "", "exceeds max body size"},
+		{"GET", "/template?template=" + url.QueryEscape(`{{$x := "a"}}{{range 26}}{{$x = printf "%s%s" $x $x}}{{end}}{{len $x}}`), "", "exceeds max body size"},
+		{"GET", "/template?template=" + url.QueryEscape(`{{randInt 10 1}}`), "", "randInt: max 1 must be greater than min 10"},
+	}
+	for _, test := range errorTests {
+		t.Run("error"+test.path, func(t *testing.T) {
+			t.Parallel()
+			req := newTestRequest(t, test.method, app.URL(test.path), strings.NewReader(test.body))
+			resp := mustDoRequest(t, app, req)
+			assert.StatusCode(t, resp, http.StatusBadRequest)
+			assert.BodyContains(t, resp, test.wantErr)
+		})
+	}
+}
+
 func TestTrailers(t *testing.T) {
 	t.Parallel()
 
@@ -2318,11 +3278,67 @@ func TestDelay(t *testing.T) {
 		assert.Equal(t, w.Code, 499, "incorrect status code")
 	})
 
+	t.Run("distributions", func(t *testing.T) {
+		t.Parallel()
+
+		for _, path := range []string{
+			"/delay/normal?mean=50ms&stddev=10ms&seed=1",
+			"/delay/lognormal?mean=50ms&stddev=10ms&seed=1",
+			"/delay/exponential?mean=50ms&seed=1",
+			"/delay/uniform?min=10ms&max=50ms&seed=1",
+			"/delay/uniform?max=50ms&seed=1",
+			"/delay/percentiles?p50=10ms&p99=50ms&seed=1",
+		} {
+			t.Run(path, func(t *testing.T) {
+				t.Parallel()
+				req := newTestRequest(t, "GET", app.URL(path), nil)
+				resp := mustDoRequest(t, app, req)
+				_ = mustParseResponse[bodyResponse](t, resp)
+
+				timings := decodeServerTimings(resp.Header.Get("Server-Timing"))
+				timing, ok := timings["initial_delay"]
+				assert.Equal(t, ok, true, "missing initial_delay Server-Timing")
+				distribution, _, _ := strings.Cut(strings.TrimPrefix(path, "/delay/"), "?")
+				assert.Equal(t, timing.desc, "sampled from "+distribution+" distribution", "incorrect Server-Timing description")
+
+				// the same seed must produce the same delay
+				req = newTestRequest(t, "GET", app.URL(path), nil)
+				resp = mustDoRequest(t, app, req)
+				assert.Equal(t, decodeServerTimings(resp.Header.Get("Server-Timing"))["initial_delay"], timing, "expected same delay for same seed")
+			})
+		}
+	})
+
+	t.Run("distribution bounded by max duration", func(t *testing.T) {
+		t.Parallel()
+		app := setupTestApp(t, WithMaxDuration(100*time.Millisecond))
+		req := newTestRequest(t, "GET", app.URL("/delay/normal?mean=100ms&stddev=100ms&seed=2"), nil)
+		resp := mustDoRequest(t, app, req)
+		assert.StatusCode(t, resp, http.StatusOK)
+		timing := decodeServerTimings(resp.Header.Get("Server-Timing"))["initial_delay"]
+		if timing.dur < 0 || timing.dur > 100*time.Millisecond {
+			t.Fatalf("expected delay in range [0, 100ms], got %s", timing.dur)
+		}
+	})
+
 	badTests := []struct {
 		url  string
 		code int
 	}{
 		{"/delay", http.StatusNotFound},
+		{"/delay/normal", http.StatusBadRequest},
+		{"/delay/normal?mean=100ms", http.StatusBadRequest},
+		{"/delay/normal?mean=100ms&stddev=foo", http.StatusBadRequest},
+		{"/delay/normal?mean=1m&stddev=10ms", http.StatusBadRequest},
+		{"/delay/lognormal?mean=0&stddev=10ms", http.StatusBadRequest},
+		{"/delay/exponential", http.StatusBadRequest},
+		{"/delay/uniform?min=200ms&max=100ms", http.StatusBadRequest},
+		{"/delay/uniform?min=10ms", http.StatusBadRequest},
+		{"/delay/percentiles", http.StatusBadRequest},
+		{"/delay/percentiles?p101=100ms", http.StatusBadRequest},
+		{"/delay/percentiles?pfoo=100ms", http.StatusBadRequest},
+		{"/delay/percentiles?p50=200ms&p99=100ms", http.StatusBadRequest},
+		{"/delay/uniform?max=100ms&seed=foo", http.StatusBadRequest},
 		{"/delay/foo", http.StatusBadRequest},
 		{"/delay/1/foo", http.StatusNotFound},
 
@@ -3102,22 +4118,152 @@ func TestStreamBytes(t *testing.T) {
 	}
 }
 
-func TestLinks(t *testing.T) {
-	for _, prefix := range []string{"", "/test-prefix"} {
-		app := setupTestApp(t, WithPrefix(prefix))
+func TestSlowHeaders(t *testing.T) {
+	t.Parallel()
 
-		redirectTests := []struct {
-			url              string
-			expectedLocation string
-		}{
-			{"/links/1", "/links/1/0"},
-			{"/links/100", "/links/100/0"},
+	t.Run("ok", func(t *testing.T) {
+		t.Parallel()
+		app := setupTestApp(t)
+
+		start := time.Now()
+		req := newTestRequest(t, "GET", app.URL("/slow-headers?delay=50ms&header_delay=10ms&count=3"), nil)
+		resp := mustDoRequest(t, app, req)
+		result := mustParseResponse[bodyResponse](t, resp)
+
+		// 50ms initial delay + at least 10ms between each of the 3 extra
+		// headers
+		assert.MinDuration(t, time.Since(start), 80*time.Millisecond)
+		assert.Equal(t, result.URL, app.URL("/slow-headers?delay=50ms&header_delay=10ms&count=3"), "incorrect URL")
+		for i := 1; i <= 3; i++ {
+			assert.Header(t, resp, fmt.Sprintf("X-Slow-Header-%d", i), strconv.Itoa(i))
 		}
+		assert.Header(t, resp, "X-Slow-Header-4", "")
+	})
 
-		for _, test := range redirectTests {
-			t.Run("ok"+prefix+test.url, func(t *testing.T) {
-				t.Parallel()
-				req := newTestRequest(t, "GET", app.URL(prefix+test.url), nil)
+	t.Run("header lines are trickled", func(t *testing.T) {
+		t.Parallel()
+		app := setupTestApp(t)
+
+		conn, err := net.Dial("tcp", app.Srv.Listener.Addr().String())
+		assert.NilError(t, err)
+		defer conn.Close()
+		_, err = fmt.Fprintf(conn, "GET /slow-headers?header_delay=50ms&count=1 HTTP/1.1\r\nHost: test\r\n\r\n")
+		assert.NilError(t, err)
+
+		// we should receive the status line well before the next header line
+		r := bufio.NewReader(conn)
+		statusLine, err := r.ReadString('\n')
+		assert.NilError(t, err)
+		assert.Equal(t, statusLine, "HTTP/1.1 200 OK\r\n", "incorrect status line")
+		start := time.Now()
+		_, err = r.ReadString('\n')
+		assert.NilError(t, err)
+		assert.MinDuration(t, time.Since(start), 40*time.Millisecond)
+	})
+
+	t.Run("total pause bounded by max duration", func(t *testing.T) {
+		t.Parallel()
+		app := setupTestApp(t, WithMaxDuration(200*time.Millisecond))
+		start := time.Now()
+		req := newTestRequest(t, "GET", app.URL("/slow-headers?header_delay=200ms&count=10"), nil)
+		resp := mustDoRequest(t, app, req)
+		assert.StatusCode(t, resp, http.StatusOK)
+		if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+			t.Fatalf("expected header pauses to be bounded by max duration, took %s", elapsed)
+		}
+	})
+
+	t.Run("drip", func(t *testing.T) {
+		t.Parallel()
+		app := setupTestApp(t)
+		start := time.Now()
+		req := newTestRequest(t, "GET", app.URL("/drip?numbytes=5&duration=0&delay=0&header_delay=20ms"), nil)
+		resp := mustDoRequest(t, app, req)
+		assert.StatusCode(t, resp, http.StatusOK)
+		assert.BodyEquals(t, resp, "*****")
+		assert.MinDuration(t, time.Since(start), 60*time.Millisecond)
+		assert.Contains(t, resp.Header.Get("Server-Timing"), "header_delay", "Server-Timing header")
+	})
+
+	t.Run("hijacked connection has a deadline", func(t *testing.T) {
+		t.Parallel()
+		errc := make(chan error, 1)
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// offset the grace period so that the deadline is imminent
+			sw, ok := newSlowHeadersWriter(w, r, time.Millisecond, time.Millisecond, 50*time.Millisecond-slowHeadersGracePeriod)
+			if !ok {
+				errc <- errors.New("failed to hijack connection")
+				return
+			}
+			defer sw.Close()
+			time.Sleep(100 * time.Millisecond)
+			sw.WriteHeader(http.StatusOK)
+			errc <- sw.err
+		}))
+		defer srv.Close()
+
+		conn, err := net.Dial("tcp", srv.Listener.Addr().String())
+		assert.NilError(t, err)
+		defer conn.Close()
+		_, err = fmt.Fprintf(conn, "GET / HTTP/1.1\r\nHost: test\r\n\r\n")
+		assert.NilError(t, err)
+		err = <-errc
+		assert.Equal(t, errors.Is(err, os.ErrDeadlineExceeded), true, "expected %v, got %v", os.ErrDeadlineExceeded, err)
+	})
+
+	t.Run("stream-bytes", func(t *testing.T) {
+		t.Parallel()
+		app := setupTestApp(t)
+		start := time.Now()
+		req := newTestRequest(t, "GET", app.URL("/stream-bytes/256?chunk_size=10&header_delay=20ms"), nil)
+		resp := mustDoRequest(t, app, req)
+		assert.StatusCode(t, resp, http.StatusOK)
+		assert.DeepEqual(t, resp.TransferEncoding, []string{"chunked"}, "incorrect Transfer-Encoding header")
+		assert.BodySize(t, resp, 256)
+		assert.MinDuration(t, time.Since(start), 60*time.Millisecond)
+	})
+
+	badTests := []struct {
+		url  string
+		code int
+	}{
+		{"/slow-headers?delay=foo", http.StatusBadRequest},
+		{"/slow-headers?delay=1m", http.StatusBadRequest},
+		{"/slow-headers?header_delay=foo", http.StatusBadRequest},
+		{"/slow-headers?header_delay=1m", http.StatusBadRequest},
+		{"/slow-headers?count=-1", http.StatusBadRequest},
+		{"/slow-headers?count=101", http.StatusBadRequest},
+		{"/drip?header_delay=foo", http.StatusBadRequest},
+		{"/drip?header_delay=1m", http.StatusBadRequest},
+		{"/stream-bytes/10?header_delay=foo", http.StatusBadRequest},
+	}
+	for _, test := range badTests {
+		t.Run("bad"+test.url, func(t *testing.T) {
+			t.Parallel()
+			app := setupTestApp(t)
+			req := newTestRequest(t, "GET", app.URL(test.url), nil)
+			resp := mustDoRequest(t, app, req)
+			assert.StatusCode(t, resp, test.code)
+		})
+	}
+}
+
+func TestLinks(t *testing.T) {
+	for _, prefix := range []string{"", "/test-prefix"} {
+		app := setupTestApp(t, WithPrefix(prefix))
+
+		redirectTests := []struct {
+			url              string
+			expectedLocation string
+		}{
+			{"/links/1", "/links/1/0"},
+			{"/links/100", "/links/100/0"},
+		}
+
+		for _, test := range redirectTests {
+			t.Run("ok"+prefix+test.url, func(t *testing.T) {
+				t.Parallel()
+				req := newTestRequest(t, "GET", app.URL(prefix+test.url), nil)
 				resp := mustDoRequest(t, app, req)
 				assert.StatusCode(t, resp, http.StatusFound)
 				assert.Header(t, resp, "Location", prefix+test.expectedLocation)
@@ -3676,6 +4822,521 @@ func TestNotImplemented(t *testing.T) {
 	}
 }
 
+func TestHistory(t *testing.T) {
+	t.Parallel()
+
+	// getHistory waits for the expected number of requests to be recorded,
+	// which happens after each response is written, ignoring requests to
+	// /history itself
+	getHistory := func(t *testing.T, app *appTestInfo, want int) []historyEntry {
+		t.Helper()
+		deadline := time.Now().Add(time.Second)
+		for {
+			req := newTestRequest(t, "GET", app.URL("/history"), nil)
+			resp := mustDoRequest(t, app, req)
+			result := mustParseResponse[historyResponse](t, resp)
+			var entries []historyEntry
+			for _, entry := range result.Requests {
+				if !strings.HasPrefix(entry.URI, "/history") {
+					entries = append(entries, entry)
+				}
+			}
+			if len(entries) >= want || time.Now().After(deadline) {
+				return entries
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+	}
+
+	t.Run("ok", func(t *testing.T) {
+		t.Parallel()
+		app := setupTestApp(t, WithStore(NewMemoryStore(StoreLimits{})))
+
+		req := newTestRequest(t, "POST", app.URL("/post?foo=bar"), strings.NewReader("hello"))
+		req.Header.Set("User-Agent", "test-agent")
+		mustDoRequest(t, app, req)
+
+		req = newTestRequest(t, "PUT", app.URL("/status/418"), bytes.NewReader([]byte{0xff, 0xfe}))
+		req.Header.Set("Content-Type", "image/png")
+		mustDoRequest(t, app, req)
+
+		entries := getHistory(t, app, 2)
+		assert.Equal(t, len(entries), 2, "incorrect number of requests")
+
+		teapot := entries[0]
+		assert.Equal(t, teapot.Method, "PUT", "incorrect method")
+		assert.Equal(t, teapot.URI, "/status/418", "incorrect uri")
+		assert.Equal(t, teapot.Status, http.StatusTeapot, "incorrect status")
+		assert.Equal(t, teapot.Body, "", "expected unread body to be omitted")
+
+		post := entries[1]
+		assert.Equal(t, post.Method, "POST", "incorrect method")
+		assert.Equal(t, post.URI, "/post?foo=bar", "incorrect uri")
+		assert.Equal(t, post.Status, http.StatusOK, "incorrect status")
+		assert.Equal(t, post.UserAgent, "test-agent", "incorrect user agent")
+		assert.Equal(t, post.Body, "hello", "incorrect body")
+		assert.Equal(t, post.BodySize, int64(5), "incorrect body size")
+		assert.Equal(t, post.ID, teapot.ID-1, "expected ids to increase")
+		assert.Equal(t, post.Size > 0, true, "expected response size")
+		_, err := time.ParseDuration(post.Duration)
+		assert.NilError(t, err)
+
+		req = newTestRequest(t, "GET", app.URL("/history?limit=1"), nil)
+		resp := mustDoRequest(t, app, req)
+		result := mustParseResponse[historyResponse](t, resp)
+		assert.Equal(t, len(result.Requests), 1, "incorrect number of requests")
+	})
+
+	t.Run("ok/binary body", func(t *testing.T) {
+		t.Parallel()
+		app := setupTestApp(t, WithStore(NewMemoryStore(StoreLimits{})))
+		req := newTestRequest(t, "POST", app.URL("/anything"), bytes.NewReader([]byte{0xff, 0xfe}))
+		req.Header.Set("Content-Type", "image/png")
+		mustDoRequest(t, app, req)
+
+		entries := getHistory(t, app, 1)
+		assert.Equal(t, entries[0].Body, "data:image/png;base64,__4=", "incorrect body")
+	})
+
+	t.Run("not found without store", func(t *testing.T) {
+		t.Parallel()
+		app := setupTestApp(t)
+		req := newTestRequest(t, "GET", app.URL("/history"), nil)
+		resp := mustDoRequest(t, app, req)
+		assert.StatusCode(t, resp, http.StatusNotFound)
+	})
+
+	for _, limit := range []string{"foo", "0", "1001"} {
+		t.Run("error/limit="+limit, func(t *testing.T) {
+			t.Parallel()
+			app := setupTestApp(t, WithStore(NewMemoryStore(StoreLimits{})))
+			req := newTestRequest(t, "GET", app.URL("/history?limit="+limit), nil)
+			resp := mustDoRequest(t, app, req)
+			assert.StatusCode(t, resp, http.StatusBadRequest)
+		})
+	}
+}
+
+func TestMocks(t *testing.T) {
+	t.Parallel()
+	app := setupTestApp(t, WithMocks(DefaultMocksPrefix, []Mock{
+		{
+			Method:  "GET",
+			Path:    "/users/{id}",
+			Status:  http.StatusCreated,
+			Headers: map[string]string{"Content-Type": jsonContentType, "X-Foo": "bar"},
+			Body:    []byte(`{"id":1}`),
+		},
+		{Path: "/slow", Body: []byte("done"), Delay: 50 * time.Millisecond},
+		{Path: "/too-slow", Delay: time.Minute},
+		{Path: "/empty"},
+	}))
+
+	t.Run("ok", func(t *testing.T) {
+		t.Parallel()
+		req := newTestRequest(t, "GET", app.URL("/mocks/users/123"), nil)
+		resp := mustDoRequest(t, app, req)
+		assert.StatusCode(t, resp, http.StatusCreated)
+		assert.ContentType(t, resp, jsonContentType)
+		assert.Header(t, resp, "X-Foo", "bar")
+		assert.BodyEquals(t, resp, `{"id":1}`)
+	})
+
+	t.Run("ok/any method", func(t *testing.T) {
+		t.Parallel()
+		req := newTestRequest(t, "DELETE", app.URL("/mocks/empty"), nil)
+		resp := mustDoRequest(t, app, req)
+		assert.StatusCode(t, resp, http.StatusOK)
+		assert.BodyEquals(t, resp, "")
+	})
+
+	t.Run("ok/delay", func(t *testing.T) {
+		t.Parallel()
+		start := time.Now()
+		req := newTestRequest(t, "GET", app.URL("/mocks/slow"), nil)
+		resp := mustDoRequest(t, app, req)
+		assert.StatusCode(t, resp, http.StatusOK)
+		assert.BodyEquals(t, resp, "done")
+		assert.MinDuration(t, time.Since(start), 50*time.Millisecond)
+	})
+
+	t.Run("client closed connection", func(t *testing.T) {
+		t.Parallel()
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		req := newTestRequest(t, "GET", app.URL("/mocks/too-slow"), nil).WithContext(ctx)
+		_, err := app.Client.Do(req)
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("expected context deadline exceeded, got %v", err)
+		}
+	})
+
+	t.Run("method not allowed", func(t *testing.T) {
+		t.Parallel()
+		req := newTestRequest(t, "POST", app.URL("/mocks/users/123"), nil)
+		resp := mustDoRequest(t, app, req)
+		assert.StatusCode(t, resp, http.StatusMethodNotAllowed)
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		t.Parallel()
+		req := newTestRequest(t, "GET", app.URL("/mocks/nope"), nil)
+		resp := mustDoRequest(t, app, req)
+		assert.StatusCode(t, resp, http.StatusNotFound)
+	})
+}
+
+func TestMocksAdmin(t *testing.T) {
+	t.Parallel()
+	app := setupTestApp(t, WithMocksAdmin())
+
+	createMock := func(t *testing.T, namespace, body string) *http.Response {
+		t.Helper()
+		req := newTestRequest(t, "POST", app.URL("/_mocks/"+namespace), strings.NewReader(body))
+		return mustDoRequest(t, app, req)
+	}
+
+	t.Run("ok", func(t *testing.T) {
+		t.Parallel()
+		resp := createMock(t, "ok", `{"method": "GET", "path": "/users/{id}", "status": 201, "body": {"id": 1}}`)
+		assert.StatusCode(t, resp, http.StatusCreated)
+		assert.Header(t, resp, "Location", "/_mocks/ok/1")
+		created := must.Unmarshal[mockResponse](t, resp.Body)
+		assert.DeepEqual(t, created, mockResponse{
+			ID:      1,
+			Method:  "GET",
+			Path:    "/users/{id}",
+			URL:     app.URL("/mocks/ok/users/{id}"),
+			Status:  http.StatusCreated,
+			Headers: map[string]string{"Content-Type": jsonContentType},
+			Body:    `{"id":1}`,
+			Delay:   "0s",
+		}, "incorrect mock")
+
+		req := newTestRequest(t, "GET", app.URL("/mocks/ok/users/123"), nil)
+		resp = mustDoRequest(t, app, req)
+		assert.StatusCode(t, resp, http.StatusCreated)
+		assert.ContentType(t, resp, jsonContentType)
+		assert.BodyEquals(t, resp, `{"id":1}`)
+
+		req = newTestRequest(t, "GET", app.URL("/_mocks/ok"), nil)
+		resp = mustDoRequest(t, app, req)
+		assert.StatusCode(t, resp, http.StatusOK)
+		listed := mustParseResponse[mocksResponse](t, resp)
+		assert.DeepEqual(t, listed, mocksResponse{Namespace: "ok", Mocks: []mockResponse{created}}, "incorrect mocks")
+	})
+
+	t.Run("dangerous content is escaped", func(t *testing.T) {
+		t.Parallel()
+		resp := createMock(t, "xss", `{"method": "GET", "path": "/html", "headers": {"content-type": "text/html"}, "body": "<script>alert(1)</script>"}`)
+		assert.StatusCode(t, resp, http.StatusCreated)
+		resp = createMock(t, "xss", `{"method": "GET", "path": "/text", "headers": {"Content-Type": "text/plain"}, "body": "<b>safe</b>"}`)
+		assert.StatusCode(t, resp, http.StatusCreated)
+
+		req := newTestRequest(t, "GET", app.URL("/mocks/xss/html"), nil)
+		resp = mustDoRequest(t, app, req)
+		assert.ContentType(t, resp, "text/html")
+		assert.BodyEquals(t, resp, "&lt;script&gt;alert(1)&lt;/script&gt;")
+
+		req = newTestRequest(t, "GET", app.URL("/mocks/xss/text"), nil)
+		resp = mustDoRequest(t, app, req)
+		assert.BodyEquals(t, resp, "<b>safe</b>")
+
+		// headers differing only in case could otherwise bypass escaping
+		resp = createMock(t, "xss", `{"method": "GET", "path": "/dupe", "headers": {"Content-Type": "text/plain", "content-type": "text/html"}, "body": "<script>alert(1)</script>"}`)
+		assert.StatusCode(t, resp, http.StatusBadRequest)
+		assert.BodyContains(t, resp, "duplicate headers")
+	})
+
+	t.Run("dangerous content allowed if configured", func(t *testing.T) {
+		t.Parallel()
+		app := setupTestApp(t, WithMocksAdmin(), WithUnsafeAllowDangerousResponses())
+		req := newTestRequest(t, "POST", app.URL("/_mocks/unsafe"), strings.NewReader(`{"method": "GET", "path": "/html", "headers": {"Content-Type": "text/html"}, "body": "<p>hi</p>"}`))
+		resp := mustDoRequest(t, app, req)
+		assert.StatusCode(t, resp, http.StatusCreated)
+
+		req = newTestRequest(t, "GET", app.URL("/mocks/unsafe/html"), nil)
+		resp = mustDoRequest(t, app, req)
+		assert.BodyEquals(t, resp, "<p>hi</p>")
+	})
+
+	t.Run("verify hits by content type", func(t *testing.T) {
+		t.Parallel()
+		assert.StatusCode(t, createMock(t, "verify", `{"method": "POST", "path": "/orders"}`), http.StatusCreated)
+		assert.StatusCode(t, createMock(t, "verify", `{"path": "/health"}`), http.StatusCreated)
+
+		for _, contentType := range []string{"application/json", "application/json; charset=utf-8", "text/plain", ""} {
+			req := newTestRequest(t, "POST", app.URL("/mocks/verify/orders"), strings.NewReader("{}"))
+			if contentType != "" {
+				req.Header.Set("Content-Type", contentType)
+			}
+			resp := mustDoRequest(t, app, req)
+			assert.StatusCode(t, resp, http.StatusOK)
+		}
+		req := newTestRequest(t, "GET", app.URL("/mocks/verify/unknown"), nil)
+		resp := mustDoRequest(t, app, req)
+		assert.StatusCode(t, resp, http.StatusNotFound)
+
+		req = newTestRequest(t, "GET", app.URL("/_mocks/verify/verify"), nil)
+		resp = mustDoRequest(t, app, req)
+		assert.StatusCode(t, resp, http.StatusOK)
+		result := mustParseResponse[mockVerifyResponse](t, resp)
+		assert.DeepEqual(t, result, mockVerifyResponse{
+			Namespace: "verify",
+			Mocks: []mockHitsResponse{
+				{
+					ID:     1,
+					Method: "POST",
+					Path:   "/orders",
+					Hits:   4,
+					HitsByContentType: map[string]int{
+						"application/json": 2,
+						"text/plain":       1,
+						"none":             1,
+					},
+				},
+				{ID: 2, Path: "/health", HitsByContentType: map[string]int{}},
+			},
+			Unmatched: 1,
+		}, "incorrect verification")
+	})
+
+	t.Run("namespaces are isolated", func(t *testing.T) {
+		t.Parallel()
+		assert.StatusCode(t, createMock(t, "isolated-a", `{"path": "/foo", "body": "a"}`), http.StatusCreated)
+		assert.StatusCode(t, createMock(t, "isolated-b", `{"path": "/foo", "body": "b"}`), http.StatusCreated)
+
+		for _, namespace := range []string{"isolated-a", "isolated-b"} {
+			req := newTestRequest(t, "GET", app.URL("/mocks/"+namespace+"/foo"), nil)
+			resp := mustDoRequest(t, app, req)
+			assert.StatusCode(t, resp, http.StatusOK)
+			assert.BodyEquals(t, resp, strings.TrimPrefix(namespace, "isolated-"))
+		}
+	})
+
+	t.Run("delete mock", func(t *testing.T) {
+		t.Parallel()
+		assert.StatusCode(t, createMock(t, "delete", `{"path": "/foo"}`), http.StatusCreated)
+		assert.StatusCode(t, createMock(t, "delete", `{"path": "/bar"}`), http.StatusCreated)
+
+		req := newTestRequest(t, "DELETE", app.URL("/_mocks/delete/1"), nil)
+		resp := mustDoRequest(t, app, req)
+		assert.StatusCode(t, resp, http.StatusNoContent)
+
+		req = newTestRequest(t, "GET", app.URL("/mocks/delete/foo"), nil)
+		resp = mustDoRequest(t, app, req)
+		assert.StatusCode(t, resp, http.StatusNotFound)
+
+		req = newTestRequest(t, "GET", app.URL("/mocks/delete/bar"), nil)
+		resp = mustDoRequest(t, app, req)
+		assert.StatusCode(t, resp, http.StatusOK)
+
+		req = newTestRequest(t, "DELETE", app.URL("/_mocks/delete/1"), nil)
+		resp = mustDoRequest(t, app, req)
+		assert.StatusCode(t, resp, http.StatusNotFound)
+	})
+
+	t.Run("clear namespace", func(t *testing.T) {
+		t.Parallel()
+		assert.StatusCode(t, createMock(t, "clear", `{"path": "/foo"}`), http.StatusCreated)
+
+		req := newTestRequest(t, "DELETE", app.URL("/_mocks/clear"), nil)
+		resp := mustDoRequest(t, app, req)
+		assert.StatusCode(t, resp, http.StatusNoContent)
+
+		req = newTestRequest(t, "GET", app.URL("/mocks/clear/foo"), nil)
+		resp = mustDoRequest(t, app, req)
+		assert.StatusCode(t, resp, http.StatusNotFound)
+
+		req = newTestRequest(t, "GET", app.URL("/_mocks/clear"), nil)
+		resp = mustDoRequest(t, app, req)
+		assert.StatusCode(t, resp, http.StatusNotFound)
+	})
+
+	t.Run("conflict", func(t *testing.T) {
+		t.Parallel()
+		assert.StatusCode(t, createMock(t, "conflict", `{"path": "/users/{id}"}`), http.StatusCreated)
+		resp := createMock(t, "conflict", `{"path": "/users/{name}"}`)
+		assert.StatusCode(t, resp, http.StatusConflict)
+		assert.BodyContains(t, resp, errMockConflict.Error())
+	})
+
+	errorTests := map[string]struct {
+		body    string
+		wantErr string
+	}{
+		"invalid json":    {`{"path": `, "invalid request body"},
+		"unknown field":   {`{"path": "/foo", "stauts": 200}`, `unknown field \"stauts\"`},
+		"body_file":       {`{"path": "/foo", "body_file": "/etc/passwd"}`, "body_file is not supported"},
+		"invalid path":    {`{"path": "foo"}`, "must start with a slash"},
+		"invalid pattern": {`{"path": "/{id"}`, "invalid path"},
+		"delay too long":  {`{"path": "/foo", "delay": "1h"}`, "must be <= 1s"},
+		"invalid delay":   {`{"path": "/foo", "delay": "soon"}`, "invalid delay"},
+		"invalid status":  {`{"path": "/foo", "status": 1000}`, "invalid status"},
+		"invalid method":  {`{"method": "get", "path": "/foo"}`, "invalid method"},
+	}
+	for name, tc := range errorTests {
+		t.Run("error/"+name, func(t *testing.T) {
+			t.Parallel()
+			resp := createMock(t, "errors", tc.body)
+			assert.StatusCode(t, resp, http.StatusBadRequest)
+			assert.BodyContains(t, resp, tc.wantErr)
+		})
+	}
+
+	t.Run("disabled by default", func(t *testing.T) {
+		t.Parallel()
+		app := setupTestApp(t)
+		req := newTestRequest(t, "POST", app.URL("/_mocks/foo"), strings.NewReader(`{"path": "/foo"}`))
+		resp := mustDoRequest(t, app, req)
+		assert.StatusCode(t, resp, http.StatusNotFound)
+	})
+}
+
+func TestIdempotent(t *testing.T) {
+	t.Parallel()
+	app := setupTestApp(t)
+
+	doRequest := func(t *testing.T, method, path, key, body string) *http.Response {
+		t.Helper()
+		req := newTestRequest(t, method, app.URL(path), strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		if key != "" {
+			req.Header.Set("Idempotency-Key", key)
+		}
+		return mustDoRequest(t, app, req)
+	}
+
+	t.Run("retries are replayed", func(t *testing.T) {
+		t.Parallel()
+		resp := doRequest(t, "POST", "/idempotent", "replay", `{"amount": 100}`)
+		assert.StatusCode(t, resp, http.StatusCreated)
+		assert.ContentType(t, resp, jsonContentType)
+		assert.Header(t, resp, "Idempotent-Replayed", "false")
+		first := must.ReadAll(t, resp.Body)
+		result := must.Unmarshal[idempotentResponse](t, strings.NewReader(first))
+		assert.Equal(t, result.IdempotencyKey, "replay", "incorrect idempotency key")
+		assert.Equal(t, result.Method, "POST", "incorrect method")
+		assert.DeepEqual(t, result.JSON, any(map[string]any{"amount": float64(100)}), "incorrect json")
+
+		resp = doRequest(t, "POST", "/idempotent", "replay", `{"amount": 100}`)
+		assert.StatusCode(t, resp, http.StatusCreated)
+		assert.Header(t, resp, "Idempotent-Replayed", "true")
+		assert.BodyEquals(t, resp, first)
+	})
+
+	t.Run("different payload", func(t *testing.T) {
+		t.Parallel()
+		resp := doRequest(t, "POST", "/idempotent", "mismatch", `{"amount": 100}`)
+		assert.StatusCode(t, resp, http.StatusCreated)
+
+		resp = doRequest(t, "POST", "/idempotent", "mismatch", `{"amount": 200}`)
+		assert.StatusCode(t, resp, http.StatusUnprocessableEntity)
+		assert.BodyContains(t, resp, errIdempotencyKeyMismatch.Error())
+
+		resp = doRequest(t, "PATCH", "/idempotent", "mismatch", `{"amount": 100}`)
+		assert.StatusCode(t, resp, http.StatusUnprocessableEntity)
+	})
+
+	t.Run("concurrent duplicate", func(t *testing.T) {
+		t.Parallel()
+		done := make(chan *http.Response)
+		go func() {
+			done <- doRequest(t, "PATCH", "/idempotent?delay=200ms", "in-flight", `{}`)
+		}()
+		time.Sleep(50 * time.Millisecond)
+
+		resp := doRequest(t, "PATCH", "/idempotent", "in-flight", `{}`)
+		assert.StatusCode(t, resp, http.StatusConflict)
+		assert.BodyContains(t, resp, errIdempotencyKeyInFlight.Error())
+
+		resp = <-done
+		assert.StatusCode(t, resp, http.StatusCreated)
+		resp = doRequest(t, "PATCH", "/idempotent", "in-flight", `{}`)
+		assert.Header(t, resp, "Idempotent-Replayed", "true")
+	})
+
+	t.Run("key is released if the client goes away", func(t *testing.T) {
+		t.Parallel()
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+		req := newTestRequest(t, "POST", app.URL("/idempotent?delay=1s"), strings.NewReader(`{}`)).WithContext(ctx)
+		req.Header.Set("Idempotency-Key", "released")
+		_, err := app.Client.Do(req)
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("expected context deadline exceeded, got %v", err)
+		}
+
+		// the key is released asynchronously once the handler notices the
+		// client has gone away
+		deadline := time.Now().Add(time.Second)
+		for {
+			resp := doRequest(t, "POST", "/idempotent", "released", `{}`)
+			if resp.StatusCode == http.StatusCreated {
+				assert.Header(t, resp, "Idempotent-Replayed", "false")
+				break
+			}
+			assert.StatusCode(t, resp, http.StatusConflict)
+			if time.Now().After(deadline) {
+				t.Fatal("expected key to be released")
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	})
+
+	errorTests := map[string]struct {
+		method  string
+		path    string
+		key     string
+		status  int
+		wantErr string
+	}{
+		"missing key": {
+			method:  "POST",
+			path:    "/idempotent",
+			status:  http.StatusBadRequest,
+			wantErr: "missing Idempotency-Key header",
+		},
+		"key too long": {
+			method:  "POST",
+			path:    "/idempotent",
+			key:     strings.Repeat("k", maxIdempotencyKeyLength+1),
+			status:  http.StatusBadRequest,
+			wantErr: "must be at most 255 characters",
+		},
+		"invalid ttl": {
+			method:  "POST",
+			path:    "/idempotent?ttl=48h",
+			key:     "invalid-ttl",
+			status:  http.StatusBadRequest,
+			wantErr: "invalid ttl",
+		},
+		"invalid delay": {
+			method:  "POST",
+			path:    "/idempotent?delay=1m",
+			key:     "invalid-delay",
+			status:  http.StatusBadRequest,
+			wantErr: "invalid delay",
+		},
+		"method not allowed": {
+			method: "PUT",
+			path:   "/idempotent",
+			key:    "put",
+			status: http.StatusMethodNotAllowed,
+		},
+	}
+	for name, tc := range errorTests {
+		t.Run("error/"+name, func(t *testing.T) {
+			t.Parallel()
+			resp := doRequest(t, tc.method, tc.path, tc.key, `{}`)
+			assert.StatusCode(t, resp, tc.status)
+			if tc.wantErr != "" {
+				assert.BodyContains(t, resp, tc.wantErr)
+			}
+		})
+	}
+}
+
 func TestHostname(t *testing.T) {
 	t.Run("default hostname", func(t *testing.T) {
 		t.Parallel()
@@ -4110,6 +5771,288 @@ func TestWebSocketEcho(t *testing.T) {
 	}
 }
 
+func TestWatch(t *testing.T) {
+	t.Parallel()
+	app := setupTestApp(t)
+
+	sendHook := func(t *testing.T, channel string, body string) watchHookResponse {
+		t.Helper()
+		req := newTestRequest(t, "POST", app.URL("/watch/"+channel+"/hook"), strings.NewReader(body))
+		req.Header.Set("X-Webhook-Event", "push")
+		resp := mustDoRequest(t, app, req)
+		return mustParseResponse[watchHookResponse](t, resp)
+	}
+
+	t.Run("ok/sse", func(t *testing.T) {
+		t.Parallel()
+		req := newTestRequest(t, "GET", app.URL("/watch/sse/events?count=2"), nil)
+		resp := mustDoRequest(t, app, req)
+		assert.StatusCode(t, resp, http.StatusOK)
+		assert.ContentType(t, resp, sseContentType)
+
+		// requests to other channels are not delivered
+		assert.Equal(t, sendHook(t, "other", "nope").Delivered, 0, "incorrect number of deliveries")
+		assert.Equal(t, sendHook(t, "sse", "first").Delivered, 1, "incorrect number of deliveries")
+		assert.Equal(t, sendHook(t, "sse", "second").Delivered, 1, "incorrect number of deliveries")
+
+		body := must.ReadAll(t, resp.Body)
+		events := strings.Split(strings.TrimSuffix(body, "\n\n"), "\n\n")
+		assert.Equal(t, len(events), 2, "incorrect number of events")
+		for i, wantBody := range []string{"first", "second"} {
+			eventType, data, _ := strings.Cut(events[i], "\n")
+			assert.Equal(t, eventType, "event: request", "incorrect event type")
+			var captured capturedRequest
+			assert.NilError(t, json.Unmarshal([]byte(strings.TrimPrefix(data, "data: ")), &captured))
+			assert.Equal(t, captured.Method, "POST", "incorrect method")
+			assert.Equal(t, captured.Body, wantBody, "incorrect body")
+			assert.Equal(t, captured.Headers.Get("X-Webhook-Event"), "push", "incorrect headers")
+		}
+	})
+
+	t.Run("ok/sse timeout", func(t *testing.T) {
+		t.Parallel()
+		start := time.Now()
+		req := newTestRequest(t, "GET", app.URL("/watch/timeout/events?timeout=50ms"), nil)
+		resp := mustDoRequest(t, app, req)
+		assert.StatusCode(t, resp, http.StatusOK)
+		assert.BodyEquals(t, resp, "")
+		assert.MinDuration(t, time.Since(start), 50*time.Millisecond)
+	})
+
+	t.Run("ok/websocket", func(t *testing.T) {
+		t.Parallel()
+		req := newTestRequest(t, "GET", app.URL("/watch/ws/websocket?count=1"), nil)
+		req.Header.Set("Connection", "upgrade")
+		req.Header.Set("Upgrade", "websocket")
+		req.Header.Set("Sec-WebSocket-Key", "dGhlIHNhbXBsZSBub25jZQ==")
+		req.Header.Set("Sec-WebSocket-Version", "13")
+		resp := mustDoRequest(t, app, req)
+		assert.StatusCode(t, resp, http.StatusSwitchingProtocols)
+
+		hook := sendHook(t, "ws", "hello")
+		assert.Equal(t, hook.Delivered, 1, "incorrect number of deliveries")
+
+		// read a single unfragmented text frame, followed by a close frame
+		buf := bufio.NewReader(resp.Body)
+		header := make([]byte, 2)
+		_, err := io.ReadFull(buf, header)
+		assert.NilError(t, err)
+		assert.Equal(t, header[0], byte(0b10000001), "expected final text frame")
+		payloadLen := int(header[1])
+		if payloadLen == 126 {
+			var extendedLen uint16
+			assert.NilError(t, binary.Read(buf, binary.BigEndian, &extendedLen))
+			payloadLen = int(extendedLen)
+		}
+		payload := make([]byte, payloadLen)
+		_, err = io.ReadFull(buf, payload)
+		assert.NilError(t, err)
+
+		var captured capturedRequest
+		assert.NilError(t, json.Unmarshal(payload, &captured))
+		assert.DeepEqual(t, captured, hook.Request, "incorrect captured request")
+
+		_, err = io.ReadFull(buf, header)
+		assert.NilError(t, err)
+		assert.Equal(t, header[0], byte(0b10001000), "expected close frame")
+	})
+
+	errorTests := []struct {
+		method string
+		path   string
+		status int
+	}{
+		{"GET", "/watch/bad/events?count=foo", http.StatusBadRequest},
+		{"GET", "/watch/bad/events?count=-1", http.StatusBadRequest},
+		{"GET", "/watch/bad/events?timeout=foo", http.StatusBadRequest},
+		{"GET", "/watch/bad/events?timeout=2s", http.StatusBadRequest},
+		{"GET", "/watch/bad/websocket?timeout=2s", http.StatusBadRequest},
+		{"GET", "/watch/bad/websocket", http.StatusBadRequest}, // missing handshake headers
+		{"POST", "/watch/bad/events", http.StatusMethodNotAllowed},
+	}
+	for _, test := range errorTests {
+		t.Run("error/"+test.method+test.path, func(t *testing.T) {
+			t.Parallel()
+			req := newTestRequest(t, test.method, app.URL(test.path), nil)
+			resp := mustDoRequest(t, app, req)
+			assert.StatusCode(t, resp, test.status)
+		})
+	}
+}
+
+func TestFault(t *testing.T) {
+	t.Parallel()
+
+	t.Run("reset", func(t *testing.T) {
+		t.Parallel()
+		app := setupTestApp(t)
+		req := newTestRequest(t, http.MethodGet, app.URL("/fault/reset"), nil)
+		_, err := app.Client.Do(req)
+		assert.Equal(t, errors.Is(err, syscall.ECONNRESET), true, "expected %v, got %v", syscall.ECONNRESET, err)
+	})
+
+	t.Run("empty reply", func(t *testing.T) {
+		t.Parallel()
+		app := setupTestApp(t)
+		req := newTestRequest(t, http.MethodGet, app.URL("/fault/empty-reply"), nil)
+		_, err := app.Client.Do(req)
+		assert.Equal(t, errors.Is(err, io.EOF), true, "expected %v, got %v", io.EOF, err)
+	})
+
+	t.Run("hang", func(t *testing.T) {
+		t.Parallel()
+		app := setupTestApp(t)
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+		req := newTestRequest(t, http.MethodGet, app.URL("/fault/hang"), nil).WithContext(ctx)
+		_, err := app.Client.Do(req)
+		assert.Equal(t, errors.Is(err, context.DeadlineExceeded), true, "expected %v, got %v", context.DeadlineExceeded, err)
+	})
+
+	t.Run("hang until max duration", func(t *testing.T) {
+		t.Parallel()
+		app := setupTestApp(t, WithMaxDuration(100*time.Millisecond))
+		start := time.Now()
+		req := newTestRequest(t, http.MethodGet, app.URL("/fault/hang"), nil)
+		_, err := app.Client.Do(req)
+		assert.Equal(t, errors.Is(err, io.EOF), true, "expected %v, got %v", io.EOF, err)
+		assert.MinDuration(t, time.Since(start), 100*time.Millisecond)
+	})
+
+	t.Run("close after", func(t *testing.T) {
+		t.Parallel()
+
+		testCases := []struct {
+			path              string
+			wantContentLength int64
+			wantBodySize      int
+		}{
+			{"/fault/close-after/0", 1, 0},
+			{"/fault/close-after/10", 20, 10},
+			{"/fault/close-after/10?content_length=11", 11, 10},
+			{"/fault/close-after/1024?content_length=999999", 999999, 1024},
+		}
+		for _, tc := range testCases {
+			t.Run(tc.path, func(t *testing.T) {
+				t.Parallel()
+				app := setupTestApp(t)
+				req := newTestRequest(t, http.MethodGet, app.URL(tc.path), nil)
+				resp := mustDoRequest(t, app, req)
+				assert.StatusCode(t, resp, http.StatusOK)
+				assert.Equal(t, resp.ContentLength, tc.wantContentLength, "incorrect content length")
+
+				body, err := io.ReadAll(resp.Body)
+				assert.Error(t, err, io.ErrUnexpectedEOF)
+				assert.Equal(t, len(body), tc.wantBodySize, "incorrect body size")
+			})
+		}
+	})
+
+	t.Run("close after invalid", func(t *testing.T) {
+		t.Parallel()
+
+		for _, path := range []string{
+			"/fault/close-after/-1",
+			"/fault/close-after/foo",
+			"/fault/close-after/1025",
+			"/fault/close-after/10?content_length=10",
+			"/fault/close-after/10?content_length=foo",
+		} {
+			t.Run(path, func(t *testing.T) {
+				t.Parallel()
+				app := setupTestApp(t)
+				req := newTestRequest(t, http.MethodGet, app.URL(path), nil)
+				resp := mustDoRequest(t, app, req)
+				assert.StatusCode(t, resp, http.StatusBadRequest)
+			})
+		}
+	})
+
+	t.Run("hijacking not supported", func(t *testing.T) {
+		t.Parallel()
+		app := createApp()
+		for _, path := range []string{"/fault/reset", "/fault/close-after/10", "/fault/hang", "/fault/empty-reply"} {
+			w := httptest.NewRecorder()
+			app.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+			assert.Equal(t, w.Code, http.StatusNotImplemented, "incorrect status code for %s", path)
+		}
+	})
+}
+
+func TestMalformed(t *testing.T) {
+	t.Parallel()
+
+	// readRawResponse sends a request over a raw connection and returns
+	// everything written back before the server closes the connection, since
+	// a well-behaved HTTP client would refuse to parse it.
+	readRawResponse := func(t *testing.T, app *appTestInfo, path string) string {
+		t.Helper()
+		conn, err := net.Dial("tcp", app.Srv.Listener.Addr().String())
+		assert.NilError(t, err)
+		defer conn.Close()
+		_, err = fmt.Fprintf(conn, "GET %s HTTP/1.1\r\nHost: test\r\n\r\n", path)
+		assert.NilError(t, err)
+		resp, err := io.ReadAll(conn)
+		assert.NilError(t, err)
+		return string(resp)
+	}
+
+	testCases := map[string]string{
+		"bad-chunk-size":           "Transfer-Encoding: chunked\r\n\r\nzz\r\nhello\r\n0\r\n\r\n",
+		"missing-final-chunk":      "Transfer-Encoding: chunked\r\n\r\n5\r\nhello\r\n",
+		"conflicting-length":       "Content-Length: 5\r\nTransfer-Encoding: chunked\r\n",
+		"duplicate-content-length": "Content-Length: 5\r\nContent-Length: 6\r\n",
+		"invalid-status-line":      "HTTP/1.1 2OO OK\r\n",
+		"obs-fold":                 "X-Folded: first line,\r\n  second line\r\n",
+		"oversized-headers":        "X-Oversized: " + strings.Repeat("a", defaultMalformedHeaderSize) + "\r\n",
+		"body-too-long":            "Content-Length: 5\r\n\r\nhello, this body is longer than advertised",
+	}
+	assert.Equal(t, len(testCases), len(malformedResponses), "expected test case for every kind")
+	for kind, wantContains := range testCases {
+		t.Run(kind, func(t *testing.T) {
+			t.Parallel()
+			app := setupTestApp(t)
+			resp := readRawResponse(t, app, "/malformed/"+kind)
+			assert.Contains(t, resp, wantContains, "malformed response")
+			assert.Contains(t, resp, "Connection: close\r\n", "malformed response")
+		})
+	}
+
+	t.Run("oversized-headers with size", func(t *testing.T) {
+		t.Parallel()
+		app := setupTestApp(t)
+		resp := readRawResponse(t, app, "/malformed/oversized-headers?size=10")
+		assert.Contains(t, resp, "X-Oversized: aaaaaaaaaa\r\n", "malformed response")
+	})
+
+	t.Run("rejected by go client", func(t *testing.T) {
+		t.Parallel()
+		app := setupTestApp(t)
+		req := newTestRequest(t, http.MethodGet, app.URL("/malformed/duplicate-content-length"), nil)
+		_, err := app.Client.Do(req)
+		assert.Contains(t, fmt.Sprint(err), "multiple Content-Length headers", "client error")
+	})
+
+	errorTests := []struct {
+		path       string
+		wantStatus int
+	}{
+		{"/malformed/foo", http.StatusNotFound},
+		{"/malformed/oversized-headers?size=0", http.StatusBadRequest},
+		{"/malformed/oversized-headers?size=foo", http.StatusBadRequest},
+		{fmt.Sprintf("/malformed/oversized-headers?size=%d", maxMalformedHeaderSize+1), http.StatusBadRequest},
+	}
+	for _, tc := range errorTests {
+		t.Run(tc.path, func(t *testing.T) {
+			t.Parallel()
+			app := setupTestApp(t)
+			req := newTestRequest(t, http.MethodGet, app.URL(tc.path), nil)
+			resp := mustDoRequest(t, app, req)
+			assert.StatusCode(t, resp, tc.wantStatus)
+		})
+	}
+}
+
 func newTestRequest(t *testing.T, verb, endpoint string, body io.Reader) *http.Request {
 	t.Helper()
 	req, err := http.NewRequest(verb, endpoint, body)
@@ -0,0 +1,439 @@
+package httpbin
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// DefaultHARMaxEntries is the default number of entries retained by the HAR
+// recorder.
+const DefaultHARMaxEntries = 1000
+
+// maxHARBodySize bounds the number of request and response body bytes
+// recorded for each HAR entry.
+const maxHARBodySize = 64 * 1024
+
+// harVersion is the version of the HAR format produced and accepted.
+const harVersion = "1.2"
+
+// The following types implement the subset of the HAR 1.2 format produced by
+// the recorder and used for playback, see http://www.softwareishard.com/blog/har-12-spec/
+type harFile struct {
+	Log harLog `json:"log"`
+}
+
+type harLog struct {
+	Version string     `json:"version"`
+	Creator harCreator `json:"creator"`
+	Entries []harEntry `json:"entries"`
+}
+
+type harCreator struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+type harEntry struct {
+	StartedDateTime time.Time   `json:"startedDateTime"`
+	Time            float64     `json:"time"`
+	Request         harRequest  `json:"request"`
+	Response        harResponse `json:"response"`
+	Cache           struct{}    `json:"cache"`
+	Timings         harTimings  `json:"timings"`
+}
+
+type harRequest struct {
+	Method      string         `json:"method"`
+	URL         string         `json:"url"`
+	HTTPVersion string         `json:"httpVersion"`
+	Cookies     []harNameValue `json:"cookies"`
+	Headers     []harNameValue `json:"headers"`
+	QueryString []harNameValue `json:"queryString"`
+	PostData    *harPostData   `json:"postData,omitempty"`
+	HeadersSize int64          `json:"headersSize"`
+	BodySize    int64          `json:"bodySize"`
+}
+
+type harResponse struct {
+	Status      int            `json:"status"`
+	StatusText  string         `json:"statusText"`
+	HTTPVersion string         `json:"httpVersion"`
+	Cookies     []harNameValue `json:"cookies"`
+	Headers     []harNameValue `json:"headers"`
+	Content     harContent     `json:"content"`
+	RedirectURL string         `json:"redirectURL"`
+	HeadersSize int64          `json:"headersSize"`
+	BodySize    int64          `json:"bodySize"`
+}
+
+type harNameValue struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type harPostData struct {
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text"`
+	Comment  string `json:"comment,omitempty"`
+}
+
+type harContent struct {
+	Size     int64  `json:"size"`
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text"`
+	Encoding string `json:"encoding,omitempty"`
+	Comment  string `json:"comment,omitempty"`
+}
+
+type harTimings struct {
+	Blocked float64 `json:"blocked"`
+	DNS     float64 `json:"dns"`
+	Connect float64 `json:"connect"`
+	Send    float64 `json:"send"`
+	Wait    float64 `json:"wait"`
+	Receive float64 `json:"receive"`
+}
+
+// harRecorder retains the most recent requests and responses served, for
+// export as HAR.
+type harRecorder struct {
+	mu         sync.Mutex
+	entries    []harEntry
+	maxEntries int
+
+	// requests to this path, which exports the recorded entries, are not
+	// themselves recorded
+	excludePath string
+}
+
+func newHARRecorder(maxEntries int) *harRecorder {
+	if maxEntries <= 0 {
+		maxEntries = DefaultHARMaxEntries
+	}
+	return &harRecorder{maxEntries: maxEntries}
+}
+
+// record adds an entry for the given request, started at the given time, and
+// its response, as written to mw.
+func (rec *harRecorder) record(t time.Time, r *http.Request, body *sampledBody, result Result, mw *metaResponseWriter) {
+	if r.URL.Path == rec.excludePath {
+		return
+	}
+
+	entry := harEntry{
+		StartedDateTime: t,
+		Time:            durationMillis(result.Duration),
+		Request: harRequest{
+			Method:      r.Method,
+			URL:         getURL(r).String(),
+			HTTPVersion: r.Proto,
+			Cookies:     harCookies(r.Cookies()),
+			Headers:     harHeaders(r.Header),
+			QueryString: harQueryString(r.URL.Query()),
+			HeadersSize: -1,
+		},
+		Response: harResponse{
+			Status:      result.Status,
+			StatusText:  http.StatusText(result.Status),
+			HTTPVersion: r.Proto,
+			Cookies:     harCookies((&http.Response{Header: mw.Header()}).Cookies()),
+			Headers:     harHeaders(mw.Header()),
+			Content:     newHARContent(mw.sample, result.Size, mw.Header().Get("Content-Type")),
+			RedirectURL: mw.Header().Get("Location"),
+			HeadersSize: -1,
+			BodySize:    result.Size,
+		},
+		Timings: harTimings{Blocked: -1, DNS: -1, Connect: -1, Wait: durationMillis(result.Duration)},
+	}
+	if body != nil && body.size > 0 {
+		entry.Request.BodySize = body.size
+		entry.Request.PostData = &harPostData{MimeType: r.Header.Get("Content-Type")}
+		sample := body.sample
+		if body.size > int64(len(sample)) {
+			sample = trimPartialRune(sample)
+		}
+		switch {
+		case !utf8.Valid(sample):
+			entry.Request.PostData.Comment = "binary body omitted"
+		case body.size > int64(len(sample)):
+			entry.Request.PostData.Text = string(sample)
+			entry.Request.PostData.Comment = "truncated"
+		default:
+			entry.Request.PostData.Text = string(sample)
+		}
+	}
+
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	rec.entries = append(rec.entries, entry)
+	if extra := len(rec.entries) - rec.maxEntries; extra > 0 {
+		rec.entries = slices.Delete(rec.entries, 0, extra)
+	}
+}
+
+// export returns the recorded entries as a HAR log.
+func (rec *harRecorder) export(creator harCreator) harFile {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	return harFile{Log: harLog{
+		Version: harVersion,
+		Creator: creator,
+		Entries: slices.Clone(rec.entries),
+	}}
+}
+
+func newHARContent(sample []byte, size int64, mimeType string) harContent {
+	c := harContent{Size: size, MimeType: mimeType}
+	if size > int64(len(sample)) {
+		sample = trimPartialRune(sample)
+	}
+	if utf8.Valid(sample) {
+		c.Text = string(sample)
+	} else {
+		c.Text = base64.StdEncoding.EncodeToString(sample)
+		c.Encoding = "base64"
+	}
+	if size > int64(len(sample)) {
+		c.Comment = "truncated"
+	}
+	return c
+}
+
+// harRedactedValue replaces the values of credentials in exported HAR logs.
+const harRedactedValue = "REDACTED"
+
+// harRedactedHeaders are headers that commonly carry credentials, whose
+// values are redacted from exported HAR logs along with all cookie values.
+var harRedactedHeaders = []string{"Authorization", "Cookie", "Proxy-Authorization", "Set-Cookie", "X-Api-Key", "X-Auth-Token"}
+
+func harHeaders(h http.Header) []harNameValue {
+	pairs := harNameValues(h)
+	for i, pair := range pairs {
+		if slices.Contains(harRedactedHeaders, http.CanonicalHeaderKey(pair.Name)) {
+			pairs[i].Value = harRedactedValue
+		}
+	}
+	return pairs
+}
+
+func harQueryString(q url.Values) []harNameValue {
+	return harNameValues(q)
+}
+
+func harNameValues(values map[string][]string) []harNameValue {
+	pairs := []harNameValue{}
+	for _, name := range slices.Sorted(maps.Keys(values)) {
+		for _, value := range values[name] {
+			pairs = append(pairs, harNameValue{Name: name, Value: value})
+		}
+	}
+	return pairs
+}
+
+func harCookies(cookies []*http.Cookie) []harNameValue {
+	pairs := make([]harNameValue, 0, len(cookies))
+	for _, c := range cookies {
+		pairs = append(pairs, harNameValue{Name: c.Name, Value: harRedactedValue})
+	}
+	return pairs
+}
+
+func durationMillis(d time.Duration) float64 {
+	return d.Seconds() * 1e3
+}
+
+// HARArchive holds the entries loaded from a HAR file, to be served as mock
+// responses via WithHAR.
+type HARArchive struct {
+	entries []harPlaybackEntry
+}
+
+// Len returns the number of entries in the archive.
+func (a *HARArchive) Len() int {
+	return len(a.entries)
+}
+
+// harPlaybackEntry is a HAR entry prepared for playback.
+type harPlaybackEntry struct {
+	method   string
+	path     string
+	query    url.Values
+	status   int
+	headers  http.Header
+	mimeType string
+	body     []byte
+	time     time.Duration
+}
+
+// LoadHAR loads the entries from the HAR 1.2 file at the given path.
+func LoadHAR(path string) (*HARArchive, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return parseHAR(data)
+}
+
+func parseHAR(data []byte) (*HARArchive, error) {
+	var f struct {
+		Log *harLog `json:"log"`
+	}
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("invalid JSON: %w", err)
+	}
+	if f.Log == nil {
+		return nil, errors.New("missing log")
+	}
+
+	archive := &HARArchive{entries: make([]harPlaybackEntry, 0, len(f.Log.Entries))}
+	for i, entry := range f.Log.Entries {
+		e, err := newHARPlaybackEntry(entry)
+		if err != nil {
+			return nil, fmt.Errorf("entry %d: %w", i, err)
+		}
+		archive.entries = append(archive.entries, e)
+	}
+	return archive, nil
+}
+
+func newHARPlaybackEntry(entry harEntry) (harPlaybackEntry, error) {
+	if entry.Request.Method == "" {
+		return harPlaybackEntry{}, errors.New("missing request method")
+	}
+	u, err := url.Parse(entry.Request.URL)
+	if err != nil {
+		return harPlaybackEntry{}, fmt.Errorf("invalid request url: %w", err)
+	}
+	if status := entry.Response.Status; status < 100 || status > 599 {
+		return harPlaybackEntry{}, fmt.Errorf("invalid response status %d, must be in range [100, 599]", status)
+	}
+
+	body := []byte(entry.Response.Content.Text)
+	if entry.Response.Content.Encoding == "base64" {
+		body, err = base64.StdEncoding.DecodeString(entry.Response.Content.Text)
+		if err != nil {
+			return harPlaybackEntry{}, fmt.Errorf("invalid response content: %w", err)
+		}
+	}
+	headers := make(http.Header, len(entry.Response.Headers))
+	for _, h := range entry.Response.Headers {
+		headers.Add(h.Name, h.Value)
+	}
+	path := u.Path
+	if path == "" {
+		path = "/"
+	}
+	return harPlaybackEntry{
+		method:   entry.Request.Method,
+		path:     path,
+		query:    u.Query(),
+		status:   entry.Response.Status,
+		headers:  headers,
+		mimeType: entry.Response.Content.MimeType,
+		body:     body,
+		time:     time.Duration(max(entry.Time, 0) * float64(time.Millisecond)),
+	}, nil
+}
+
+// harSkipHeaders are response headers that are not played back, because they
+// describe the recorded response's encoding rather than its content.
+var harSkipHeaders = []string{"Connection", "Content-Encoding", "Content-Length", "Content-Type", "Keep-Alive", "Transfer-Encoding"}
+
+// harPlayer serves the entries in a HARArchive, matched by method and path
+// relative to prefix. Entries whose query strings also match are preferred.
+type harPlayer struct {
+	entries     map[string][]harPlaybackEntry
+	prefix      string
+	timings     bool
+	maxDuration time.Duration
+
+	mu     sync.Mutex
+	served map[string]int
+}
+
+func newHARPlayer(archive *HARArchive, prefix string, timings bool, maxDuration time.Duration) *harPlayer {
+	p := &harPlayer{
+		entries:     make(map[string][]harPlaybackEntry),
+		prefix:      prefix,
+		timings:     timings,
+		maxDuration: maxDuration,
+		served:      make(map[string]int),
+	}
+	for _, e := range archive.entries {
+		key := e.method + " " + e.path
+		p.entries[key] = append(p.entries[key], e)
+	}
+	return p
+}
+
+// next returns the entry to serve in response to the given request. Repeated
+// requests are served the matching entries in the order they were recorded,
+// after which the last is served again.
+func (p *harPlayer) next(r *http.Request) (harPlaybackEntry, bool) {
+	key := r.Method + " " + strings.TrimPrefix(r.URL.Path, p.prefix)
+	candidates := p.entries[key]
+	if len(candidates) == 0 {
+		return harPlaybackEntry{}, false
+	}
+	query := r.URL.Query()
+	var exact []harPlaybackEntry
+	for _, e := range candidates {
+		if maps.EqualFunc(e.query, query, slices.Equal) {
+			exact = append(exact, e)
+		}
+	}
+	if len(exact) > 0 {
+		candidates = exact
+		key += "?" + query.Encode()
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	i := min(p.served[key], len(candidates)-1)
+	p.served[key] = i + 1
+	return candidates[i], true
+}
+
+func (p *harPlayer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	e, ok := p.next(r)
+	if !ok {
+		writeError(w, http.StatusNotFound, fmt.Errorf("no HAR entry matches %s %s", r.Method, strings.TrimPrefix(r.URL.Path, p.prefix)))
+		return
+	}
+	p.serve(w, r, e)
+}
+
+// serve writes the given entry's recorded response.
+func (p *harPlayer) serve(w http.ResponseWriter, r *http.Request, e harPlaybackEntry) {
+	if p.timings && e.time > 0 {
+		select {
+		case <-r.Context().Done():
+			w.WriteHeader(499) // "Client Closed Request" https://httpstatuses.com/499
+			return
+		case <-time.After(min(e.time, p.maxDuration)):
+		}
+	}
+
+	for name, values := range e.headers {
+		if slices.Contains(harSkipHeaders, name) {
+			continue
+		}
+		w.Header()[name] = values
+	}
+	mimeType := e.mimeType
+	if mimeType == "" {
+		mimeType = binaryContentType
+	}
+	writeResponse(w, e.status, mimeType, e.body)
+}
@@ -0,0 +1,257 @@
+package httpbin
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mccutchen/go-httpbin/v2/internal/testing/assert"
+)
+
+func TestHARRecorder(t *testing.T) {
+	t.Parallel()
+	app := setupTestApp(t, WithHARRecorder(2))
+
+	req := newTestRequest(t, "GET", app.URL("/get"), nil)
+	mustDoRequest(t, app, req)
+
+	req = newTestRequest(t, "POST", app.URL("/post?foo=bar"), strings.NewReader("hello"))
+	req.Header.Set("Content-Type", "text/plain")
+	req.AddCookie(&http.Cookie{Name: "session", Value: "abc"})
+	mustDoRequest(t, app, req)
+
+	req = newTestRequest(t, "GET", app.URL("/bytes/100?seed=1"), nil)
+	mustDoRequest(t, app, req)
+
+	req = newTestRequest(t, "GET", app.URL("/har"), nil)
+	resp := mustDoRequest(t, app, req)
+	har := mustParseResponse[harFile](t, resp)
+	assert.Equal(t, har.Log.Version, "1.2", "incorrect version")
+	assert.Equal(t, har.Log.Creator.Name, "go-httpbin", "incorrect creator")
+	assert.Equal(t, len(har.Log.Entries), 2, "expected oldest entry to be discarded")
+
+	entry := har.Log.Entries[0]
+	assert.Equal(t, entry.Request.Method, "POST", "incorrect method")
+	assert.Equal(t, entry.Request.URL, app.URL("/post?foo=bar"), "incorrect url")
+	assert.DeepEqual(t, entry.Request.QueryString, []harNameValue{{Name: "foo", Value: "bar"}}, "incorrect query string")
+	assert.DeepEqual(t, entry.Request.Cookies, []harNameValue{{Name: "session", Value: "REDACTED"}}, "incorrect cookies")
+	assert.DeepEqual(t, entry.Request.PostData, &harPostData{MimeType: "text/plain", Text: "hello"}, "incorrect post data")
+	assert.Equal(t, entry.Response.Status, http.StatusOK, "incorrect status")
+	assert.Equal(t, entry.Response.StatusText, "OK", "incorrect status text")
+	assert.Equal(t, entry.Response.Content.MimeType, jsonContentType, "incorrect mime type")
+
+	entry = har.Log.Entries[1]
+	assert.Equal(t, entry.Response.Content.Encoding, "base64", "expected binary content to be base64 encoded")
+	assert.Equal(t, entry.Response.Content.Size, int64(100), "incorrect content size")
+
+	t.Run("round trip", func(t *testing.T) {
+		t.Parallel()
+		data, err := os.ReadFile(writeHAR(t, har))
+		assert.NilError(t, err)
+		archive, err := parseHAR(data)
+		assert.NilError(t, err)
+		assert.Equal(t, archive.Len(), 2, "incorrect number of entries")
+
+		player := setupTestApp(t, WithHAR(archive, false))
+		req := newTestRequest(t, "GET", player.URL("/mocks/bytes/100?seed=1"), nil)
+		resp := mustDoRequest(t, player, req)
+		assert.StatusCode(t, resp, http.StatusOK)
+		assert.ContentType(t, resp, binaryContentType)
+		assert.BodySize(t, resp, 100)
+	})
+
+	t.Run("credentials are redacted", func(t *testing.T) {
+		t.Parallel()
+		app := setupTestApp(t, WithHARRecorder(1))
+
+		req := newTestRequest(t, "GET", app.URL("/cookies/set?token=secret"), nil)
+		req.Header.Set("Authorization", "Bearer secret")
+		req.Header.Set("X-Api-Key", "secret")
+		req.AddCookie(&http.Cookie{Name: "session", Value: "secret"})
+		resp, err := app.Client.Transport.RoundTrip(req)
+		assert.NilError(t, err)
+		assert.StatusCode(t, resp, http.StatusFound)
+
+		req = newTestRequest(t, "GET", app.URL("/har"), nil)
+		resp = mustDoRequest(t, app, req)
+		har := mustParseResponse[harFile](t, resp)
+		assert.Equal(t, len(har.Log.Entries), 1, "incorrect number of entries")
+		entry := har.Log.Entries[0]
+		for _, pairs := range [][]harNameValue{
+			entry.Request.Headers,
+			entry.Request.Cookies,
+			entry.Response.Headers,
+			entry.Response.Cookies,
+		} {
+			for _, pair := range pairs {
+				if strings.Contains(pair.Value, "secret") {
+					t.Fatalf("expected %s to be redacted, got %q", pair.Name, pair.Value)
+				}
+			}
+		}
+		assert.DeepEqual(t, entry.Response.Cookies, []harNameValue{{Name: "token", Value: "REDACTED"}}, "incorrect response cookies")
+	})
+
+	t.Run("disabled by default", func(t *testing.T) {
+		t.Parallel()
+		app := setupTestApp(t)
+		req := newTestRequest(t, "GET", app.URL("/har"), nil)
+		resp := mustDoRequest(t, app, req)
+		assert.StatusCode(t, resp, http.StatusNotFound)
+	})
+}
+
+func TestHARPlayback(t *testing.T) {
+	t.Parallel()
+
+	archive, err := LoadHAR(writeHAR(t, harFile{Log: harLog{Entries: []harEntry{
+		newTestHAREntry("GET", "http://example.com/users?page=1", http.StatusOK, "page 1", 0),
+		newTestHAREntry("GET", "http://example.com/users?page=2", http.StatusOK, "page 2", 0),
+		newTestHAREntry("POST", "http://example.com/users", http.StatusCreated, "first", 0),
+		newTestHAREntry("POST", "http://example.com/users", http.StatusConflict, "second", 0),
+		newTestHAREntry("GET", "http://example.com/slow", http.StatusOK, "slow", 100*time.Millisecond),
+	}}}))
+	assert.NilError(t, err)
+
+	for _, timings := range []bool{false, true} {
+		app := setupTestApp(t, WithHAR(archive, timings))
+
+		t.Run("query strings are matched", func(t *testing.T) {
+			t.Parallel()
+			req := newTestRequest(t, "GET", app.URL("/mocks/users?page=2"), nil)
+			resp := mustDoRequest(t, app, req)
+			assert.StatusCode(t, resp, http.StatusOK)
+			assert.ContentType(t, resp, textContentType)
+			assert.Header(t, resp, "X-Recorded", "true")
+			assert.BodyEquals(t, resp, "page 2")
+
+			// unmatched query strings fall back to the first entry for the path
+			req = newTestRequest(t, "GET", app.URL("/mocks/users?page=3"), nil)
+			resp = mustDoRequest(t, app, req)
+			assert.BodyEquals(t, resp, "page 1")
+		})
+
+		t.Run("repeated requests are served in order", func(t *testing.T) {
+			t.Parallel()
+			for _, want := range []string{"first", "second", "second"} {
+				req := newTestRequest(t, "POST", app.URL("/mocks/users"), nil)
+				resp := mustDoRequest(t, app, req)
+				assert.BodyEquals(t, resp, want)
+			}
+		})
+
+		t.Run("timings", func(t *testing.T) {
+			t.Parallel()
+			start := time.Now()
+			req := newTestRequest(t, "GET", app.URL("/mocks/slow"), nil)
+			resp := mustDoRequest(t, app, req)
+			assert.BodyEquals(t, resp, "slow")
+			elapsed := time.Since(start)
+			if timings {
+				assert.MinDuration(t, elapsed, 100*time.Millisecond)
+			} else if elapsed >= 100*time.Millisecond {
+				t.Fatalf("expected recorded timings to be ignored, took %s", elapsed)
+			}
+		})
+
+		t.Run("not found", func(t *testing.T) {
+			t.Parallel()
+			req := newTestRequest(t, "DELETE", app.URL("/mocks/users"), nil)
+			resp := mustDoRequest(t, app, req)
+			assert.StatusCode(t, resp, http.StatusNotFound)
+			assert.BodyContains(t, resp, "no HAR entry matches DELETE /users")
+		})
+	}
+
+	t.Run("with runtime mocks", func(t *testing.T) {
+		t.Parallel()
+		archive, err := LoadHAR(writeHAR(t, harFile{Log: harLog{Entries: []harEntry{
+			newTestHAREntry("GET", "http://example.com/api/users", http.StatusOK, "users", 0),
+		}}}))
+		assert.NilError(t, err)
+		app := setupTestApp(t, WithHAR(archive, false), WithMocksAdmin())
+
+		// multi-segment paths are matched by the runtime mocks' pattern, but
+		// still reach HAR entries when no runtime mock matches
+		req := newTestRequest(t, "GET", app.URL("/mocks/api/users"), nil)
+		resp := mustDoRequest(t, app, req)
+		assert.StatusCode(t, resp, http.StatusOK)
+		assert.BodyEquals(t, resp, "users")
+
+		// runtime mocks take precedence over HAR entries
+		req = newTestRequest(t, "POST", app.URL("/_mocks/api"), strings.NewReader(`{"method":"GET","path":"/users","body":"mocked"}`))
+		resp = mustDoRequest(t, app, req)
+		assert.StatusCode(t, resp, http.StatusCreated)
+		req = newTestRequest(t, "GET", app.URL("/mocks/api/users"), nil)
+		resp = mustDoRequest(t, app, req)
+		assert.BodyEquals(t, resp, "mocked")
+
+		req = newTestRequest(t, "GET", app.URL("/mocks/api/other"), nil)
+		resp = mustDoRequest(t, app, req)
+		assert.StatusCode(t, resp, http.StatusNotFound)
+		assert.BodyContains(t, resp, `no mock in namespace \"api\" matches GET /other`)
+	})
+}
+
+func TestLoadHAR(t *testing.T) {
+	t.Parallel()
+
+	errorTests := map[string]struct {
+		data    string
+		wantErr string
+	}{
+		"invalid json": {
+			data:    `{"log": `,
+			wantErr: "invalid JSON: unexpected end of JSON input",
+		},
+		"missing log": {
+			data:    `{"mocks": []}`,
+			wantErr: "missing log",
+		},
+		"missing method": {
+			data:    `{"log": {"entries": [{"request": {"url": "/foo"}, "response": {"status": 200}}]}}`,
+			wantErr: "entry 0: missing request method",
+		},
+		"invalid status": {
+			data:    `{"log": {"entries": [{"request": {"method": "GET", "url": "/foo"}, "response": {"status": 0}}]}}`,
+			wantErr: "entry 0: invalid response status 0, must be in range [100, 599]",
+		},
+		"invalid content": {
+			data:    `{"log": {"entries": [{"request": {"method": "GET", "url": "/foo"}, "response": {"status": 200, "content": {"text": "!", "encoding": "base64"}}}]}}`,
+			wantErr: "entry 0: invalid response content: illegal base64 data at input byte 0",
+		},
+	}
+	for name, tc := range errorTests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			_, err := parseHAR([]byte(tc.data))
+			assert.Error(t, err, errors.New(tc.wantErr))
+		})
+	}
+}
+
+func newTestHAREntry(method, url string, status int, body string, d time.Duration) harEntry {
+	return harEntry{
+		Time:    durationMillis(d),
+		Request: harRequest{Method: method, URL: url},
+		Response: harResponse{
+			Status:  status,
+			Headers: []harNameValue{{Name: "X-Recorded", Value: "true"}, {Name: "Content-Length", Value: "999"}},
+			Content: harContent{MimeType: textContentType, Text: body},
+		},
+	}
+}
+
+func writeHAR(t *testing.T, har harFile) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "test.har")
+	data, err := json.Marshal(har)
+	assert.NilError(t, err)
+	assert.NilError(t, os.WriteFile(path, data, 0o644))
+	return path
+}
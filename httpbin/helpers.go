@@ -1,10 +1,12 @@
 package httpbin
 
 import (
+	"bufio"
 	"bytes"
 	"context"
 	crypto_rand "crypto/rand"
 	"crypto/sha1"
+	"crypto/subtle"
 	"encoding/base64"
 	"encoding/json"
 	"errors"
@@ -17,10 +19,12 @@ import (
 	"net/http"
 	"net/url"
 	"regexp"
+	"slices"
 	"strconv"
 	"strings"
 	"sync"
 	"time"
+	"unicode/utf8"
 )
 
 // requestHeaders takes in incoming request and returns an http.Header map
@@ -172,10 +176,42 @@ func parseCookieAttrs(params url.Values, defaultSecure bool) http.Cookie {
 	return c
 }
 
+// validCSRFToken checks that the CSRF token submitted with a request, either
+// as a form field or a header, matches the token in the request's CSRF
+// cookie. Callers must parse the request's form before calling.
+func validCSRFToken(r *http.Request) bool {
+	c, err := r.Cookie(csrfCookieName)
+	if err != nil || c.Value == "" {
+		return false
+	}
+	token := r.PostForm.Get(csrfFormField)
+	if token == "" {
+		token = r.Header.Get(csrfHeader)
+	}
+	return subtle.ConstantTimeCompare([]byte(token), []byte(c.Value)) == 1
+}
+
 func parseBoolParam(s string) bool {
 	return s == "1" || strings.EqualFold(s, "true")
 }
 
+// getAPIKey looks up an API key with the given name in the given location of
+// the request, where in is one of "header", "query", or "cookie".
+func getAPIKey(r *http.Request, in, name string) (string, bool) {
+	var key string
+	switch in {
+	case "header":
+		key = r.Header.Get(name)
+	case "query":
+		key = r.URL.Query().Get(name)
+	case "cookie":
+		if c, err := r.Cookie(name); err == nil {
+			key = c.Value
+		}
+	}
+	return key, key != ""
+}
+
 func writeResponse(w http.ResponseWriter, status int, contentType string, body []byte) {
 	w.Header().Set("Content-Type", contentType)
 	w.WriteHeader(status)
@@ -321,6 +357,21 @@ func encodeData(body []byte, contentType string) string {
 	return string("data:" + contentType + ";base64," + data)
 }
 
+// trimPartialRune removes an incomplete UTF-8 encoded rune from the end of a
+// truncated body sample, so that truncation alone does not make a text body
+// look like binary data.
+func trimPartialRune(sample []byte) []byte {
+	for i := len(sample) - 1; i >= 0 && i >= len(sample)-utf8.UTFMax; i-- {
+		if utf8.RuneStart(sample[i]) {
+			if !utf8.FullRune(sample[i:]) {
+				return sample[:i]
+			}
+			break
+		}
+	}
+	return sample
+}
+
 func parseStatusCode(input string) (int, error) {
 	return parseBoundedStatusCode(input, 100, 599)
 }
@@ -367,6 +418,30 @@ func parseBoundedDuration(input string, minVal, maxVal time.Duration) (time.Dura
 	return d, err
 }
 
+// parseRetryAfter parses a Retry-After value given as either a number of
+// seconds or an HTTP-date, which must not ask clients to wait longer than
+// maxDuration. The value is returned in a form suitable for the Retry-After
+// header.
+func parseRetryAfter(input string, maxDuration time.Duration) (string, error) {
+	if seconds, err := strconv.ParseInt(input, 10, 64); err == nil {
+		if seconds < 0 {
+			return "", fmt.Errorf("%d seconds must not be negative", seconds)
+		}
+		if seconds > int64(maxDuration/time.Second) {
+			return "", fmt.Errorf("%d seconds longer than %s", seconds, maxDuration)
+		}
+		return strconv.FormatInt(seconds, 10), nil
+	}
+	t, err := http.ParseTime(input)
+	if err != nil {
+		return "", fmt.Errorf("%q must be a number of seconds or an HTTP-date", input)
+	}
+	if wait := time.Until(t); wait > maxDuration {
+		return "", fmt.Errorf("date %s more than %s in the future", input, maxDuration)
+	}
+	return t.UTC().Format(http.TimeFormat), nil
+}
+
 // Returns a new rand.Rand from the given seed string.
 func parseSeed(rawSeed string) (*rand.Rand, error) {
 	var seed int64
@@ -525,6 +600,16 @@ func uuidv4() string {
 	return fmt.Sprintf("%x-%x-%x-%x-%x", buff[0:4], buff[4:6], buff[6:8], buff[8:10], buff[10:])
 }
 
+// randomToken returns a random, URL-safe token suitable for use as an
+// unguessable identifier.
+func randomToken() string {
+	buff := make([]byte, 16)
+	if _, err := crypto_rand.Read(buff); err != nil {
+		panic(err)
+	}
+	return fmt.Sprintf("%x", buff)
+}
+
 // base64Helper encapsulates a base64 operation (encode or decode) and its input
 // data.
 type base64Helper struct {
@@ -740,3 +825,279 @@ func isDangerousContentType(ct string) bool {
 	}
 	return !safeContentTypes[mediatype]
 }
+
+// hijackConn takes over the client connection underlying the given response,
+// writing an error response if the connection cannot be hijacked (e.g. for
+// HTTP/2 requests).
+func hijackConn(w http.ResponseWriter) (net.Conn, *bufio.ReadWriter, bool) {
+	hj, ok := w.(http.Hijacker)
+	if !ok {
+		writeError(w, http.StatusNotImplemented, errors.New("connection faults require an HTTP/1.x connection"))
+		return nil, nil, false
+	}
+	conn, buf, err := hj.Hijack()
+	if errors.Is(err, http.ErrNotSupported) {
+		writeError(w, http.StatusNotImplemented, errors.New("connection faults require an HTTP/1.x connection"))
+		return nil, nil, false
+	} else if err != nil {
+		writeError(w, http.StatusInternalServerError, fmt.Errorf("failed to hijack connection: %w", err))
+		return nil, nil, false
+	}
+	return conn, buf, true
+}
+
+// maxSlowHeadersCount is the max number of extra headers the /slow-headers
+// endpoint will trickle out.
+const maxSlowHeadersCount = 100
+
+// slowHeadersWriter is an http.ResponseWriter that writes directly to a
+// hijacked connection, trickling out the status line and each header line
+// with a pause between them, to simulate a server that stalls before its
+// response body.
+//
+// Responses without a Content-Length are sent using chunked encoding. The
+// connection is closed when the writer is closed.
+type slowHeadersWriter struct {
+	ctx     context.Context
+	conn    net.Conn
+	buf     *bufio.ReadWriter
+	header  http.Header
+	pause   time.Duration
+	budget  time.Duration
+	chunked bool
+
+	wroteHeader bool
+	err         error
+}
+
+// slowHeadersGracePeriod is added to the deadline of hijacked connections, so
+// that responses paced to finish just within their time limit are not cut
+// off.
+const slowHeadersGracePeriod = time.Second
+
+// newSlowHeadersWriter hijacks the connection underlying the given response,
+// writing an error response if that is not possible. The total time spent
+// pausing between header lines is capped at budget.
+//
+// The server's timeouts no longer apply to the hijacked connection, so writes
+// to it fail once timeout has elapsed, bounding the time spent on clients
+// that stop reading.
+func newSlowHeadersWriter(w http.ResponseWriter, r *http.Request, pause, budget, timeout time.Duration) (*slowHeadersWriter, bool) {
+	header := w.Header().Clone()
+	conn, buf, ok := hijackConn(w)
+	if !ok {
+		return nil, false
+	}
+	if err := conn.SetDeadline(time.Now().Add(timeout + slowHeadersGracePeriod)); err != nil {
+		conn.Close()
+		return nil, false
+	}
+	return &slowHeadersWriter{
+		ctx:    r.Context(),
+		conn:   conn,
+		buf:    buf,
+		header: header,
+		pause:  pause,
+		budget: budget,
+	}, true
+}
+
+func (sw *slowHeadersWriter) Header() http.Header {
+	return sw.header
+}
+
+func (sw *slowHeadersWriter) WriteHeader(code int) {
+	if sw.wroteHeader {
+		return
+	}
+	sw.wroteHeader = true
+
+	sw.header.Set("Connection", "close")
+	if sw.header.Get("Content-Length") == "" {
+		sw.chunked = true
+		sw.header.Set("Transfer-Encoding", "chunked")
+	}
+
+	lines := []string{fmt.Sprintf("HTTP/1.1 %d %s", code, http.StatusText(code))}
+	keys := make([]string, 0, len(sw.header))
+	for key := range sw.header {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	for _, key := range keys {
+		for _, val := range sw.header[key] {
+			lines = append(lines, key+": "+val)
+		}
+	}
+	lines = append(lines, "")
+
+	// stay within the budget by shortening the pause between lines, if
+	// necessary
+	pause := min(sw.pause, sw.budget/time.Duration(len(lines)-1))
+
+	written := 0
+	for i := range newPacer(sw.ctx, len(lines), pause, 0) {
+		sw.buf.WriteString(lines[i] + "\r\n")
+		if err := sw.buf.Flush(); err != nil {
+			sw.err = err
+			return
+		}
+		written++
+	}
+	if written < len(lines) {
+		sw.err = sw.ctx.Err()
+	}
+}
+
+func (sw *slowHeadersWriter) Write(b []byte) (int, error) {
+	if !sw.wroteHeader {
+		sw.WriteHeader(http.StatusOK)
+	}
+	if sw.err != nil {
+		return 0, sw.err
+	}
+	if len(b) == 0 {
+		return 0, nil
+	}
+	if !sw.chunked {
+		return sw.buf.Write(b)
+	}
+	fmt.Fprintf(sw.buf, "%x\r\n", len(b))
+	n, err := sw.buf.Write(b)
+	sw.buf.WriteString("\r\n")
+	return n, err
+}
+
+func (sw *slowHeadersWriter) Flush() {
+	if sw.err == nil {
+		sw.err = sw.buf.Flush()
+	}
+}
+
+// Close finishes the response and closes the underlying connection.
+func (sw *slowHeadersWriter) Close() error {
+	if !sw.wroteHeader {
+		sw.WriteHeader(http.StatusOK)
+	}
+	if sw.err == nil {
+		if sw.chunked {
+			sw.buf.WriteString("0\r\n\r\n")
+		}
+		sw.buf.Flush()
+	}
+	return sw.conn.Close()
+}
+
+// resetConn abruptly closes the given connection with a TCP RST instead of
+// the usual graceful FIN, by setting SO_LINGER to 0 before closing it.
+//
+// Wrapped connections, like TLS connections or those returned by listeners
+// that limit the number of open connections, are unwrapped via their NetConn
+// method to reach the underlying TCP connection. TLS connections are closed
+// without sending a close_notify alert, as a reset connection would be.
+func resetConn(conn net.Conn) error {
+	for {
+		wrapped, ok := conn.(interface{ NetConn() net.Conn })
+		if !ok {
+			break
+		}
+		conn = wrapped.NetConn()
+	}
+	if tcpConn, ok := conn.(*net.TCPConn); ok {
+		if err := tcpConn.SetLinger(0); err != nil {
+			conn.Close()
+			return err
+		}
+	}
+	return conn.Close()
+}
+
+// Headers used to request fault injection via WithFaultInjectionHeaders. Each
+// may also be given as a query parameter, e.g. _httpbin_delay for
+// X-Httpbin-Delay.
+const (
+	faultDelayHeader    = "X-Httpbin-Delay"
+	faultJitterHeader   = "X-Httpbin-Jitter"
+	faultFailRateHeader = "X-Httpbin-Fail-Rate"
+	faultStatusHeader   = "X-Httpbin-Status"
+	faultSeedHeader     = "X-Httpbin-Seed"
+)
+
+// faultInjection describes the faults a client requested be injected into
+// the response to a request.
+type faultInjection struct {
+	delay    time.Duration
+	failRate float64
+	statuses []weightedChoice[int]
+	rng      *rand.Rand
+}
+
+// getFaultParam returns the value of the given fault injection header, falling
+// back to the equivalent _httpbin_* query parameter.
+func getFaultParam(r *http.Request, header string) string {
+	if val := r.Header.Get(header); val != "" {
+		return val
+	}
+	param := "_httpbin_" + strings.ReplaceAll(strings.ToLower(strings.TrimPrefix(header, "X-Httpbin-")), "-", "_")
+	return r.URL.Query().Get(param)
+}
+
+// parseFaultInjection parses the faults requested via headers or query
+// params, returning nil if no faults were requested.
+//
+// A requested status implies a fail rate of 1, and a requested fail rate
+// implies a status of 500, unless both are given.
+func parseFaultInjection(r *http.Request, maxDuration time.Duration) (*faultInjection, error) {
+	var (
+		rawDelay    = getFaultParam(r, faultDelayHeader)
+		rawJitter   = getFaultParam(r, faultJitterHeader)
+		rawFailRate = getFaultParam(r, faultFailRateHeader)
+		rawStatus   = getFaultParam(r, faultStatusHeader)
+		err         error
+	)
+	if rawDelay == "" && rawFailRate == "" && rawStatus == "" {
+		return nil, nil
+	}
+
+	f := &faultInjection{}
+
+	if rawDelay != "" {
+		f.delay, err = parseBoundedDuration(rawDelay, 0, maxDuration)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s: %w", faultDelayHeader, err)
+		}
+	}
+
+	if rawJitter != "" {
+		jitter, err := strconv.ParseFloat(rawJitter, 64)
+		if err != nil || jitter < 0 || jitter > 1 {
+			return nil, fmt.Errorf("invalid %s: must be a float in range [0, 1]", faultJitterHeader)
+		}
+		f.delay = min(applyJitter(f.delay, jitter), maxDuration)
+	}
+
+	f.statuses = []weightedChoice[int]{{Choice: http.StatusInternalServerError, Weight: 1}}
+	if rawStatus != "" {
+		f.statuses, err = parseWeightedChoices(rawStatus, func(s string) (int, error) {
+			return parseBoundedStatusCode(s, 400, 599)
+		})
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s: %w", faultStatusHeader, err)
+		}
+		f.failRate = 1
+	}
+
+	if rawFailRate != "" {
+		f.failRate, err = strconv.ParseFloat(rawFailRate, 64)
+		if err != nil || f.failRate < 0 || f.failRate > 1 {
+			return nil, fmt.Errorf("invalid %s: must be a float in range [0, 1]", faultFailRateHeader)
+		}
+	}
+
+	f.rng, err = parseSeed(getFaultParam(r, faultSeedHeader))
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", faultSeedHeader, err)
+	}
+
+	return f, nil
+}
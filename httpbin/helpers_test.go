@@ -597,6 +597,27 @@ func TestWeightedRandomChoice(t *testing.T) {
 	}
 }
 
+func TestTrimPartialRune(t *testing.T) {
+	t.Parallel()
+	testCases := map[string]struct {
+		sample string
+		want   string
+	}{
+		"empty":               {"", ""},
+		"ascii":               {"abc", "abc"},
+		"complete rune":       {"abé", "abé"},
+		"partial 2 byte rune": {"ab\xc3", "ab"},
+		"partial 4 byte rune": {"ab\xf0\x9f\x98", "ab"},
+		"invalid bytes":       {"ab\xff", "ab\xff"},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			assert.Equal(t, string(trimPartialRune([]byte(tc.sample))), tc.want, "incorrect result")
+		})
+	}
+}
+
 func TestIsDangerousContentType(t *testing.T) {
 	testCases := []struct {
 		contentType string
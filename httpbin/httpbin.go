@@ -3,6 +3,7 @@ package httpbin
 import (
 	"bytes"
 	"net/http"
+	"net/url"
 	"time"
 )
 
@@ -47,6 +48,14 @@ var DefaultDefaultParams = DefaultParams{
 	JSONLDelay:    0,
 }
 
+// formsPostData is used to render the forms-post.html.tmpl template, which
+// backs both /forms/post and the /session/login form.
+type formsPostData struct {
+	Prefix    string
+	Action    string
+	CSRFToken string
+}
+
 type headersProcessorFunc func(h http.Header) http.Header
 
 // HTTPBin contains the business logic
@@ -83,6 +92,10 @@ type HTTPBin struct {
 	// -allowed-redirect-domains/ALLOWED_REDIRECT_DOMAINS
 	forbiddenRedirectError string
 
+	// The API key expected by the /api-key endpoint when no key is given in
+	// the path.
+	apiKey string
+
 	// The hostname to expose via /hostname.
 	hostname string
 
@@ -99,6 +112,74 @@ type HTTPBin struct {
 	indexHTML     []byte
 	formsPostHTML []byte
 
+	// Optional cap on the bandwidth used by each response, in bytes per
+	// second
+	maxBandwidth float64
+
+	// If true, clients may inject delays and failures into any endpoint via
+	// the X-Httpbin-* headers
+	faultInjectionHeaders bool
+
+	// Request bins created via the /bins endpoints
+	bins *binStore
+
+	// Optional mock endpoints, served under mocksPrefix
+	mocks       []Mock
+	mocksPrefix string
+
+	// Optional mocks registered at runtime via the /_mocks admin API, served
+	// under mocksPrefix
+	mockRegistry *mockRegistry
+
+	// Optional record and replay modes, in which requests are proxied to an
+	// upstream server or served from a cassette in place of the built-in
+	// endpoints
+	recordUpstream *url.URL
+	cassette       *CassetteWriter
+	replayer       *replayer
+
+	// Optional HAR recorder exposed via the /har endpoint, and HAR entries
+	// served as mock responses under mocksPrefix
+	harRecorder *harRecorder
+	harPlayer   *harPlayer
+	harArchive  *HARArchive
+	harTimings  bool
+
+	// Optional store persisting the history of handled requests, exposed via
+	// the /history endpoint
+	store Store
+
+	// Clients watching for requests via the /watch endpoints
+	watchers *watchHub
+
+	// Optional server-wide chaos mode, whose settings may only be updated at
+	// runtime if chaosAdmin is set
+	chaos      *chaosMode
+	chaosAdmin bool
+
+	// Optional server-wide rate limiter
+	rateLimiter *rateLimiter
+
+	// Optional limit on the number of requests handled concurrently, and how
+	// long requests may wait for a slot before being rejected
+	concurrencySlots        chan struct{}
+	concurrencyQueueTimeout time.Duration
+
+	// Per-key quotas tracked by the /rate-limit endpoint
+	quotas *quotaTracker
+
+	// Responses stored by the /idempotent endpoint, keyed by Idempotency-Key
+	idempotency *idempotencyStore
+
+	// Optional sender delivering webhooks via the /webhooks endpoints
+	webhooks *webhookSender
+
+	// Scripted status code sequences tracked by the /scenario endpoints
+	scenarios *scenarioStore
+
+	// Sessions created via the /session endpoints
+	sessions *sessionStore
+
 	// Pre-computed map of special cases for the /status endpoint
 	statusSpecialCases map[int]*statusCase
 
@@ -122,6 +203,7 @@ func New(opts ...OptionFunc) *HTTPBin {
 		MaxDuration:   DefaultMaxDuration,
 		DefaultParams: DefaultDefaultParams,
 		hostname:      DefaultHostname,
+		mocksPrefix:   DefaultMocksPrefix,
 		version:       versionResponse{Service: "go-httpbin"},
 	}
 	for _, opt := range opts {
@@ -131,8 +213,23 @@ func New(opts ...OptionFunc) *HTTPBin {
 	// pre-compute some configuration values and pre-render templates
 	tmplData := struct{ Prefix string }{Prefix: h.prefix}
 	h.indexHTML = mustRenderTemplate("index.html.tmpl", tmplData)
-	h.formsPostHTML = mustRenderTemplate("forms-post.html.tmpl", tmplData)
+	h.formsPostHTML = mustRenderTemplate("forms-post.html.tmpl", formsPostData{Prefix: h.prefix, Action: "/post"})
 	h.statusSpecialCases = createSpecialCases(h.prefix)
+	h.sessions = newSessionStore()
+	h.scenarios = newScenarioStore()
+	h.bins = newBinStore()
+	h.idempotency = newIdempotencyStore()
+	h.watchers = newWatchHub()
+	h.quotas = newQuotaTracker()
+	if h.harRecorder != nil {
+		h.harRecorder.excludePath = h.prefix + "/har"
+	}
+	if h.chaosAdmin && h.chaos == nil {
+		h.chaos = newChaosMode(Chaos{})
+	}
+	if h.harArchive != nil {
+		h.harPlayer = newHARPlayer(h.harArchive, h.mocksPrefix, h.harTimings, h.MaxDuration)
+	}
 
 	// compute max Server-Sent Event count based on max request size and rough
 	// estimate of a single event's size on the wire
@@ -154,6 +251,16 @@ func (h *HTTPBin) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	h.handler.ServeHTTP(w, r)
 }
 
+// Close stops any background work started by the HTTPBin instance, like
+// webhook deliveries that are scheduled or being retried. It does not close
+// the Store given via WithStore.
+func (h *HTTPBin) Close() error {
+	if h.webhooks != nil {
+		h.webhooks.Close()
+	}
+	return nil
+}
+
 // Assert that HTTPBin implements http.Handler interface
 var _ http.Handler = &HTTPBin{}
 
@@ -165,25 +272,42 @@ func (h *HTTPBin) Handler() http.Handler {
 	mux.HandleFunc("DELETE /delete", h.RequestWithBody)
 	mux.HandleFunc("GET /{$}", h.Index)
 	mux.HandleFunc("GET /encoding/utf8", h.UTF8)
+	mux.HandleFunc("GET /bins/{id}/requests", h.BinRequests)
+	mux.HandleFunc("GET /bins/{id}/requests/{requestID}", h.BinRequest)
 	mux.HandleFunc("GET /forms/post", h.FormsPost)
 	mux.HandleFunc("GET /get", h.Get)
+	mux.HandleFunc("GET /session/login", h.SessionLoginForm)
+	mux.HandleFunc("GET /session/me", h.SessionMe)
+	mux.HandleFunc("GET /watch/{channel}/events", h.WatchEvents)
+	mux.HandleFunc("GET /watch/{channel}/websocket", h.WatchWebSocket)
 	mux.HandleFunc("GET /websocket/echo", h.WebSocketEcho)
 	mux.HandleFunc("HEAD /head", h.Get)
+	mux.HandleFunc("PATCH /idempotent", h.Idempotent)
 	mux.HandleFunc("PATCH /patch", h.RequestWithBody)
+	mux.HandleFunc("POST /bins", h.CreateBin)
+	mux.HandleFunc("POST /idempotent", h.Idempotent)
 	mux.HandleFunc("POST /post", h.RequestWithBody)
+	mux.HandleFunc("GET /scenario/{id}/state", h.ScenarioState)
+	mux.HandleFunc("POST /scenario/{id}/reset", h.ScenarioReset)
+	mux.HandleFunc("POST /session/login", h.SessionLogin)
+	mux.HandleFunc("POST /session/logout", h.SessionLogout)
 	mux.HandleFunc("PUT /put", h.RequestWithBody)
 
 	// Endpoints that accept any methods
 	mux.HandleFunc("/absolute-redirect/{numRedirects}", h.AbsoluteRedirect)
 	mux.HandleFunc("/anything", h.Anything)
 	mux.HandleFunc("/anything/", h.Anything)
+	mux.HandleFunc("/api-key", h.APIKey)
+	mux.HandleFunc("/api-key/{key}", h.APIKey)
 	mux.HandleFunc("/base64/{data}", h.Base64)
 	mux.HandleFunc("/base64/{operation}/{data}", h.Base64)
 	mux.HandleFunc("/basic-auth/{user}/{password}", h.BasicAuth)
 	mux.HandleFunc("/bearer", h.Bearer)
+	mux.HandleFunc("/bins/{id}", h.BinCapture)
 	mux.HandleFunc("/bytes/{numBytes}", h.Bytes)
 	mux.HandleFunc("/cache", h.Cache)
 	mux.HandleFunc("/cache/{numSeconds}", h.CacheControl)
+	mux.HandleFunc("/chaos/{outcomes}", h.Chaos)
 	mux.HandleFunc("/cookies", h.Cookies)
 	mux.HandleFunc("/cookies/delete", h.DeleteCookies)
 	mux.HandleFunc("/cookies/set", h.SetCookies)
@@ -196,8 +320,14 @@ func (h *HTTPBin) Handler() http.Handler {
 	mux.HandleFunc("/dump/request", h.DumpRequest)
 	mux.HandleFunc("/env", h.Env)
 	mux.HandleFunc("/etag/{etag}", h.ETag)
+	mux.HandleFunc("/fault/close-after/{n}", h.FaultCloseAfter)
+	mux.HandleFunc("/fault/empty-reply", h.FaultEmptyReply)
+	mux.HandleFunc("/fault/hang", h.FaultHang)
+	mux.HandleFunc("/fault/reset", h.FaultReset)
 	mux.HandleFunc("/gzip", h.Gzip)
 	mux.HandleFunc("/headers", h.Headers)
+	mux.HandleFunc("/hidden-api-key", h.HiddenAPIKey)
+	mux.HandleFunc("/hidden-api-key/{key}", h.HiddenAPIKey)
 	mux.HandleFunc("/hidden-basic-auth/{user}/{password}", h.HiddenBasicAuth)
 	mux.HandleFunc("/hostname", h.Hostname)
 	mux.HandleFunc("/html", h.HTML)
@@ -208,16 +338,22 @@ func (h *HTTPBin) Handler() http.Handler {
 	mux.HandleFunc("/jsonl", h.JSONL)
 	mux.HandleFunc("/links/{numLinks}", h.Links)
 	mux.HandleFunc("/links/{numLinks}/{offset}", h.Links)
+	mux.HandleFunc("/malformed/{kind}", h.Malformed)
 	mux.HandleFunc("/range/{numBytes}", h.Range)
+	mux.HandleFunc("/rate-limit/{key}", h.RateLimited)
 	mux.HandleFunc("/redirect-to", h.RedirectTo)
 	mux.HandleFunc("/redirect/{numRedirects}", h.Redirect)
 	mux.HandleFunc("/relative-redirect/{numRedirects}", h.RelativeRedirect)
 	mux.HandleFunc("/response-headers", h.ResponseHeaders)
 	mux.HandleFunc("/robots.txt", h.Robots)
+	mux.HandleFunc("/scenario/{id}", h.Scenario)
+	mux.HandleFunc("/slow-headers", h.SlowHeaders)
 	mux.HandleFunc("/sse", h.SSE)
 	mux.HandleFunc("/status/{code}", h.Status)
 	mux.HandleFunc("/stream-bytes/{numBytes}", h.StreamBytes)
 	mux.HandleFunc("/stream/{numLines}", h.Stream)
+	mux.HandleFunc("/template", h.Template)
+	mux.HandleFunc("/template/{path...}", h.Template)
 	mux.HandleFunc("/trailers", h.Trailers)
 	mux.HandleFunc("/unstable", h.Unstable)
 	mux.HandleFunc("POST /upload", h.RequestWithBodyDiscard)
@@ -226,24 +362,90 @@ func (h *HTTPBin) Handler() http.Handler {
 	mux.HandleFunc("/user-agent", h.UserAgent)
 	mux.HandleFunc("/uuid", h.UUID)
 	mux.HandleFunc("/version", h.Version)
+	mux.HandleFunc("/watch/{channel}/hook", h.WatchHook)
 	mux.HandleFunc("/xml", h.XML)
 
+	// Mock endpoints with canned responses, if configured
+	for _, m := range h.mocks {
+		m.Delay = min(m.Delay, h.MaxDuration)
+		mux.HandleFunc(m.pattern(h.mocksPrefix), mockHandler(m))
+	}
+	if h.harPlayer != nil {
+		mux.Handle(h.mocksPrefix+"/", h.harPlayer)
+	}
+
+	// Admin endpoints, only available when the corresponding feature is
+	// enabled
+	if h.chaos != nil {
+		mux.HandleFunc("GET "+chaosAdminPath, h.ChaosMode)
+	}
+	if h.chaosAdmin {
+		mux.HandleFunc("PUT "+chaosAdminPath, h.SetChaosMode)
+	}
+	if h.store != nil {
+		mux.HandleFunc("GET /history", h.History)
+	}
+	if h.harRecorder != nil {
+		mux.HandleFunc("GET /har", h.HAR)
+	}
+	if h.webhooks != nil {
+		mux.HandleFunc("POST /webhooks/send", h.SendWebhook)
+		mux.HandleFunc("GET /webhooks/deliveries", h.WebhookDeliveries)
+		mux.HandleFunc("GET /webhooks/deliveries/{id}", h.WebhookDelivery)
+	}
+	if h.mockRegistry != nil {
+		mux.HandleFunc("POST "+mocksAdminPath+"/{namespace}", h.CreateMock)
+		mux.HandleFunc("GET "+mocksAdminPath+"/{namespace}", h.ListMocks)
+		mux.HandleFunc("DELETE "+mocksAdminPath+"/{namespace}", h.ClearMocks)
+		mux.HandleFunc("DELETE "+mocksAdminPath+"/{namespace}/{id}", h.DeleteMock)
+		mux.HandleFunc("GET "+mocksAdminPath+"/{namespace}/verify", h.VerifyMocks)
+		mux.HandleFunc(h.mocksPrefix+"/{mockNamespace}/{mockPath...}", h.RuntimeMock)
+	}
+
 	// existing httpbin endpoints that we do not support
 	mux.HandleFunc("/brotli", notImplementedHandler)
 
 	// Apply global middleware
 	var handler http.Handler
-	handler = mux
-	handler = limitRequestSize(h.MaxBodySize, handler)
-	handler = preflight(handler)
-	handler = autohead(handler)
+	switch {
+	case h.cassette != nil:
+		handler = recordUpstream(h.recordUpstream, h.cassette, h.MaxBodySize)
+		handler = limitRequestSize(h.MaxBodySize, handler)
+	case h.replayer != nil:
+		handler = limitRequestSize(h.MaxBodySize, h.replayer)
+	default:
+		handler = mux
+		handler = limitRequestSize(h.MaxBodySize, handler)
+		handler = preflight(handler)
+		handler = autohead(handler)
+	}
+
+	if h.chaos != nil {
+		handler = injectChaos(h.chaos, h.MaxDuration, handler)
+	}
+
+	// applied within StripPrefix, so that the rate and burst query params are
+	// recognized by path
+	handler = throttleBandwidth(h.maxBandwidth, h.MaxDuration, handler)
 
 	if h.prefix != "" {
 		handler = http.StripPrefix(h.prefix, handler)
 	}
 
-	if h.Observer != nil {
-		handler = observe(h.Observer, handler)
+	if h.faultInjectionHeaders {
+		handler = injectFaults(h.MaxDuration, handler)
+	}
+
+	if h.concurrencySlots != nil {
+		handler = limitConcurrency(h.concurrencySlots, h.concurrencyQueueTimeout, handler)
+	}
+
+	if h.rateLimiter != nil {
+		handler = rateLimit(h.rateLimiter, handler)
+	}
+
+	if h.Observer != nil || h.store != nil || h.harRecorder != nil {
+		handler = observe(h.Observer, h.store, h.harRecorder, handler)
 	}
 
 	return handler
@@ -0,0 +1,193 @@
+package httpbin
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// Limits on the parameters accepted by the /idempotent endpoint
+const (
+	defaultIdempotencyKeyTTL = 24 * time.Hour
+	maxIdempotencyKeyTTL     = 24 * time.Hour
+	maxIdempotencyKeyLength  = 255
+)
+
+// maxIdempotencyKeys bounds the number of keys tracked at once, both in total
+// and for each client, and maxIdempotencyBytes bounds the total size of the
+// stored responses, so that clients cannot exhaust the server's memory. Once
+// a limit is reached, the oldest stored responses are evicted to make room.
+const (
+	maxIdempotencyKeys          = 1000
+	maxIdempotencyKeysPerClient = 100
+	maxIdempotencyBytes         = 32 << 20
+)
+
+var (
+	errIdempotencyKeyInFlight = errors.New("a request with this idempotency key is already being processed")
+	errIdempotencyKeyMismatch = errors.New("idempotency key was already used with a different request payload")
+	errTooManyIdempotencyKeys = errors.New("too many requests with idempotency keys in flight")
+	errIdempotencyStoreFull   = errors.New("too much data stored for idempotency keys")
+)
+
+// idempotencyKey identifies an Idempotency-Key sent by a specific client, so
+// that clients cannot see or interfere with each other's keys.
+type idempotencyKey struct {
+	client string
+	key    string
+}
+
+// idempotencyEntry tracks a single Idempotency-Key, from the moment its first
+// request begins processing until its stored response expires.
+type idempotencyEntry struct {
+	key         idempotencyKey
+	fingerprint string
+	ttl         time.Duration
+
+	// the order in which entries were created, oldest first
+	seq uint64
+
+	// set once the first request with the key has been processed, after
+	// which the entry expires after ttl
+	done    bool
+	expires time.Time
+	status  int
+	body    []byte
+}
+
+// expired reports whether the entry's stored response has expired. Entries
+// whose requests are still being processed never expire.
+func (e *idempotencyEntry) expired(now time.Time) bool {
+	return e.done && !now.Before(e.expires)
+}
+
+// idempotencyStore holds the responses stored by the /idempotent endpoint,
+// keyed by client and Idempotency-Key.
+type idempotencyStore struct {
+	mu      sync.Mutex
+	entries map[idempotencyKey]*idempotencyEntry
+	clients map[string]int
+	size    int
+	seq     uint64
+}
+
+func newIdempotencyStore() *idempotencyStore {
+	return &idempotencyStore{
+		entries: make(map[idempotencyKey]*idempotencyEntry),
+		clients: make(map[string]int),
+	}
+}
+
+// begin claims the given client's key for a request with the given payload
+// fingerprint. If a response was already stored for the key and an identical
+// payload, a copy of its entry is returned for replay, with done set.
+// Otherwise, the returned entry is the caller's claim on the key, which must
+// be passed to either complete or release once the request has been
+// processed.
+func (s *idempotencyStore) begin(client, key, fingerprint string, ttl time.Duration, now time.Time) (*idempotencyEntry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	k := idempotencyKey{client: client, key: key}
+	if e, found := s.entries[k]; found && !e.expired(now) {
+		switch {
+		case e.fingerprint != fingerprint:
+			return nil, errIdempotencyKeyMismatch
+		case !e.done:
+			return nil, errIdempotencyKeyInFlight
+		default:
+			replay := *e
+			return &replay, nil
+		}
+	}
+	// an expired entry for the key may not have been swept yet
+	s.remove(k)
+
+	if s.clients[client] >= maxIdempotencyKeysPerClient && !s.evict(now, func(e *idempotencyEntry) bool { return e.key.client == client }) {
+		return nil, errTooManyIdempotencyKeys
+	}
+	if len(s.entries) >= maxIdempotencyKeys && !s.evict(now, func(*idempotencyEntry) bool { return true }) {
+		return nil, errTooManyIdempotencyKeys
+	}
+
+	s.seq++
+	e := &idempotencyEntry{key: k, fingerprint: fingerprint, ttl: ttl, seq: s.seq}
+	s.entries[k] = e
+	s.clients[client]++
+	return e, nil
+}
+
+// complete stores the response to the request that made the given claim, to
+// be replayed to subsequent requests with the same key until it expires. If
+// the response cannot be stored within maxIdempotencyBytes, even after
+// evicting older stored responses, it is not stored and the claim is
+// released.
+func (s *idempotencyStore) complete(claim *idempotencyEntry, status int, body []byte, now time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.entries[claim.key] != claim {
+		return nil
+	}
+	if len(body) > maxIdempotencyBytes {
+		s.remove(claim.key)
+		return errIdempotencyStoreFull
+	}
+	for s.size+len(body) > maxIdempotencyBytes {
+		if !s.evict(now, func(*idempotencyEntry) bool { return true }) {
+			s.remove(claim.key)
+			return errIdempotencyStoreFull
+		}
+	}
+	claim.done, claim.status, claim.body = true, status, body
+	claim.expires = now.Add(claim.ttl)
+	s.size += len(body)
+	return nil
+}
+
+// release abandons the given claim, made by a request that could not be
+// processed, so that the key may be retried.
+func (s *idempotencyStore) release(claim *idempotencyEntry) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.entries[claim.key] == claim && !claim.done {
+		s.remove(claim.key)
+	}
+}
+
+// remove removes the entry for the given key. Callers must hold s.mu.
+func (s *idempotencyStore) remove(k idempotencyKey) {
+	e, found := s.entries[k]
+	if !found {
+		return
+	}
+	s.size -= len(e.body)
+	delete(s.entries, k)
+	if s.clients[k.client]--; s.clients[k.client] == 0 {
+		delete(s.clients, k.client)
+	}
+}
+
+// evict makes room for a new entry among those matching the given function by
+// removing any expired entries, or failing that the oldest stored response.
+// Entries whose requests are still being processed are never evicted. It
+// reports whether any entry was removed. Callers must hold s.mu.
+func (s *idempotencyStore) evict(now time.Time, match func(*idempotencyEntry) bool) bool {
+	var oldest *idempotencyEntry
+	evicted := false
+	for k, e := range s.entries {
+		switch {
+		case !match(e) || !e.done:
+			continue
+		case e.expired(now):
+			s.remove(k)
+			evicted = true
+		case oldest == nil || e.seq < oldest.seq:
+			oldest = e
+		}
+	}
+	if !evicted && oldest != nil {
+		s.remove(oldest.key)
+		evicted = true
+	}
+	return evicted
+}
@@ -0,0 +1,160 @@
+package httpbin
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/mccutchen/go-httpbin/v2/internal/testing/assert"
+)
+
+func TestIdempotencyStore(t *testing.T) {
+	t.Parallel()
+
+	t.Run("keys expire", func(t *testing.T) {
+		t.Parallel()
+		s := newIdempotencyStore()
+		now := time.Now()
+		claim, err := s.begin("client", "key", "a", time.Minute, now)
+		assert.NilError(t, err)
+		assert.NilError(t, s.complete(claim, 201, []byte("stored"), now))
+
+		stored, err := s.begin("client", "key", "a", time.Minute, now.Add(30*time.Second))
+		assert.NilError(t, err)
+		assert.Equal(t, stored.done, true, "expected stored response")
+		assert.Equal(t, string(stored.body), "stored", "incorrect stored response")
+
+		// once expired, the key may be reused with any payload
+		claim, err = s.begin("client", "key", "b", time.Minute, now.Add(time.Minute))
+		assert.NilError(t, err)
+		assert.Equal(t, claim.done, false, "expected no stored response")
+	})
+
+	t.Run("keys do not expire while in flight", func(t *testing.T) {
+		t.Parallel()
+		s := newIdempotencyStore()
+		now := time.Now()
+		claim, err := s.begin("client", "key", "a", time.Second, now)
+		assert.NilError(t, err)
+
+		later := now.Add(time.Minute)
+		_, err = s.begin("client", "key", "a", time.Second, later)
+		assert.Error(t, err, errIdempotencyKeyInFlight)
+
+		// the stored response expires after ttl, counting from completion
+		assert.NilError(t, s.complete(claim, 201, []byte("stored"), later))
+		stored, err := s.begin("client", "key", "a", time.Second, later)
+		assert.NilError(t, err)
+		assert.Equal(t, stored.done, true, "expected stored response")
+	})
+
+	t.Run("keys are scoped to clients", func(t *testing.T) {
+		t.Parallel()
+		s := newIdempotencyStore()
+		now := time.Now()
+		claim, err := s.begin("client-a", "key", "a", time.Minute, now)
+		assert.NilError(t, err)
+		assert.NilError(t, s.complete(claim, 201, []byte("stored"), now))
+
+		claim, err = s.begin("client-b", "key", "b", time.Minute, now)
+		assert.NilError(t, err)
+		assert.Equal(t, claim.done, false, "expected no stored response")
+	})
+
+	t.Run("completed keys are not released", func(t *testing.T) {
+		t.Parallel()
+		s := newIdempotencyStore()
+		now := time.Now()
+		claim, err := s.begin("client", "key", "a", time.Minute, now)
+		assert.NilError(t, err)
+		assert.NilError(t, s.complete(claim, 201, []byte("stored"), now))
+		s.release(claim)
+
+		stored, err := s.begin("client", "key", "a", time.Minute, now)
+		assert.NilError(t, err)
+		assert.Equal(t, stored.status, 201, "expected stored response")
+	})
+
+	t.Run("stale claims do not affect newer claims", func(t *testing.T) {
+		t.Parallel()
+		s := newIdempotencyStore()
+		now := time.Now()
+		stale, err := s.begin("client", "key", "a", time.Second, now)
+		assert.NilError(t, err)
+		assert.NilError(t, s.complete(stale, 201, []byte("stale"), now))
+
+		later := now.Add(time.Minute)
+		claim, err := s.begin("client", "key", "a", time.Second, later)
+		assert.NilError(t, err)
+		s.release(stale)
+		assert.NilError(t, s.complete(stale, 201, []byte("stale"), later))
+		assert.Equal(t, s.entries[claim.key], claim, "expected newer claim to be kept")
+		assert.Equal(t, claim.done, false, "expected newer claim to be in flight")
+	})
+
+	t.Run("oldest responses are evicted when full", func(t *testing.T) {
+		t.Parallel()
+		s := newIdempotencyStore()
+		now := time.Now()
+		for i := range maxIdempotencyKeysPerClient {
+			claim, err := s.begin("client", strconv.Itoa(i), "fp", time.Minute, now)
+			assert.NilError(t, err)
+			assert.NilError(t, s.complete(claim, 201, nil, now))
+		}
+		_, err := s.begin("client", "extra", "fp", time.Minute, now)
+		assert.NilError(t, err)
+		assert.Equal(t, len(s.entries), maxIdempotencyKeysPerClient, "expected oldest key to be evicted")
+		_, found := s.entries[idempotencyKey{"client", "0"}]
+		assert.Equal(t, found, false, "expected oldest key to be evicted")
+
+		// other clients are unaffected by a client's limit
+		for i := range maxIdempotencyKeys - maxIdempotencyKeysPerClient {
+			claim, err := s.begin(strconv.Itoa(i), "key", "fp", time.Minute, now)
+			assert.NilError(t, err)
+			assert.NilError(t, s.complete(claim, 201, nil, now))
+		}
+		assert.Equal(t, len(s.entries), maxIdempotencyKeys, "incorrect number of keys")
+		_, err = s.begin("another", "key", "fp", time.Minute, now)
+		assert.NilError(t, err)
+		assert.Equal(t, len(s.entries), maxIdempotencyKeys, "expected oldest key to be evicted")
+	})
+
+	t.Run("in flight keys are not evicted", func(t *testing.T) {
+		t.Parallel()
+		s := newIdempotencyStore()
+		now := time.Now()
+		for i := range maxIdempotencyKeysPerClient {
+			_, err := s.begin("client", strconv.Itoa(i), "fp", time.Minute, now)
+			assert.NilError(t, err)
+		}
+		_, err := s.begin("client", "extra", "fp", time.Minute, now)
+		assert.Error(t, err, errTooManyIdempotencyKeys)
+	})
+
+	t.Run("stored responses are bounded by size", func(t *testing.T) {
+		t.Parallel()
+		s := newIdempotencyStore()
+		now := time.Now()
+		big := make([]byte, maxIdempotencyBytes/2)
+
+		for _, key := range []string{"a", "b"} {
+			claim, err := s.begin("client", key, "fp", time.Minute, now)
+			assert.NilError(t, err)
+			assert.NilError(t, s.complete(claim, 201, big, now))
+		}
+
+		// the oldest stored response is evicted to make room
+		claim, err := s.begin("client", "c", "fp", time.Minute, now)
+		assert.NilError(t, err)
+		assert.NilError(t, s.complete(claim, 201, []byte("x"), now))
+		assert.Equal(t, len(s.entries), 2, "expected oldest key to be evicted")
+		assert.Equal(t, s.size, len(big)+1, "incorrect stored size")
+
+		// responses too large to store at all release their claim
+		claim, err = s.begin("client", "d", "fp", time.Minute, now)
+		assert.NilError(t, err)
+		assert.Error(t, s.complete(claim, 201, make([]byte, maxIdempotencyBytes+1), now), errIdempotencyStoreFull)
+		_, found := s.entries[claim.key]
+		assert.Equal(t, found, false, "expected claim to be released")
+	})
+}
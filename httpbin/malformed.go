@@ -0,0 +1,96 @@
+package httpbin
+
+import (
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+)
+
+const (
+	defaultMalformedHeaderSize = 64 * 1024
+	maxMalformedHeaderSize     = 1024 * 1024
+)
+
+// malformedBody is the body sent in each malformed response, where the kind of
+// response allows for one.
+const malformedBody = "hello"
+
+// malformedResponses maps each kind of response supported by the /malformed
+// endpoint to a function that writes a deliberately broken HTTP/1.1 response
+// to a hijacked connection, which will be closed afterwards.
+var malformedResponses = map[string]func(w io.Writer, headerSize int){
+	// chunk size is not a valid hex number
+	"bad-chunk-size": func(w io.Writer, _ int) {
+		writeMalformedHead(w, "HTTP/1.1 200 OK", "Transfer-Encoding: chunked")
+		fmt.Fprintf(w, "zz\r\n%s\r\n0\r\n\r\n", malformedBody)
+	},
+	// chunked body ends without the terminating zero-length chunk
+	"missing-final-chunk": func(w io.Writer, _ int) {
+		writeMalformedHead(w, "HTTP/1.1 200 OK", "Transfer-Encoding: chunked")
+		fmt.Fprintf(w, "%x\r\n%s\r\n", len(malformedBody), malformedBody)
+	},
+	// both Content-Length and Transfer-Encoding, the classic request
+	// smuggling vector
+	"conflicting-length": func(w io.Writer, _ int) {
+		writeMalformedHead(w, "HTTP/1.1 200 OK",
+			fmt.Sprintf("Content-Length: %d", len(malformedBody)),
+			"Transfer-Encoding: chunked")
+		fmt.Fprintf(w, "%x\r\n%s\r\n0\r\n\r\n", len(malformedBody), malformedBody)
+	},
+	// two Content-Length headers with different values
+	"duplicate-content-length": func(w io.Writer, _ int) {
+		writeMalformedHead(w, "HTTP/1.1 200 OK",
+			fmt.Sprintf("Content-Length: %d", len(malformedBody)),
+			fmt.Sprintf("Content-Length: %d", len(malformedBody)+1))
+		io.WriteString(w, malformedBody+"!")
+	},
+	// status code is not a 3-digit number
+	"invalid-status-line": func(w io.Writer, _ int) {
+		writeMalformedHead(w, "HTTP/1.1 2OO OK", fmt.Sprintf("Content-Length: %d", len(malformedBody)))
+		io.WriteString(w, malformedBody)
+	},
+	// header value continued on the next line via obsolete line folding,
+	// which RFC 9112 forbids in responses
+	"obs-fold": func(w io.Writer, _ int) {
+		writeMalformedHead(w, "HTTP/1.1 200 OK",
+			"X-Folded: first line,\r\n  second line",
+			fmt.Sprintf("Content-Length: %d", len(malformedBody)))
+		io.WriteString(w, malformedBody)
+	},
+	// a single header larger than most clients are willing to accept
+	"oversized-headers": func(w io.Writer, headerSize int) {
+		writeMalformedHead(w, "HTTP/1.1 200 OK",
+			"X-Oversized: "+strings.Repeat("a", headerSize),
+			fmt.Sprintf("Content-Length: %d", len(malformedBody)))
+		io.WriteString(w, malformedBody)
+	},
+	// more body bytes than the Content-Length header advertises
+	"body-too-long": func(w io.Writer, _ int) {
+		writeMalformedHead(w, "HTTP/1.1 200 OK", fmt.Sprintf("Content-Length: %d", len(malformedBody)))
+		io.WriteString(w, malformedBody+", this body is longer than advertised")
+	},
+}
+
+// writeMalformedHead writes the given status line and headers, along with
+// the headers common to all malformed responses.
+func writeMalformedHead(w io.Writer, statusLine string, headers ...string) {
+	io.WriteString(w, statusLine+"\r\n")
+	io.WriteString(w, "Content-Type: text/plain; charset=utf-8\r\n")
+	io.WriteString(w, "Connection: close\r\n")
+	for _, header := range headers {
+		io.WriteString(w, header+"\r\n")
+	}
+	io.WriteString(w, "\r\n")
+}
+
+// malformedKinds returns the sorted list of supported malformed response
+// kinds, for use in error messages.
+func malformedKinds() []string {
+	kinds := make([]string, 0, len(malformedResponses))
+	for kind := range malformedResponses {
+		kinds = append(kinds, kind)
+	}
+	slices.Sort(kinds)
+	return kinds
+}
@@ -3,10 +3,12 @@ package httpbin
 import (
 	"bufio"
 	"context"
+	"errors"
 	"fmt"
 	"log/slog"
 	"net"
 	"net/http"
+	"strconv"
 	"time"
 )
 
@@ -43,6 +45,212 @@ func limitRequestSize(maxSize int64, h http.Handler) http.Handler {
 	})
 }
 
+// rateLimit applies the given rate limiter to each request, rejecting requests
+// that exceed a client's limit with a 429 and reporting each client's quota
+// via the IETF RateLimit-Policy and RateLimit headers.
+func rateLimit(l *rateLimiter, h http.Handler) http.Handler {
+	policy := fmt.Sprintf(`"default";q=%d;w=%d`, int(l.burst), ceilSeconds(l.window()))
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := "ip:" + getClientIP(r)
+		if l.keyHeader != "" {
+			// Scope keys by client IP, so that one client cannot use up
+			// another's quota by sending the same key.
+			if val := r.Header.Get(l.keyHeader); val != "" {
+				key += " key:" + val
+			}
+		}
+
+		d := l.take(key, time.Now())
+		w.Header().Set("RateLimit-Policy", policy)
+		w.Header().Set("RateLimit", fmt.Sprintf(`"default";r=%d;t=%d`, d.remaining, ceilSeconds(d.reset)))
+		if !d.allowed {
+			markRejected(w, "rate_limit")
+			w.Header().Set("Retry-After", strconv.FormatInt(ceilSeconds(d.retryAfter), 10))
+			writeError(w, http.StatusTooManyRequests, errors.New("rate limit exceeded"))
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// injectFaults delays and/or fails requests on behalf of clients that ask for
+// it via the X-Httpbin-* fault injection headers or their equivalent query
+// params, regardless of which endpoint is requested.
+func injectFaults(maxDuration time.Duration, h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		f, err := parseFaultInjection(r, maxDuration)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		if f == nil {
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		if f.delay > 0 {
+			// The injected delay counts against the same MaxDuration budget
+			// as the handler's own delays, so the request as a whole cannot
+			// take longer than MaxDuration.
+			ctx, cancel := context.WithDeadline(r.Context(), time.Now().Add(maxDuration))
+			defer cancel()
+			r = r.WithContext(ctx)
+
+			select {
+			case <-r.Context().Done():
+				w.WriteHeader(499) // "Client Closed Request" https://httpstatuses.com/499
+				return
+			case <-time.After(f.delay):
+			}
+			w.Header().Set("Server-Timing", encodeServerTimings([]serverTiming{
+				{"injected_delay", f.delay, "injected delay"},
+			}))
+		}
+
+		if f.rng.Float64() < f.failRate {
+			writeError(w, weightedRandomChoice(f.statuses, f.rng.Float64), errors.New("injected fault"))
+			return
+		}
+
+		h.ServeHTTP(w, r)
+	})
+}
+
+// injectChaos delays and/or fails requests according to the server-wide
+// chaos mode settings, which apply regardless of what the client asks for.
+func injectChaos(m *chaosMode, maxDuration time.Duration, h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == chaosAdminPath {
+			h.ServeHTTP(w, r)
+			return
+		}
+		delay, fail, ok := m.roll(r.URL.Path)
+		if !ok {
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		if delay = min(delay, maxDuration); delay > 0 {
+			select {
+			case <-r.Context().Done():
+				w.WriteHeader(499) // "Client Closed Request" https://httpstatuses.com/499
+				return
+			case <-time.After(delay):
+			}
+			w.Header().Set("Server-Timing", encodeServerTimings([]serverTiming{
+				{"chaos_delay", delay, "chaos mode delay"},
+			}))
+		}
+
+		if fail {
+			writeError(w, http.StatusInternalServerError, errors.New("chaos mode fault"))
+			return
+		}
+
+		h.ServeHTTP(w, r)
+	})
+}
+
+// throttleBandwidth caps the rate at which response bodies are written, at the
+// rate requested by the client via the X-Httpbin-Rate header or rate query
+// param and/or the server-wide maxRate (if non-zero).
+//
+// Client-requested throttling is bounded by maxDuration, after which the rest
+// of the response is written at maxRate (or unthrottled).
+func throttleBandwidth(maxRate float64, maxDuration time.Duration, h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rawRate := getBandwidthParam(r, bandwidthRateHeader, bandwidthRateParam)
+		if rawRate == "" && maxRate == 0 {
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		var (
+			rate     = maxRate
+			deadline time.Time
+		)
+		if rawRate != "" {
+			clientRate, err := parseBandwidth(rawRate)
+			if err != nil {
+				writeError(w, http.StatusBadRequest, fmt.Errorf("invalid rate: %w", err))
+				return
+			}
+			if maxRate == 0 || clientRate < maxRate {
+				rate = clientRate
+				deadline = time.Now().Add(maxDuration)
+			}
+		}
+
+		burst := defaultBurst(rate)
+		if rawBurst := getBandwidthParam(r, bandwidthBurstHeader, bandwidthBurstParam); rawBurst != "" {
+			size, err := parseByteSize(rawBurst)
+			if err != nil || size < 1 || size > maxThrottleSize {
+				writeError(w, http.StatusBadRequest, fmt.Errorf("invalid burst: must be a size between 1 byte and 1GiB"))
+				return
+			}
+			if maxRate > 0 {
+				// clients may not burst beyond one second of the server-wide
+				// bandwidth
+				size = min(size, maxRate)
+			}
+			burst = int(size)
+		}
+
+		tw := newThrottledResponseWriter(w, r.Context(), rate, burst)
+		tw.deadline = deadline
+		tw.fallbackRate = maxRate
+		h.ServeHTTP(tw, r)
+	})
+}
+
+// limitConcurrency limits the number of requests handled concurrently, waiting
+// up to queueTimeout for a slot to free up before rejecting a request with a
+// 503.
+func limitConcurrency(slots chan struct{}, queueTimeout time.Duration, h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !acquireSlot(r.Context(), slots, queueTimeout) {
+			markRejected(w, "max_concurrent_requests")
+			w.Header().Set("Retry-After", "1")
+			writeError(w, http.StatusServiceUnavailable, errors.New("too many concurrent requests"))
+			return
+		}
+		defer func() { <-slots }()
+		h.ServeHTTP(w, r)
+	})
+}
+
+// acquireSlot attempts to acquire a slot from the given semaphore, waiting up
+// to timeout for one to free up.
+func acquireSlot(ctx context.Context, slots chan struct{}, timeout time.Duration) bool {
+	select {
+	case slots <- struct{}{}:
+		return true
+	default:
+	}
+	if timeout <= 0 {
+		return false
+	}
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case slots <- struct{}{}:
+		return true
+	case <-timer.C:
+		return false
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// markRejected records that a request was rejected by one of the server's
+// protective limits rather than handled by an endpoint, so that the rejection
+// may be reported via the Observer.
+func markRejected(w http.ResponseWriter, reason string) {
+	if mw, ok := w.(*metaResponseWriter); ok {
+		mw.rejectedBy = reason
+	}
+}
+
 // headResponseWriter implements http.ResponseWriter in order to discard the
 // body of the response
 type headResponseWriter struct {
@@ -69,14 +277,22 @@ var testMode = false
 // metaResponseWriter implements http.ResponseWriter and http.Flusher in order
 // to record a response's status code and body size for logging purposes.
 type metaResponseWriter struct {
-	w      http.ResponseWriter
-	status int
-	size   int64
+	w          http.ResponseWriter
+	status     int
+	size       int64
+	rejectedBy string
+
+	// optionally, a sample of up to sampleLimit of the first bytes written
+	sample      []byte
+	sampleLimit int
 }
 
 func (mw *metaResponseWriter) Write(b []byte) (int, error) {
 	size, err := mw.w.Write(b)
 	mw.size += int64(size)
+	if room := mw.sampleLimit - len(mw.sample); room > 0 {
+		mw.sample = append(mw.sample, b[:min(size, room)]...)
+	}
 	return size, err
 }
 
@@ -109,23 +325,52 @@ func (mw *metaResponseWriter) Size() int64 {
 }
 
 func (mw *metaResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
-	return mw.w.(http.Hijacker).Hijack()
+	hj, ok := mw.w.(http.Hijacker)
+	if !ok {
+		return nil, nil, http.ErrNotSupported
+	}
+	return hj.Hijack()
 }
 
-func observe(o Observer, h http.Handler) http.Handler {
+// observe reports the result of each request to the given Observer, Store
+// and/or HAR recorder, any of which may be nil.
+func observe(o Observer, s Store, har *harRecorder, h http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body *sampledBody
+		if (s != nil || har != nil) && r.Body != nil {
+			body = &sampledBody{ReadCloser: r.Body, limit: maxHistoryBodySample}
+			if har != nil {
+				body.limit = maxHARBodySize
+			}
+			r.Body = body
+		}
 		mw := &metaResponseWriter{w: w}
+		if har != nil {
+			mw.sampleLimit = maxHARBodySize
+		}
 		t := time.Now()
 		h.ServeHTTP(mw, r)
-		o(Result{
-			Status:    mw.Status(),
-			Method:    r.Method,
-			URI:       r.URL.RequestURI(),
-			Size:      mw.Size(),
-			Duration:  time.Since(t),
-			UserAgent: r.Header.Get("User-Agent"),
-			ClientIP:  getClientIP(r),
-		})
+		result := Result{
+			Status:     mw.Status(),
+			Method:     r.Method,
+			URI:        r.URL.RequestURI(),
+			Size:       mw.Size(),
+			Duration:   time.Since(t),
+			UserAgent:  r.Header.Get("User-Agent"),
+			ClientIP:   getClientIP(r),
+			RejectedBy: mw.rejectedBy,
+		}
+		if o != nil {
+			o(result)
+		}
+		if s != nil {
+			// failing to persist a request's history must not affect the
+			// response, which has already been written
+			_ = s.Append(newHistoryRecord(t, result, body, r.Header.Get("Content-Type")))
+		}
+		if har != nil {
+			har.record(t, r, body, result, mw)
+		}
 	})
 }
 
@@ -138,6 +383,11 @@ type Result struct {
 	Duration  time.Duration
 	UserAgent string
 	ClientIP  string
+
+	// If the request was rejected by one of the server's protective limits
+	// rather than handled by an endpoint, the name of that limit (e.g.
+	// "rate_limit").
+	RejectedBy string
 }
 
 // Observer is a function that will be called with the details of a handled
@@ -154,10 +404,7 @@ func StdLogObserver(l *slog.Logger) Observer {
 		} else if result.Status >= 400 && result.Status < 500 {
 			logLevel = slog.LevelWarn
 		}
-		l.LogAttrs(
-			context.Background(),
-			logLevel,
-			fmt.Sprintf("%d %s %s %.1fms", result.Status, result.Method, result.URI, result.Duration.Seconds()*1e3),
+		attrs := []slog.Attr{
 			slog.Int("status", result.Status),
 			slog.String("method", result.Method),
 			slog.String("uri", result.URI),
@@ -165,6 +412,15 @@ func StdLogObserver(l *slog.Logger) Observer {
 			slog.Float64("duration_ms", result.Duration.Seconds()*1e3),
 			slog.String("user_agent", result.UserAgent),
 			slog.String("client_ip", result.ClientIP),
+		}
+		if result.RejectedBy != "" {
+			attrs = append(attrs, slog.String("rejected_by", result.RejectedBy))
+		}
+		l.LogAttrs(
+			context.Background(),
+			logLevel,
+			fmt.Sprintf("%d %s %s %.1fms", result.Status, result.Method, result.URI, result.Duration.Seconds()*1e3),
+			attrs...,
 		)
 	}
 }
@@ -1,9 +1,14 @@
 package httpbin
 
 import (
+	"math"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/mccutchen/go-httpbin/v2/internal/testing/assert"
 )
@@ -18,7 +23,7 @@ func TestTestMode(t *testing.T) {
 	// early after writing an error response, and has helped identify and fix
 	// some subtly broken error handling.
 	observer := func(_ Result) {}
-	handler := observe(observer, http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+	handler := observe(observer, nil, nil, http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
 		w.WriteHeader(http.StatusBadRequest)
 		w.WriteHeader(http.StatusOK)
 	}))
@@ -37,3 +42,580 @@ func TestTestMode(t *testing.T) {
 	r := httptest.NewRequest(http.MethodGet, "/", nil)
 	handler.ServeHTTP(w, r)
 }
+
+func TestRateLimit(t *testing.T) {
+	t.Parallel()
+
+	t.Run("by client ip", func(t *testing.T) {
+		t.Parallel()
+
+		var (
+			mu      sync.Mutex
+			results []Result
+		)
+		observer := func(r Result) {
+			mu.Lock()
+			defer mu.Unlock()
+			results = append(results, r)
+		}
+		app := setupTestApp(t, WithRateLimit(RateLimit{Rate: 0.1, Burst: 2}), WithObserver(observer))
+
+		doReq := func(clientIP string) *http.Response {
+			req := newTestRequest(t, "GET", app.URL("/get"), nil)
+			req.Header.Set("X-Forwarded-For", clientIP)
+			return mustDoRequest(t, app, req)
+		}
+
+		resp := doReq("1.1.1.1")
+		assert.StatusCode(t, resp, http.StatusOK)
+		assert.Header(t, resp, "RateLimit-Policy", `"default";q=2;w=20`)
+		assert.Header(t, resp, "RateLimit", `"default";r=1;t=10`)
+
+		resp = doReq("1.1.1.1")
+		assert.StatusCode(t, resp, http.StatusOK)
+		assert.Header(t, resp, "RateLimit", `"default";r=0;t=20`)
+
+		resp = doReq("1.1.1.1")
+		assert.StatusCode(t, resp, http.StatusTooManyRequests)
+		assert.Header(t, resp, "Retry-After", "10")
+		assert.Header(t, resp, "RateLimit", `"default";r=0;t=20`)
+		assert.BodyContains(t, resp, "rate limit exceeded")
+
+		// other clients are not affected
+		resp = doReq("2.2.2.2")
+		assert.StatusCode(t, resp, http.StatusOK)
+
+		mu.Lock()
+		defer mu.Unlock()
+		assert.Equal(t, len(results), 4, "incorrect number of observed results")
+		assert.Equal(t, results[1].RejectedBy, "", "expected allowed request not to be rejected")
+		assert.Equal(t, results[2].Status, http.StatusTooManyRequests, "incorrect observed status")
+		assert.Equal(t, results[2].RejectedBy, "rate_limit", "expected throttled request to be reported")
+	})
+
+	t.Run("by key header", func(t *testing.T) {
+		t.Parallel()
+		app := setupTestApp(t, WithRateLimit(RateLimit{Rate: 0.1, Burst: 1, KeyHeader: "X-API-Key"}))
+
+		doReq := func(apiKey string) *http.Response {
+			req := newTestRequest(t, "GET", app.URL("/get"), nil)
+			if apiKey != "" {
+				req.Header.Set("X-API-Key", apiKey)
+			}
+			return mustDoRequest(t, app, req)
+		}
+
+		assert.StatusCode(t, doReq("a"), http.StatusOK)
+		assert.StatusCode(t, doReq("a"), http.StatusTooManyRequests)
+		assert.StatusCode(t, doReq("b"), http.StatusOK)
+
+		// clients without a key fall back to their ip
+		assert.StatusCode(t, doReq(""), http.StatusOK)
+		assert.StatusCode(t, doReq(""), http.StatusTooManyRequests)
+	})
+
+	t.Run("key header is scoped by client ip", func(t *testing.T) {
+		t.Parallel()
+		app := setupTestApp(t, WithRateLimit(RateLimit{Rate: 0.1, Burst: 1, KeyHeader: "X-API-Key"}))
+
+		doReq := func(clientIP string) *http.Response {
+			req := newTestRequest(t, "GET", app.URL("/get"), nil)
+			req.Header.Set("X-API-Key", "a")
+			req.Header.Set("X-Forwarded-For", clientIP)
+			return mustDoRequest(t, app, req)
+		}
+
+		assert.StatusCode(t, doReq("10.0.0.1"), http.StatusOK)
+		assert.StatusCode(t, doReq("10.0.0.1"), http.StatusTooManyRequests)
+		assert.StatusCode(t, doReq("10.0.0.2"), http.StatusOK)
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		t.Parallel()
+		app := setupTestApp(t, WithRateLimit(RateLimit{Rate: 0}))
+		for range 5 {
+			req := newTestRequest(t, "GET", app.URL("/get"), nil)
+			resp := mustDoRequest(t, app, req)
+			assert.StatusCode(t, resp, http.StatusOK)
+			assert.Header(t, resp, "RateLimit", "")
+		}
+	})
+}
+
+func TestLimitConcurrency(t *testing.T) {
+	t.Parallel()
+
+	var (
+		mu      sync.Mutex
+		results []Result
+	)
+	observer := func(r Result) {
+		mu.Lock()
+		defer mu.Unlock()
+		results = append(results, r)
+	}
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	blocking := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/block" {
+			close(started)
+			<-release
+		}
+		w.WriteHeader(http.StatusOK)
+	})
+	handler := observe(observer, nil, nil, limitConcurrency(make(chan struct{}, 1), 50*time.Millisecond, blocking))
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest("GET", "/block", nil))
+		assert.Equal(t, w.Code, http.StatusOK, "incorrect status code for first request")
+	}()
+	<-started
+
+	// the only slot is taken, so this request is rejected once the queue
+	// timeout elapses
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/get", nil))
+	assert.Equal(t, w.Code, http.StatusServiceUnavailable, "incorrect status code")
+	assert.Equal(t, w.Header().Get("Retry-After"), "1", "incorrect Retry-After header")
+	assert.Contains(t, w.Body.String(), "too many concurrent requests", "incorrect body")
+
+	// a queued request is handled as soon as a slot frees up
+	queued := make(chan int)
+	go func() {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest("GET", "/get", nil))
+		queued <- w.Code
+	}()
+	close(release)
+	<-done
+	assert.Equal(t, <-queued, http.StatusOK, "incorrect status code for queued request")
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, len(results), 3, "incorrect number of observed results")
+	assert.Equal(t, results[0].Status, http.StatusServiceUnavailable, "incorrect observed status")
+	assert.Equal(t, results[0].RejectedBy, "max_concurrent_requests", "expected rejected request to be reported")
+	assert.Equal(t, results[1].RejectedBy, "", "expected handled request not to be reported as rejected")
+}
+
+func TestInjectFaults(t *testing.T) {
+	t.Parallel()
+
+	t.Run("disabled by default", func(t *testing.T) {
+		t.Parallel()
+		app := setupTestApp(t)
+		req := newTestRequest(t, "GET", app.URL("/get"), nil)
+		req.Header.Set("X-Httpbin-Status", "503")
+		resp := mustDoRequest(t, app, req)
+		assert.StatusCode(t, resp, http.StatusOK)
+	})
+
+	t.Run("no faults requested", func(t *testing.T) {
+		t.Parallel()
+		app := setupTestApp(t, WithFaultInjectionHeaders())
+		req := newTestRequest(t, "GET", app.URL("/json"), nil)
+		resp := mustDoRequest(t, app, req)
+		assert.StatusCode(t, resp, http.StatusOK)
+		assert.Header(t, resp, "Server-Timing", "")
+	})
+
+	testCases := map[string]struct {
+		path       string
+		headers    map[string]string
+		wantStatus int
+		wantDelay  time.Duration
+	}{
+		"status header": {
+			path:       "/json",
+			headers:    map[string]string{"X-Httpbin-Status": "503"},
+			wantStatus: http.StatusServiceUnavailable,
+		},
+		"status query param": {
+			path:       "/json?_httpbin_status=429",
+			wantStatus: http.StatusTooManyRequests,
+		},
+		"header takes precedence over query param": {
+			path:       "/json?_httpbin_status=429",
+			headers:    map[string]string{"X-Httpbin-Status": "502"},
+			wantStatus: http.StatusBadGateway,
+		},
+		"fail rate defaults to 500": {
+			path:       "/json",
+			headers:    map[string]string{"X-Httpbin-Fail-Rate": "1"},
+			wantStatus: http.StatusInternalServerError,
+		},
+		"zero fail rate": {
+			path:       "/json",
+			headers:    map[string]string{"X-Httpbin-Fail-Rate": "0", "X-Httpbin-Status": "503"},
+			wantStatus: http.StatusOK,
+		},
+		"weighted statuses": {
+			path:       "/json",
+			headers:    map[string]string{"X-Httpbin-Status": "500:0,503:1"},
+			wantStatus: http.StatusServiceUnavailable,
+		},
+		"delay header": {
+			path:       "/get",
+			headers:    map[string]string{"X-Httpbin-Delay": "100ms"},
+			wantStatus: http.StatusOK,
+			wantDelay:  100 * time.Millisecond,
+		},
+		"delay query param and status": {
+			path:       "/get?_httpbin_delay=0.1&_httpbin_status=504",
+			wantStatus: http.StatusGatewayTimeout,
+			wantDelay:  100 * time.Millisecond,
+		},
+		"invalid delay": {
+			path:       "/get",
+			headers:    map[string]string{"X-Httpbin-Delay": "foo"},
+			wantStatus: http.StatusBadRequest,
+		},
+		"delay longer than max duration": {
+			path:       "/get",
+			headers:    map[string]string{"X-Httpbin-Delay": "1m"},
+			wantStatus: http.StatusBadRequest,
+		},
+		"invalid jitter": {
+			path:       "/get",
+			headers:    map[string]string{"X-Httpbin-Delay": "10ms", "X-Httpbin-Jitter": "2"},
+			wantStatus: http.StatusBadRequest,
+		},
+		"invalid fail rate": {
+			path:       "/get",
+			headers:    map[string]string{"X-Httpbin-Fail-Rate": "1.5"},
+			wantStatus: http.StatusBadRequest,
+		},
+		"invalid status": {
+			path:       "/get",
+			headers:    map[string]string{"X-Httpbin-Status": "200"},
+			wantStatus: http.StatusBadRequest,
+		},
+		"invalid seed": {
+			path:       "/get",
+			headers:    map[string]string{"X-Httpbin-Fail-Rate": "0.5", "X-Httpbin-Seed": "foo"},
+			wantStatus: http.StatusBadRequest,
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			app := setupTestApp(t, WithFaultInjectionHeaders())
+			req := newTestRequest(t, "GET", app.URL(tc.path), nil)
+			for k, v := range tc.headers {
+				req.Header.Set(k, v)
+			}
+			start := time.Now()
+			resp := mustDoRequest(t, app, req)
+			assert.StatusCode(t, resp, tc.wantStatus)
+			if tc.wantDelay > 0 {
+				assert.MinDuration(t, time.Since(start), tc.wantDelay)
+				assert.Contains(t, resp.Header.Get("Server-Timing"), "injected_delay", "Server-Timing header")
+			}
+		})
+	}
+
+	t.Run("injected delay counts against max duration", func(t *testing.T) {
+		t.Parallel()
+		maxDuration := 300 * time.Millisecond
+		app := setupTestApp(t, WithFaultInjectionHeaders(), WithMaxDuration(maxDuration))
+		req := newTestRequest(t, "GET", app.URL("/delay/0.3"), nil)
+		req.Header.Set("X-Httpbin-Delay", "200ms")
+		start := time.Now()
+		resp := mustDoRequest(t, app, req)
+		elapsed := time.Since(start)
+		assert.Equal(t, resp.StatusCode, 499, "incorrect status code")
+		assert.MinDuration(t, elapsed, maxDuration)
+		if elapsed >= maxDuration+200*time.Millisecond {
+			t.Fatalf("expected request to finish near max duration %s, took %s", maxDuration, elapsed)
+		}
+	})
+
+	t.Run("seeded fail rate is deterministic", func(t *testing.T) {
+		t.Parallel()
+		app := setupTestApp(t, WithFaultInjectionHeaders())
+		doReq := func() int {
+			req := newTestRequest(t, "GET", app.URL("/get?_httpbin_fail_rate=0.5&_httpbin_seed=1234"), nil)
+			return mustDoRequest(t, app, req).StatusCode
+		}
+		want := doReq()
+		for range 5 {
+			assert.Equal(t, doReq(), want, "expected same outcome for same seed")
+		}
+	})
+}
+
+func TestInjectChaos(t *testing.T) {
+	t.Parallel()
+
+	t.Run("disabled by default", func(t *testing.T) {
+		t.Parallel()
+		app := setupTestApp(t)
+		req := newTestRequest(t, "GET", app.URL(chaosAdminPath), nil)
+		resp := mustDoRequest(t, app, req)
+		assert.StatusCode(t, resp, http.StatusNotFound)
+	})
+
+	t.Run("errors and latency", func(t *testing.T) {
+		t.Parallel()
+		app := setupTestApp(t, WithChaos(Chaos{
+			ChaosSettings: ChaosSettings{ErrorRate: 1, Latency: 50 * time.Millisecond},
+			Routes:        []string{"/status/*"},
+			Overrides: map[string]ChaosSettings{
+				"/json": {Latency: 10 * time.Millisecond},
+			},
+		}))
+
+		start := time.Now()
+		req := newTestRequest(t, "GET", app.URL("/status/200"), nil)
+		resp := mustDoRequest(t, app, req)
+		assert.StatusCode(t, resp, http.StatusInternalServerError)
+		assert.BodyContains(t, resp, "chaos mode fault")
+		assert.Header(t, resp, "Server-Timing", `chaos_delay;dur=50.00;desc="chaos mode delay"`)
+		assert.MinDuration(t, time.Since(start), 50*time.Millisecond)
+
+		req = newTestRequest(t, "GET", app.URL("/json"), nil)
+		resp = mustDoRequest(t, app, req)
+		assert.StatusCode(t, resp, http.StatusOK)
+		assert.Header(t, resp, "Server-Timing", `chaos_delay;dur=10.00;desc="chaos mode delay"`)
+
+		req = newTestRequest(t, "GET", app.URL("/get"), nil)
+		resp = mustDoRequest(t, app, req)
+		assert.StatusCode(t, resp, http.StatusOK)
+		assert.Header(t, resp, "Server-Timing", "")
+	})
+
+	t.Run("latency bounded by max duration", func(t *testing.T) {
+		t.Parallel()
+		app := setupTestApp(t, WithMaxDuration(50*time.Millisecond), WithChaos(Chaos{
+			ChaosSettings: ChaosSettings{Latency: time.Hour},
+		}))
+		req := newTestRequest(t, "GET", app.URL("/get"), nil)
+		resp := mustDoRequest(t, app, req)
+		assert.StatusCode(t, resp, http.StatusOK)
+		assert.Header(t, resp, "Server-Timing", `chaos_delay;dur=50.00;desc="chaos mode delay"`)
+	})
+
+	t.Run("admin endpoint", func(t *testing.T) {
+		t.Parallel()
+		app := setupTestApp(t, WithChaosAdmin(), WithChaos(Chaos{
+			ChaosSettings: ChaosSettings{ErrorRate: 1},
+			Seed:          1234,
+		}))
+
+		// the admin endpoint is never subject to chaos
+		req := newTestRequest(t, "GET", app.URL(chaosAdminPath), nil)
+		resp := mustDoRequest(t, app, req)
+		result := mustParseResponse[chaosResponse](t, resp)
+		assert.DeepEqual(t, result, chaosResponse{
+			ErrorRate: 1,
+			Latency:   "0s",
+			Routes:    []string{},
+			Overrides: map[string]chaosSettingsResponse{},
+			Seed:      1234,
+		}, "incorrect settings")
+
+		req = newTestRequest(t, "PUT", app.URL(chaosAdminPath), strings.NewReader(`{
+			"error_rate": 0,
+			"latency": "10ms",
+			"routes": ["/get"],
+			"overrides": {"/status/*": {"error_rate": 1}}
+		}`))
+		resp = mustDoRequest(t, app, req)
+		result = mustParseResponse[chaosResponse](t, resp)
+		assert.DeepEqual(t, result, chaosResponse{
+			ErrorRate: 0,
+			Latency:   "10ms",
+			Routes:    []string{"/get"},
+			Overrides: map[string]chaosSettingsResponse{
+				"/status/*": {ErrorRate: 1, Latency: "0s"},
+			},
+			Seed: 1234,
+		}, "incorrect updated settings")
+
+		req = newTestRequest(t, "GET", app.URL("/get"), nil)
+		resp = mustDoRequest(t, app, req)
+		assert.StatusCode(t, resp, http.StatusOK)
+		assert.Header(t, resp, "Server-Timing", `chaos_delay;dur=10.00;desc="chaos mode delay"`)
+
+		req = newTestRequest(t, "GET", app.URL("/status/200"), nil)
+		resp = mustDoRequest(t, app, req)
+		assert.StatusCode(t, resp, http.StatusInternalServerError)
+
+		badBodies := []string{
+			`foo`,
+			`{"error_rate": 2}`,
+			`{"error_rate": -1}`,
+			`{"latency": "foo"}`,
+			`{"latency": "2s"}`,
+			`{"routes": ["get"]}`,
+			`{"routes": ["/[get"]}`,
+			`{"overrides": {"/get": {"latency": "foo"}}}`,
+			`{"overrides": {"/get": {"error_rate": 2}}}`,
+		}
+		for _, body := range badBodies {
+			req := newTestRequest(t, "PUT", app.URL(chaosAdminPath), strings.NewReader(body))
+			resp := mustDoRequest(t, app, req)
+			assert.StatusCode(t, resp, http.StatusBadRequest)
+		}
+	})
+
+	t.Run("admin updates require opt in", func(t *testing.T) {
+		t.Parallel()
+		app := setupTestApp(t, WithChaos(Chaos{ChaosSettings: ChaosSettings{Latency: 10 * time.Millisecond}}))
+		req := newTestRequest(t, "PUT", app.URL(chaosAdminPath), strings.NewReader(`{"error_rate": 1}`))
+		resp := mustDoRequest(t, app, req)
+		assert.StatusCode(t, resp, http.StatusMethodNotAllowed)
+
+		req = newTestRequest(t, "GET", app.URL(chaosAdminPath), nil)
+		resp = mustDoRequest(t, app, req)
+		assert.StatusCode(t, resp, http.StatusOK)
+	})
+
+	t.Run("admin enables chaos mode", func(t *testing.T) {
+		t.Parallel()
+		app := setupTestApp(t, WithChaosAdmin())
+		req := newTestRequest(t, "GET", app.URL("/status/200"), nil)
+		resp := mustDoRequest(t, app, req)
+		assert.StatusCode(t, resp, http.StatusOK)
+
+		req = newTestRequest(t, "PUT", app.URL(chaosAdminPath), strings.NewReader(`{"error_rate": 1}`))
+		resp = mustDoRequest(t, app, req)
+		assert.StatusCode(t, resp, http.StatusOK)
+
+		req = newTestRequest(t, "GET", app.URL("/status/200"), nil)
+		resp = mustDoRequest(t, app, req)
+		assert.StatusCode(t, resp, http.StatusInternalServerError)
+	})
+}
+
+func TestThrottleBandwidth(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		opts        []OptionFunc
+		path        string
+		headers     map[string]string
+		wantStatus  int
+		wantMinTime time.Duration
+	}{
+		"rate query param": {
+			path:        "/bytes/1000?rate=10KB/s&burst=500",
+			wantStatus:  http.StatusOK,
+			wantMinTime: 50 * time.Millisecond,
+		},
+		"prefixed rate query param": {
+			path:        "/bytes/1000?_httpbin_rate=10KB/s&_httpbin_burst=500",
+			wantStatus:  http.StatusOK,
+			wantMinTime: 50 * time.Millisecond,
+		},
+		"rate query param on other endpoints": {
+			path:        "/range/1000?rate=10KB/s&burst=500",
+			wantStatus:  http.StatusOK,
+			wantMinTime: 50 * time.Millisecond,
+		},
+		"rate query param with prefix": {
+			opts:        []OptionFunc{WithPrefix("/prefix")},
+			path:        "/prefix/bytes/1000?rate=10KB/s&burst=500",
+			wantStatus:  http.StatusOK,
+			wantMinTime: 50 * time.Millisecond,
+		},
+		"rate header": {
+			path:        "/bytes/1000",
+			headers:     map[string]string{"X-Httpbin-Rate": "10KB/s", "X-Httpbin-Burst": "500"},
+			wantStatus:  http.StatusOK,
+			wantMinTime: 50 * time.Millisecond,
+		},
+		"max bandwidth": {
+			opts:        []OptionFunc{WithMaxBandwidth(2000)},
+			path:        "/bytes/1000",
+			wantStatus:  http.StatusOK,
+			wantMinTime: 350 * time.Millisecond,
+		},
+		"client cannot exceed max bandwidth": {
+			opts:        []OptionFunc{WithMaxBandwidth(2000)},
+			path:        "/bytes/1000?rate=1GB/s",
+			wantStatus:  http.StatusOK,
+			wantMinTime: 350 * time.Millisecond,
+		},
+		"client cannot burst beyond max bandwidth": {
+			opts:        []OptionFunc{WithMaxBandwidth(500)},
+			path:        "/bytes/1000?burst=1GB",
+			wantStatus:  http.StatusOK,
+			wantMinTime: 900 * time.Millisecond,
+		},
+		"invalid rate": {
+			path:       "/bytes/1000?rate=foo",
+			wantStatus: http.StatusBadRequest,
+		},
+		"invalid burst": {
+			path:       "/bytes/1000?rate=1KB/s&burst=0",
+			wantStatus: http.StatusBadRequest,
+		},
+		"oversized rate": {
+			path:       "/bytes/1000?rate=99999999999999999999999",
+			wantStatus: http.StatusBadRequest,
+		},
+		"oversized burst": {
+			path:       "/bytes/1000?rate=1KB&burst=99999999999999999999999",
+			wantStatus: http.StatusBadRequest,
+		},
+		"oversized burst header": {
+			path:       "/bytes/1000",
+			headers:    map[string]string{"X-Httpbin-Rate": "1KB", "X-Httpbin-Burst": "2GiB"},
+			wantStatus: http.StatusBadRequest,
+		},
+		"huge max bandwidth": {
+			opts:       []OptionFunc{WithMaxBandwidth(math.MaxInt64)},
+			path:       "/bytes/1000?burst=1GiB",
+			wantStatus: http.StatusOK,
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			app := setupTestApp(t, tc.opts...)
+			req := newTestRequest(t, "GET", app.URL(tc.path), nil)
+			for k, v := range tc.headers {
+				req.Header.Set(k, v)
+			}
+			start := time.Now()
+			resp := mustDoRequest(t, app, req)
+			assert.StatusCode(t, resp, tc.wantStatus)
+			if tc.wantStatus == http.StatusOK {
+				assert.BodySize(t, resp, 1000)
+				assert.MinDuration(t, time.Since(start), tc.wantMinTime)
+			}
+		})
+	}
+
+	t.Run("rate and burst query params are only reserved by body endpoints", func(t *testing.T) {
+		t.Parallel()
+		app := setupTestApp(t)
+		req := newTestRequest(t, "GET", app.URL("/get?rate=x&burst=y"), nil)
+		resp := mustDoRequest(t, app, req)
+		result := mustParseResponse[noBodyResponse](t, resp)
+		assert.DeepEqual(t, result.Args, url.Values{"rate": {"x"}, "burst": {"y"}}, "incorrect args")
+
+		// the prefixed params may be used anywhere
+		req = newTestRequest(t, "GET", app.URL("/get?_httpbin_rate=x"), nil)
+		resp = mustDoRequest(t, app, req)
+		assert.StatusCode(t, resp, http.StatusBadRequest)
+	})
+
+	t.Run("client throttling bounded by max duration", func(t *testing.T) {
+		t.Parallel()
+		app := setupTestApp(t, WithMaxDuration(100*time.Millisecond))
+		start := time.Now()
+		req := newTestRequest(t, "GET", app.URL("/bytes/1000?rate=1"), nil)
+		resp := mustDoRequest(t, app, req)
+		assert.StatusCode(t, resp, http.StatusOK)
+		assert.BodySize(t, resp, 1000)
+		if elapsed := time.Since(start); elapsed > 2*time.Second {
+			t.Fatalf("expected throttling to stop after max duration, took %s", elapsed)
+		}
+	})
+}
@@ -0,0 +1,447 @@
+package httpbin
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultMocksPrefix is the default path prefix under which mock endpoints are
+// served.
+const DefaultMocksPrefix = "/mocks"
+
+// Mock defines an endpoint that always responds with the same canned
+// response.
+type Mock struct {
+	// HTTP method the mock responds to; any method if empty
+	Method string
+
+	// Path pattern the mock responds to, relative to the mocks prefix, which
+	// may contain {vars} and a trailing {rest...} wildcard as supported by
+	// http.ServeMux
+	Path string
+
+	// Response status code, defaulting to 200
+	Status int
+
+	// Response headers and body
+	Headers map[string]string
+	Body    []byte
+
+	// Delay before responding
+	Delay time.Duration
+}
+
+// pattern returns the http.ServeMux pattern for the mock under the given
+// prefix.
+func (m Mock) pattern(prefix string) string {
+	if m.Method == "" {
+		return prefix + m.Path
+	}
+	return m.Method + " " + prefix + m.Path
+}
+
+// validate checks the mock's definition, without regard to conflicts with
+// other endpoints.
+func (m Mock) validate() error {
+	if m.Method != "" && strings.ContainsFunc(m.Method, func(r rune) bool { return r < 'A' || r > 'Z' }) {
+		return fmt.Errorf("invalid method %q, must be an uppercase HTTP method", m.Method)
+	}
+	if !strings.HasPrefix(m.Path, "/") {
+		return fmt.Errorf("invalid path %q, must start with a slash", m.Path)
+	}
+	if m.Status != 0 && (m.Status < 100 || m.Status > 599) {
+		return fmt.Errorf("invalid status %d, must be in range [100, 599]", m.Status)
+	}
+	if m.Delay < 0 {
+		return fmt.Errorf("invalid delay %s, must be >= 0", m.Delay)
+	}
+	// header names are case-insensitive, so names differing only in case
+	// would be ambiguous
+	names := make(map[string]string, len(m.Headers))
+	for _, name := range slices.Sorted(maps.Keys(m.Headers)) {
+		if other, ok := names[http.CanonicalHeaderKey(name)]; ok {
+			return fmt.Errorf("duplicate headers %q and %q, header names are case-insensitive", other, name)
+		}
+		names[http.CanonicalHeaderKey(name)] = name
+	}
+	return nil
+}
+
+// ValidateMocks checks that the given mocks are valid and may be served under
+// the given prefix without conflicting with each other or with the built-in
+// endpoints, including those serving mocks registered at runtime and HAR
+// entries. Mocks may not delay for longer than maxDuration, which should match
+// the server's MaxDuration.
+func ValidateMocks(prefix string, mocks []Mock, maxDuration time.Duration) (err error) {
+	if prefix != "" && (!strings.HasPrefix(prefix, "/") || strings.HasSuffix(prefix, "/")) {
+		return fmt.Errorf("invalid mocks prefix %q, must start with a slash and not end with a slash", prefix)
+	}
+	for i, m := range mocks {
+		if err := m.validate(); err != nil {
+			return fmt.Errorf("mock %d: %w", i, err)
+		}
+		if m.Delay > maxDuration {
+			return fmt.Errorf("mock %d: invalid delay %s, must be <= %s", i, m.Delay, maxDuration)
+		}
+	}
+
+	// http.ServeMux panics on invalid or conflicting patterns, which we
+	// surface as an error by registering every endpoint on a throwaway mux
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%v", r)
+		}
+	}()
+	New(WithMocks(prefix, mocks), WithMocksAdmin(), WithHAR(&HARArchive{}, false), WithMaxDuration(maxDuration))
+	return nil
+}
+
+// mockDefinition is the representation of a Mock in a mocks file, where the
+// body may be given as a string, as any other JSON value, or as the path to a
+// file relative to the mocks file.
+type mockDefinition struct {
+	Method   string            `json:"method"`
+	Path     string            `json:"path"`
+	Status   int               `json:"status"`
+	Headers  map[string]string `json:"headers"`
+	Body     json.RawMessage   `json:"body"`
+	BodyFile string            `json:"body_file"`
+	Delay    string            `json:"delay"`
+}
+
+type mocksFile struct {
+	Mocks []mockDefinition `json:"mocks"`
+}
+
+// LoadMocks loads mock endpoint definitions from the JSON file at the given
+// path, which takes the form:
+//
+//	{"mocks": [{"method": "GET", "path": "/users/{id}", "status": 200, "headers": {"X-Foo": "bar"}, "body": {"id": 1}, "delay": "100ms"}]}
+//
+// A body given as a JSON string is served as-is, while any other JSON value is
+// served with an application/json Content-Type unless otherwise specified.
+// Alternatively, body_file gives the path to a file, relative to the mocks
+// file, whose contents are served instead.
+func LoadMocks(path string) ([]Mock, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return parseMocks(data, filepath.Dir(path))
+}
+
+func parseMocks(data []byte, baseDir string) ([]Mock, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	var f mocksFile
+	if err := dec.Decode(&f); err != nil {
+		return nil, fmt.Errorf("invalid JSON: %w", err)
+	}
+
+	mocks := make([]Mock, 0, len(f.Mocks))
+	for i, def := range f.Mocks {
+		m, err := def.toMock(baseDir)
+		if err != nil {
+			return nil, fmt.Errorf("mock %d: %w", i, err)
+		}
+		mocks = append(mocks, m)
+	}
+	return mocks, nil
+}
+
+func (def mockDefinition) toMock(baseDir string) (Mock, error) {
+	m := Mock{
+		Method:  def.Method,
+		Path:    def.Path,
+		Status:  def.Status,
+		Headers: def.Headers,
+	}
+	if def.Delay != "" {
+		delay, err := time.ParseDuration(def.Delay)
+		if err != nil {
+			return Mock{}, fmt.Errorf("invalid delay %q: %w", def.Delay, err)
+		}
+		m.Delay = delay
+	}
+
+	hasBody := len(def.Body) > 0 && string(def.Body) != "null"
+	switch {
+	case hasBody && def.BodyFile != "":
+		return Mock{}, errors.New("body and body_file are mutually exclusive")
+	case def.BodyFile != "":
+		path := def.BodyFile
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(baseDir, path)
+		}
+		body, err := os.ReadFile(path)
+		if err != nil {
+			return Mock{}, fmt.Errorf("invalid body_file: %w", err)
+		}
+		m.Body = body
+	case hasBody:
+		var s string
+		if err := json.Unmarshal(def.Body, &s); err == nil {
+			m.Body = []byte(s)
+			break
+		}
+		var buf bytes.Buffer
+		if err := json.Compact(&buf, def.Body); err != nil {
+			return Mock{}, fmt.Errorf("invalid body: %w", err)
+		}
+		m.Body = buf.Bytes()
+		if !hasHeader(m.Headers, "Content-Type") {
+			m.Headers = withHeader(m.Headers, "Content-Type", jsonContentType)
+		}
+	}
+	return m, m.validate()
+}
+
+// hasHeader reports whether the given header map contains the named header,
+// ignoring case.
+func hasHeader(headers map[string]string, name string) bool {
+	for k := range headers {
+		if strings.EqualFold(k, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// withHeader returns a copy of the given header map with the named header
+// set.
+func withHeader(headers map[string]string, name, value string) map[string]string {
+	result := make(map[string]string, len(headers)+1)
+	for k, v := range headers {
+		result[k] = v
+	}
+	result[name] = value
+	return result
+}
+
+// contentType returns the Content-Type header of the mock's response, if any.
+func (m Mock) contentType() string {
+	for k, v := range m.Headers {
+		if strings.EqualFold(k, "Content-Type") {
+			return v
+		}
+	}
+	return ""
+}
+
+// mockHandler serves the canned response for the given mock.
+func mockHandler(m Mock) http.HandlerFunc {
+	status := m.Status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		if m.Delay > 0 {
+			select {
+			case <-r.Context().Done():
+				w.WriteHeader(499) // "Client Closed Request" https://httpstatuses.com/499
+				return
+			case <-time.After(m.Delay):
+			}
+		}
+		for k, v := range m.Headers {
+			w.Header().Set(k, v)
+		}
+		w.WriteHeader(status)
+		w.Write(m.Body)
+	}
+}
+
+// mocksAdminPath is the path of the admin API used to manage mocks at
+// runtime.
+const mocksAdminPath = "/_mocks"
+
+// Limits on the mocks that may be registered at runtime via the admin API
+const (
+	maxMockNamespaces    = 1000
+	maxMocksPerNamespace = 100
+)
+
+var (
+	errMockConflict          = errors.New("mock conflicts with an existing mock in namespace")
+	errMockNamespaceNotFound = errors.New("mock namespace not found")
+	errTooManyMockNamespaces = errors.New("too many mock namespaces")
+	errTooManyMocks          = errors.New("too many mocks in namespace")
+)
+
+// registeredMock is a mock registered at runtime, along with the number of
+// times it has been hit, keyed by the media type of each request's
+// Content-Type ("none" for requests without one).
+type registeredMock struct {
+	id   int
+	mock Mock
+	hits map[string]int
+}
+
+// mockNamespace is an isolated set of mocks registered at runtime, so that
+// clients sharing a server do not collide.
+type mockNamespace struct {
+	mocks     []*registeredMock
+	mux       *http.ServeMux
+	nextID    int
+	unmatched int
+}
+
+// mockRegistry tracks the mocks registered at runtime via the admin API.
+type mockRegistry struct {
+	mu         sync.Mutex
+	namespaces map[string]*mockNamespace
+}
+
+func newMockRegistry() *mockRegistry {
+	return &mockRegistry{namespaces: make(map[string]*mockNamespace)}
+}
+
+// register adds a mock to the given namespace, which is created if necessary,
+// returning its id. Mocks whose patterns conflict with existing mocks in the
+// namespace are rejected.
+func (reg *mockRegistry) register(namespace string, m Mock) (int, error) {
+	if err := m.validate(); err != nil {
+		return 0, err
+	}
+
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+
+	ns, found := reg.namespaces[namespace]
+	if !found {
+		if len(reg.namespaces) >= maxMockNamespaces {
+			return 0, errTooManyMockNamespaces
+		}
+		ns = &mockNamespace{}
+	}
+	if len(ns.mocks) >= maxMocksPerNamespace {
+		return 0, errTooManyMocks
+	}
+
+	rm := &registeredMock{id: ns.nextID + 1, mock: m, hits: make(map[string]int)}
+	// check the mock's pattern in isolation first, so that invalid patterns
+	// may be distinguished from conflicts
+	if _, err := reg.newMux(namespace, []*registeredMock{rm}); err != nil {
+		return 0, fmt.Errorf("invalid path: %w", err)
+	}
+	mocks := append(slices.Clone(ns.mocks), rm)
+	mux, err := reg.newMux(namespace, mocks)
+	if err != nil {
+		return 0, errMockConflict
+	}
+	ns.mocks, ns.mux, ns.nextID = mocks, mux, rm.id
+	reg.namespaces[namespace] = ns
+	return rm.id, nil
+}
+
+// newMux builds a mux routing requests to the given mocks, since mocks
+// cannot be removed from an existing mux. Callers must hold reg.mu.
+func (reg *mockRegistry) newMux(namespace string, mocks []*registeredMock) (mux *http.ServeMux, err error) {
+	// http.ServeMux panics on invalid or conflicting patterns
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%v", r)
+		}
+	}()
+	mux = http.NewServeMux()
+	for _, rm := range mocks {
+		serve := mockHandler(rm.mock)
+		mux.HandleFunc(rm.mock.pattern(""), func(w http.ResponseWriter, r *http.Request) {
+			reg.recordHit(namespace, rm, r)
+			serve(w, r)
+		})
+	}
+	return mux, nil
+}
+
+// remove removes the mock with the given id from the given namespace,
+// reporting whether it existed.
+func (reg *mockRegistry) remove(namespace string, id int) bool {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+
+	ns, found := reg.namespaces[namespace]
+	if !found {
+		return false
+	}
+	i := slices.IndexFunc(ns.mocks, func(rm *registeredMock) bool { return rm.id == id })
+	if i == -1 {
+		return false
+	}
+	mocks := slices.Delete(slices.Clone(ns.mocks), i, i+1)
+	// removing a mock cannot introduce a conflict, so the error may be
+	// safely ignored
+	ns.mux, _ = reg.newMux(namespace, mocks)
+	ns.mocks = mocks
+	return true
+}
+
+// clear removes the given namespace and all of its mocks, reporting whether
+// it existed.
+func (reg *mockRegistry) clear(namespace string) bool {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	_, found := reg.namespaces[namespace]
+	delete(reg.namespaces, namespace)
+	return found
+}
+
+// list returns copies of the mocks in the given namespace and the number of
+// requests that did not match any of them.
+func (reg *mockRegistry) list(namespace string) ([]registeredMock, int, error) {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+
+	ns, found := reg.namespaces[namespace]
+	if !found {
+		return nil, 0, errMockNamespaceNotFound
+	}
+	mocks := make([]registeredMock, 0, len(ns.mocks))
+	for _, rm := range ns.mocks {
+		mocks = append(mocks, registeredMock{id: rm.id, mock: rm.mock, hits: maps.Clone(rm.hits)})
+	}
+	return mocks, ns.unmatched, nil
+}
+
+// handler returns the handler for the mock in the given namespace matching
+// the given request, recording a miss if there is none.
+func (reg *mockRegistry) handler(namespace string, r *http.Request) (http.Handler, bool) {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+
+	ns, found := reg.namespaces[namespace]
+	if !found {
+		return nil, false
+	}
+	if _, pattern := ns.mux.Handler(r); pattern == "" {
+		ns.unmatched++
+		return nil, false
+	}
+	return ns.mux, true
+}
+
+// recordHit records a request served by the given mock.
+func (reg *mockRegistry) recordHit(namespace string, rm *registeredMock, r *http.Request) {
+	mediaType, _, _ := strings.Cut(r.Header.Get("Content-Type"), ";")
+	mediaType = strings.ToLower(strings.TrimSpace(mediaType))
+	if mediaType == "" {
+		mediaType = "none"
+	}
+
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	// hits are only recorded for mocks that are still registered
+	if ns, found := reg.namespaces[namespace]; found && slices.Contains(ns.mocks, rm) {
+		rm.hits[mediaType]++
+	}
+}
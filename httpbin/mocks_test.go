@@ -0,0 +1,205 @@
+package httpbin
+
+import (
+	"errors"
+	"fmt"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mccutchen/go-httpbin/v2/internal/testing/assert"
+)
+
+func TestLoadMocks(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	assert.NilError(t, os.WriteFile(filepath.Join(dir, "report.csv"), []byte("a,b\n1,2\n"), 0o644))
+	assert.NilError(t, os.WriteFile(filepath.Join(dir, "mocks.json"), []byte(`{
+		"mocks": [
+			{"method": "GET", "path": "/users/{id}", "status": 201, "headers": {"X-Foo": "bar"}, "body": {"id": 1}, "delay": "100ms"},
+			{"path": "/hello", "body": "hello, world"},
+			{"path": "/report", "body_file": "report.csv", "headers": {"content-type": "text/csv"}}
+		]
+	}`), 0o644))
+
+	mocks, err := LoadMocks(filepath.Join(dir, "mocks.json"))
+	assert.NilError(t, err)
+	assert.DeepEqual(t, mocks, []Mock{
+		{
+			Method:  "GET",
+			Path:    "/users/{id}",
+			Status:  201,
+			Headers: map[string]string{"X-Foo": "bar", "Content-Type": jsonContentType},
+			Body:    []byte(`{"id":1}`),
+			Delay:   100 * time.Millisecond,
+		},
+		{
+			Path: "/hello",
+			Body: []byte("hello, world"),
+		},
+		{
+			Path:    "/report",
+			Headers: map[string]string{"content-type": "text/csv"},
+			Body:    []byte("a,b\n1,2\n"),
+		},
+	}, "incorrect mocks")
+
+	errorTests := map[string]struct {
+		data    string
+		wantErr string
+	}{
+		"unknown field": {
+			data:    `{"mocks": [{"path": "/foo", "stauts": 200}]}`,
+			wantErr: `invalid JSON: json: unknown field "stauts"`,
+		},
+		"missing path": {
+			data:    `{"mocks": [{"method": "GET"}]}`,
+			wantErr: `mock 0: invalid path "", must start with a slash`,
+		},
+		"invalid method": {
+			data:    `{"mocks": [{"method": "get", "path": "/foo"}]}`,
+			wantErr: `mock 0: invalid method "get", must be an uppercase HTTP method`,
+		},
+		"invalid status": {
+			data:    `{"mocks": [{"path": "/foo", "status": 99}]}`,
+			wantErr: `mock 0: invalid status 99, must be in range [100, 599]`,
+		},
+		"invalid delay": {
+			data:    `{"mocks": [{"path": "/foo"}, {"path": "/bar", "delay": "soon"}]}`,
+			wantErr: `mock 1: invalid delay "soon": time: invalid duration "soon"`,
+		},
+		"body and body_file": {
+			data:    `{"mocks": [{"path": "/foo", "body": "x", "body_file": "report.csv"}]}`,
+			wantErr: `mock 0: body and body_file are mutually exclusive`,
+		},
+		"missing body_file": {
+			data:    `{"mocks": [{"path": "/foo", "body_file": "missing.txt"}]}`,
+			wantErr: `mock 0: invalid body_file: open ` + filepath.Join(dir, "missing.txt") + `: no such file or directory`,
+		},
+	}
+	for name, tc := range errorTests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			_, err := parseMocks([]byte(tc.data), dir)
+			assert.Error(t, err, errors.New(tc.wantErr))
+		})
+	}
+}
+
+func TestValidateMocks(t *testing.T) {
+	t.Parallel()
+
+	assert.NilError(t, ValidateMocks(DefaultMocksPrefix, []Mock{
+		{Method: "GET", Path: "/users/{id}"},
+		{Method: "DELETE", Path: "/users/{id}"},
+	}, DefaultMaxDuration))
+	// mocks may be served at the root, as long as they do not conflict with
+	// any built-in endpoints
+	assert.NilError(t, ValidateMocks("", []Mock{{Path: "/custom"}}, DefaultMaxDuration))
+
+	errorTests := map[string]struct {
+		prefix  string
+		mocks   []Mock
+		wantErr string
+	}{
+		"invalid prefix": {
+			prefix:  "mocks/",
+			wantErr: `invalid mocks prefix "mocks/", must start with a slash and not end with a slash`,
+		},
+		"invalid mock": {
+			prefix:  DefaultMocksPrefix,
+			mocks:   []Mock{{Path: "/foo", Delay: -time.Second}},
+			wantErr: "mock 0: invalid delay -1s, must be >= 0",
+		},
+		"delay longer than max duration": {
+			prefix:  DefaultMocksPrefix,
+			mocks:   []Mock{{Path: "/foo", Delay: time.Minute}},
+			wantErr: "mock 0: invalid delay 1m0s, must be <= 10s",
+		},
+		"duplicate headers": {
+			prefix:  DefaultMocksPrefix,
+			mocks:   []Mock{{Path: "/foo", Headers: map[string]string{"Content-Type": "text/plain", "content-type": "text/html"}}},
+			wantErr: `mock 0: duplicate headers "Content-Type" and "content-type", header names are case-insensitive`,
+		},
+		"invalid pattern": {
+			prefix:  DefaultMocksPrefix,
+			mocks:   []Mock{{Path: "/{id"}},
+			wantErr: "parsing",
+		},
+		"conflicting mocks": {
+			prefix:  DefaultMocksPrefix,
+			mocks:   []Mock{{Path: "/users/{id}"}, {Path: "/users/{name}"}},
+			wantErr: "conflicts with",
+		},
+		"conflict with built-in endpoint": {
+			prefix:  "",
+			mocks:   []Mock{{Path: "/status/{status}"}},
+			wantErr: "conflicts with",
+		},
+	}
+	for name, tc := range errorTests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			err := ValidateMocks(tc.prefix, tc.mocks, DefaultMaxDuration)
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Fatalf("expected error containing %q, got %v", tc.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestMockRegistry(t *testing.T) {
+	t.Parallel()
+
+	t.Run("limits", func(t *testing.T) {
+		t.Parallel()
+		reg := newMockRegistry()
+		for i := range maxMocksPerNamespace {
+			_, err := reg.register("ns", Mock{Path: fmt.Sprintf("/%d", i)})
+			assert.NilError(t, err)
+		}
+		_, err := reg.register("ns", Mock{Path: "/extra"})
+		assert.Error(t, err, errTooManyMocks)
+
+		for i := range maxMockNamespaces - 1 {
+			_, err := reg.register(fmt.Sprintf("ns-%d", i), Mock{Path: "/"})
+			assert.NilError(t, err)
+		}
+		_, err = reg.register("extra", Mock{Path: "/"})
+		assert.Error(t, err, errTooManyMockNamespaces)
+	})
+
+	t.Run("ids are not reused", func(t *testing.T) {
+		t.Parallel()
+		reg := newMockRegistry()
+		id, err := reg.register("ns", Mock{Path: "/a"})
+		assert.NilError(t, err)
+		assert.Equal(t, reg.remove("ns", id), true, "expected mock to be removed")
+		id, err = reg.register("ns", Mock{Path: "/a"})
+		assert.NilError(t, err)
+		assert.Equal(t, id, 2, "incorrect id")
+	})
+
+	t.Run("hits are only recorded for registered mocks", func(t *testing.T) {
+		t.Parallel()
+		reg := newMockRegistry()
+		_, err := reg.register("ns", Mock{Path: "/a"})
+		assert.NilError(t, err)
+
+		r := httptest.NewRequest("GET", "/a", nil)
+		handler, ok := reg.handler("ns", r)
+		assert.Equal(t, ok, true, "expected mock to match")
+		reg.clear("ns")
+		handler.ServeHTTP(httptest.NewRecorder(), r)
+
+		_, err = reg.register("ns", Mock{Path: "/a"})
+		assert.NilError(t, err)
+		mocks, _, err := reg.list("ns")
+		assert.NilError(t, err)
+		assert.Equal(t, len(mocks[0].hits), 0, "expected no hits")
+	})
+}
@@ -2,6 +2,7 @@ package httpbin
 
 import (
 	"fmt"
+	"net/url"
 	"sort"
 	"strings"
 	"time"
@@ -39,6 +40,14 @@ func WithHostname(s string) OptionFunc {
 	}
 }
 
+// WithAPIKey sets the API key expected by the /api-key endpoint when no key
+// is given in the request path.
+func WithAPIKey(key string) OptionFunc {
+	return func(h *HTTPBin) {
+		h.apiKey = key
+	}
+}
+
 // WithObserver sets the request observer callback
 func WithObserver(o Observer) OptionFunc {
 	return func(h *HTTPBin) {
@@ -89,6 +98,161 @@ Allowed redirect destinations:
 	}
 }
 
+// WithAllowedWebhookDomains enables the /webhooks endpoints, which deliver
+// signed webhooks to target URLs on the given domains on behalf of clients.
+// Domains allow any port unless given with one, e.g. example.com:8443.
+// Deliveries continue in the background until the HTTPBin is closed.
+func WithAllowedWebhookDomains(hosts []string) OptionFunc {
+	return func(h *HTTPBin) {
+		h.webhooks = newWebhookSender(hosts)
+	}
+}
+
+// WithRateLimit enables server-wide rate limiting of each client, rejecting
+// requests that exceed the limit with a 429 Too Many Requests response.
+func WithRateLimit(cfg RateLimit) OptionFunc {
+	return func(h *HTTPBin) {
+		if cfg.Rate > 0 {
+			h.rateLimiter = newRateLimiter(cfg)
+		} else {
+			h.rateLimiter = nil
+		}
+	}
+}
+
+// WithMaxConcurrentRequests limits the number of requests handled
+// concurrently. Requests beyond the limit wait up to queueTimeout for another
+// request to finish before being rejected with a 503 Service Unavailable
+// response.
+func WithMaxConcurrentRequests(n int, queueTimeout time.Duration) OptionFunc {
+	return func(h *HTTPBin) {
+		if n > 0 {
+			h.concurrencySlots = make(chan struct{}, n)
+			h.concurrencyQueueTimeout = queueTimeout
+		} else {
+			h.concurrencySlots = nil
+			h.concurrencyQueueTimeout = 0
+		}
+	}
+}
+
+// WithMaxBandwidth caps the rate at which each response body is written, in
+// bytes per second. Clients may request a lower rate via the X-Httpbin-Rate
+// header or rate query param, e.g. rate=64KiB/s, regardless of this option.
+func WithMaxBandwidth(bytesPerSecond int64) OptionFunc {
+	return func(h *HTTPBin) {
+		h.maxBandwidth = float64(max(bytesPerSecond, 0))
+	}
+}
+
+// WithFaultInjectionHeaders allows clients to inject latency and failures into
+// the response from any endpoint via the X-Httpbin-Delay, X-Httpbin-Jitter,
+// X-Httpbin-Fail-Rate, X-Httpbin-Status and X-Httpbin-Seed request headers,
+// or the equivalent _httpbin_delay, _httpbin_jitter, etc query params.
+//
+// Injected delays are bounded by MaxDuration and count against it, so a
+// request with an injected delay never takes longer than MaxDuration overall.
+func WithFaultInjectionHeaders() OptionFunc {
+	return func(h *HTTPBin) {
+		h.faultInjectionHeaders = true
+	}
+}
+
+// WithChaos enables server-wide chaos mode, which injects errors and latency
+// into requests for the configured routes. The settings may be inspected at
+// runtime via GET requests to /_chaos, and updated via PUT requests if
+// WithChaosAdmin is also given. Use (Chaos).Validate to check for invalid
+// settings, which otherwise cause a panic.
+func WithChaos(cfg Chaos) OptionFunc {
+	return func(h *HTTPBin) {
+		if err := cfg.Validate(); err != nil {
+			panic(fmt.Sprintf("httpbin: invalid chaos settings: %s", err))
+		}
+		h.chaos = newChaosMode(cfg)
+	}
+}
+
+// WithChaosAdmin enables an unauthenticated admin API at PUT /_chaos, via
+// which clients may replace the chaos mode settings at runtime. Unless chaos
+// mode is also configured via WithChaos, it starts out injecting no errors or
+// latency.
+func WithChaosAdmin() OptionFunc {
+	return func(h *HTTPBin) {
+		h.chaosAdmin = true
+	}
+}
+
+// WithMocks serves the given mock endpoints under the given path prefix (e.g.
+// DefaultMocksPrefix), each of which always responds with the same canned
+// response. Use ValidateMocks to check for invalid or conflicting mocks, which
+// otherwise cause a panic. Mock delays are bounded by MaxDuration.
+func WithMocks(prefix string, mocks []Mock) OptionFunc {
+	return func(h *HTTPBin) {
+		h.mocksPrefix = prefix
+		h.mocks = mocks
+	}
+}
+
+// WithMocksAdmin enables an unauthenticated admin API at /_mocks, via which
+// clients may register mock endpoints at runtime and verify the requests made
+// to them. Each client's mocks are isolated in a namespace, served under the
+// mocks prefix (DefaultMocksPrefix unless otherwise given via WithMocks).
+func WithMocksAdmin() OptionFunc {
+	return func(h *HTTPBin) {
+		h.mockRegistry = newMockRegistry()
+	}
+}
+
+// WithRecordUpstream enables record mode, in which every request is
+// reverse-proxied to the given upstream server instead of being handled by
+// the built-in endpoints, and each interaction is recorded to the given
+// cassette for later replay via WithReplay.
+func WithRecordUpstream(upstream *url.URL, cassette *CassetteWriter) OptionFunc {
+	return func(h *HTTPBin) {
+		h.recordUpstream = upstream
+		h.cassette = cassette
+	}
+}
+
+// WithReplay enables replay mode, in which every request is served the
+// response from a matching interaction recorded in a cassette (see
+// LoadCassette) instead of being handled by the built-in endpoints. Requests
+// that match no recorded interaction fail with a 502 error.
+func WithReplay(interactions []Interaction, rules MatchRules) OptionFunc {
+	return func(h *HTTPBin) {
+		h.replayer = newReplayer(interactions, rules)
+	}
+}
+
+// WithHARRecorder records up to maxEntries of the most recent requests and
+// responses served (DefaultHARMaxEntries if 0), including samples of their
+// bodies, and exports them in HAR 1.2 format via /har.
+func WithHARRecorder(maxEntries int) OptionFunc {
+	return func(h *HTTPBin) {
+		h.harRecorder = newHARRecorder(maxEntries)
+	}
+}
+
+// WithHAR serves the entries in the given HAR archive (see LoadHAR) as mock
+// responses under the mocks prefix, matched by method and path. If timings
+// is true, each response is delayed by the time recorded for its entry,
+// bounded by MaxDuration.
+func WithHAR(archive *HARArchive, timings bool) OptionFunc {
+	return func(h *HTTPBin) {
+		h.harArchive = archive
+		h.harTimings = timings
+	}
+}
+
+// WithStore persists the history of handled requests, including a sample of
+// each request body, to the given Store and exposes it via /history. The
+// caller remains responsible for closing the store.
+func WithStore(s Store) OptionFunc {
+	return func(h *HTTPBin) {
+		h.store = s
+	}
+}
+
 // WithVersion sets the service name and build metadata to expose via /version.
 func WithVersion(service, version, commit, buildDate, goVersion string) OptionFunc {
 	return func(h *HTTPBin) {
@@ -0,0 +1,202 @@
+package httpbin
+
+import (
+	"errors"
+	"math"
+	"sync"
+	"time"
+)
+
+// RateLimit configures the optional server-wide rate limiting middleware,
+// which applies a token bucket to each client.
+type RateLimit struct {
+	// Number of requests per second each client may sustain. Rate limiting is
+	// disabled if zero.
+	Rate float64
+
+	// Max number of requests each client may make in a burst. Defaults to
+	// Rate, rounded up, if zero.
+	Burst int
+
+	// If set, clients are identified by the value of this request header
+	// (e.g. X-API-Key) together with their IP address, falling back to
+	// their IP address alone if the header is not present. Otherwise,
+	// clients are identified by IP address.
+	//
+	// Clients may send any value they like, so the header should be set by
+	// a trusted proxy in front of go-httpbin rather than by clients.
+	KeyHeader string
+}
+
+// rateLimitSweepInterval controls how often the rate limiter discards the
+// buckets of clients that have not made requests recently.
+const rateLimitSweepInterval = time.Minute
+
+// rateLimiter implements a token bucket rate limiter keyed by client.
+type rateLimiter struct {
+	mu sync.Mutex
+
+	rate      float64
+	burst     float64
+	keyHeader string
+
+	buckets   map[string]*tokenBucket
+	lastSweep time.Time
+}
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// rateLimitDecision is the result of taking a token from a client's bucket.
+type rateLimitDecision struct {
+	allowed bool
+	// whole tokens remaining in the bucket
+	remaining int
+	// time until the next token is available, if the request was not allowed
+	retryAfter time.Duration
+	// time until the bucket is full again
+	reset time.Duration
+}
+
+func newRateLimiter(cfg RateLimit) *rateLimiter {
+	burst := float64(cfg.Burst)
+	if burst < 1 {
+		burst = math.Max(1, math.Ceil(cfg.Rate))
+	}
+	return &rateLimiter{
+		rate:      cfg.Rate,
+		burst:     burst,
+		keyHeader: cfg.KeyHeader,
+		buckets:   make(map[string]*tokenBucket),
+		lastSweep: time.Now(),
+	}
+}
+
+// window is the time it takes for an empty bucket to fill up.
+func (l *rateLimiter) window() time.Duration {
+	return time.Duration(l.burst / l.rate * float64(time.Second))
+}
+
+// take attempts to take a token from the bucket for the given key.
+func (l *rateLimiter) take(key string, now time.Time) rateLimitDecision {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if now.Sub(l.lastSweep) >= rateLimitSweepInterval {
+		l.sweep(now)
+	}
+
+	b, found := l.buckets[key]
+	if !found {
+		b = &tokenBucket{tokens: l.burst, last: now}
+		l.buckets[key] = b
+	}
+	b.tokens = math.Min(l.burst, b.tokens+now.Sub(b.last).Seconds()*l.rate)
+	b.last = now
+
+	var d rateLimitDecision
+	if b.tokens >= 1 {
+		b.tokens--
+		d.allowed = true
+	} else {
+		d.retryAfter = l.secondsToDuration((1 - b.tokens) / l.rate)
+	}
+	d.remaining = int(b.tokens)
+	d.reset = l.secondsToDuration((l.burst - b.tokens) / l.rate)
+	return d
+}
+
+// sweep discards buckets that would have refilled completely by now, which
+// are indistinguishable from new buckets.
+func (l *rateLimiter) sweep(now time.Time) {
+	for key, b := range l.buckets {
+		if b.tokens+now.Sub(b.last).Seconds()*l.rate >= l.burst {
+			delete(l.buckets, key)
+		}
+	}
+	l.lastSweep = now
+}
+
+func (l *rateLimiter) secondsToDuration(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
+
+// ceilSeconds rounds a duration up to a whole number of seconds.
+func ceilSeconds(d time.Duration) int64 {
+	return int64(math.Ceil(d.Seconds()))
+}
+
+// Limits on the parameters accepted by the /rate-limit endpoint
+const (
+	maxRateLimitQuota  = 10000
+	maxRateLimitWindow = time.Hour
+)
+
+// maxQuotaKeys bounds the number of keys tracked by the /rate-limit endpoint,
+// so that clients cannot exhaust the server's memory with unique keys.
+const maxQuotaKeys = 10000
+
+var errTooManyQuotaKeys = errors.New("too many rate limit keys in use")
+
+// quotaTracker counts the hits for each key in fixed windows on behalf of the
+// /rate-limit endpoint.
+type quotaTracker struct {
+	mu      sync.Mutex
+	windows map[string]*quotaWindow
+}
+
+type quotaWindow struct {
+	start time.Time
+	end   time.Time
+	hits  int
+}
+
+// quotaDecision is the result of counting a hit against a key's quota.
+type quotaDecision struct {
+	allowed   bool
+	used      int
+	remaining int
+	reset     time.Time
+}
+
+func newQuotaTracker() *quotaTracker {
+	return &quotaTracker{windows: make(map[string]*quotaWindow)}
+}
+
+// hit counts a hit against the quota for key, starting a new window if the
+// key has no active window. Hits beyond the limit are rejected and do not
+// count against the quota.
+func (q *quotaTracker) hit(key string, limit int, window time.Duration, now time.Time) (quotaDecision, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	w, found := q.windows[key]
+	if found && !now.Before(w.end) {
+		found = false
+	}
+	if !found {
+		if len(q.windows) >= maxQuotaKeys {
+			for k, w := range q.windows {
+				if !now.Before(w.end) {
+					delete(q.windows, k)
+				}
+			}
+			if len(q.windows) >= maxQuotaKeys {
+				return quotaDecision{}, errTooManyQuotaKeys
+			}
+		}
+		w = &quotaWindow{start: now, end: now.Add(window)}
+		q.windows[key] = w
+	}
+
+	d := quotaDecision{reset: w.end}
+	if w.hits < limit {
+		w.hits++
+		d.allowed = true
+	}
+	d.used = w.hits
+	d.remaining = max(0, limit-w.hits)
+	return d, nil
+}
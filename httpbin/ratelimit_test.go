@@ -0,0 +1,116 @@
+package httpbin
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/mccutchen/go-httpbin/v2/internal/testing/assert"
+)
+
+func TestRateLimiter(t *testing.T) {
+	t.Parallel()
+
+	t.Run("token bucket", func(t *testing.T) {
+		t.Parallel()
+		l := newRateLimiter(RateLimit{Rate: 2, Burst: 3})
+		now := time.Now()
+
+		// a full bucket allows a burst
+		for i := range 3 {
+			d := l.take("a", now)
+			assert.Equal(t, d.allowed, true, "expected request %d to be allowed", i)
+			assert.Equal(t, d.remaining, 2-i, "incorrect remaining tokens")
+		}
+
+		// and then rejects requests until a token is replenished
+		d := l.take("a", now)
+		assert.Equal(t, d.allowed, false, "expected request to be rejected")
+		assert.Equal(t, d.remaining, 0, "incorrect remaining tokens")
+		assert.Equal(t, d.retryAfter, 500*time.Millisecond, "incorrect retry after")
+		assert.Equal(t, d.reset, 1500*time.Millisecond, "incorrect reset")
+
+		// other keys are unaffected
+		d = l.take("b", now)
+		assert.Equal(t, d.allowed, true, "expected other key to be allowed")
+
+		// tokens are replenished at the given rate
+		d = l.take("a", now.Add(500*time.Millisecond))
+		assert.Equal(t, d.allowed, true, "expected request to be allowed after refill")
+		assert.Equal(t, d.remaining, 0, "incorrect remaining tokens")
+
+		// but never beyond the burst size
+		d = l.take("a", now.Add(time.Hour))
+		assert.Equal(t, d.allowed, true, "expected request to be allowed after refill")
+		assert.Equal(t, d.remaining, 2, "incorrect remaining tokens")
+	})
+
+	t.Run("default burst", func(t *testing.T) {
+		t.Parallel()
+		assert.Equal(t, newRateLimiter(RateLimit{Rate: 2.5}).burst, 3.0, "incorrect default burst")
+		assert.Equal(t, newRateLimiter(RateLimit{Rate: 0.1}).burst, 1.0, "incorrect default burst")
+		assert.Equal(t, newRateLimiter(RateLimit{Rate: 0.1}).window(), 10*time.Second, "incorrect window")
+	})
+
+	t.Run("sweep", func(t *testing.T) {
+		t.Parallel()
+		l := newRateLimiter(RateLimit{Rate: 1, Burst: 10})
+		now := time.Now()
+		l.take("idle", now)
+		for range 10 {
+			l.take("busy", now.Add(rateLimitSweepInterval))
+		}
+		l.take("trigger", now.Add(rateLimitSweepInterval))
+
+		_, idleFound := l.buckets["idle"]
+		_, busyFound := l.buckets["busy"]
+		assert.Equal(t, idleFound, false, "expected idle bucket to be swept")
+		assert.Equal(t, busyFound, true, "expected busy bucket to be kept")
+	})
+}
+
+func TestQuotaTracker(t *testing.T) {
+	t.Parallel()
+
+	t.Run("fixed window", func(t *testing.T) {
+		t.Parallel()
+		q := newQuotaTracker()
+		now := time.Now()
+
+		for i := range 2 {
+			d, err := q.hit("a", 2, time.Second, now)
+			assert.NilError(t, err)
+			assert.DeepEqual(t, d, quotaDecision{allowed: true, used: i + 1, remaining: 1 - i, reset: now.Add(time.Second)}, "incorrect decision")
+		}
+
+		d, err := q.hit("a", 2, time.Second, now.Add(999*time.Millisecond))
+		assert.NilError(t, err)
+		assert.DeepEqual(t, d, quotaDecision{allowed: false, used: 2, remaining: 0, reset: now.Add(time.Second)}, "incorrect decision")
+
+		later := now.Add(time.Second)
+		d, err = q.hit("a", 2, time.Second, later)
+		assert.NilError(t, err)
+		assert.DeepEqual(t, d, quotaDecision{allowed: true, used: 1, remaining: 1, reset: later.Add(time.Second)}, "incorrect decision")
+	})
+
+	t.Run("max keys", func(t *testing.T) {
+		t.Parallel()
+		q := newQuotaTracker()
+		now := time.Now()
+		for i := range maxQuotaKeys {
+			_, err := q.hit(strconv.Itoa(i), 1, time.Second, now)
+			assert.NilError(t, err)
+		}
+
+		// existing keys may still be used, but new keys are rejected
+		_, err := q.hit("0", 1, time.Second, now)
+		assert.NilError(t, err)
+		_, err = q.hit("new", 1, time.Second, now)
+		assert.Error(t, err, errTooManyQuotaKeys)
+
+		// until old windows expire
+		_, err = q.hit("new", 1, time.Second, now.Add(time.Second))
+		assert.NilError(t, err)
+		assert.Equal(t, len(q.windows), 1, "expected expired windows to be discarded")
+	})
+}
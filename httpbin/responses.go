@@ -3,6 +3,7 @@ package httpbin
 import (
 	"net/http"
 	"net/url"
+	"time"
 )
 
 const (
@@ -73,6 +74,13 @@ type bodyResponse struct {
 	JSON  any        `json:"json"`
 }
 
+type idempotentResponse struct {
+	bodyResponse
+	ID             string    `json:"id"`
+	IdempotencyKey string    `json:"idempotency_key"`
+	Created        time.Time `json:"created"`
+}
+
 type cookiesResponse struct {
 	Cookies map[string]string `json:"cookies"`
 }
@@ -99,6 +107,28 @@ type uuidResponse struct {
 	UUID string `json:"uuid"`
 }
 
+type sessionResponse struct {
+	Authenticated bool      `json:"authenticated"`
+	User          string    `json:"user"`
+	Created       time.Time `json:"created,omitzero"`
+	Expires       time.Time `json:"expires,omitzero"`
+}
+
+type apiKeyResponse struct {
+	Authenticated bool   `json:"authenticated"`
+	Key           string `json:"key"`
+	In            string `json:"in"`
+	Name          string `json:"name"`
+}
+
+type rateLimitResponse struct {
+	Key       string `json:"key"`
+	Limit     int    `json:"limit"`
+	Remaining int    `json:"remaining"`
+	Used      int    `json:"used"`
+	Reset     int64  `json:"reset"`
+}
+
 type bearerResponse struct {
 	Authenticated bool   `json:"authenticated"`
 	Token         string `json:"token"`
@@ -108,6 +138,134 @@ type hostnameResponse struct {
 	Hostname string `json:"hostname"`
 }
 
+type scenarioResponse struct {
+	ID           string      `json:"id"`
+	Sequence     []int       `json:"sequence"`
+	Attempts     int         `json:"attempts"`
+	NextStatus   int         `json:"next_status"`
+	AttemptTimes []time.Time `json:"attempt_times"`
+	Expires      time.Time   `json:"expires"`
+}
+
+// chaosResponse describes the server-wide chaos mode settings, and is also
+// accepted as the request body used to update them.
+type chaosResponse struct {
+	ErrorRate float64                          `json:"error_rate"`
+	Latency   string                           `json:"latency"`
+	Routes    []string                         `json:"routes"`
+	Overrides map[string]chaosSettingsResponse `json:"overrides"`
+	Seed      int64                            `json:"seed"`
+}
+
+type chaosSettingsResponse struct {
+	ErrorRate float64 `json:"error_rate"`
+	Latency   string  `json:"latency"`
+}
+
+type binResponse struct {
+	ID          string    `json:"id"`
+	URL         string    `json:"url"`
+	RequestsURL string    `json:"requests_url"`
+	Expires     time.Time `json:"expires"`
+}
+
+type binRequestsResponse struct {
+	Requests []capturedRequest `json:"requests"`
+}
+
+// capturedRequest is a complete record of an incoming request, captured for
+// later inspection. Duration is the time taken to read the request body.
+type capturedRequest struct {
+	ID       int         `json:"id"`
+	Method   string      `json:"method"`
+	URL      string      `json:"url"`
+	Args     url.Values  `json:"args"`
+	Headers  http.Header `json:"headers"`
+	Origin   string      `json:"origin"`
+	Body     string      `json:"body"`
+	BodySize int64       `json:"body_size"`
+	Time     time.Time   `json:"time"`
+	Duration string      `json:"duration"`
+}
+
+type watchHookResponse struct {
+	Delivered int             `json:"delivered"`
+	Request   capturedRequest `json:"request"`
+}
+
+type historyResponse struct {
+	Requests []historyEntry `json:"requests"`
+}
+
+// historyEntry is a HistoryRecord with a human-readable duration, consistent
+// with the rest of the API.
+type historyEntry struct {
+	HistoryRecord
+	Duration string `json:"duration"`
+}
+
+type mockResponse struct {
+	ID      int               `json:"id"`
+	Method  string            `json:"method"`
+	Path    string            `json:"path"`
+	URL     string            `json:"url"`
+	Status  int               `json:"status"`
+	Headers map[string]string `json:"headers"`
+	Body    string            `json:"body"`
+	Delay   string            `json:"delay"`
+}
+
+type mocksResponse struct {
+	Namespace string         `json:"namespace"`
+	Mocks     []mockResponse `json:"mocks"`
+}
+
+type mockHitsResponse struct {
+	ID                int            `json:"id"`
+	Method            string         `json:"method"`
+	Path              string         `json:"path"`
+	Hits              int            `json:"hits"`
+	HitsByContentType map[string]int `json:"hits_by_content_type"`
+}
+
+type mockVerifyResponse struct {
+	Namespace string             `json:"namespace"`
+	Mocks     []mockHitsResponse `json:"mocks"`
+
+	// Number of requests to the namespace that did not match any mock
+	Unmatched int `json:"unmatched"`
+}
+
+type webhookSendResponse struct {
+	Deliveries []webhookDelivery `json:"deliveries"`
+
+	// Signing secret used for the deliveries, which receivers may use to
+	// verify their signatures
+	Secret          string `json:"secret"`
+	SignatureHeader string `json:"signature_header"`
+}
+
+type webhookDeliveriesResponse struct {
+	Deliveries []webhookDelivery `json:"deliveries"`
+}
+
+// webhookDelivery is an entry in the webhook delivery log, recording each
+// attempt made to deliver a single webhook.
+type webhookDelivery struct {
+	ID        string           `json:"id"`
+	URL       string           `json:"url"`
+	State     string           `json:"state"`
+	Scheduled time.Time        `json:"scheduled"`
+	Attempts  []webhookAttempt `json:"attempts"`
+}
+
+type webhookAttempt struct {
+	Time       time.Time `json:"time"`
+	StatusCode int       `json:"status_code,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	Duration   string    `json:"duration"`
+}
+
 type errorRespnose struct {
 	StatusCode int    `json:"status_code"`
 	Error      string `json:"error"`
@@ -0,0 +1,130 @@
+package httpbin
+
+import (
+	"errors"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Limits on the parameters accepted by the /scenario endpoints
+const (
+	defaultScenarioTTL     = 10 * time.Minute
+	maxScenarioTTL         = 24 * time.Hour
+	maxScenarioSequenceLen = 100
+)
+
+// maxScenarios bounds the number of scenarios tracked at once, so that
+// clients cannot exhaust the server's memory with unique ids.
+const maxScenarios = 10000
+
+// maxScenarioAttemptTimes bounds the number of attempt timestamps recorded
+// for each scenario; only the most recent attempts are kept.
+const maxScenarioAttemptTimes = 100
+
+var (
+	errScenarioNotFound = errors.New("scenario not found")
+	errTooManyScenarios = errors.New("too many scenarios in progress")
+)
+
+// scenario is a scripted sequence of status codes, advanced by each request
+// for the same id.
+type scenario struct {
+	sequence     []int
+	attempts     int
+	attemptTimes []time.Time
+	expires      time.Time
+}
+
+// scenarioStep is the result of advancing a scenario by one attempt.
+type scenarioStep struct {
+	status  int
+	attempt int
+	expires time.Time
+}
+
+// scenarioStore tracks the progress of each scenario on behalf of the
+// /scenario endpoints. Scenarios expire after a period of inactivity.
+type scenarioStore struct {
+	mu        sync.Mutex
+	scenarios map[string]*scenario
+}
+
+func newScenarioStore() *scenarioStore {
+	return &scenarioStore{scenarios: make(map[string]*scenario)}
+}
+
+// advance records an attempt for the scenario with the given id, returning
+// the status code for that attempt. Once the sequence is exhausted, its last
+// status code is repeated.
+//
+// A new scenario is started if the id is unknown, has expired, or a different
+// sequence is given. A nil sequence continues an existing scenario.
+func (s *scenarioStore) advance(id string, sequence []int, ttl time.Duration, now time.Time) (scenarioStep, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sc, found := s.scenarios[id]
+	if found && !now.Before(sc.expires) {
+		found = false
+	}
+	if !found || (sequence != nil && !slices.Equal(sequence, sc.sequence)) {
+		if sequence == nil {
+			return scenarioStep{}, errScenarioNotFound
+		}
+		if !found && len(s.scenarios) >= maxScenarios {
+			s.sweep(now)
+			if len(s.scenarios) >= maxScenarios {
+				return scenarioStep{}, errTooManyScenarios
+			}
+		}
+		sc = &scenario{sequence: sequence}
+		s.scenarios[id] = sc
+	}
+
+	status := sc.sequence[min(sc.attempts, len(sc.sequence)-1)]
+	sc.attempts++
+	sc.attemptTimes = append(sc.attemptTimes, now)
+	if len(sc.attemptTimes) > maxScenarioAttemptTimes {
+		sc.attemptTimes = slices.Delete(sc.attemptTimes, 0, len(sc.attemptTimes)-maxScenarioAttemptTimes)
+	}
+	sc.expires = now.Add(ttl)
+
+	return scenarioStep{status: status, attempt: sc.attempts, expires: sc.expires}, nil
+}
+
+// get returns a copy of the scenario with the given id, if it exists.
+func (s *scenarioStore) get(id string, now time.Time) (scenario, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sc, found := s.scenarios[id]
+	if !found || !now.Before(sc.expires) {
+		return scenario{}, false
+	}
+	return scenario{
+		sequence:     slices.Clone(sc.sequence),
+		attempts:     sc.attempts,
+		attemptTimes: slices.Clone(sc.attemptTimes),
+		expires:      sc.expires,
+	}, true
+}
+
+// reset forgets the scenario with the given id, reporting whether it existed.
+func (s *scenarioStore) reset(id string, now time.Time) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sc, found := s.scenarios[id]
+	delete(s.scenarios, id)
+	return found && now.Before(sc.expires)
+}
+
+// sweep removes expired scenarios. Callers must hold s.mu.
+func (s *scenarioStore) sweep(now time.Time) {
+	for id, sc := range s.scenarios {
+		if !now.Before(sc.expires) {
+			delete(s.scenarios, id)
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package httpbin
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/mccutchen/go-httpbin/v2/internal/testing/assert"
+)
+
+func TestScenarioStore(t *testing.T) {
+	t.Parallel()
+
+	t.Run("expired scenarios restart", func(t *testing.T) {
+		t.Parallel()
+		s := newScenarioStore()
+		now := time.Now()
+
+		step, err := s.advance("id", []int{503, 200}, time.Minute, now)
+		assert.NilError(t, err)
+		assert.Equal(t, step.status, 503, "incorrect status")
+
+		_, err = s.advance("id", nil, time.Minute, now.Add(2*time.Minute))
+		assert.Equal(t, err, errScenarioNotFound, "expected expired scenario to be forgotten")
+
+		step, err = s.advance("id", []int{503, 200}, time.Minute, now.Add(2*time.Minute))
+		assert.NilError(t, err)
+		assert.Equal(t, step.status, 503, "expected expired scenario to restart")
+		assert.Equal(t, step.attempt, 1, "incorrect attempt")
+	})
+
+	t.Run("attempts refresh expiry", func(t *testing.T) {
+		t.Parallel()
+		s := newScenarioStore()
+		now := time.Now()
+
+		for i := range 3 {
+			_, err := s.advance("id", []int{503, 200}, time.Minute, now.Add(time.Duration(i)*50*time.Second))
+			assert.NilError(t, err)
+		}
+		sc, found := s.get("id", now.Add(150*time.Second))
+		assert.Equal(t, found, true, "expected scenario to be found")
+		assert.Equal(t, sc.attempts, 3, "incorrect attempts")
+		assert.Equal(t, sc.expires, now.Add(160*time.Second), "incorrect expiry")
+	})
+
+	t.Run("attempt times are bounded", func(t *testing.T) {
+		t.Parallel()
+		s := newScenarioStore()
+		now := time.Now()
+
+		for i := range maxScenarioAttemptTimes + 10 {
+			_, err := s.advance("id", []int{200}, time.Minute, now.Add(time.Duration(i)))
+			assert.NilError(t, err)
+		}
+		sc, _ := s.get("id", now)
+		assert.Equal(t, sc.attempts, maxScenarioAttemptTimes+10, "incorrect attempts")
+		assert.Equal(t, len(sc.attemptTimes), maxScenarioAttemptTimes, "incorrect number of attempt times")
+		assert.Equal(t, sc.attemptTimes[0], now.Add(10), "expected oldest attempt times to be dropped")
+	})
+
+	t.Run("number of scenarios is bounded", func(t *testing.T) {
+		t.Parallel()
+		s := newScenarioStore()
+		now := time.Now()
+
+		for i := range maxScenarios {
+			s.scenarios[strconv.Itoa(i)] = &scenario{sequence: []int{200}, expires: now.Add(time.Minute)}
+		}
+		_, err := s.advance("new", []int{200}, time.Minute, now)
+		assert.Equal(t, err, errTooManyScenarios, "expected capacity error")
+
+		// existing scenarios may still advance
+		_, err = s.advance("0", nil, time.Minute, now)
+		assert.NilError(t, err)
+
+		// expired scenarios are swept to make room
+		_, err = s.advance("new", []int{200}, time.Minute, now.Add(2*time.Minute))
+		assert.NilError(t, err)
+	})
+}
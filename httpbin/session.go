@@ -0,0 +1,147 @@
+package httpbin
+
+import (
+	"crypto/hmac"
+	crypto_rand "crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	sessionCookieName = "httpbin_session"
+	csrfCookieName    = "httpbin_csrf"
+	csrfFormField     = "csrf_token"
+	csrfHeader        = "X-CSRF-Token"
+
+	defaultSessionMaxAge = 1 * time.Hour
+	maxSessionMaxAge     = 24 * time.Hour
+
+	// maxSessions bounds the number of live sessions kept in memory, so that
+	// clients cannot exhaust the server's memory by logging in repeatedly.
+	maxSessions = 10000
+)
+
+var (
+	errSessionMissing  = errors.New("missing session cookie")
+	errSessionInvalid  = errors.New("invalid session cookie")
+	errSessionExpired  = errors.New("session expired")
+	errTooManySessions = errors.New("too many active sessions")
+)
+
+// session is a single logged in session created via /session/login.
+type session struct {
+	ID      string
+	User    string
+	Created time.Time
+	Expires time.Time
+}
+
+// sessionStore keeps track of the sessions created via /session/login and
+// issues signed cookie values that identify them.
+//
+// Cookie values take the form <id>.<expires>.<signature>, where the signature
+// is an HMAC-SHA256 of the id and expiration time using a secret generated
+// when the store is created. Sessions are also tracked server-side, so that
+// they may be revoked via /session/logout before they expire.
+type sessionStore struct {
+	mu       sync.Mutex
+	secret   []byte
+	sessions map[string]*session
+}
+
+func newSessionStore() *sessionStore {
+	secret := make([]byte, 32)
+	if _, err := crypto_rand.Read(secret); err != nil {
+		panic(err)
+	}
+	return &sessionStore{
+		secret:   secret,
+		sessions: make(map[string]*session),
+	}
+}
+
+// create starts a new session for the given user, returning the session and
+// the signed cookie value that identifies it.
+func (s *sessionStore) create(user string, maxAge time.Duration) (*session, string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	for id, sess := range s.sessions {
+		if !now.Before(sess.Expires) {
+			delete(s.sessions, id)
+		}
+	}
+	if len(s.sessions) >= maxSessions {
+		return nil, "", errTooManySessions
+	}
+
+	sess := &session{
+		ID:      randomToken(),
+		User:    user,
+		Created: now,
+		Expires: now.Add(maxAge),
+	}
+	s.sessions[sess.ID] = sess
+	return sess, s.sign(sess.ID, sess.Expires), nil
+}
+
+// lookup verifies the given cookie value and returns the session it
+// identifies.
+func (s *sessionStore) lookup(cookieValue string) (*session, error) {
+	id, rawExpires, sig, ok := splitSessionCookie(cookieValue)
+	if !ok {
+		return nil, errSessionInvalid
+	}
+	if !hmac.Equal([]byte(sig), []byte(s.mac(id+"."+rawExpires))) {
+		return nil, errSessionInvalid
+	}
+	expires, err := strconv.ParseInt(rawExpires, 10, 64)
+	if err != nil {
+		return nil, errSessionInvalid
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !time.Now().Before(time.Unix(expires, 0)) {
+		delete(s.sessions, id)
+		return nil, errSessionExpired
+	}
+	sess, found := s.sessions[id]
+	if !found {
+		return nil, errSessionInvalid
+	}
+	return sess, nil
+}
+
+// delete revokes the session with the given id.
+func (s *sessionStore) delete(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.sessions, id)
+}
+
+func (s *sessionStore) sign(id string, expires time.Time) string {
+	payload := id + "." + strconv.FormatInt(expires.Unix(), 10)
+	return payload + "." + s.mac(payload)
+}
+
+func (s *sessionStore) mac(payload string) string {
+	m := hmac.New(sha256.New, s.secret)
+	m.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(m.Sum(nil))
+}
+
+func splitSessionCookie(value string) (id, expires, sig string, ok bool) {
+	parts := strings.Split(value, ".")
+	if len(parts) != 3 {
+		return "", "", "", false
+	}
+	return parts[0], parts[1], parts[2], true
+}
@@ -0,0 +1,385 @@
+package httpbin
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// DefaultStoreMaxRecords is the default number of records retained by a
+// Store.
+const DefaultStoreMaxRecords = 10000
+
+// maxHistoryBodySample bounds the number of request body bytes persisted for
+// each request.
+const maxHistoryBodySample = 1024
+
+// Default and max number of records returned by the /history endpoint
+const (
+	defaultHistoryLimit = 100
+	maxHistoryLimit     = 1000
+)
+
+// maxStoreRecordSize bounds the size of each line read from a FileStore.
+const maxStoreRecordSize = 1024 * 1024
+
+var errStoreClosed = errors.New("history store is closed")
+
+// HistoryRecord is a persisted record of a request handled by HTTPBin.
+type HistoryRecord struct {
+	ID         int64         `json:"id"`
+	Time       time.Time     `json:"time"`
+	Status     int           `json:"status"`
+	Method     string        `json:"method"`
+	URI        string        `json:"uri"`
+	Size       int64         `json:"size"`
+	Duration   time.Duration `json:"duration"`
+	UserAgent  string        `json:"user_agent"`
+	ClientIP   string        `json:"client_ip"`
+	RejectedBy string        `json:"rejected_by,omitempty"`
+
+	// A sample of the request body, made up of the first bytes read while
+	// handling the request. Samples that are not valid UTF-8 are encoded as
+	// base64 data URLs.
+	Body          string `json:"body"`
+	BodySize      int64  `json:"body_size"`
+	BodyTruncated bool   `json:"body_truncated,omitempty"`
+}
+
+// Store persists the history of requests handled by HTTPBin, which is exposed
+// via the /history endpoint. Implementations must be safe for concurrent use.
+type Store interface {
+	// Append records a handled request, assigning it the next id.
+	Append(rec HistoryRecord) error
+
+	// List returns up to limit of the most recently recorded requests,
+	// newest first.
+	List(limit int) ([]HistoryRecord, error)
+
+	// Close releases any resources held by the store.
+	Close() error
+}
+
+// StoreLimits bounds the history retained by a Store.
+type StoreLimits struct {
+	// Max number of records retained, after which the oldest records are
+	// discarded. Defaults to DefaultStoreMaxRecords.
+	MaxRecords int
+
+	// Max age of retained records (0 means no limit)
+	MaxAge time.Duration
+}
+
+// historyBuffer holds the records retained by a Store, oldest first. It is
+// not safe for concurrent use.
+type historyBuffer struct {
+	limits  StoreLimits
+	records []HistoryRecord
+	lastID  int64
+}
+
+func newHistoryBuffer(limits StoreLimits) historyBuffer {
+	if limits.MaxRecords <= 0 {
+		limits.MaxRecords = DefaultStoreMaxRecords
+	}
+	return historyBuffer{limits: limits}
+}
+
+// add retains the given record, assigning it the next id unless it already
+// has one.
+func (b *historyBuffer) add(rec HistoryRecord) HistoryRecord {
+	if rec.ID == 0 {
+		rec.ID = b.lastID + 1
+	}
+	b.lastID = max(b.lastID, rec.ID)
+	b.records = append(b.records, rec)
+	if extra := len(b.records) - b.limits.MaxRecords; extra > 0 {
+		b.records = b.records[extra:]
+	}
+	return rec
+}
+
+// expire discards records older than the max age.
+func (b *historyBuffer) expire(now time.Time) {
+	if b.limits.MaxAge <= 0 {
+		return
+	}
+	cutoff := now.Add(-b.limits.MaxAge)
+	i := 0
+	for i < len(b.records) && b.records[i].Time.Before(cutoff) {
+		i++
+	}
+	b.records = b.records[i:]
+}
+
+// list returns up to limit of the most recent records, newest first.
+func (b *historyBuffer) list(limit int) []HistoryRecord {
+	n := min(limit, len(b.records))
+	records := make([]HistoryRecord, 0, n)
+	for i := len(b.records) - 1; i >= 0 && len(records) < n; i-- {
+		records = append(records, b.records[i])
+	}
+	return records
+}
+
+// MemoryStore is a Store that keeps request history in memory, where it is
+// lost when the process exits.
+type MemoryStore struct {
+	mu  sync.Mutex
+	buf historyBuffer
+	now func() time.Time
+}
+
+var _ Store = &MemoryStore{}
+
+// NewMemoryStore creates a new MemoryStore with the given limits.
+func NewMemoryStore(limits StoreLimits) *MemoryStore {
+	return &MemoryStore{buf: newHistoryBuffer(limits), now: time.Now}
+}
+
+// Append implements Store.
+func (s *MemoryStore) Append(rec HistoryRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rec.ID = 0
+	s.buf.add(rec)
+	s.buf.expire(s.now())
+	return nil
+}
+
+// List implements Store.
+func (s *MemoryStore) List(limit int) ([]HistoryRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.buf.expire(s.now())
+	return s.buf.list(limit), nil
+}
+
+// Close implements Store.
+func (s *MemoryStore) Close() error {
+	return nil
+}
+
+// FileStore is a Store that appends request history to a file as JSON lines,
+// so that it survives restarts. The most recent records are also kept in
+// memory to serve reads.
+//
+// Records discarded due to the store's limits remain in the file until it is
+// compacted, which happens when the store is opened and whenever the
+// discarded records outnumber the max number of retained records.
+type FileStore struct {
+	mu   sync.Mutex
+	buf  historyBuffer
+	now  func() time.Time
+	path string
+	f    *os.File
+
+	// number of records written to the file since it was last compacted
+	written int
+}
+
+var _ Store = &FileStore{}
+
+// NewFileStore opens a FileStore backed by the file at the given path, which
+// is created if it does not exist. Existing records are loaded from the file
+// and subject to the given limits.
+func NewFileStore(path string, limits StoreLimits) (*FileStore, error) {
+	s := &FileStore{buf: newHistoryBuffer(limits), now: time.Now, path: path}
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.buf.expire(s.now())
+	if err := s.compact(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// load reads existing records from the store's file. A truncated final
+// record, as left behind by an interrupted write, is ignored.
+func (s *FileStore) load() error {
+	f, err := os.Open(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, maxStoreRecordSize)
+	var invalidLine int
+	for line := 1; scanner.Scan(); line++ {
+		if invalidLine != 0 {
+			return fmt.Errorf("%s:%d: invalid history record", s.path, invalidLine)
+		}
+		var rec HistoryRecord
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil || rec.ID == 0 {
+			invalidLine = line
+			continue
+		}
+		s.buf.add(rec)
+	}
+	return scanner.Err()
+}
+
+// compact rewrites the store's file to contain only the retained records,
+// replacing it atomically. Callers must hold s.mu.
+func (s *FileStore) compact() error {
+	var data bytes.Buffer
+	for _, rec := range s.buf.records {
+		line, err := json.Marshal(rec)
+		if err != nil {
+			return err
+		}
+		data.Write(line)
+		data.WriteByte('\n')
+	}
+
+	tmpPath := s.path + ".tmp"
+	if err := writeFileSync(tmpPath, data.Bytes()); err != nil {
+		return err
+	}
+	if err := os.Rename(tmpPath, s.path); err != nil {
+		return err
+	}
+
+	if s.f != nil {
+		s.f.Close()
+	}
+	f, err := os.OpenFile(s.path, os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		s.f = nil
+		return err
+	}
+	s.f = f
+	s.written = len(s.buf.records)
+	return nil
+}
+
+// Append implements Store.
+func (s *FileStore) Append(rec HistoryRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.f == nil {
+		return errStoreClosed
+	}
+	rec.ID = 0
+	rec = s.buf.add(rec)
+	s.buf.expire(s.now())
+
+	line, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	if _, err := s.f.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	s.written++
+
+	if s.written-len(s.buf.records) >= s.buf.limits.MaxRecords {
+		return s.compact()
+	}
+	return nil
+}
+
+// List implements Store.
+func (s *FileStore) List(limit int) ([]HistoryRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.buf.expire(s.now())
+	return s.buf.list(limit), nil
+}
+
+// Close implements Store.
+func (s *FileStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.f == nil {
+		return nil
+	}
+	err := s.f.Close()
+	s.f = nil
+	return err
+}
+
+// writeFileSync writes data to the named file and flushes it to stable
+// storage before closing it.
+func writeFileSync(name string, data []byte) error {
+	f, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// sampledBody wraps a request body in order to keep a sample of up to limit
+// of the first bytes read from it, for persisting to a Store or recording as
+// HAR.
+type sampledBody struct {
+	io.ReadCloser
+	limit  int
+	sample []byte
+	size   int64
+}
+
+func (b *sampledBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if room := b.limit - len(b.sample); room > 0 {
+		b.sample = append(b.sample, p[:min(n, room)]...)
+	}
+	b.size += int64(n)
+	return n, err
+}
+
+// newHistoryRecord creates a record of a request handled at the given time,
+// including a sample of its body, if available.
+func newHistoryRecord(t time.Time, result Result, body *sampledBody, contentType string) HistoryRecord {
+	rec := HistoryRecord{
+		Time:       t,
+		Status:     result.Status,
+		Method:     result.Method,
+		URI:        result.URI,
+		Size:       result.Size,
+		Duration:   result.Duration,
+		UserAgent:  result.UserAgent,
+		ClientIP:   result.ClientIP,
+		RejectedBy: result.RejectedBy,
+	}
+	if body == nil {
+		return rec
+	}
+	sample := body.sample[:min(len(body.sample), maxHistoryBodySample)]
+	if body.size > int64(len(sample)) {
+		sample = trimPartialRune(sample)
+	}
+	rec.BodySize = body.size
+	rec.BodyTruncated = body.size > int64(len(sample))
+	if utf8.Valid(sample) {
+		rec.Body = string(sample)
+	} else {
+		contentType, _, _ := strings.Cut(contentType, ";")
+		rec.Body = encodeData(sample, contentType)
+	}
+	return rec
+}
@@ -0,0 +1,176 @@
+package httpbin
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mccutchen/go-httpbin/v2/internal/testing/assert"
+)
+
+func TestMemoryStore(t *testing.T) {
+	t.Parallel()
+
+	t.Run("oldest records are discarded", func(t *testing.T) {
+		t.Parallel()
+		s := NewMemoryStore(StoreLimits{MaxRecords: 3})
+		for _, uri := range []string{"/a", "/b", "/c", "/d"} {
+			assert.NilError(t, s.Append(HistoryRecord{URI: uri, Time: time.Now()}))
+		}
+		records, err := s.List(10)
+		assert.NilError(t, err)
+		assert.DeepEqual(t, historyURIs(records), []string{"/d", "/c", "/b"}, "incorrect records")
+		assert.Equal(t, records[0].ID, int64(4), "incorrect id")
+
+		records, err = s.List(1)
+		assert.NilError(t, err)
+		assert.DeepEqual(t, historyURIs(records), []string{"/d"}, "incorrect records")
+	})
+
+	t.Run("records expire", func(t *testing.T) {
+		t.Parallel()
+		now := time.Now()
+		s := NewMemoryStore(StoreLimits{MaxAge: time.Minute})
+		s.now = func() time.Time { return now }
+		assert.NilError(t, s.Append(HistoryRecord{URI: "/old", Time: now.Add(-2 * time.Minute)}))
+		assert.NilError(t, s.Append(HistoryRecord{URI: "/new", Time: now}))
+
+		records, err := s.List(10)
+		assert.NilError(t, err)
+		assert.DeepEqual(t, historyURIs(records), []string{"/new"}, "expected old record to expire")
+	})
+}
+
+func TestFileStore(t *testing.T) {
+	t.Parallel()
+
+	t.Run("history survives reopening", func(t *testing.T) {
+		t.Parallel()
+		path := filepath.Join(t.TempDir(), "history.jsonl")
+		s, err := NewFileStore(path, StoreLimits{})
+		assert.NilError(t, err)
+		assert.NilError(t, s.Append(HistoryRecord{URI: "/a", Time: time.Now(), Duration: time.Second}))
+		assert.NilError(t, s.Append(HistoryRecord{URI: "/b", Time: time.Now()}))
+		assert.NilError(t, s.Close())
+		assert.Error(t, s.Append(HistoryRecord{}), errStoreClosed)
+
+		s, err = NewFileStore(path, StoreLimits{})
+		assert.NilError(t, err)
+		defer s.Close()
+		assert.NilError(t, s.Append(HistoryRecord{URI: "/c", Time: time.Now()}))
+		records, err := s.List(10)
+		assert.NilError(t, err)
+		assert.DeepEqual(t, historyURIs(records), []string{"/c", "/b", "/a"}, "incorrect records")
+		assert.Equal(t, records[0].ID, int64(3), "expected ids to continue from existing records")
+		assert.Equal(t, records[2].Duration, time.Second, "incorrect duration")
+	})
+
+	t.Run("file is compacted", func(t *testing.T) {
+		t.Parallel()
+		path := filepath.Join(t.TempDir(), "history.jsonl")
+		s, err := NewFileStore(path, StoreLimits{MaxRecords: 2})
+		assert.NilError(t, err)
+		defer s.Close()
+
+		for range 3 {
+			assert.NilError(t, s.Append(HistoryRecord{Time: time.Now()}))
+		}
+		assert.Equal(t, countLines(t, path), 3, "expected discarded record to remain until compaction")
+
+		assert.NilError(t, s.Append(HistoryRecord{Time: time.Now()}))
+		assert.Equal(t, countLines(t, path), 2, "expected file to be compacted")
+
+		records, err := s.List(10)
+		assert.NilError(t, err)
+		assert.Equal(t, len(records), 2, "incorrect number of records")
+		assert.Equal(t, records[0].ID, int64(4), "incorrect id")
+	})
+
+	t.Run("expired records are discarded when opened", func(t *testing.T) {
+		t.Parallel()
+		path := filepath.Join(t.TempDir(), "history.jsonl")
+		s, err := NewFileStore(path, StoreLimits{})
+		assert.NilError(t, err)
+		assert.NilError(t, s.Append(HistoryRecord{URI: "/old", Time: time.Now().Add(-time.Hour)}))
+		assert.NilError(t, s.Append(HistoryRecord{URI: "/new", Time: time.Now()}))
+		assert.NilError(t, s.Close())
+
+		s, err = NewFileStore(path, StoreLimits{MaxAge: time.Minute})
+		assert.NilError(t, err)
+		defer s.Close()
+		assert.Equal(t, countLines(t, path), 1, "expected expired record to be compacted away")
+	})
+
+	t.Run("truncated final record is ignored", func(t *testing.T) {
+		t.Parallel()
+		path := filepath.Join(t.TempDir(), "history.jsonl")
+		data := `{"id":1,"uri":"/a"}` + "\n" + `{"id":2,"ur`
+		assert.NilError(t, os.WriteFile(path, []byte(data), 0o644))
+
+		s, err := NewFileStore(path, StoreLimits{})
+		assert.NilError(t, err)
+		defer s.Close()
+		assert.NilError(t, s.Append(HistoryRecord{URI: "/b"}))
+		records, err := s.List(10)
+		assert.NilError(t, err)
+		assert.DeepEqual(t, historyURIs(records), []string{"/b", "/a"}, "incorrect records")
+		assert.Equal(t, countLines(t, path), 2, "incorrect number of lines")
+	})
+
+	t.Run("invalid records are an error", func(t *testing.T) {
+		t.Parallel()
+		path := filepath.Join(t.TempDir(), "history.jsonl")
+		data := `{"id":1,"uri":"/a"}` + "\nnope\n" + `{"id":2,"uri":"/b"}` + "\n"
+		assert.NilError(t, os.WriteFile(path, []byte(data), 0o644))
+
+		_, err := NewFileStore(path, StoreLimits{})
+		assert.Error(t, err, errors.New(path+":2: invalid history record"))
+	})
+}
+
+func TestNewHistoryRecord(t *testing.T) {
+	t.Parallel()
+
+	body := &sampledBody{
+		ReadCloser: io.NopCloser(strings.NewReader(strings.Repeat("a", 2*maxHistoryBodySample))),
+		limit:      maxHARBodySize,
+	}
+	_, err := io.ReadAll(body)
+	assert.NilError(t, err)
+
+	rec := newHistoryRecord(time.Now(), Result{Method: "POST"}, body, "text/plain")
+	assert.Equal(t, len(rec.Body), maxHistoryBodySample, "incorrect body sample size")
+	assert.Equal(t, rec.BodySize, int64(2*maxHistoryBodySample), "incorrect body size")
+	assert.Equal(t, rec.BodyTruncated, true, "expected body to be truncated")
+
+	// a sample that splits a multi-byte rune is still treated as text
+	body = &sampledBody{
+		ReadCloser: io.NopCloser(strings.NewReader("a" + strings.Repeat("é", maxHistoryBodySample))),
+		limit:      maxHARBodySize,
+	}
+	_, err = io.ReadAll(body)
+	assert.NilError(t, err)
+
+	rec = newHistoryRecord(time.Now(), Result{Method: "POST"}, body, "text/plain")
+	assert.Equal(t, rec.Body, "a"+strings.Repeat("é", (maxHistoryBodySample-2)/2), "incorrect body sample")
+	assert.Equal(t, rec.BodyTruncated, true, "expected body to be truncated")
+}
+
+func historyURIs(records []HistoryRecord) []string {
+	uris := make([]string, 0, len(records))
+	for _, rec := range records {
+		uris = append(uris, rec.URI)
+	}
+	return uris
+}
+
+func countLines(t *testing.T, path string) int {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	assert.NilError(t, err)
+	return strings.Count(string(data), "\n")
+}
@@ -0,0 +1,249 @@
+package httpbin
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"text/template"
+	"text/template/parse"
+	"time"
+)
+
+// maxTemplateIterations bounds the total number of loop iterations performed
+// while rendering a template, across all of its range actions, so that
+// templates producing no output cannot loop indefinitely.
+const maxTemplateIterations = 100000
+
+// maxTemplatePrintfWidth bounds the width and precision given to printf
+// verbs, so that tiny templates cannot allocate huge strings.
+const maxTemplatePrintfWidth = 1000
+
+var errTemplateTooLarge = errors.New("rendered template exceeds max body size")
+
+// templateContext is the data available to templates rendered by the
+// /template endpoint.
+type templateContext struct {
+	Method     string
+	URL        string
+	Path       string
+	PathValues map[string]string
+	Query      url.Values
+	Headers    http.Header
+	Origin     string
+
+	// The raw request body and, if it is valid JSON, its parsed value
+	Body string
+	JSON any
+}
+
+// templateRenderer renders a single template, tracking the resources it
+// consumes.
+type templateRenderer struct {
+	rng        *rand.Rand
+	iterations int
+
+	// maxBytes bounds the total size of the strings produced by template
+	// functions, which could otherwise be used to grow variables without
+	// bound, e.g. by repeatedly doubling a string.
+	maxBytes int64
+	bytes    int64
+}
+
+func (tr *templateRenderer) funcs() template.FuncMap {
+	return template.FuncMap{
+		"json":      func(v any) (string, error) { return tr.count(templateJSON(v)) },
+		"lower":     func(s string) (string, error) { return tr.count(strings.ToLower(s), nil) },
+		"now":       time.Now,
+		"printf":    func(format string, args ...any) (string, error) { return tr.count(templatePrintf(format, args...)) },
+		"randFloat": tr.rng.Float64,
+		"randInt":   tr.randInt,
+		"upper":     func(s string) (string, error) { return tr.count(strings.ToUpper(s), nil) },
+		"uuid":      uuidv4,
+
+		// replace the builtin functions producing strings, whose results
+		// would otherwise not count against maxBytes
+		"html":     func(args ...any) (string, error) { return tr.count(template.HTMLEscaper(args...), nil) },
+		"js":       func(args ...any) (string, error) { return tr.count(template.JSEscaper(args...), nil) },
+		"print":    func(args ...any) (string, error) { return tr.count(fmt.Sprint(args...), nil) },
+		"println":  func(args ...any) (string, error) { return tr.count(fmt.Sprintln(args...), nil) },
+		"urlquery": func(args ...any) (string, error) { return tr.count(template.URLQueryEscaper(args...), nil) },
+
+		// injected into the pipeline of every range action by parseTemplate
+		"rangeGuard": tr.rangeGuard,
+	}
+}
+
+// count counts the size of a string produced by a template function against
+// the renderer's maxBytes.
+func (tr *templateRenderer) count(s string, err error) (string, error) {
+	if err != nil {
+		return "", err
+	}
+	tr.bytes += int64(len(s))
+	if tr.bytes > tr.maxBytes {
+		return "", errTemplateTooLarge
+	}
+	return s, nil
+}
+
+// randInt returns a random integer in the range [min, max).
+func (tr *templateRenderer) randInt(minVal, maxVal int) (int, error) {
+	if maxVal <= minVal {
+		return 0, fmt.Errorf("randInt: max %d must be greater than min %d", maxVal, minVal)
+	}
+	return minVal + tr.rng.Intn(maxVal-minVal), nil
+}
+
+// rangeGuard counts the iterations about to be performed by a range action,
+// failing once the total exceeds maxTemplateIterations.
+func (tr *templateRenderer) rangeGuard(v any) (any, error) {
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Array, reflect.Slice, reflect.Map:
+		tr.iterations += rv.Len()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		tr.iterations += int(max(rv.Int(), 0))
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		tr.iterations += int(min(rv.Uint(), maxTemplateIterations+1))
+	}
+	if tr.iterations > maxTemplateIterations {
+		return nil, fmt.Errorf("template exceeds max of %d loop iterations", maxTemplateIterations)
+	}
+	return v, nil
+}
+
+// parseTemplate parses the given template text, rejecting templates that
+// define or invoke other templates, which would allow for unbounded
+// recursion, and guarding each range action against excessive iteration.
+func (tr *templateRenderer) parseTemplate(text string) (*template.Template, error) {
+	tmpl, err := template.New("template").Funcs(tr.funcs()).Parse(text)
+	if err != nil {
+		return nil, err
+	}
+	if len(tmpl.Templates()) > 1 {
+		return nil, errors.New("defining templates is not supported")
+	}
+	if tmpl.Tree == nil {
+		return tmpl, nil
+	}
+	if err := guardTemplateNode(tmpl.Tree, tmpl.Root); err != nil {
+		return nil, err
+	}
+	return tmpl, nil
+}
+
+// guardTemplateNode walks the given template node, adding a call to
+// rangeGuard to the end of each range action's pipeline.
+func guardTemplateNode(tree *parse.Tree, node parse.Node) error {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return nil
+		}
+		for _, child := range n.Nodes {
+			if err := guardTemplateNode(tree, child); err != nil {
+				return err
+			}
+		}
+	case *parse.TemplateNode:
+		return errors.New("invoking templates is not supported")
+	case *parse.RangeNode:
+		guard := parse.NewIdentifier("rangeGuard").SetTree(tree).SetPos(n.Pipe.Position())
+		n.Pipe.Cmds = append(n.Pipe.Cmds, &parse.CommandNode{
+			NodeType: parse.NodeCommand,
+			Pos:      n.Pipe.Position(),
+			Args:     []parse.Node{guard},
+		})
+		return guardTemplateBranch(tree, &n.BranchNode)
+	case *parse.IfNode:
+		return guardTemplateBranch(tree, &n.BranchNode)
+	case *parse.WithNode:
+		return guardTemplateBranch(tree, &n.BranchNode)
+	}
+	return nil
+}
+
+func guardTemplateBranch(tree *parse.Tree, n *parse.BranchNode) error {
+	if err := guardTemplateNode(tree, n.List); err != nil {
+		return err
+	}
+	return guardTemplateNode(tree, n.ElseList)
+}
+
+// templateJSON encodes the given value as JSON.
+func templateJSON(v any) (string, error) {
+	b, err := json.Marshal(v)
+	return string(b), err
+}
+
+// templatePrintf replaces the builtin printf function in order to limit the
+// width and precision of its verbs.
+func templatePrintf(format string, args ...any) (string, error) {
+	rest := format
+	for i := strings.IndexByte(rest, '%'); i != -1; i = strings.IndexByte(rest, '%') {
+		// a verb's flags, argument indexes, width and precision precede the
+		// verb itself
+		spec := rest[i+1:]
+		end := strings.IndexFunc(spec, func(r rune) bool {
+			return !strings.ContainsRune("+-# 0123456789.[]*", r)
+		})
+		if end == -1 {
+			end = len(spec)
+		}
+		spec, rest = spec[:end], spec[min(end+1, len(spec)):]
+
+		if strings.ContainsRune(spec, '*') {
+			return "", errors.New("printf: * width and precision are not supported")
+		}
+		for _, size := range strings.FieldsFunc(spec, func(r rune) bool { return r < '0' || r > '9' }) {
+			if n, err := strconv.Atoi(size); err != nil || n > maxTemplatePrintfWidth {
+				return "", fmt.Errorf("printf: width and precision must be <= %d", maxTemplatePrintfWidth)
+			}
+		}
+	}
+	return fmt.Sprintf(format, args...), nil
+}
+
+// limitedBuffer is an io.Writer that accumulates up to limit bytes, failing
+// any writes beyond that.
+type limitedBuffer struct {
+	buf   []byte
+	limit int64
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if int64(len(b.buf)+len(p)) > b.limit {
+		return 0, errTemplateTooLarge
+	}
+	b.buf = append(b.buf, p...)
+	return len(p), nil
+}
+
+// pathValues returns the values of the wildcards in the pattern matched by
+// the given request, keyed by name.
+func pathValues(r *http.Request) map[string]string {
+	values := make(map[string]string)
+	pattern := r.Pattern
+	for {
+		start := strings.Index(pattern, "{")
+		if start == -1 {
+			break
+		}
+		end := strings.Index(pattern[start:], "}")
+		if end == -1 {
+			break
+		}
+		name := strings.TrimSuffix(pattern[start+1:start+end], "...")
+		if name != "$" {
+			values[name] = r.PathValue(name)
+		}
+		pattern = pattern[start+end+1:]
+	}
+	return values
+}
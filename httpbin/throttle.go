@@ -0,0 +1,222 @@
+package httpbin
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Headers and query params used to request a throttled response, along with
+// the optional burst size. Like the fault injection headers, each header may
+// also be given as a query param anywhere, e.g. _httpbin_rate for
+// X-Httpbin-Rate.
+const (
+	bandwidthRateHeader  = "X-Httpbin-Rate"
+	bandwidthBurstHeader = "X-Httpbin-Burst"
+	bandwidthRateParam   = "rate"
+	bandwidthBurstParam  = "burst"
+)
+
+// bandwidthParamPaths are the paths of the endpoints serving canned or
+// generated bodies, which accept the plain rate and burst query params.
+// Elsewhere those params are left alone, e.g. /get?rate=x echoes them back.
+// Paths ending in a slash match any path beneath them.
+var bandwidthParamPaths = []string{
+	"/base64/",
+	"/bytes/",
+	"/drip",
+	"/encoding/utf8",
+	"/html",
+	"/image",
+	"/image/",
+	"/json",
+	"/range/",
+	"/robots.txt",
+	"/stream-bytes/",
+	"/xml",
+}
+
+// getBandwidthParam returns the value of the given throttling header, falling
+// back to the equivalent _httpbin_* query param and then, for the endpoints
+// in bandwidthParamPaths, the given plain query param.
+func getBandwidthParam(r *http.Request, header, param string) string {
+	if val := getFaultParam(r, header); val != "" {
+		return val
+	}
+	for _, path := range bandwidthParamPaths {
+		if r.URL.Path == path || (strings.HasSuffix(path, "/") && strings.HasPrefix(r.URL.Path, path)) {
+			return r.URL.Query().Get(param)
+		}
+	}
+	return ""
+}
+
+// maxThrottleSize bounds the rate and burst size clients may request, in
+// bytes (per second), so that they may be safely converted to ints.
+const maxThrottleSize = 1 << 30
+
+// byteSizeUnits maps the (lowercased) units accepted by parseByteSize to
+// their size in bytes.
+var byteSizeUnits = map[string]float64{
+	"":    1,
+	"b":   1,
+	"k":   1000,
+	"kb":  1000,
+	"kib": 1 << 10,
+	"m":   1000 * 1000,
+	"mb":  1000 * 1000,
+	"mib": 1 << 20,
+	"g":   1000 * 1000 * 1000,
+	"gb":  1000 * 1000 * 1000,
+	"gib": 1 << 30,
+}
+
+// parseByteSize parses a size in bytes with an optional unit, e.g. 512,
+// 64KiB or 1.5MB.
+func parseByteSize(input string) (float64, error) {
+	input = strings.TrimSpace(input)
+	i := strings.IndexFunc(input, func(r rune) bool {
+		return (r < '0' || r > '9') && r != '.'
+	})
+	if i == -1 {
+		i = len(input)
+	}
+	n, err := strconv.ParseFloat(input[:i], 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid size %q", input)
+	}
+	unit, ok := byteSizeUnits[strings.ToLower(strings.TrimSpace(input[i:]))]
+	if !ok {
+		return 0, fmt.Errorf("invalid size %q: unknown unit %q", input, input[i:])
+	}
+	return n * unit, nil
+}
+
+// parseBandwidth parses a bandwidth in bytes per second, e.g. 64KiB/s, where
+// the /s suffix is optional.
+func parseBandwidth(input string) (float64, error) {
+	rate, err := parseByteSize(strings.TrimSuffix(strings.TrimSpace(input), "/s"))
+	if err != nil {
+		return 0, err
+	}
+	if rate < 1 || rate > maxThrottleSize {
+		return 0, fmt.Errorf("invalid rate %q: must be between 1 byte and 1GiB per second", input)
+	}
+	return rate, nil
+}
+
+// defaultBurst returns the default burst size for the given rate, which
+// allows for 100ms worth of data to be written at once, up to
+// maxThrottleSize.
+func defaultBurst(rate float64) int {
+	return max(int(min(rate/10, maxThrottleSize)), 1)
+}
+
+// throttledResponseWriter is an http.ResponseWriter that caps the rate at
+// which the response body is written, using a token bucket that allows for
+// bursts of up to burst bytes.
+//
+// If a deadline is given, the response is written at fallbackRate (or
+// unthrottled, if 0) once it has passed.
+type throttledResponseWriter struct {
+	w            http.ResponseWriter
+	ctx          context.Context
+	rate         float64
+	burst        int
+	deadline     time.Time
+	fallbackRate float64
+
+	tokens float64
+	last   time.Time
+}
+
+func newThrottledResponseWriter(w http.ResponseWriter, ctx context.Context, rate float64, burst int) *throttledResponseWriter {
+	return &throttledResponseWriter{
+		w:      w,
+		ctx:    ctx,
+		rate:   rate,
+		burst:  burst,
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+}
+
+func (tw *throttledResponseWriter) Header() http.Header {
+	return tw.w.Header()
+}
+
+func (tw *throttledResponseWriter) WriteHeader(code int) {
+	tw.w.WriteHeader(code)
+}
+
+func (tw *throttledResponseWriter) Write(b []byte) (int, error) {
+	written := 0
+	for len(b) > 0 {
+		if !tw.deadline.IsZero() && time.Now().After(tw.deadline) {
+			tw.deadline = time.Time{}
+			if tw.fallbackRate == 0 {
+				n, err := tw.w.Write(b)
+				return written + n, err
+			}
+			tw.rate = tw.fallbackRate
+			tw.burst = min(tw.burst, defaultBurst(tw.rate))
+			tw.tokens = min(tw.tokens, float64(tw.burst))
+		}
+
+		chunk := b[:min(len(b), tw.burst)]
+		if err := tw.wait(len(chunk)); err != nil {
+			return written, err
+		}
+		n, err := tw.w.Write(chunk)
+		written += n
+		if err != nil {
+			return written, err
+		}
+		if f, ok := tw.w.(http.Flusher); ok {
+			f.Flush()
+		}
+		b = b[n:]
+	}
+	return written, nil
+}
+
+// wait blocks until n tokens are available, and then takes them.
+func (tw *throttledResponseWriter) wait(n int) error {
+	now := time.Now()
+	tw.tokens = min(tw.tokens+now.Sub(tw.last).Seconds()*tw.rate, float64(tw.burst))
+	tw.last = now
+	if deficit := float64(n) - tw.tokens; deficit > 0 {
+		pause := time.Duration(deficit / tw.rate * float64(time.Second))
+		if !tw.deadline.IsZero() {
+			pause = min(pause, time.Until(tw.deadline))
+		}
+		select {
+		case <-time.After(pause):
+		case <-tw.ctx.Done():
+			return tw.ctx.Err()
+		}
+		tw.tokens = float64(n)
+		tw.last = time.Now()
+	}
+	tw.tokens -= float64(n)
+	return nil
+}
+
+func (tw *throttledResponseWriter) Flush() {
+	if f, ok := tw.w.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (tw *throttledResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hj, ok := tw.w.(http.Hijacker)
+	if !ok {
+		return nil, nil, http.ErrNotSupported
+	}
+	return hj.Hijack()
+}
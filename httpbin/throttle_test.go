@@ -0,0 +1,93 @@
+package httpbin
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/mccutchen/go-httpbin/v2/internal/testing/assert"
+)
+
+func TestParseBandwidth(t *testing.T) {
+	t.Parallel()
+
+	okTests := map[string]float64{
+		"1":         1,
+		"512":       512,
+		"512/s":     512,
+		"64KiB/s":   64 * 1024,
+		"64kib/s":   64 * 1024,
+		"1.5KB/s":   1500,
+		"1MB":       1000 * 1000,
+		"2MiB/s":    2 * 1024 * 1024,
+		"1 GiB/s":   1024 * 1024 * 1024,
+		"100B/s":    100,
+		" 10k/s   ": 10000,
+		"1GiB/s":    1 << 30,
+	}
+	for input, want := range okTests {
+		t.Run("ok/"+input, func(t *testing.T) {
+			t.Parallel()
+			got, err := parseBandwidth(input)
+			assert.NilError(t, err)
+			assert.Equal(t, got, want, "incorrect bandwidth")
+		})
+	}
+
+	for _, input := range []string{"", "0", "0.5", "foo", "KiB/s", "10XB/s", "-1", "10KiB/m", "2GiB/s", "99999999999999999999999"} {
+		t.Run("bad/"+input, func(t *testing.T) {
+			t.Parallel()
+			_, err := parseBandwidth(input)
+			if err == nil {
+				t.Fatalf("expected error parsing %q", input)
+			}
+		})
+	}
+}
+
+func TestThrottledResponseWriter(t *testing.T) {
+	t.Parallel()
+
+	t.Run("caps rate after initial burst", func(t *testing.T) {
+		t.Parallel()
+		w := httptest.NewRecorder()
+		tw := newThrottledResponseWriter(w, context.Background(), 1000, 100)
+
+		// the first burst is written immediately, the remaining 100 bytes
+		// take ~100ms at 1000 bytes/sec
+		start := time.Now()
+		n, err := tw.Write(make([]byte, 200))
+		assert.NilError(t, err)
+		assert.Equal(t, n, 200, "incorrect bytes written")
+		assert.Equal(t, w.Body.Len(), 200, "incorrect body size")
+		assert.MinDuration(t, time.Since(start), 90*time.Millisecond)
+	})
+
+	t.Run("stops throttling after deadline", func(t *testing.T) {
+		t.Parallel()
+		w := httptest.NewRecorder()
+		tw := newThrottledResponseWriter(w, context.Background(), 1, 1)
+		tw.deadline = time.Now().Add(-time.Second)
+
+		start := time.Now()
+		n, err := tw.Write(make([]byte, 1000))
+		assert.NilError(t, err)
+		assert.Equal(t, n, 1000, "incorrect bytes written")
+		if elapsed := time.Since(start); elapsed > 100*time.Millisecond {
+			t.Fatalf("expected unthrottled write after deadline, took %s", elapsed)
+		}
+	})
+
+	t.Run("canceled", func(t *testing.T) {
+		t.Parallel()
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+		w := httptest.NewRecorder()
+		tw := newThrottledResponseWriter(w, ctx, 1, 1)
+
+		n, err := tw.Write(make([]byte, 10))
+		assert.Error(t, err, context.DeadlineExceeded)
+		assert.Equal(t, n, 1, "incorrect bytes written")
+	})
+}
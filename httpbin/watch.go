@@ -0,0 +1,79 @@
+package httpbin
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+)
+
+// maxWatchers bounds the number of clients that may watch for requests at
+// once, across all channels.
+const maxWatchers = 1000
+
+// watcherBufferSize is the number of captured requests buffered for each
+// watcher. Requests are dropped for watchers that fall further behind.
+const watcherBufferSize = 16
+
+var errTooManyWatchers = errors.New("too many watchers")
+
+// watchHub delivers the requests captured by /watch/{channel}/hook to every
+// client currently watching the same channel.
+type watchHub struct {
+	mu       sync.Mutex
+	channels map[string]map[chan capturedRequest]struct{}
+	watchers int
+	nextID   atomic.Int64
+}
+
+func newWatchHub() *watchHub {
+	return &watchHub{channels: make(map[string]map[chan capturedRequest]struct{})}
+}
+
+// subscribe starts watching the given channel, returning a channel of captured
+// requests and a function that must be called to stop watching.
+func (hub *watchHub) subscribe(channel string) (<-chan capturedRequest, func(), error) {
+	hub.mu.Lock()
+	defer hub.mu.Unlock()
+
+	if hub.watchers >= maxWatchers {
+		return nil, nil, errTooManyWatchers
+	}
+	ch := make(chan capturedRequest, watcherBufferSize)
+	if hub.channels[channel] == nil {
+		hub.channels[channel] = make(map[chan capturedRequest]struct{})
+	}
+	hub.channels[channel][ch] = struct{}{}
+	hub.watchers++
+
+	unsubscribe := func() {
+		hub.mu.Lock()
+		defer hub.mu.Unlock()
+		delete(hub.channels[channel], ch)
+		if len(hub.channels[channel]) == 0 {
+			delete(hub.channels, channel)
+		}
+		hub.watchers--
+	}
+	return ch, unsubscribe, nil
+}
+
+// publish assigns the captured request an id and delivers it to every client
+// watching the given channel, returning the request and the number of
+// watchers it was delivered to.
+func (hub *watchHub) publish(channel string, req capturedRequest) (capturedRequest, int) {
+	req.ID = int(hub.nextID.Add(1))
+
+	hub.mu.Lock()
+	defer hub.mu.Unlock()
+
+	delivered := 0
+	for ch := range hub.channels[channel] {
+		select {
+		case ch <- req:
+			delivered++
+		default:
+			// watcher is too far behind, drop the request
+		}
+	}
+	return req, delivered
+}
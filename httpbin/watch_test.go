@@ -0,0 +1,62 @@
+package httpbin
+
+import (
+	"testing"
+
+	"github.com/mccutchen/go-httpbin/v2/internal/testing/assert"
+)
+
+func TestWatchHub(t *testing.T) {
+	t.Parallel()
+
+	t.Run("requests are delivered to each watcher", func(t *testing.T) {
+		t.Parallel()
+		hub := newWatchHub()
+		ch1, unsubscribe1, err := hub.subscribe("a")
+		assert.NilError(t, err)
+		ch2, unsubscribe2, err := hub.subscribe("a")
+		assert.NilError(t, err)
+
+		req, delivered := hub.publish("a", capturedRequest{Method: "POST"})
+		assert.Equal(t, delivered, 2, "incorrect number of deliveries")
+		assert.Equal(t, req.ID, 1, "incorrect request id")
+		assert.Equal(t, (<-ch1).ID, 1, "incorrect request id")
+		assert.Equal(t, (<-ch2).ID, 1, "incorrect request id")
+
+		_, delivered = hub.publish("b", capturedRequest{})
+		assert.Equal(t, delivered, 0, "expected no deliveries to other channels")
+
+		unsubscribe1()
+		unsubscribe2()
+		_, delivered = hub.publish("a", capturedRequest{})
+		assert.Equal(t, delivered, 0, "expected no deliveries after unsubscribing")
+		assert.Equal(t, len(hub.channels), 0, "expected empty channels to be removed")
+	})
+
+	t.Run("slow watchers drop requests", func(t *testing.T) {
+		t.Parallel()
+		hub := newWatchHub()
+		ch, unsubscribe, err := hub.subscribe("a")
+		assert.NilError(t, err)
+		defer unsubscribe()
+
+		for range watcherBufferSize {
+			_, delivered := hub.publish("a", capturedRequest{})
+			assert.Equal(t, delivered, 1, "incorrect number of deliveries")
+		}
+		_, delivered := hub.publish("a", capturedRequest{})
+		assert.Equal(t, delivered, 0, "expected request to be dropped")
+		assert.Equal(t, len(ch), watcherBufferSize, "incorrect number of buffered requests")
+	})
+
+	t.Run("number of watchers is bounded", func(t *testing.T) {
+		t.Parallel()
+		hub := newWatchHub()
+		for range maxWatchers {
+			_, _, err := hub.subscribe("a")
+			assert.NilError(t, err)
+		}
+		_, _, err := hub.subscribe("b")
+		assert.Equal(t, err, errTooManyWatchers, "expected capacity error")
+	})
+}
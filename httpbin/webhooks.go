@@ -0,0 +1,343 @@
+package httpbin
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	crypto_rand "crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Limits on the parameters accepted by the /webhooks/send endpoint
+const (
+	defaultWebhookAttempts = 3
+	maxWebhookAttempts     = 10
+	defaultWebhookBackoff  = time.Second
+	maxWebhookCount        = 10
+
+	// Cap on the exponentially increasing delay between attempts to deliver
+	// a single webhook
+	maxWebhookRetryDelay = time.Minute
+)
+
+// maxWebhookDeliveries bounds the number of deliveries kept in the delivery
+// log, and maxPendingWebhookDeliveries bounds the number of deliveries that
+// may be scheduled or retrying at once, so that clients cannot exhaust the
+// server's resources.
+const (
+	maxWebhookDeliveries        = 100
+	maxPendingWebhookDeliveries = 100
+)
+
+// Headers defined by the Standard Webhooks spec, see
+// https://www.standardwebhooks.com/
+const (
+	webhookIDHeader               = "webhook-id"
+	webhookTimestampHeader        = "webhook-timestamp"
+	defaultWebhookSignatureHeader = "webhook-signature"
+	webhookSecretPrefix           = "whsec_"
+)
+
+// Delivery states reported in the delivery log
+const (
+	webhookPending   = "pending"
+	webhookSucceeded = "succeeded"
+	webhookFailed    = "failed"
+)
+
+var (
+	errTooManyWebhookDeliveries = errors.New("too many pending webhook deliveries")
+	errWebhookDeliveryNotFound  = errors.New("webhook delivery not found")
+	errWebhookSenderClosed      = errors.New("webhook sender is closed")
+)
+
+// webhookMessage is a webhook to be delivered to a target URL, signed
+// according to the Standard Webhooks spec.
+type webhookMessage struct {
+	id              string
+	url             string
+	contentType     string
+	payload         []byte
+	secret          []byte
+	signatureHeader string
+}
+
+// sign returns the Standard Webhooks signature of the message, sent at the
+// given unix timestamp, in the "v1,<base64>" format.
+func (m webhookMessage) sign(timestamp string) string {
+	mac := hmac.New(sha256.New, m.secret)
+	mac.Write([]byte(m.id + "." + timestamp + "."))
+	mac.Write(m.payload)
+	return "v1," + base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// webhookSender delivers webhooks to target URLs on an allowlist of domains,
+// retrying failed attempts with exponential backoff, and keeps a log of the
+// most recent deliveries.
+type webhookSender struct {
+	allowedDomains map[string]struct{}
+	client         *http.Client
+
+	// cancelled when the sender is closed, stopping deliveries in progress
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	mu         sync.Mutex
+	deliveries []*webhookDelivery
+	pending    int
+}
+
+func newWebhookSender(hosts []string) *webhookSender {
+	allowed := make(map[string]struct{}, len(hosts))
+	for _, host := range hosts {
+		allowed[host] = struct{}{}
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	return &webhookSender{
+		allowedDomains: allowed,
+		client: &http.Client{
+			// redirects could otherwise be used to reach hosts that are not
+			// on the allowlist
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+		ctx:    ctx,
+		cancel: cancel,
+	}
+}
+
+// allowed reports whether webhooks may be delivered to the given URL. Allowed
+// domains given without a port allow any port, while those given with a port
+// (e.g. example.com:8443) allow only that port.
+func (s *webhookSender) allowed(target *url.URL) bool {
+	if _, ok := s.allowedDomains[target.Hostname()]; ok {
+		return true
+	}
+	port := target.Port()
+	if port == "" {
+		port = map[string]string{"http": "80", "https": "443"}[target.Scheme]
+	}
+	_, ok := s.allowedDomains[net.JoinHostPort(target.Hostname(), port)]
+	return ok
+}
+
+// Close stops any deliveries that are scheduled or in progress, waiting for
+// them to finish. Stopped deliveries are marked as failed.
+func (s *webhookSender) Close() {
+	s.mu.Lock()
+	s.cancel()
+	s.mu.Unlock()
+	s.wg.Wait()
+}
+
+// schedule adds count deliveries of the given message to the delivery log and
+// starts delivering them in the background, interval apart, making up to
+// attempts attempts to deliver each one. Each delivery is a separate message
+// with its own id. Attempts are bounded by timeout.
+func (s *webhookSender) schedule(msg webhookMessage, count int, interval time.Duration, attempts int, backoff, timeout time.Duration, now time.Time) ([]webhookDelivery, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.ctx.Err() != nil {
+		return nil, errWebhookSenderClosed
+	}
+	if s.pending+count > maxPendingWebhookDeliveries {
+		return nil, errTooManyWebhookDeliveries
+	}
+	s.pending += count
+
+	scheduled := make([]webhookDelivery, 0, count)
+	for i := range count {
+		msg := msg
+		msg.id = "msg_" + uuidv4()
+		d := &webhookDelivery{
+			ID:        msg.id,
+			URL:       msg.url,
+			State:     webhookPending,
+			Scheduled: now.Add(time.Duration(i) * interval).UTC(),
+			Attempts:  []webhookAttempt{},
+		}
+		s.deliveries = append(s.deliveries, d)
+		if len(s.deliveries) > maxWebhookDeliveries {
+			s.deliveries = s.deliveries[1:]
+		}
+		scheduled = append(scheduled, d.snapshot())
+		s.wg.Add(1)
+		go s.deliver(d, msg, time.Duration(i)*interval, attempts, backoff, timeout)
+	}
+	return scheduled, nil
+}
+
+// deliver waits for the given delay and then attempts to deliver the message,
+// retrying with exponential backoff until an attempt succeeds, the attempts
+// are exhausted or the sender is closed.
+func (s *webhookSender) deliver(d *webhookDelivery, msg webhookMessage, delay time.Duration, attempts int, backoff, timeout time.Duration) {
+	defer s.wg.Done()
+	for n := range attempts {
+		if n > 0 {
+			delay = min(backoff<<(n-1), maxWebhookRetryDelay)
+		}
+		if !s.wait(delay) {
+			s.mu.Lock()
+			d.State = webhookFailed
+			s.pending--
+			s.mu.Unlock()
+			return
+		}
+		attempt := s.attempt(msg, timeout)
+		succeeded := attempt.Error == "" && attempt.StatusCode >= 200 && attempt.StatusCode < 300
+
+		s.mu.Lock()
+		d.Attempts = append(d.Attempts, attempt)
+		switch {
+		case succeeded:
+			d.State = webhookSucceeded
+		case n == attempts-1:
+			d.State = webhookFailed
+		}
+		if d.State != webhookPending {
+			s.pending--
+		}
+		s.mu.Unlock()
+
+		if succeeded {
+			return
+		}
+	}
+}
+
+// wait waits for the given delay, reporting false if the sender is closed in
+// the meantime.
+func (s *webhookSender) wait(delay time.Duration) bool {
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-s.ctx.Done():
+		return false
+	}
+}
+
+// attempt makes a single attempt to deliver the message.
+func (s *webhookSender) attempt(msg webhookMessage, timeout time.Duration) webhookAttempt {
+	start := time.Now()
+	attempt := webhookAttempt{Time: start.UTC()}
+
+	ctx, cancel := context.WithTimeout(s.ctx, timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, "POST", msg.url, bytes.NewReader(msg.payload))
+	if err != nil {
+		attempt.Error = err.Error()
+		return attempt
+	}
+	// the timestamp, and therefore the signature, change with each attempt
+	timestamp := strconv.FormatInt(start.Unix(), 10)
+	req.Header.Set("Content-Type", msg.contentType)
+	req.Header.Set("User-Agent", "go-httpbin-webhooks")
+	req.Header.Set(webhookIDHeader, msg.id)
+	req.Header.Set(webhookTimestampHeader, timestamp)
+	req.Header.Set(msg.signatureHeader, msg.sign(timestamp))
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		attempt.Error = err.Error()
+	} else {
+		attempt.StatusCode = resp.StatusCode
+		// the response body is not recorded, but is drained so that the
+		// connection may be reused
+		_, _ = io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+	}
+	attempt.Duration = time.Since(start).String()
+	return attempt
+}
+
+// snapshot returns a copy of the delivery that is safe to use once s.mu is
+// released. Callers must hold s.mu.
+func (d *webhookDelivery) snapshot() webhookDelivery {
+	snapshot := *d
+	snapshot.Attempts = append([]webhookAttempt{}, d.Attempts...)
+	return snapshot
+}
+
+// list returns a snapshot of the delivery log, oldest first.
+func (s *webhookSender) list() []webhookDelivery {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	deliveries := make([]webhookDelivery, 0, len(s.deliveries))
+	for _, d := range s.deliveries {
+		deliveries = append(deliveries, d.snapshot())
+	}
+	return deliveries
+}
+
+// get returns a snapshot of the delivery with the given id, if it is still
+// in the delivery log.
+func (s *webhookSender) get(id string) (webhookDelivery, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, d := range s.deliveries {
+		if d.ID == id {
+			return d.snapshot(), nil
+		}
+	}
+	return webhookDelivery{}, errWebhookDeliveryNotFound
+}
+
+// parseWebhookSecret parses a Standard Webhooks signing secret, which is
+// base64 encoded and optionally prefixed with "whsec_".
+func parseWebhookSecret(s string) ([]byte, error) {
+	secret, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(s, webhookSecretPrefix))
+	if err != nil {
+		return nil, errors.New("secret must be base64 encoded")
+	}
+	if len(secret) == 0 {
+		return nil, errors.New("secret must not be empty")
+	}
+	return secret, nil
+}
+
+// formatWebhookSecret formats a signing secret in the format accepted by
+// parseWebhookSecret.
+func formatWebhookSecret(secret []byte) string {
+	return webhookSecretPrefix + base64.StdEncoding.EncodeToString(secret)
+}
+
+// newWebhookSecret generates a random signing secret.
+func newWebhookSecret() []byte {
+	secret := make([]byte, 24)
+	if _, err := crypto_rand.Read(secret); err != nil {
+		panic(err)
+	}
+	return secret
+}
+
+// validHeaderName reports whether the given string is a valid HTTP header
+// field name, per RFC 9110.
+func validHeaderName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for _, c := range name {
+		switch {
+		case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z', '0' <= c && c <= '9':
+		case strings.ContainsRune("!#$%&'*+-.^_`|~", c):
+		default:
+			return false
+		}
+	}
+	return true
+}
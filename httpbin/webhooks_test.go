@@ -0,0 +1,376 @@
+package httpbin
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mccutchen/go-httpbin/v2/internal/testing/assert"
+	"github.com/mccutchen/go-httpbin/v2/internal/testing/must"
+)
+
+// webhookReceiver is a target for webhooks sent in tests, which responds to
+// each request with the next status in a sequence, repeating the last.
+type webhookReceiver struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	statuses []int
+	requests []*http.Request
+	bodies   []string
+}
+
+func newWebhookReceiver(t *testing.T, statuses ...int) *webhookReceiver {
+	t.Helper()
+	recv := &webhookReceiver{statuses: statuses}
+	recv.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		recv.mu.Lock()
+		defer recv.mu.Unlock()
+		recv.requests = append(recv.requests, r)
+		recv.bodies = append(recv.bodies, string(body))
+		status := recv.statuses[min(len(recv.requests), len(recv.statuses))-1]
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(recv.Close)
+	return recv
+}
+
+func (recv *webhookReceiver) received() ([]*http.Request, []string) {
+	recv.mu.Lock()
+	defer recv.mu.Unlock()
+	return append([]*http.Request{}, recv.requests...), append([]string{}, recv.bodies...)
+}
+
+func TestWebhooks(t *testing.T) {
+	t.Parallel()
+	app := setupTestApp(t, WithAllowedWebhookDomains([]string{"127.0.0.1"}))
+
+	send := func(t *testing.T, target string, params url.Values, body string) *http.Response {
+		t.Helper()
+		if params == nil {
+			params = url.Values{}
+		}
+		params.Set("url", target)
+		req := newTestRequest(t, "POST", app.URL("/webhooks/send?"+params.Encode()), strings.NewReader(body))
+		return mustDoRequest(t, app, req)
+	}
+
+	// waitForDelivery polls the delivery log until the given delivery has
+	// either succeeded or failed
+	waitForDelivery := func(t *testing.T, id string) webhookDelivery {
+		t.Helper()
+		deadline := time.Now().Add(5 * time.Second)
+		for {
+			req := newTestRequest(t, "GET", app.URL("/webhooks/deliveries/"+id), nil)
+			delivery := mustParseResponse[webhookDelivery](t, mustDoRequest(t, app, req))
+			if delivery.State != webhookPending {
+				return delivery
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("timed out waiting for delivery %s", id)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+
+	t.Run("signed delivery", func(t *testing.T) {
+		t.Parallel()
+		recv := newWebhookReceiver(t, http.StatusNoContent)
+		secret := formatWebhookSecret([]byte("test secret"))
+
+		resp := send(t, recv.URL+"/hook", url.Values{"secret": {secret}}, `{"event": "test"}`)
+		assert.StatusCode(t, resp, http.StatusAccepted)
+		result := must.Unmarshal[webhookSendResponse](t, resp.Body)
+		assert.Equal(t, result.Secret, secret, "incorrect secret")
+		assert.Equal(t, result.SignatureHeader, "webhook-signature", "incorrect signature header")
+		assert.Equal(t, len(result.Deliveries), 1, "incorrect number of deliveries")
+		assert.Equal(t, result.Deliveries[0].State, webhookPending, "incorrect state")
+
+		delivery := waitForDelivery(t, result.Deliveries[0].ID)
+		assert.Equal(t, delivery.State, webhookSucceeded, "incorrect state")
+		assert.Equal(t, delivery.URL, recv.URL+"/hook", "incorrect url")
+		assert.Equal(t, len(delivery.Attempts), 1, "incorrect number of attempts")
+		assert.Equal(t, delivery.Attempts[0].StatusCode, http.StatusNoContent, "incorrect status code")
+
+		requests, bodies := recv.received()
+		assert.Equal(t, len(requests), 1, "incorrect number of requests")
+		req := requests[0]
+		assert.Equal(t, req.URL.Path, "/hook", "incorrect path")
+		assert.Equal(t, bodies[0], `{"event": "test"}`, "incorrect body")
+		assert.Equal(t, req.Header.Get("Content-Type"), jsonContentType, "incorrect content type")
+		assert.Equal(t, req.Header.Get("webhook-id"), delivery.ID, "incorrect webhook-id")
+
+		// verify the signature independently, per the Standard Webhooks spec
+		mac := hmac.New(sha256.New, []byte("test secret"))
+		mac.Write([]byte(req.Header.Get("webhook-id") + "." + req.Header.Get("webhook-timestamp") + "." + bodies[0]))
+		want := "v1," + base64.StdEncoding.EncodeToString(mac.Sum(nil))
+		assert.Equal(t, req.Header.Get("webhook-signature"), want, "incorrect signature")
+	})
+
+	t.Run("custom signature header and generated secret", func(t *testing.T) {
+		t.Parallel()
+		recv := newWebhookReceiver(t, http.StatusOK)
+
+		resp := send(t, recv.URL, url.Values{"header": {"X-Signature"}}, "payload")
+		assert.StatusCode(t, resp, http.StatusAccepted)
+		result := must.Unmarshal[webhookSendResponse](t, resp.Body)
+		assert.Equal(t, result.SignatureHeader, "X-Signature", "incorrect signature header")
+		secret, err := parseWebhookSecret(result.Secret)
+		assert.NilError(t, err)
+
+		waitForDelivery(t, result.Deliveries[0].ID)
+		requests, bodies := recv.received()
+		req := requests[0]
+		msg := webhookMessage{id: req.Header.Get("webhook-id"), payload: []byte(bodies[0]), secret: secret}
+		assert.Equal(t, req.Header.Get("X-Signature"), msg.sign(req.Header.Get("webhook-timestamp")), "incorrect signature")
+		assert.Equal(t, req.Header.Get("webhook-signature"), "", "expected no default signature header")
+	})
+
+	t.Run("retries with backoff", func(t *testing.T) {
+		t.Parallel()
+		recv := newWebhookReceiver(t, http.StatusInternalServerError, http.StatusServiceUnavailable, http.StatusOK)
+
+		resp := send(t, recv.URL, url.Values{"backoff": {"20ms"}}, "{}")
+		result := must.Unmarshal[webhookSendResponse](t, resp.Body)
+		delivery := waitForDelivery(t, result.Deliveries[0].ID)
+		assert.Equal(t, delivery.State, webhookSucceeded, "incorrect state")
+		assert.Equal(t, len(delivery.Attempts), 3, "incorrect number of attempts")
+		for i, want := range []int{500, 503, 200} {
+			assert.Equal(t, delivery.Attempts[i].StatusCode, want, "incorrect status code")
+		}
+
+		// each retry waits twice as long as the last
+		firstDelay := delivery.Attempts[1].Time.Sub(delivery.Attempts[0].Time)
+		secondDelay := delivery.Attempts[2].Time.Sub(delivery.Attempts[1].Time)
+		if firstDelay < 20*time.Millisecond || secondDelay < 40*time.Millisecond {
+			t.Fatalf("expected exponential backoff, got delays of %s and %s", firstDelay, secondDelay)
+		}
+
+		// retries are the same message, signed with a fresh timestamp
+		requests, _ := recv.received()
+		assert.Equal(t, requests[2].Header.Get("webhook-id"), requests[0].Header.Get("webhook-id"), "expected same webhook-id")
+	})
+
+	t.Run("attempts exhausted", func(t *testing.T) {
+		t.Parallel()
+		recv := newWebhookReceiver(t, http.StatusFound)
+
+		resp := send(t, recv.URL, url.Values{"attempts": {"2"}, "backoff": {"0s"}}, "{}")
+		result := must.Unmarshal[webhookSendResponse](t, resp.Body)
+		delivery := waitForDelivery(t, result.Deliveries[0].ID)
+		assert.Equal(t, delivery.State, webhookFailed, "incorrect state")
+		assert.Equal(t, len(delivery.Attempts), 2, "incorrect number of attempts")
+		assert.Equal(t, delivery.Attempts[1].StatusCode, http.StatusFound, "expected redirect not to be followed")
+	})
+
+	t.Run("connection errors", func(t *testing.T) {
+		t.Parallel()
+		recv := newWebhookReceiver(t, http.StatusOK)
+		recv.Close()
+
+		resp := send(t, recv.URL, url.Values{"attempts": {"1"}}, "{}")
+		result := must.Unmarshal[webhookSendResponse](t, resp.Body)
+		delivery := waitForDelivery(t, result.Deliveries[0].ID)
+		assert.Equal(t, delivery.State, webhookFailed, "incorrect state")
+		if delivery.Attempts[0].Error == "" {
+			t.Fatal("expected attempt error")
+		}
+	})
+
+	t.Run("scheduled deliveries", func(t *testing.T) {
+		t.Parallel()
+		recv := newWebhookReceiver(t, http.StatusOK)
+
+		resp := send(t, recv.URL, url.Values{"count": {"3"}, "interval": {"20ms"}}, "{}")
+		result := must.Unmarshal[webhookSendResponse](t, resp.Body)
+		assert.Equal(t, len(result.Deliveries), 3, "incorrect number of deliveries")
+		assert.Equal(t, result.Deliveries[2].Scheduled.Sub(result.Deliveries[0].Scheduled), 40*time.Millisecond, "incorrect schedule")
+
+		ids := map[string]bool{}
+		for _, d := range result.Deliveries {
+			delivery := waitForDelivery(t, d.ID)
+			assert.Equal(t, delivery.State, webhookSucceeded, "incorrect state")
+			if delivery.Attempts[0].Time.Before(d.Scheduled) {
+				t.Fatalf("delivery %s attempted at %s, before it was scheduled at %s", d.ID, delivery.Attempts[0].Time, d.Scheduled)
+			}
+			ids[d.ID] = true
+		}
+		assert.Equal(t, len(ids), 3, "expected each delivery to have its own id")
+
+		req := newTestRequest(t, "GET", app.URL("/webhooks/deliveries"), nil)
+		log := mustParseResponse[webhookDeliveriesResponse](t, mustDoRequest(t, app, req))
+		found := 0
+		for _, d := range log.Deliveries {
+			if ids[d.ID] {
+				found++
+			}
+		}
+		assert.Equal(t, found, 3, "expected deliveries in log")
+	})
+
+	t.Run("delivery not found", func(t *testing.T) {
+		t.Parallel()
+		req := newTestRequest(t, "GET", app.URL("/webhooks/deliveries/msg_unknown"), nil)
+		resp := mustDoRequest(t, app, req)
+		assert.StatusCode(t, resp, http.StatusNotFound)
+	})
+
+	errorTests := map[string]struct {
+		target  string
+		params  url.Values
+		status  int
+		wantErr string
+	}{
+		"forbidden host": {
+			target:  "http://example.com/hook",
+			status:  http.StatusForbidden,
+			wantErr: `webhooks may not be sent to \"example.com\"`,
+		},
+		"forbidden host with port": {
+			target:  "http://example.com:8080/hook",
+			status:  http.StatusForbidden,
+			wantErr: `webhooks may not be sent to \"example.com:8080\"`,
+		},
+		"missing url": {
+			status:  http.StatusBadRequest,
+			wantErr: "invalid url",
+		},
+		"relative url": {
+			target:  "/hook",
+			status:  http.StatusBadRequest,
+			wantErr: "invalid url",
+		},
+		"unsupported scheme": {
+			target:  "ftp://127.0.0.1/hook",
+			status:  http.StatusBadRequest,
+			wantErr: "invalid url",
+		},
+		"invalid count": {
+			target:  "http://127.0.0.1/hook",
+			params:  url.Values{"count": {"11"}},
+			status:  http.StatusBadRequest,
+			wantErr: "invalid count",
+		},
+		"invalid interval": {
+			target:  "http://127.0.0.1/hook",
+			params:  url.Values{"interval": {"1m"}},
+			status:  http.StatusBadRequest,
+			wantErr: "invalid interval",
+		},
+		"invalid attempts": {
+			target:  "http://127.0.0.1/hook",
+			params:  url.Values{"attempts": {"0"}},
+			status:  http.StatusBadRequest,
+			wantErr: "invalid attempts",
+		},
+		"invalid backoff": {
+			target:  "http://127.0.0.1/hook",
+			params:  url.Values{"backoff": {"-1s"}},
+			status:  http.StatusBadRequest,
+			wantErr: "invalid backoff",
+		},
+		"invalid header": {
+			target:  "http://127.0.0.1/hook",
+			params:  url.Values{"header": {"bad header"}},
+			status:  http.StatusBadRequest,
+			wantErr: "invalid header",
+		},
+		"invalid secret": {
+			target:  "http://127.0.0.1/hook",
+			params:  url.Values{"secret": {"whsec_!!!"}},
+			status:  http.StatusBadRequest,
+			wantErr: "invalid secret",
+		},
+	}
+	for name, tc := range errorTests {
+		t.Run("error/"+name, func(t *testing.T) {
+			t.Parallel()
+			params := tc.params
+			if params == nil {
+				params = url.Values{}
+			}
+			params.Set("url", tc.target)
+			req := newTestRequest(t, "POST", app.URL("/webhooks/send?"+params.Encode()), nil)
+			resp := mustDoRequest(t, app, req)
+			assert.StatusCode(t, resp, tc.status)
+			assert.BodyContains(t, resp, tc.wantErr)
+		})
+	}
+
+	t.Run("disabled by default", func(t *testing.T) {
+		t.Parallel()
+		app := setupTestApp(t)
+		req := newTestRequest(t, "POST", app.URL("/webhooks/send?url=http://127.0.0.1/"), nil)
+		resp := mustDoRequest(t, app, req)
+		assert.StatusCode(t, resp, http.StatusNotFound)
+	})
+}
+
+func TestWebhookSenderAllowed(t *testing.T) {
+	t.Parallel()
+	s := newWebhookSender([]string{"any-port.test", "one-port.test:8443", "default-port.test:443"})
+	tests := map[string]bool{
+		"http://any-port.test/hook":          true,
+		"https://any-port.test:9999/hook":    true,
+		"https://one-port.test:8443/hook":    true,
+		"https://one-port.test/hook":         false,
+		"http://one-port.test:8080/hook":     false,
+		"https://default-port.test/hook":     true,
+		"https://default-port.test:443/hook": true,
+		"http://default-port.test/hook":      false,
+		"http://other.test/hook":             false,
+	}
+	for target, want := range tests {
+		t.Run(target, func(t *testing.T) {
+			t.Parallel()
+			u, err := url.Parse(target)
+			assert.NilError(t, err)
+			assert.Equal(t, s.allowed(u), want, "incorrect result")
+		})
+	}
+}
+
+func TestWebhookSenderClose(t *testing.T) {
+	t.Parallel()
+	s := newWebhookSender(nil)
+	msg := webhookMessage{url: "http://127.0.0.1:0/", contentType: textContentType, signatureHeader: defaultWebhookSignatureHeader}
+
+	_, err := s.schedule(msg, 1, 0, 2, time.Hour, time.Second, time.Now())
+	assert.NilError(t, err)
+	_, err = s.schedule(msg, 1, time.Hour, 1, 0, time.Second, time.Now())
+	assert.NilError(t, err)
+
+	// deliveries waiting to be attempted or retried are stopped
+	start := time.Now()
+	s.Close()
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("expected close to stop deliveries, took %s", elapsed)
+	}
+	for _, d := range s.list() {
+		assert.Equal(t, d.State, webhookFailed, "incorrect state")
+	}
+	assert.Equal(t, s.pending, 0, "expected no pending deliveries")
+
+	_, err = s.schedule(msg, 1, 0, 1, 0, time.Second, time.Now())
+	assert.Error(t, err, errWebhookSenderClosed)
+}
+
+func TestWebhookSenderLimits(t *testing.T) {
+	t.Parallel()
+	s := newWebhookSender(nil)
+	msg := webhookMessage{url: "http://127.0.0.1:0/", contentType: textContentType, signatureHeader: defaultWebhookSignatureHeader}
+
+	s.pending = maxPendingWebhookDeliveries - 1
+	_, err := s.schedule(msg, 2, 0, 1, 0, time.Second, time.Now())
+	assert.Error(t, err, errTooManyWebhookDeliveries)
+	assert.Equal(t, len(s.list()), 0, "expected no deliveries to be scheduled")
+}
@@ -10,14 +10,20 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
 	"strings"
+	"sync"
 	"time"
 	"unicode/utf8"
 )
 
 const requiredVersion = "13"
 
+// closeTimeout is how long Push waits to send a close frame to the client once
+// the max duration has elapsed.
+const closeTimeout = time.Second
+
 // Opcode is a websocket OPCODE.
 type Opcode uint8
 
@@ -142,25 +148,109 @@ func (s *WebSocket) Serve(handler Handler) {
 		panic("websocket: serve: handshake not completed")
 	}
 
+	conn, buf := s.hijack("serve")
+	defer conn.Close()
+
+	// errors intentionally ignored here. it's serverLoop's responsibility to
+	// properly close the websocket connection with a useful error message, and
+	// any unexpected error returned from serverLoop is not actionable.
+	_ = s.serveLoop(s.r.Context(), buf, handler)
+}
+
+// Push sends each message received from messages to the client, until
+// messages is closed, the client closes the connection, or the max duration
+// elapses. Messages sent by the client are discarded, but pings are answered
+// and close frames are honored.
+func (s *WebSocket) Push(messages <-chan *Message) {
+	if !s.handshook {
+		panic("websocket: push: handshake not completed")
+	}
+
+	conn, buf := s.hijack("push")
+	defer conn.Close()
+
+	// the max duration is enforced by the timer below instead of the
+	// connection's deadline, so that we have a chance to send a close frame
+	// once it elapses
+	conn.SetReadDeadline(time.Time{})
+	conn.SetWriteDeadline(time.Now().Add(s.maxDuration + closeTimeout))
+
+	// writes may come from both the loop below and the goroutine answering
+	// the client's control frames
+	var mu sync.Mutex
+	writeFrames := func(frames ...*Frame) error {
+		mu.Lock()
+		defer mu.Unlock()
+		for _, frame := range frames {
+			if err := writeFrame(buf, frame); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	clientDone := make(chan struct{})
+	go func() {
+		defer close(clientDone)
+		for {
+			frame, err := nextFrame(buf)
+			if err != nil {
+				return
+			}
+			if err := validateFrame(frame, s.maxFragmentSize); err != nil {
+				_ = writeFrames(newCloseFrame(StatusProtocolError, err))
+				return
+			}
+			switch frame.Opcode {
+			case OpcodeClose:
+				_ = writeFrames(newCloseFrame(StatusNormalClosure, nil))
+				return
+			case OpcodePing:
+				frame.Opcode = OpcodePong
+				if err := writeFrames(frame); err != nil {
+					return
+				}
+			}
+		}
+	}()
+
+	timer := time.NewTimer(s.maxDuration)
+	defer timer.Stop()
+	for {
+		select {
+		case msg, ok := <-messages:
+			if !ok {
+				_ = writeFrames(newCloseFrame(StatusNormalClosure, nil))
+				return
+			}
+			if err := writeFrames(frameResponse(msg, s.maxFragmentSize)...); err != nil {
+				return
+			}
+		case <-clientDone:
+			return
+		case <-timer.C:
+			_ = writeFrames(newCloseFrame(StatusGoingAway, nil))
+			return
+		}
+	}
+}
+
+// hijack takes over the underlying connection once the handshake has been
+// completed.
+func (s *WebSocket) hijack(op string) (net.Conn, *bufio.ReadWriter) {
 	hj, ok := s.w.(http.Hijacker)
 	if !ok {
-		panic("websocket: serve: server does not support hijacking")
+		panic(fmt.Sprintf("websocket: %s: server does not support hijacking", op))
 	}
 
 	conn, buf, err := hj.Hijack()
 	if err != nil {
-		panic(fmt.Errorf("websocket: serve: hijack failed: %s", err))
+		panic(fmt.Errorf("websocket: %s: hijack failed: %s", op, err))
 	}
-	defer conn.Close()
 
 	// best effort attempt to ensure that our websocket conenctions do not
 	// exceed the maximum request duration
 	conn.SetDeadline(time.Now().Add(s.maxDuration))
-
-	// errors intentionally ignored here. it's serverLoop's responsibility to
-	// properly close the websocket connection with a useful error message, and
-	// any unexpected error returned from serverLoop is not actionable.
-	_ = s.serveLoop(s.r.Context(), buf, handler)
+	return conn, buf
 }
 
 func (s *WebSocket) serveLoop(ctx context.Context, buf *bufio.ReadWriter, handler Handler) error {
@@ -357,16 +447,21 @@ func writeFrame(dst *bufio.ReadWriter, frame *Frame) error {
 // writeCloseFrame writes a close frame to the wire, with an optional error
 // message.
 func writeCloseFrame(dst *bufio.ReadWriter, code StatusCode, err error) error {
+	return writeFrame(dst, newCloseFrame(code, err))
+}
+
+// newCloseFrame creates a close frame with an optional error message.
+func newCloseFrame(code StatusCode, err error) *Frame {
 	var payload []byte
 	payload = binary.BigEndian.AppendUint16(payload, uint16(code))
 	if err != nil {
 		payload = append(payload, []byte(err.Error())...)
 	}
-	return writeFrame(dst, &Frame{
+	return &Frame{
 		Fin:     true,
 		Opcode:  OpcodeClose,
 		Payload: payload,
-	})
+	}
 }
 
 // frameResponse splits a message into N frames with payloads of at most
@@ -399,6 +494,7 @@ func frameResponse(msg *Message, fragmentSize int) []*Frame {
 		if fin {
 			break
 		}
+		offset = end
 	}
 	return result
 }
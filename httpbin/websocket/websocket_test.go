@@ -394,6 +394,177 @@ func TestConnectionLimits(t *testing.T) {
 	})
 }
 
+func TestPush(t *testing.T) {
+	t.Parallel()
+
+	newServer := func(t *testing.T, maxDuration time.Duration, messages <-chan *websocket.Message) *httptest.Server {
+		t.Helper()
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ws := websocket.New(w, r, websocket.Limits{
+				MaxDuration:     maxDuration,
+				MaxFragmentSize: 4,
+				MaxMessageSize:  256,
+			})
+			if err := ws.Handshake(); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			ws.Push(messages)
+		}))
+		t.Cleanup(srv.Close)
+		return srv
+	}
+
+	connect := func(t *testing.T, srv *httptest.Server) *bufio.Reader {
+		t.Helper()
+		conn, err := net.Dial("tcp", srv.Listener.Addr().String())
+		assert.NilError(t, err)
+		t.Cleanup(func() { conn.Close() })
+
+		reqParts := []string{
+			"GET /websocket/push HTTP/1.1",
+			"Host: test",
+			"Connection: upgrade",
+			"Upgrade: websocket",
+			"Sec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==",
+			"Sec-WebSocket-Version: 13",
+		}
+		_, err = conn.Write([]byte(strings.Join(reqParts, "\r\n") + "\r\n\r\n"))
+		assert.NilError(t, err)
+
+		r := bufio.NewReader(conn)
+		resp, err := http.ReadResponse(r, nil)
+		assert.NilError(t, err)
+		assert.StatusCode(t, resp, http.StatusSwitchingProtocols)
+		return r
+	}
+
+	// readFrame reads a single small, unmasked frame from the server
+	readFrame := func(t *testing.T, r *bufio.Reader) (fin bool, opcode websocket.Opcode, payload []byte) {
+		t.Helper()
+		header := make([]byte, 2)
+		_, err := io.ReadFull(r, header)
+		assert.NilError(t, err)
+		payload = make([]byte, header[1]&0b01111111)
+		_, err = io.ReadFull(r, payload)
+		assert.NilError(t, err)
+		return header[0]&0b10000000 != 0, websocket.Opcode(header[0] & 0b00001111), payload
+	}
+
+	t.Run("messages are fragmented and sent until closed", func(t *testing.T) {
+		t.Parallel()
+		messages := make(chan *websocket.Message, 2)
+		messages <- &websocket.Message{Payload: []byte("hello world")}
+		messages <- &websocket.Message{Binary: true, Payload: []byte{1, 2}}
+		close(messages)
+
+		r := connect(t, newServer(t, time.Second, messages))
+
+		wantFrames := []struct {
+			fin     bool
+			opcode  websocket.Opcode
+			payload string
+		}{
+			{false, websocket.OpcodeText, "hell"},
+			{false, websocket.OpcodeContinuation, "o wo"},
+			{true, websocket.OpcodeContinuation, "rld"},
+			{true, websocket.OpcodeBinary, "\x01\x02"},
+			{true, websocket.OpcodeClose, "\x03\xe8"},
+		}
+		for _, want := range wantFrames {
+			fin, opcode, payload := readFrame(t, r)
+			assert.Equal(t, fin, want.fin, "incorrect fin bit")
+			assert.Equal(t, opcode, want.opcode, "incorrect opcode")
+			assert.Equal(t, string(payload), want.payload, "incorrect payload")
+		}
+	})
+
+	t.Run("maximum duration is enforced", func(t *testing.T) {
+		t.Parallel()
+		start := time.Now()
+		r := connect(t, newServer(t, 100*time.Millisecond, make(chan *websocket.Message)))
+
+		_, opcode, payload := readFrame(t, r)
+		assert.Equal(t, opcode, websocket.OpcodeClose, "incorrect opcode")
+		assert.Equal(t, string(payload), "\x03\xe9", "expected going away status")
+		assert.MinDuration(t, time.Since(start), 100*time.Millisecond)
+	})
+}
+
+func TestServeFragmentation(t *testing.T) {
+	t.Parallel()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ws := websocket.New(w, r, websocket.Limits{
+			MaxDuration:     time.Second,
+			MaxFragmentSize: 4,
+			MaxMessageSize:  64,
+		})
+		if err := ws.Handshake(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		ws.Serve(websocket.EchoHandler)
+	}))
+	t.Cleanup(srv.Close)
+
+	conn, err := net.Dial("tcp", srv.Listener.Addr().String())
+	assert.NilError(t, err)
+	t.Cleanup(func() { conn.Close() })
+
+	reqParts := []string{
+		"GET /websocket/echo HTTP/1.1",
+		"Host: test",
+		"Connection: upgrade",
+		"Upgrade: websocket",
+		"Sec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==",
+		"Sec-WebSocket-Version: 13",
+	}
+	_, err = conn.Write([]byte(strings.Join(reqParts, "\r\n") + "\r\n\r\n"))
+	assert.NilError(t, err)
+	r := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(r, nil)
+	assert.NilError(t, err)
+	assert.StatusCode(t, resp, http.StatusSwitchingProtocols)
+
+	// a message larger than the max fragment size, sent by the client as
+	// multiple fragments, must be echoed back as multiple fragments rather
+	// than looping forever on the first one
+	frames := []struct {
+		fin     bool
+		opcode  websocket.Opcode
+		payload string
+	}{
+		{false, websocket.OpcodeText, "hell"},
+		{false, websocket.OpcodeContinuation, "o wo"},
+		{true, websocket.OpcodeContinuation, "rld"},
+	}
+	for _, f := range frames {
+		b0 := byte(f.opcode)
+		if f.fin {
+			b0 |= 0b10000000
+		}
+		// client frames must be masked, and an all-zero mask key leaves the
+		// payload unchanged
+		frame := append([]byte{b0, 0b10000000 | byte(len(f.payload)), 0, 0, 0, 0}, f.payload...)
+		_, err := conn.Write(frame)
+		assert.NilError(t, err)
+	}
+
+	assert.NilError(t, conn.SetReadDeadline(time.Now().Add(time.Second)))
+	for _, want := range frames {
+		header := make([]byte, 2)
+		_, err := io.ReadFull(r, header)
+		assert.NilError(t, err)
+		payload := make([]byte, header[1]&0b01111111)
+		_, err = io.ReadFull(r, payload)
+		assert.NilError(t, err)
+		assert.Equal(t, header[0]&0b10000000 != 0, want.fin, "incorrect fin bit")
+		assert.Equal(t, websocket.Opcode(header[0]&0b00001111), want.opcode, "incorrect opcode")
+		assert.Equal(t, string(payload), want.payload, "incorrect payload")
+	}
+}
+
 // brokenHijackResponseWriter implements just enough to satisfy the
 // http.ResponseWriter and http.Hijacker interfaces and get through the
 // handshake before failing to actually hijack the connection.